@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"text/tabwriter"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/ecrupdater"
+	"github.com/lescactus/ecr-go/policy"
+	"github.com/lescactus/ecr-go/summary"
+	"go.uber.org/zap"
+)
+
+// Output formats of the access report
+const (
+	accessTable = "table"
+	accessCSV   = "csv"
+	accessJSON  = "json"
+)
+
+// Values of the permissions of a row of the access report
+const (
+	accessGranted     = "yes"
+	accessConditional = "conditional"
+)
+
+// accessSettings are the flags of the access command
+type accessSettings struct {
+	live       bool
+	output     string
+	repository string
+	principal  string
+	permission string
+}
+
+// accessOptions are the flags of the access command of the current run
+var accessOptions accessSettings
+
+// accessFlags will register the flags of the access command
+func accessFlags(fs *flag.FlagSet) {
+	accessOptions = accessSettings{}
+	fs.BoolVar(&accessOptions.live, "live", false, "Report the current policies of the repositories instead of the configured ones")
+	fs.StringVar(&accessOptions.output, "output", accessTable, "Format of the report: table, csv or json")
+	fs.StringVar(&accessOptions.repository, "repository", "", "Only report the repositories whose name matches this glob")
+	fs.StringVar(&accessOptions.principal, "principal", "", "Only report this principal: an account ID, an ARN, a service, an organization or an organizational unit ID. An account also matches its roles and users")
+	fs.StringVar(&accessOptions.permission, "permission", "", "Only report the principals granted this permission: pull or push")
+}
+
+// accessRow is a principal granted access to a repository in the access report
+type accessRow struct {
+	Principal  string `json:"principal"`
+	Type       string `json:"type"`
+	Repository string `json:"repository"`
+	Pull       string `json:"pull,omitempty"`
+	Push       string `json:"push,omitempty"`
+}
+
+// accessCommand will report which principals can pull from or push to each repository, from its configured or current policy
+func accessCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	switch accessOptions.output {
+	case accessTable, accessCSV, accessJSON:
+	default:
+		logger.Error(fmt.Sprintf("Error: unknown output format %q, must be table, csv or json", accessOptions.output))
+		return exitUsage
+	}
+	switch policy.Permission(accessOptions.permission) {
+	case "", policy.PermissionPull, policy.PermissionPush:
+	default:
+		logger.Error(fmt.Sprintf("Error: unknown permission %q, must be pull or push", accessOptions.permission))
+		return exitUsage
+	}
+	if _, err := path.Match(accessOptions.repository, ""); err != nil {
+		logger.Error(fmt.Sprintf("Error: invalid repository glob %q: %v", accessOptions.repository, err))
+		return exitUsage
+	}
+
+	repositories, err := loadRepositories(logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitFailed
+	}
+	var organization *configuration.OrganizationSnapshot
+	if appconfig.Config.AWS.OrganizationFile != "" {
+		if organization, err = configuration.LoadOrganizationSnapshot(appconfig.Config.AWS.OrganizationFile); err != nil {
+			logger.Error(fmt.Sprintf("Error: cannot load the organization file: %v", err))
+			return exitFailed
+		}
+	}
+	members := organization.Members()
+
+	code := exitOK
+	rows := []accessRow{}
+	add := func(record summary.Record, text string) {
+		if accessOptions.repository != "" {
+			if ok, _ := path.Match(accessOptions.repository, record.Repository); !ok {
+				return
+			}
+		}
+		doc, err := policy.Parse(text)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error: %s: %v", record.Target(), err))
+			code = exitFailed
+			return
+		}
+		rows = append(rows, accessRows(record, policy.ExpandOrganizations(policy.Grants(doc, record.Public), members))...)
+	}
+
+	if accessOptions.live {
+		clients := newClientFactory(logger, repositories.targets, summary.NewCollector())
+		ctx, stop, cancel := runContext(logger)
+		defer cancel()
+		for _, c := range ecrupdater.PlanJobs(ctx, stop, repositories.jobs(clients), appconfig.Config.Run.Workers) {
+			switch {
+			case c.Action == ecrupdater.ActionError:
+				logger.Error(fmt.Sprintf("Error: %s: %v", c.Record.Target(), c.Err))
+				code = exitFailed
+			case c.Current != "":
+				add(c.Record, c.Current)
+			}
+		}
+	} else {
+		for _, r := range repositories.list() {
+			add(r.record, string(r.config.RepositoryPolicy))
+		}
+	}
+
+	if err := writeAccess(out, accessOptions.output, rows); err != nil {
+		logger.Error(fmt.Sprintf("Error: cannot write the report: %v", err))
+		return exitFailed
+	}
+	return code
+}
+
+// accessRows returns a row per principal of the grants of a repository selected by the principal and permission flags
+func accessRows(record summary.Record, grants []policy.Grant) []accessRow {
+	rows := []accessRow{}
+	index := make(map[policy.Principal]int)
+	for _, g := range grants {
+		if accessOptions.principal != "" && !g.Principal.MatchesQuery(accessOptions.principal) {
+			continue
+		}
+		i, ok := index[g.Principal]
+		if !ok {
+			i = len(rows)
+			index[g.Principal] = i
+			rows = append(rows, accessRow{Principal: g.Principal.String(), Type: g.Principal.Type, Repository: record.Target()})
+		}
+		value := accessGranted
+		if g.Conditional {
+			value = accessConditional
+		}
+		if g.Permission == policy.PermissionPull {
+			rows[i].Pull = value
+		} else {
+			rows[i].Push = value
+		}
+	}
+
+	if accessOptions.permission == "" {
+		return rows
+	}
+	selected := []accessRow{}
+	for _, r := range rows {
+		if (accessOptions.permission == string(policy.PermissionPull) && r.Pull != "") || (accessOptions.permission == string(policy.PermissionPush) && r.Push != "") {
+			selected = append(selected, r)
+		}
+	}
+	return selected
+}
+
+// writeAccess will write the rows of the access report in the given format
+func writeAccess(out io.Writer, format string, rows []accessRow) error {
+	switch format {
+	case accessJSON:
+		e := json.NewEncoder(out)
+		e.SetIndent("", "    ")
+		return e.Encode(rows)
+	case accessCSV:
+		w := csv.NewWriter(out)
+		w.Write([]string{"principal", "type", "repository", "pull", "push"})
+		for _, r := range rows {
+			w.Write([]string{r.Principal, r.Type, r.Repository, r.Pull, r.Push})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PRINCIPAL\tTYPE\tREPOSITORY\tPULL\tPUSH")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Principal, r.Type, r.Repository, r.Pull, r.Push)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	policy := filepath.Join(dir, "app.json")
+	assert.NoError(t, ioutil.WriteFile(policy, []byte(`{"Version":"2008-10-17","Statement":[
+		{"Effect":"Allow","Principal":{"AWS":"111111111111"},"Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"]},
+		{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::222222222222:role/ci"},"Action":"ecr:*"}
+	]}`), 0644))
+	for _, name := range []string{"app", "tools"} {
+		config := "repositoryName: " + name + "\nrepositoryPolicyFile: " + policy + "\n"
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".yaml"), []byte(config), 0644))
+	}
+
+	tests := []struct {
+		desc string
+		args []string
+		code int
+		want string
+	}{
+		{
+			desc: "Table",
+			args: []string{"--repository", "app"},
+			want: "PRINCIPAL                          TYPE     REPOSITORY  PULL  PUSH\n" +
+				"111111111111                       account  app         yes   \n" +
+				"arn:aws:iam::222222222222:role/ci  role     app         yes   yes\n",
+		},
+		{
+			desc: "Who can push",
+			args: []string{"--output", "csv", "--permission", "push"},
+			want: "principal,type,repository,pull,push\n" +
+				"arn:aws:iam::222222222222:role/ci,role,app,yes,yes\n" +
+				"arn:aws:iam::222222222222:role/ci,role,tools,yes,yes\n",
+		},
+		{
+			desc: "What can an account pull",
+			args: []string{"--output", "json", "--principal", "111111111111", "--repository", "t*"},
+			want: "[\n    {\n        \"principal\": \"111111111111\",\n        \"type\": \"account\",\n        \"repository\": \"tools\",\n        \"pull\": \"yes\"\n    }\n]\n",
+		},
+		{
+			desc: "Unknown output",
+			args: []string{"--output", "xml"},
+			code: exitUsage,
+		},
+		{
+			desc: "Unknown permission",
+			args: []string{"--permission", "delete"},
+			code: exitUsage,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"access", "--config-dir", dir}, test.args...), &stdout, &stderr)
+			assert.Equal(t, test.code, code)
+			assert.Equal(t, test.want, stdout.String())
+		})
+	}
+}
+
+func TestAccessCommandOrganization(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	configs := filepath.Join(dir, "configs")
+	assert.NoError(t, os.Mkdir(configs, 0755))
+	config := "repositoryName: app\naccess:\n  pull:\n    - org:o-a1b2c3d4e5\n  push:\n    - ou:ou-ab12-11111111\n"
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(configs, "app.yaml"), []byte(config), 0644))
+	organization := filepath.Join(dir, "organization.yaml")
+	assert.NoError(t, ioutil.WriteFile(organization, []byte("organizations:\n  o-a1b2c3d4e5: [\"111111111111\", \"222222222222\"]\nunits:\n  ou-ab12-11111111: [\"222222222222\"]\n"), 0644))
+
+	tests := []struct {
+		desc string
+		args []string
+		want string
+	}{
+		{
+			desc: "Without organization file",
+			args: []string{"--output", "csv"},
+			want: "principal,type,repository,pull,push\n" +
+				"*,anyone,app,conditional,conditional\n" +
+				"o-a1b2c3d4e5,organization,app,yes,\n" +
+				"ou-ab12-11111111,ou,app,,yes\n",
+		},
+		{
+			desc: "With organization file",
+			args: []string{"--output", "csv", "--organization-file", organization},
+			want: "principal,type,repository,pull,push\n" +
+				"*,anyone,app,conditional,conditional\n" +
+				"111111111111,account,app,yes,\n" +
+				"222222222222,account,app,yes,yes\n",
+		},
+		{
+			desc: "Organizational unit",
+			args: []string{"--output", "csv", "--principal", "ou-ab12-11111111", "--permission", "push"},
+			want: "principal,type,repository,pull,push\n" +
+				"*,anyone,app,conditional,conditional\n" +
+				"ou-ab12-11111111,ou,app,,yes\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"access", "--config-dir", configs}, test.args...), &stdout, &stderr)
+			assert.Equal(t, exitOK, code, stderr.String())
+			assert.Equal(t, test.want, stdout.String())
+		})
+	}
+}
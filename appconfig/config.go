@@ -3,30 +3,216 @@ package appconfig
 import (
 	"errors"
 	"fmt"
-
-	"github.com/caarlos0/env"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
-	validLogLevels = []string{"error", "info", "debug"}
+	validLogLevels  = []string{"error", "info", "debug"}
+	accountIDRegexp = regexp.MustCompile(`^[0-9]{12}$`)
 )
 
-func LoadConfig(c *config) error {
-	if err := env.Parse(&c.Application); err != nil {
+// Sources are the values of the settings set on the command line and in the configuration file, by flag name
+type Sources struct {
+	Flags map[string]string
+	File  map[string]string
+}
+
+// Init will load Config from the given sources, see Load
+func Init(s Sources) error {
+	c := &config{}
+	if err := Load(c, s); err != nil {
 		return err
 	}
+	Config = c
+	return nil
+}
+
+// LoadConfig will load c from the environment variables and the defaults
+// It returns any error encountered
+func LoadConfig(c *config) error {
+	return Load(c, Sources{})
+}
+
+// Load will load c from, by order of precedence, the flags, the environment variables, the configuration file and the defaults
+// The name of the flag and of the configuration file key of a setting is its environment variable name in kebab case, see FlagName
+// It returns any error encountered while parsing or validating the configuration
+func Load(c *config, s Sources) error {
+	for _, st := range settings(c) {
+		raw, origin, ok := st.lookup(s)
+		if !ok {
+			continue
+		}
+		if err := st.set(raw); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", raw, origin, err)
+		}
+	}
+	return validate(c)
+}
+
+// validate will ensure the loaded configuration is consistent
+// It returns the first error encountered
+func validate(c *config) error {
 	if !isValidLogLevel(c.Application.LogLevel) {
 		return errors.New("LogLevel must be 'error', 'info' or 'debug'")
 	}
+	if c.Retry.MaxAttempts < 1 {
+		return errors.New("RetryMaxAttempts must be greater than 0")
+	}
+	if c.RateLimit.ReadRate < 0 || c.RateLimit.WriteRate < 0 {
+		return errors.New("RateLimitRead and RateLimitWrite must not be negative")
+	}
+	if c.Run.Workers < 1 {
+		return errors.New("Workers must be greater than 0")
+	}
+	if c.Run.Timeout < 0 || c.Run.CallTimeout < 0 {
+		return errors.New("RunTimeout and CallTimeout must not be negative")
+	}
+	for i, r := range c.AWS.Regions {
+		c.AWS.Regions[i] = strings.TrimSpace(r)
+		if c.AWS.Regions[i] == "" {
+			return errors.New("Regions must not contain an empty region")
+		}
+	}
+	for i, a := range c.Preflight.ExpectedAccounts {
+		c.Preflight.ExpectedAccounts[i] = strings.TrimSpace(a)
+		if !accountIDRegexp.MatchString(c.Preflight.ExpectedAccounts[i]) {
+			return fmt.Errorf("ExpectedAccounts must be 12 digits AWS account IDs, got %q", a)
+		}
+	}
+	if c.Policy.ExpiryWarningDays < 0 {
+		return errors.New("ExpiryWarningDays must not be negative")
+	}
+	for i, p := range c.Policy.ExpiryRequired {
+		c.Policy.ExpiryRequired[i] = strings.TrimSpace(p)
+		if c.Policy.ExpiryRequired[i] == "" {
+			return errors.New("ExpiryRequired must not contain an empty glob")
+		}
+	}
+	if c.BreakGlass.LedgerFile == "" {
+		return errors.New("BreakGlassLedger must not be empty")
+	}
+	if c.BreakGlass.MaxDuration <= 0 {
+		return errors.New("BreakGlassMaxDuration must be greater than 0")
+	}
+	for _, patterns := range [][]string{c.Filter.Only, c.Filter.Exclude, c.Filter.Files} {
+		for i, p := range patterns {
+			patterns[i] = strings.TrimSpace(p)
+			if _, err := path.Match(patterns[i], ""); err != nil || patterns[i] == "" {
+				return fmt.Errorf("Only, Exclude and Files must be valid globs, got %q", p)
+			}
+		}
+	}
 	return nil
 }
 
-func init() {
-	Config = &config{}
-	err := LoadConfig(Config)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to parse configuration:\n%v", err))
+// setting is a configuration field, described by its env, envDefault and envSeparator tags
+// Its value is parsed here rather than by an environment parser: it may come from a flag, the environment or the
+// configuration file, and an invalid value is reported with its origin
+type setting struct {
+	env       string
+	def       string
+	hasDef    bool
+	separator string
+	field     reflect.Value
+}
+
+// settings returns the settings of all the sections of c
+func settings(c *config) []setting {
+	l := []setting{}
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			f := section.Type().Field(j)
+			env, ok := f.Tag.Lookup("env")
+			if !ok {
+				continue
+			}
+			def, hasDef := f.Tag.Lookup("envDefault")
+			sep, ok := f.Tag.Lookup("envSeparator")
+			if !ok {
+				sep = ","
+			}
+			l = append(l, setting{env: env, def: def, hasDef: hasDef, separator: sep, field: section.Field(j)})
+		}
+	}
+	return l
+}
+
+// FlagName returns the name of the flag of the given environment variable, e.g. CONFIG_DIR is config-dir
+func FlagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(env), "_", "-")
+}
+
+// lookup returns the raw value of the setting from the first source defining it, and the name of this source
+func (s setting) lookup(src Sources) (string, string, bool) {
+	name := FlagName(s.env)
+	if v, ok := src.Flags[name]; ok {
+		return v, "flag --" + name, true
+	}
+	// An empty environment variable is considered as unset
+	if v := os.Getenv(s.env); v != "" {
+		return v, "environment variable " + s.env, true
+	}
+	if v, ok := src.File[name]; ok {
+		return v, "configuration file key " + name, true
+	}
+	if s.hasDef {
+		return s.def, "default of " + s.env, true
+	}
+	return "", "", false
+}
+
+// set will parse the raw value into the field of the setting
+func (s setting) set(raw string) error {
+	switch s.field.Interface().(type) {
+	case string:
+		s.field.SetString(raw)
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		s.field.SetBool(b)
+	case int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		s.field.SetInt(int64(i))
+	case float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		s.field.SetFloat(f)
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		s.field.SetInt(int64(d))
+	case []string:
+		var l []string
+		if raw != "" {
+			l = strings.Split(raw, s.separator)
+		}
+		s.field.Set(reflect.ValueOf(l))
+	default:
+		return fmt.Errorf("unsupported type %s", s.field.Type())
 	}
+	return nil
+}
+
+// isBool returns true if the setting is a boolean, set by its flag without value
+func (s setting) isBool() bool {
+	return s.field.Kind() == reflect.Bool
 }
 
 func isValidLogLevel(l string) bool {
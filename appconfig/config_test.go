@@ -2,11 +2,44 @@ package appconfig
 
 import (
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+var defaultRetry = Retry{
+	MaxAttempts: 5,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    20 * time.Second,
+}
+
+var defaultRateLimit = RateLimit{
+	ReadRate:  10,
+	WriteRate: 5,
+	Burst:     5,
+}
+
+var defaultRun = Run{
+	Workers:     10,
+	Timeout:     0,
+	CallTimeout: 30 * time.Second,
+}
+
+var defaultPreflight = Preflight{
+	Enabled: true,
+}
+
+var defaultPolicy = Policy{
+	ExpiryWarningDays: 14,
+}
+
+var defaultBreakGlass = BreakGlass{
+	LedgerFile:  "break-glass-ledger.jsonl",
+	MaxDuration: 12 * time.Hour,
+}
+
 func TestIsValidLogLevel(t *testing.T) {
 	tests := []struct {
 		desc  string
@@ -82,6 +115,12 @@ func TestLoadConfig(t *testing.T) {
 					DryRun:    true,
 					Version:   "99.99.99",
 				},
+				Retry:      defaultRetry,
+				RateLimit:  defaultRateLimit,
+				Run:        defaultRun,
+				Preflight:  defaultPreflight,
+				Policy:     defaultPolicy,
+				BreakGlass: defaultBreakGlass,
 			},
 		},
 		{
@@ -110,6 +149,12 @@ func TestLoadConfig(t *testing.T) {
 					DryRun:    false,
 					Version:   "0.1.2",
 				},
+				Retry:      defaultRetry,
+				RateLimit:  defaultRateLimit,
+				Run:        defaultRun,
+				Preflight:  defaultPreflight,
+				Policy:     defaultPolicy,
+				BreakGlass: defaultBreakGlass,
 			},
 		},
 		{
@@ -140,6 +185,12 @@ func TestLoadConfig(t *testing.T) {
 					DryRun:    false,
 					Version:   "0.1.2",
 				},
+				Retry:      defaultRetry,
+				RateLimit:  defaultRateLimit,
+				Run:        defaultRun,
+				Preflight:  defaultPreflight,
+				Policy:     defaultPolicy,
+				BreakGlass: defaultBreakGlass,
 			},
 		},
 		{
@@ -170,6 +221,12 @@ func TestLoadConfig(t *testing.T) {
 					DryRun:    true,
 					Version:   "0.1.2",
 				},
+				Retry:      defaultRetry,
+				RateLimit:  defaultRateLimit,
+				Run:        defaultRun,
+				Preflight:  defaultPreflight,
+				Policy:     defaultPolicy,
+				BreakGlass: defaultBreakGlass,
 			},
 		},
 	}
@@ -241,6 +298,267 @@ func TestLoadConfig(t *testing.T) {
 		},
 	}
 
+	// The settings of the other sections are checked on their own, keyed by setting
+	testsBySetting := []struct {
+		setting string
+		desc    string
+		osEnv   map[string]string
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			setting: "Retry",
+			desc:    "No environment variables override",
+			osEnv:   map[string]string{},
+			want:    defaultRetry,
+		},
+		{
+			setting: "Retry",
+			desc:    "Override all retry environment variables",
+			osEnv: map[string]string{
+				"RETRY_MAX_ATTEMPTS": "10",
+				"RETRY_BASE_DELAY":   "1s",
+				"RETRY_MAX_DELAY":    "1m",
+			},
+			want: Retry{
+				MaxAttempts: 10,
+				BaseDelay:   time.Second,
+				MaxDelay:    time.Minute,
+			},
+		},
+		{
+			setting: "Retry",
+			desc:    "Invalid max attempts",
+			osEnv: map[string]string{
+				"RETRY_MAX_ATTEMPTS": "0",
+			},
+			wantErr: true,
+		},
+		{
+			setting: "Retry",
+			desc:    "Invalid base delay",
+			osEnv: map[string]string{
+				"RETRY_BASE_DELAY": "invalid",
+			},
+			wantErr: true,
+		},
+		{
+			setting: "RateLimit",
+			desc:    "No environment variables override",
+			osEnv:   map[string]string{},
+			want:    defaultRateLimit,
+		},
+		{
+			setting: "RateLimit",
+			desc:    "Override all rate limit environment variables",
+			osEnv: map[string]string{
+				"RATE_LIMIT_READ":  "2.5",
+				"RATE_LIMIT_WRITE": "0",
+				"RATE_LIMIT_BURST": "1",
+			},
+			want: RateLimit{
+				ReadRate:  2.5,
+				WriteRate: 0,
+				Burst:     1,
+			},
+		},
+		{
+			setting: "RateLimit",
+			desc:    "Negative rate",
+			osEnv: map[string]string{
+				"RATE_LIMIT_WRITE": "-1",
+			},
+			wantErr: true,
+		},
+		{
+			setting: "Run",
+			desc:    "No environment variables override",
+			osEnv:   map[string]string{},
+			want:    defaultRun,
+		},
+		{
+			setting: "Run",
+			desc:    "Override all run environment variables",
+			osEnv: map[string]string{
+				"WORKERS":       "2",
+				"RUN_TIMEOUT":   "15m",
+				"CALL_TIMEOUT":  "5s",
+				"TRANSACTIONAL": "true",
+			},
+			want: Run{
+				Workers:       2,
+				Timeout:       15 * time.Minute,
+				CallTimeout:   5 * time.Second,
+				Transactional: true,
+			},
+		},
+		{
+			setting: "Run",
+			desc:    "Invalid workers",
+			osEnv: map[string]string{
+				"WORKERS": "0",
+			},
+			wantErr: true,
+		},
+		{
+			setting: "Run",
+			desc:    "Negative run timeout",
+			osEnv: map[string]string{
+				"RUN_TIMEOUT": "-1s",
+			},
+			wantErr: true,
+		},
+		{
+			setting: "AWS",
+			desc:    "No environment variables override",
+			osEnv:   map[string]string{},
+			want:    AWS{},
+		},
+		{
+			setting: "AWS",
+			desc:    "Override all AWS environment variables",
+			osEnv: map[string]string{
+				"REGIONS":           "eu-west-1, us-east-1,us-west-2",
+				"TARGETS_FILE":      "targets.yaml",
+				"ACCOUNTS_FILE":     "accounts.yaml",
+				"ORGANIZATION_FILE": "organization.yaml",
+			},
+			want: AWS{
+				Regions:          []string{"eu-west-1", "us-east-1", "us-west-2"},
+				TargetsFile:      "targets.yaml",
+				AccountsFile:     "accounts.yaml",
+				OrganizationFile: "organization.yaml",
+			},
+		},
+		{
+			setting: "AWS",
+			desc:    "Empty region",
+			osEnv: map[string]string{
+				"REGIONS": "eu-west-1,,us-east-1",
+			},
+			wantErr: true,
+		},
+		{
+			setting: "Preflight",
+			desc:    "No environment variables override",
+			osEnv:   map[string]string{},
+			want:    defaultPreflight,
+		},
+		{
+			setting: "Preflight",
+			desc:    "Override all Preflight environment variables",
+			osEnv: map[string]string{
+				"PREFLIGHT":         "false",
+				"EXPECTED_ACCOUNTS": "111111111111, 222222222222",
+			},
+			want: Preflight{
+				Enabled:          false,
+				ExpectedAccounts: []string{"111111111111", "222222222222"},
+			},
+		},
+		{
+			setting: "Preflight",
+			desc:    "Invalid expected account",
+			osEnv: map[string]string{
+				"EXPECTED_ACCOUNTS": "111111111111,prod",
+			},
+			wantErr: true,
+		},
+		{
+			setting: "Filter",
+			desc:    "Defaults",
+			want:    Filter{},
+		},
+		{
+			setting: "Filter",
+			desc:    "Override filter",
+			osEnv: map[string]string{
+				"ONLY":     "payments/*, search",
+				"EXCLUDE":  "*-legacy",
+				"FILES":    "files/payments/",
+				"SELECTOR": "team=payments,env!=dev",
+			},
+			want: Filter{
+				Only:     []string{"payments/*", "search"},
+				Exclude:  []string{"*-legacy"},
+				Files:    []string{"files/payments/"},
+				Selector: "team=payments,env!=dev",
+			},
+		},
+		{
+			setting: "Filter",
+			desc:    "Invalid glob",
+			osEnv: map[string]string{
+				"ONLY": "payments/[",
+			},
+			wantErr: true,
+		},
+		{
+			setting: "Filter",
+			desc:    "Empty glob",
+			osEnv: map[string]string{
+				"EXCLUDE": "a,,b",
+			},
+			wantErr: true,
+		},
+		{
+			setting: "Policy",
+			desc:    "Defaults",
+			want:    defaultPolicy,
+		},
+		{
+			setting: "Policy",
+			desc:    "Override policy",
+			osEnv: map[string]string{
+				"ASSERTIONS_FILE":     "assertions.yaml",
+				"MANAGED_SID_PREFIX":  "ecrgo-",
+				"EXPIRY_WARNING_DAYS": "30",
+				"EXPIRY_REQUIRED":     "account:vendor-*, arn:aws:iam::555555555555:*",
+			},
+			want: Policy{
+				AssertionsFile:    "assertions.yaml",
+				ManagedSidPrefix:  "ecrgo-",
+				ExpiryWarningDays: 30,
+				ExpiryRequired:    []string{"account:vendor-*", "arn:aws:iam::555555555555:*"},
+			},
+		},
+		{
+			setting: "Policy",
+			desc:    "Negative expiry warning",
+			osEnv:   map[string]string{"EXPIRY_WARNING_DAYS": "-1"},
+			wantErr: true,
+		},
+		{
+			setting: "Policy",
+			desc:    "Empty required expiry glob",
+			osEnv:   map[string]string{"EXPIRY_REQUIRED": "account:vendor-*,"},
+			wantErr: true,
+		},
+		{
+			setting: "BreakGlass",
+			desc:    "Defaults",
+			want:    defaultBreakGlass,
+		},
+		{
+			setting: "BreakGlass",
+			desc:    "Override break-glass",
+			osEnv: map[string]string{
+				"BREAK_GLASS_LEDGER":       "/var/lib/ecr-go/ledger.jsonl",
+				"BREAK_GLASS_MAX_DURATION": "4h",
+			},
+			want: BreakGlass{
+				LedgerFile:  "/var/lib/ecr-go/ledger.jsonl",
+				MaxDuration: 4 * time.Hour,
+			},
+		},
+		{
+			setting: "BreakGlass",
+			desc:    "Zero maximum duration",
+			osEnv:   map[string]string{"BREAK_GLASS_MAX_DURATION": "0"},
+			wantErr: true,
+		},
+	}
+
 	for _, test := range testsWithoutError {
 		t.Run(test.desc, func(t *testing.T) {
 			// set environment variables
@@ -272,4 +590,229 @@ func TestLoadConfig(t *testing.T) {
 			}
 		})
 	}
+
+	for _, test := range testsBySetting {
+		t.Run(test.setting+"/"+test.desc, func(t *testing.T) {
+			for k, v := range test.osEnv {
+				os.Setenv(k, v)
+			}
+			defer func() {
+				for k := range test.osEnv {
+					os.Unsetenv(k)
+				}
+			}()
+
+			c := &config{}
+			err := LoadConfig(c)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, section(c, test.setting))
+		})
+	}
+}
+
+// section returns the section of the configuration holding the given setting
+func section(c *config, setting string) interface{} {
+	switch setting {
+	case "Retry":
+		return c.Retry
+	case "RateLimit":
+		return c.RateLimit
+	case "Run":
+		return c.Run
+	case "AWS":
+		return c.AWS
+	case "Preflight":
+		return c.Preflight
+	case "Filter":
+		return c.Filter
+	case "Policy":
+		return c.Policy
+	case "BreakGlass":
+		return c.BreakGlass
+	}
+	return nil
+}
+
+func TestLoad(t *testing.T) {
+	os.Setenv("WORKERS", "30")
+	os.Setenv("LOG_LEVEL", "debug")
+	defer os.Unsetenv("WORKERS")
+	defer os.Unsetenv("LOG_LEVEL")
+
+	file, err := ReadFile("testdata/config.yaml")
+	assert.NoError(t, err)
+
+	c := &config{}
+	err = Load(c, Sources{
+		Flags: map[string]string{"log-level": "error", "dry-run": "true"},
+		File:  file,
+	})
+	assert.NoError(t, err)
+
+	assert := assert.New(t)
+	assert.Equal("error", c.Application.LogLevel, "flag over environment")
+	assert.True(c.Application.DryRun, "flag over default")
+	assert.Equal(30, c.Run.Workers, "environment over file")
+	assert.Equal("repositories/", c.Application.ConfigDir, "file over default")
+	assert.Equal([]string{"eu-west-1", "us-east-1"}, c.AWS.Regions)
+	assert.True(c.Run.Transactional)
+	assert.Equal(defaultRetry, c.Retry, "defaults")
+
+	err = Load(&config{}, Sources{Flags: map[string]string{"workers": "many"}})
+	assert.EqualError(err, `invalid value "many" for flag --workers: strconv.Atoi: parsing "many": invalid syntax`)
+	err = Load(&config{}, Sources{Flags: map[string]string{"workers": "0"}})
+	assert.EqualError(err, "Workers must be greater than 0")
+}
+
+func TestSettingSet(t *testing.T) {
+	var fields struct {
+		String      string
+		Bool        bool
+		Int         int
+		Float       float64
+		Duration    time.Duration
+		List        []string
+		Unsupported uint
+	}
+	values := reflect.ValueOf(&fields).Elem()
+
+	tests := []struct {
+		desc      string
+		field     string
+		separator string
+		raw       string
+		want      interface{}
+		wantErr   string
+	}{
+		{desc: "String", field: "String", raw: "eu-west-1", want: "eu-west-1"},
+		{desc: "Bool", field: "Bool", raw: "true", want: true},
+		{desc: "Invalid bool", field: "Bool", raw: "maybe", wantErr: `strconv.ParseBool: parsing "maybe": invalid syntax`},
+		{desc: "Int", field: "Int", raw: "42", want: 42},
+		{desc: "Invalid int", field: "Int", raw: "many", wantErr: `strconv.Atoi: parsing "many": invalid syntax`},
+		{desc: "Float", field: "Float", raw: "2.5", want: 2.5},
+		{desc: "Invalid float", field: "Float", raw: "fast", wantErr: `strconv.ParseFloat: parsing "fast": invalid syntax`},
+		{desc: "Duration", field: "Duration", raw: "1m30s", want: 90 * time.Second},
+		{desc: "Invalid duration", field: "Duration", raw: "soon", wantErr: `time: invalid duration "soon"`},
+		{desc: "List", field: "List", separator: ",", raw: "eu-west-1,us-east-1", want: []string{"eu-west-1", "us-east-1"}},
+		{desc: "List with separator", field: "List", separator: ";", raw: "a,b;c", want: []string{"a,b", "c"}},
+		{desc: "Empty list", field: "List", separator: ",", raw: "", want: []string(nil)},
+		{desc: "Unsupported type", field: "Unsupported", raw: "1", wantErr: "unsupported type uint"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			s := setting{separator: test.separator, field: values.FieldByName(test.field)}
+			err := s.set(test.raw)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, s.field.Interface())
+		})
+	}
+}
+
+func TestSettingLookup(t *testing.T) {
+	os.Setenv("ECR_GO_TEST_SETTING", "environment")
+	os.Setenv("ECR_GO_TEST_EMPTY", "")
+	defer os.Unsetenv("ECR_GO_TEST_SETTING")
+	defer os.Unsetenv("ECR_GO_TEST_EMPTY")
+
+	tests := []struct {
+		desc       string
+		setting    setting
+		sources    Sources
+		want       string
+		wantOrigin string
+		wantOK     bool
+	}{
+		{
+			desc:       "Flag",
+			setting:    setting{env: "ECR_GO_TEST_SETTING"},
+			sources:    Sources{Flags: map[string]string{"ecr-go-test-setting": "flag"}, File: map[string]string{"ecr-go-test-setting": "file"}},
+			want:       "flag",
+			wantOrigin: "flag --ecr-go-test-setting",
+			wantOK:     true,
+		},
+		{
+			desc:       "Environment variable",
+			setting:    setting{env: "ECR_GO_TEST_SETTING", def: "default", hasDef: true},
+			sources:    Sources{File: map[string]string{"ecr-go-test-setting": "file"}},
+			want:       "environment",
+			wantOrigin: "environment variable ECR_GO_TEST_SETTING",
+			wantOK:     true,
+		},
+		{
+			desc:       "Empty environment variable",
+			setting:    setting{env: "ECR_GO_TEST_EMPTY", def: "default", hasDef: true},
+			sources:    Sources{File: map[string]string{"ecr-go-test-empty": "file"}},
+			want:       "file",
+			wantOrigin: "configuration file key ecr-go-test-empty",
+			wantOK:     true,
+		},
+		{
+			desc:       "Default",
+			setting:    setting{env: "ECR_GO_TEST_EMPTY", def: "default", hasDef: true},
+			want:       "default",
+			wantOrigin: "default of ECR_GO_TEST_EMPTY",
+			wantOK:     true,
+		},
+		{
+			desc:    "Unset without default",
+			setting: setting{env: "ECR_GO_TEST_EMPTY"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, origin, ok := test.setting.lookup(test.sources)
+			assert.Equal(t, test.wantOK, ok)
+			assert.Equal(t, test.want, got)
+			assert.Equal(t, test.wantOrigin, origin)
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	values, err := ReadFile("testdata/config.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"config-dir":    "repositories/",
+		"workers":       "20",
+		"regions":       "eu-west-1,us-east-1",
+		"transactional": "true",
+	}, values)
+
+	_, err = ReadFile("testdata/unknown.yaml")
+	assert.EqualError(t, err, "testdata/unknown.yaml: unknown setting worker")
+
+	_, err = ReadFile("testdata/doesnotexist.yaml")
+	assert.Error(t, err)
+}
+
+func TestNewFlagSet(t *testing.T) {
+	var s Sources
+	var configFile string
+	fs := NewFlagSet("apply", &s, &configFile)
+
+	err := fs.Parse([]string{"--dry-run", "--workers", "3", "--regions=eu-west-1,us-east-1", "--config-file", "ecr-go.yaml", "repo1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"dry-run": "true", "workers": "3", "regions": "eu-west-1,us-east-1"}, s.Flags)
+	assert.Equal(t, "ecr-go.yaml", configFile)
+	assert.Equal(t, []string{"repo1"}, fs.Args())
+	assert.Equal(t, "10", fs.Lookup("workers").DefValue)
+
+	// A shorthand sets the same setting
+	assert.NoError(t, fs.Parse([]string{"-l", "team=payments"}))
+	assert.Equal(t, "team=payments", s.Flags["selector"])
+
+	// Every setting is documented
+	for _, st := range settings(&config{}) {
+		assert.NotEmpty(t, help[st.env], st.env)
+	}
 }
@@ -0,0 +1,146 @@
+package appconfig
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFileEnv is the environment variable of the configuration file. Its flag is --config-file
+const ConfigFileEnv = "CONFIG_FILE"
+
+// help is the description of each setting in the usage of the flags, by environment variable
+var help = map[string]string{
+	"APPLICATION_NAME":         "Name of the application in the logs and the backups",
+	"CONFIG_DIR":               "Directory of the yaml configuration files of the repositories",
+	"LOG_LEVEL":                "Log level: error, info or debug",
+	"DRY_RUN":                  "Only validate the configuration files, without calling AWS",
+	"APPLICATION_VERSION":      "Version of the application in the logs and the backups",
+	"RETRY_MAX_ATTEMPTS":       "Maximum number of attempts of an ECR call failing with a retryable error",
+	"RETRY_BASE_DELAY":         "Delay before the first retry, doubled on each subsequent retry",
+	"RETRY_MAX_DELAY":          "Upper bound of the delay between two attempts",
+	"RATE_LIMIT_READ":          "Maximum rate of the ECR read calls per second. 0 disables the limit",
+	"RATE_LIMIT_WRITE":         "Maximum rate of the ECR write calls per second. 0 disables the limit",
+	"RATE_LIMIT_BURST":         "Maximum number of ECR calls in a burst",
+	"WORKERS":                  "Maximum number of repositories processed concurrently in each region",
+	"RUN_TIMEOUT":              "Deadline of the whole run. 0 means no deadline",
+	"CALL_TIMEOUT":             "Timeout of each ECR call. 0 means no timeout",
+	"TRANSACTIONAL":            "Roll back all the updated repositories if any update fails",
+	"BACKUP_DIR":               "Directory of the backups of the policies. Empty disables the backups",
+	"SUMMARY_FILE":             "File the records of the repositories of a run are written to, as JSON. Empty means no file",
+	"REGIONS":                  "Comma separated list of the default regions of the repositories",
+	"TARGETS_FILE":             "File declaring the named targets",
+	"ACCOUNTS_FILE":            "File declaring the aliases of the accounts referenced by the policies, as account:<name> or group:<name>",
+	"ORGANIZATION_FILE":        "Snapshot of the accounts of the organizations and organizational units, listed by the access report instead of them",
+	"PREFLIGHT":                "Check the identity and the permissions of the callers before any change",
+	"EXPECTED_ACCOUNTS":        "Comma separated list of the only AWS accounts the callers are allowed to be in",
+	"ONLY":                     "Comma separated list of globs of the only repository names to process",
+	"EXCLUDE":                  "Comma separated list of globs of the repository names not to process",
+	"FILES":                    "Comma separated list of the only configuration files to process, as globs, paths or directories",
+	"SELECTOR":                 "Label selector of the repositories to process, like team=payments,env!=dev",
+	"ASSERTIONS_FILE":          "File of the expected answers of the policies to some requests, checked by validate",
+	"EXPIRY_WARNING_DAYS":      "Number of days before their expiry the grants are reported by validate and plan. 0 disables the warnings",
+	"EXPIRY_REQUIRED":          "Comma separated list of globs of the principals whose grants must have an expiry, like account:vendor-*",
+	"MANAGED_SID_PREFIX":       "Merge mode: only manage the statements whose Sid starts with this prefix, keeping the other ones. Empty replaces the whole policies",
+	"BREAK_GLASS_LEDGER":       "Local file recording the break-glass grants and their revocations",
+	"BREAK_GLASS_MAX_DURATION": "Longest duration of a break-glass grant",
+}
+
+// shorthands are the one letter aliases of some flags, by environment variable
+var shorthands = map[string]string{
+	"SELECTOR": "l",
+}
+
+// flagValue records the value of a flag set on the command line in Sources.Flags
+type flagValue struct {
+	name   string
+	def    string
+	isBool bool
+	values map[string]string
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.def
+}
+
+func (v *flagValue) Set(s string) error {
+	v.values[v.name] = s
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// NewFlagSet returns a flag set with a flag per setting of the configuration, its shorthand if any, and the --config-file flag
+// The values of the flags set on the command line are recorded in s.Flags, and the configuration file in configFile, once parsed
+func NewFlagSet(name string, s *Sources, configFile *string) *flag.FlagSet {
+	if s.Flags == nil {
+		s.Flags = make(map[string]string)
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(configFile, FlagName(ConfigFileEnv), "", fmt.Sprintf("Yaml configuration file, keyed by flag name (env %s)", ConfigFileEnv))
+	for _, st := range settings(&config{}) {
+		name := FlagName(st.env)
+		v := &flagValue{name: name, def: st.def, isBool: st.isBool(), values: s.Flags}
+		fs.Var(v, name, fmt.Sprintf("%s (env %s)", help[st.env], st.env))
+		if short, ok := shorthands[st.env]; ok {
+			fs.Var(v, short, fmt.Sprintf("Shorthand for --%s", name))
+		}
+	}
+	return fs
+}
+
+// ReadFile will read the values of the given yaml configuration file, by flag name
+// A list is turned into the comma separated list of its elements
+// It returns an error for any key that is not the flag name of a setting
+func ReadFile(path string) (map[string]string, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(d, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	known := make(map[string]setting)
+	for _, st := range settings(&config{}) {
+		known[FlagName(st.env)] = st
+	}
+
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	values := make(map[string]string, len(raw))
+	for _, k := range keys {
+		st, ok := known[k]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown setting %s", path, k)
+		}
+		switch v := raw[k].(type) {
+		case []interface{}:
+			l := make([]string, len(v))
+			for i := range v {
+				l[i] = fmt.Sprint(v[i])
+			}
+			values[k] = strings.Join(l, st.separator)
+		case nil:
+			values[k] = ""
+		default:
+			values[k] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
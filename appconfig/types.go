@@ -1,5 +1,7 @@
 package appconfig
 
+import "time"
+
 // Config stores configuration values
 var Config *config
 
@@ -13,4 +15,122 @@ type config struct {
 		DryRun    bool   `env:"DRY_RUN" envDefault:"false"`
 		Version   string `env:"APPLICATION_VERSION" envDefault:"0.1.2"`
 	}
+
+	// Retry provides the retry configuration of the ECR calls
+	Retry Retry
+
+	// RateLimit provides the client side rate limiting configuration of the ECR calls
+	RateLimit RateLimit
+
+	// Run provides the scheduling and deadlines configuration of a run
+	Run Run
+
+	// Backup provides the configuration of the policies backups
+	Backup Backup
+
+	// Summary provides the configuration of the reports of the runs
+	Summary Summary
+
+	// AWS provides the configuration of the targeted AWS regions and sessions
+	AWS AWS
+
+	// Preflight provides the configuration of the checks run before any change
+	Preflight Preflight
+
+	// Filter provides the selection of the configured repositories to process
+	Filter Filter
+
+	// Policy provides the configuration of the checks of the policies
+	Policy Policy
+
+	// BreakGlass provides the configuration of the temporary grants of the grant command
+	BreakGlass BreakGlass
+}
+
+// Retry provides the retry configuration of the ECR calls failing with a retryable error
+type Retry struct {
+	MaxAttempts int           `env:"RETRY_MAX_ATTEMPTS" envDefault:"5"`
+	BaseDelay   time.Duration `env:"RETRY_BASE_DELAY" envDefault:"200ms"`
+	MaxDelay    time.Duration `env:"RETRY_MAX_DELAY" envDefault:"20s"`
+}
+
+// RateLimit provides the client side rate limiting configuration of the ECR calls, shared by all workers
+// A rate of 0 disables the rate limiting of the corresponding calls
+type RateLimit struct {
+	ReadRate  float64 `env:"RATE_LIMIT_READ" envDefault:"10"`
+	WriteRate float64 `env:"RATE_LIMIT_WRITE" envDefault:"5"`
+	Burst     int     `env:"RATE_LIMIT_BURST" envDefault:"5"`
+}
+
+// Run provides the scheduling and deadlines configuration of a run
+// A timeout of 0 disables the corresponding deadline
+type Run struct {
+	Workers       int           `env:"WORKERS" envDefault:"10"`
+	Timeout       time.Duration `env:"RUN_TIMEOUT" envDefault:"0"`
+	CallTimeout   time.Duration `env:"CALL_TIMEOUT" envDefault:"30s"`
+	Transactional bool          `env:"TRANSACTIONAL" envDefault:"false"`
+}
+
+// Backup provides the configuration of the policies backups
+// An empty Dir disables the backup of the policies before they are overwritten
+type Backup struct {
+	Dir string `env:"BACKUP_DIR" envDefault:""`
+}
+
+// Summary provides the configuration of the reports of the runs
+// File is the file the records of the repositories of a run are written to, as a JSON array. Empty means no file
+type Summary struct {
+	File string `env:"SUMMARY_FILE" envDefault:""`
+}
+
+// AWS provides the configuration of the targeted AWS regions and sessions
+// Regions are the default regions of the repositories not defining theirs.
+// Empty means the region of the AWS session (AWS_REGION or the profile region)
+// TargetsFile is the file declaring the named targets the configuration files can point at. Empty means no target
+// AccountsFile is the file declaring the aliases of the accounts the policies can reference. Empty means no alias
+// OrganizationFile is the snapshot of the accounts of the organizations and organizational units, used by the access report.
+// Empty means the report lists the organizations and organizational units instead of their accounts
+type AWS struct {
+	Regions          []string `env:"REGIONS" envSeparator:","`
+	TargetsFile      string   `env:"TARGETS_FILE" envDefault:""`
+	AccountsFile     string   `env:"ACCOUNTS_FILE" envDefault:""`
+	OrganizationFile string   `env:"ORGANIZATION_FILE" envDefault:""`
+}
+
+// Preflight provides the configuration of the checks run before any change
+// ExpectedAccounts are the only accounts the callers are allowed to be in. Empty means any account
+type Preflight struct {
+	Enabled          bool     `env:"PREFLIGHT" envDefault:"true"`
+	ExpectedAccounts []string `env:"EXPECTED_ACCOUNTS" envSeparator:","`
+}
+
+// Filter provides the selection of the configured repositories to process. Empty fields select all the repositories
+// Only and Exclude are globs of repository names, Files are globs, paths or directories of configuration files
+// Selector is a comma separated list of label requirements, like team=payments,env!=dev
+type Filter struct {
+	Only     []string `env:"ONLY" envSeparator:","`
+	Exclude  []string `env:"EXCLUDE" envSeparator:","`
+	Files    []string `env:"FILES" envSeparator:","`
+	Selector string   `env:"SELECTOR" envDefault:""`
+}
+
+// Policy provides the configuration of the checks of the policies
+// AssertionsFile is the file of the expected answers of the policies to some requests, checked by validate. Empty means no assertion
+// ManagedSidPrefix enables the merge mode: only the statements whose Sid starts with it are managed, the other ones are kept.
+// Empty means the configured policies replace the current ones
+// ExpiryWarningDays is the number of days before their expiry the grants are reported by validate and plan. 0 disables the warnings
+// ExpiryRequired are globs of the principals whose grants must have an expiry. Empty means no grant requires one
+type Policy struct {
+	AssertionsFile    string   `env:"ASSERTIONS_FILE" envDefault:""`
+	ManagedSidPrefix  string   `env:"MANAGED_SID_PREFIX" envDefault:""`
+	ExpiryWarningDays int      `env:"EXPIRY_WARNING_DAYS" envDefault:"14"`
+	ExpiryRequired    []string `env:"EXPIRY_REQUIRED" envSeparator:","`
+}
+
+// BreakGlass provides the configuration of the temporary grants added to the live policies by the grant command
+// LedgerFile is the local file recording the grants and their revocations, one JSON entry per line
+// MaxDuration is the longest duration of a grant
+type BreakGlass struct {
+	LedgerFile  string        `env:"BREAK_GLASS_LEDGER" envDefault:"break-glass-ledger.jsonl"`
+	MaxDuration time.Duration `env:"BREAK_GLASS_MAX_DURATION" envDefault:"12h"`
 }
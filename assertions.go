@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/lescactus/ecr-go/configuration"
+	"go.uber.org/zap"
+)
+
+// checkAssertions will evaluate each assertion of the assertions file against the configured policy of the repositories it matches
+// An assertion matching no repository fails, so that a renamed repository is noticed
+// It returns false if the file cannot be loaded or any assertion fails
+func checkAssertions(logger *zap.Logger, repositories *repositories) bool {
+	assertions, err := configuration.LoadAssertions(appconfig.Config.Policy.AssertionsFile)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: cannot load the assertions: %v", err))
+		return false
+	}
+
+	list := repositories.list()
+	failed := 0
+	for _, a := range assertions {
+		ok := true
+		found := false
+		for _, r := range list {
+			if match, _ := path.Match(a.Repository, r.record.Repository); !match {
+				continue
+			}
+			found = true
+			e, err := r.evaluate(a.Principal, a.Action, a.RequestContext())
+			switch {
+			case err != nil:
+				logger.Error(fmt.Sprintf("Error: assertion %q cannot be checked for %s: %v", a, r.record.Target(), err))
+				ok = false
+			case !a.Matches(string(e.Decision)):
+				logger.Error(fmt.Sprintf("Error: assertion %q failed for %s: expected %s, got %s", a, r.record.Target(), a.Expect, e))
+				ok = false
+			default:
+				logger.Debug(fmt.Sprintf("Assertion %q passed for %s: %s", a, r.record.Target(), e))
+			}
+		}
+		if !found && repositories.filter.IsEmpty() {
+			logger.Error(fmt.Sprintf("Error: assertion %q failed: no configured repository matches %q", a, a.Repository))
+			ok = false
+		}
+		if !ok {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		logger.Error(fmt.Sprintf("Error: %d of %d assertions failed", failed, len(assertions)))
+		return false
+	}
+	logger.Info(fmt.Sprintf("%d assertions passed", len(assertions)))
+	return true
+}
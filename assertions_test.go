@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAssertions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "assertions")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	configDir := filepath.Join(dir, "files")
+	assert.NoError(t, os.Mkdir(configDir, 0755))
+	writePolicyConfigs(t, configDir, simulatedPolicy, "app")
+
+	tests := []struct {
+		desc       string
+		assertions string
+		code       int
+	}{
+		{
+			desc: "Passed",
+			assertions: `assertions:
+  - description: prod account can pull
+    repository: "*"
+    principal: arn:aws:iam::111111111111:role/deploy
+    action: pull
+    expect: allow
+  - description: dev account cannot push
+    repository: app
+    principal: "444444444444"
+    action: push
+    expect: deny
+`,
+			code: exitOK,
+		},
+		{
+			desc: "Failed",
+			assertions: `assertions:
+  - description: nobody can delete
+    repository: app
+    principal: arn:aws:iam::222222222222:role/ci
+    action: ecr:DeleteRepository
+    expect: implicit-deny
+`,
+			code: exitFailed,
+		},
+		{
+			desc: "No repository",
+			assertions: `assertions:
+  - repository: renamed
+    principal: "111111111111"
+    action: pull
+    expect: allow
+`,
+			code: exitFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			file := filepath.Join(dir, "assertions.yaml")
+			assert.NoError(t, ioutil.WriteFile(file, []byte(test.assertions), 0644))
+
+			var stdout, stderr bytes.Buffer
+			code := run([]string{"validate", "--config-dir", configDir, "--assertions-file", file}, &stdout, &stderr)
+			assert.Equal(t, test.code, code)
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/lescactus/ecr-go/configuration"
+)
+
+const (
+	// IDFormat is the time layout used to build the backup IDs
+	IDFormat = "20060102T150405Z"
+
+	metadataFile    = "metadata.json"
+	repositoriesDir = "repositories"
+	publicDir       = "public"
+)
+
+// Metadata describes the run that created a backup
+type Metadata struct {
+	ID          string    `json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Application string    `json:"application"`
+	Version     string    `json:"version"`
+	ConfigDir   string    `json:"configDir"`
+
+	// Accounts are the accounts of the repositories of the backup, used to assume the same roles on restore
+	Accounts []configuration.Account `json:"accounts,omitempty"`
+}
+
+// Entry is the backup of the policy of a single repository
+// Exists is false when the repository had no policy before the run
+// RegistryID, Region, Account and Target are empty when the repository was updated in the default registry, in the default region,
+// with the default credentials and the default AWS session
+type Entry struct {
+	RepositoryName string `json:"repositoryName"`
+	RegistryID     string `json:"registryId,omitempty"`
+	Region         string `json:"region,omitempty"`
+	Account        string `json:"account,omitempty"`
+	Target         string `json:"target,omitempty"`
+	Public         bool   `json:"public,omitempty"` // The repository is an ECR Public repository
+	Exists         bool   `json:"exists"`
+	PolicyText     string `json:"policyText,omitempty"`
+
+	// CatalogData is the catalog data of a public repository whose catalog data is managed, without its logo. nil otherwise
+	CatalogData *configuration.CatalogData `json:"catalogData,omitempty"`
+}
+
+// typeDir returns the directory of the public repositories in the backup, nested in their region, or "" for the private ones
+func (e Entry) typeDir() string {
+	if e.Public {
+		return publicDir
+	}
+	return ""
+}
+
+// Store persists the policies backups
+// Implementations must be safe for concurrent calls to Save
+type Store interface {
+	// Init creates a new backup described by the given metadata
+	Init(m Metadata) error
+	// Save stores the entry in the backup with the given ID
+	Save(id string, e Entry) error
+	// List returns the metadata of all the backups, oldest first
+	List() ([]Metadata, error)
+	// Load returns the metadata and the entries of the backup with the given ID
+	Load(id string) (Metadata, []Entry, error)
+}
+
+// NewID returns a backup ID built from the given time
+func NewID(t time.Time) string {
+	return t.UTC().Format(IDFormat)
+}
+
+// DirStore is a Store keeping each backup in a timestamped directory:
+//
+//	<Root>/<id>/metadata.json
+//	<Root>/<id>/repositories/[<target>/][<account>/][<region>/][<registry ID>/]<escaped repository name>.json
+type DirStore struct {
+	Root string
+}
+
+// NewDirStore instanciate a DirStore
+// It returns a DirStore storing the backups under root
+func NewDirStore(root string) *DirStore {
+	return &DirStore{
+		Root: root,
+	}
+}
+
+// Init will create the backup directory and write its metadata
+// It returns an error if a backup with the same ID already exists
+func (d *DirStore) Init(m Metadata) error {
+	if m.ID == "" {
+		return errors.New("backup ID must not be empty")
+	}
+	dir := filepath.Join(d.Root, m.ID)
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("backup %s already exists", m.ID)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, repositoriesDir), 0755); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, metadataFile), m)
+}
+
+// Save will write the entry in the backup directory
+func (d *DirStore) Save(id string, e Entry) error {
+	if e.RepositoryName == "" {
+		return errors.New("RepositoryName must be present and not empty")
+	}
+	dir := filepath.Join(d.Root, id, repositoriesDir, e.Target, e.Account, e.Region, e.typeDir(), e.RegistryID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, url.PathEscape(e.RepositoryName)+".json"), e)
+}
+
+// List will read the metadata of all the backups under Root
+// It returns the backups sorted by ID, oldest first
+func (d *DirStore) List() ([]Metadata, error) {
+	files, err := ioutil.ReadDir(d.Root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Metadata{}, nil
+		}
+		return nil, err
+	}
+
+	backups := []Metadata{}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		var m Metadata
+		if err := readJSON(filepath.Join(d.Root, f.Name(), metadataFile), &m); err != nil {
+			// Not a backup directory
+			continue
+		}
+		backups = append(backups, m)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ID < backups[j].ID })
+
+	return backups, nil
+}
+
+// Load will read the metadata and all the entries of the given backup
+// It returns the entries sorted by repository name, target, account, region and registry ID
+func (d *DirStore) Load(id string) (Metadata, []Entry, error) {
+	var m Metadata
+	if err := readJSON(filepath.Join(d.Root, id, metadataFile), &m); err != nil {
+		return m, nil, fmt.Errorf("cannot read backup %s: %v", id, err)
+	}
+
+	entries := []Entry{}
+	err := filepath.Walk(filepath.Join(d.Root, id, repositoriesDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		var e Entry
+		if err := readJSON(path, &e); err != nil {
+			return fmt.Errorf("cannot read backup entry %s: %v", path, err)
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return m, nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].RepositoryName != entries[j].RepositoryName {
+			return entries[i].RepositoryName < entries[j].RepositoryName
+		}
+		if entries[i].Target != entries[j].Target {
+			return entries[i].Target < entries[j].Target
+		}
+		if entries[i].Account != entries[j].Account {
+			return entries[i].Account < entries[j].Account
+		}
+		if entries[i].Region != entries[j].Region {
+			return entries[i].Region < entries[j].Region
+		}
+		if entries[i].Public != entries[j].Public {
+			return !entries[i].Public
+		}
+		return entries[i].RegistryID < entries[j].RegistryID
+	})
+
+	return m, entries, nil
+}
+
+// Select will filter the entries on the given repositories names
+// A name selects the entries of the repository in all the targets, accounts, regions and registries
+// It returns all the entries if no name is given, or an error if a name has no entry
+func Select(entries []Entry, names []string) ([]Entry, error) {
+	if len(names) == 0 {
+		return entries, nil
+	}
+
+	byName := make(map[string][]Entry, len(entries))
+	for _, e := range entries {
+		byName[e.RepositoryName] = append(byName[e.RepositoryName], e)
+	}
+
+	selected := []Entry{}
+	for _, n := range names {
+		e, ok := byName[n]
+		if !ok {
+			return nil, fmt.Errorf("repository %s not found in backup", n)
+		}
+		selected = append(selected, e...)
+	}
+	return selected, nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+func readJSON(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Account returns the account with the given ID of the backup
+// It returns nil if the backup has no such account
+func (m Metadata) Account(id string) *configuration.Account {
+	for i := range m.Accounts {
+		if m.Accounts[i].ID == id {
+			return &m.Accounts[i]
+		}
+	}
+	return nil
+}
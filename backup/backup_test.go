@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewID(t *testing.T) {
+	loc := time.FixedZone("CEST", 2*60*60)
+	assert.Equal(t, "20210504T210659Z", NewID(time.Date(2021, 5, 4, 23, 6, 59, 0, loc)))
+}
+
+func TestDirStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "ecr-go-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	d := NewDirStore(root)
+
+	// No backup yet
+	l, err := d.List()
+	assert.NoError(t, err)
+	assert.Empty(t, l)
+
+	m1 := Metadata{ID: "20210504T210659Z", Application: "ecr-go", Version: "0.1.2", ConfigDir: "files/", Accounts: []configuration.Account{{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go", SessionName: "ecr-go"}}}
+	m2 := Metadata{ID: "20210505T080000Z", Application: "ecr-go", Version: "0.1.2", ConfigDir: "files/"}
+	assert.NoError(t, d.Init(m2))
+	assert.NoError(t, d.Init(m1))
+	assert.Error(t, d.Init(m1), "a backup ID must be unique")
+	assert.Error(t, d.Init(Metadata{}), "a backup ID must not be empty")
+
+	entries := []Entry{
+		{RepositoryName: "team/repo", Exists: true, PolicyText: `{"Version":"2008-10-17"}`},
+		{RepositoryName: "alma", Exists: false},
+		{RepositoryName: "alma", Region: "eu-west-1", Exists: true, PolicyText: `{"Version":"2008-10-17"}`},
+		{RepositoryName: "alma", Region: "eu-west-1", Account: "111111111111", Exists: false},
+		{RepositoryName: "alma", Region: "us-east-1", Target: "local", Exists: false},
+		{RepositoryName: "alma", Region: "us-east-1", Public: true, Exists: true, PolicyText: `{"Version":"2008-10-17"}`},
+	}
+	for _, e := range entries {
+		assert.NoError(t, d.Save(m1.ID, e))
+	}
+	assert.Error(t, d.Save(m1.ID, Entry{}))
+	assert.FileExists(t, filepath.Join(root, m1.ID, "repositories", "team%2Frepo.json"))
+	assert.FileExists(t, filepath.Join(root, m1.ID, "repositories", "eu-west-1", "alma.json"))
+	assert.FileExists(t, filepath.Join(root, m1.ID, "repositories", "111111111111", "eu-west-1", "alma.json"))
+	assert.FileExists(t, filepath.Join(root, m1.ID, "repositories", "local", "us-east-1", "alma.json"))
+	assert.FileExists(t, filepath.Join(root, m1.ID, "repositories", "us-east-1", "public", "alma.json"))
+
+	// Not a backup directory
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "other"), 0755))
+
+	l, err = d.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []Metadata{m1, m2}, l)
+
+	m, e, err := d.Load(m1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, m1, m)
+	assert.Equal(t, []Entry{entries[1], entries[2], entries[5], entries[3], entries[4], entries[0]}, e)
+
+	m, e, err = d.Load(m2.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, m2, m)
+	assert.Empty(t, e)
+
+	_, _, err = d.Load("doesnotexist")
+	assert.Error(t, err)
+}
+
+func TestSelect(t *testing.T) {
+	entries := []Entry{
+		{RepositoryName: "repo1", Exists: true, PolicyText: "{}"},
+		{RepositoryName: "repo2"},
+		{RepositoryName: "repo3"},
+		{RepositoryName: "repo1", Region: "eu-west-1"},
+	}
+
+	tests := []struct {
+		desc    string
+		names   []string
+		want    []Entry
+		wantErr bool
+	}{
+		{
+			desc: "No name selects all entries",
+			want: entries,
+		},
+		{
+			desc:  "Select some entries",
+			names: []string{"repo3", "repo1"},
+			want:  []Entry{entries[2], entries[0], entries[3]},
+		},
+		{
+			desc:    "Unknown repository",
+			names:   []string{"repo1", "repo4"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			s, err := Select(entries, test.names)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, s)
+		})
+	}
+}
+
+func TestMetadataAccount(t *testing.T) {
+	m := Metadata{
+		Accounts: []configuration.Account{
+			{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go"},
+			{ID: "222222222222", RoleArn: "arn:aws:iam::222222222222:role/ecr-go"},
+		},
+	}
+
+	assert.Equal(t, &m.Accounts[1], m.Account("222222222222"))
+	assert.Nil(t, m.Account("333333333333"))
+	assert.Nil(t, Metadata{}.Account("111111111111"))
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/ecrupdater"
+	"github.com/lescactus/ecr-go/ledger"
+	"github.com/lescactus/ecr-go/policy"
+	"github.com/lescactus/ecr-go/summary"
+	"go.uber.org/zap"
+)
+
+// breakGlassPrincipalRegexp matches the principals of a break-glass grant: account IDs and IAM ARNs
+var breakGlassPrincipalRegexp = regexp.MustCompile(`^([0-9]{12}|arn:aws[a-z-]*:iam::[0-9]{12}:[^*?]+)$`)
+
+// grantSettings are the flags of the grant command
+type grantSettings struct {
+	repository string
+	principal  string
+	actions    string
+	duration   time.Duration
+	reason     string
+}
+
+// grantOptions are the flags of the grant command of the current run
+var grantOptions grantSettings
+
+// grantFlags will register the flags of the grant command
+func grantFlags(fs *flag.FlagSet) {
+	grantOptions = grantSettings{}
+	fs.StringVar(&grantOptions.repository, "repository", "", "Name of the configured repository to grant access to, in all its locations")
+	fs.StringVar(&grantOptions.principal, "principal", "", "Principal granted access: an account ID or an IAM ARN")
+	fs.StringVar(&grantOptions.actions, "actions", "pull", "Comma separated list of the actions granted: pull, push or ECR actions like ecr:DescribeImages")
+	fs.DurationVar(&grantOptions.duration, "duration", 0, "Duration of the grant, like 2h. At most BREAK_GLASS_MAX_DURATION")
+	fs.StringVar(&grantOptions.reason, "reason", "", "Reason of the grant recorded in the ledger, like an incident ticket")
+}
+
+// grantCommand will add a break-glass statement to the live policy of a configured repository, granting actions to a principal
+// for a limited duration. The grant is recorded in the ledger. The configuration files are not changed
+func grantCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	actions, err := parseGrant(grantOptions, appconfig.Config.BreakGlass.MaxDuration)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitUsage
+	}
+
+	repositories, err := loadRepositories(logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitFailed
+	}
+	if repositories.keepPrivate(grantOptions.repository) == 0 {
+		logger.Error(fmt.Sprintf("Error: no private repository %s is configured", grantOptions.repository))
+		return exitFailed
+	}
+
+	expires := time.Now().Add(grantOptions.duration).UTC().Truncate(time.Second)
+	logger.Info(fmt.Sprintf("Granting %s to %s on repository %s until %s, in %d location(s)", strings.Join(actions, ", "), grantOptions.principal,
+		grantOptions.repository, expires.Format(time.RFC3339), repositories.count()))
+	if prefix := appconfig.Config.Policy.ManagedSidPrefix; strings.HasPrefix(policy.BreakGlassPrefix, prefix) {
+		logger.Warn("The next apply will remove the break-glass statement, as its Sid is managed")
+	}
+
+	if appconfig.Config.Application.DryRun {
+		logger.Info("Dry-run completed ... no statement added")
+		return exitOK
+	}
+
+	edit := func(current string) (string, []string, error) {
+		text, sid, err := policy.AddBreakGlass(current, grantOptions.principal, actions, expires)
+		if err != nil {
+			return "", nil, err
+		}
+		return text, []string{sid}, nil
+	}
+	return runBreakGlass(logger, repositories, summary.OperationGrant, "grant", edit, func(r ecrupdater.BreakGlassResult, sid string) ledger.Entry {
+		e := ledgerEntry(r, sid, ledger.EventGrant, expires)
+		e.Reason = grantOptions.reason
+		e.Principal = grantOptions.principal
+		e.Actions = actions
+		return e
+	})
+}
+
+// revokeExpiredCommand will remove the expired break-glass statements from the live policies of the configured private
+// repositories, whether their configuration changed or not. The revocations are recorded in the ledger
+func revokeExpiredCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	repositories, err := loadRepositories(logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitFailed
+	}
+	repositories.keepPrivate("")
+
+	if appconfig.Config.Application.DryRun {
+		logger.Info(fmt.Sprintf("Dry-run completed ... the expired break-glass statements of %d repositories would be revoked", repositories.count()))
+		return exitOK
+	}
+
+	// The revocations are recorded with the principal, actions and reason of their grant
+	l := ledger.New(appconfig.Config.BreakGlass.LedgerFile)
+	grants, err := l.Load()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: cannot read the break-glass ledger: %v", err))
+		return exitFailed
+	}
+
+	now := time.Now()
+	edit := func(current string) (string, []string, error) {
+		return policy.RevokeExpired(current, now)
+	}
+	return runBreakGlass(logger, repositories, summary.OperationRevoke, "revocation", edit, func(r ecrupdater.BreakGlassResult, sid string) ledger.Entry {
+		expires, _ := policy.BreakGlassExpiry(sid)
+		e := ledgerEntry(r, sid, ledger.EventRevoke, expires)
+		if g, ok := ledger.Grant(grants, e); ok {
+			e.Reason = g.Reason
+			e.Principal = g.Principal
+			e.Actions = g.Actions
+		}
+		return e
+	})
+}
+
+// runBreakGlass will apply the edit to the live policies of the repositories and record the statements added or removed in
+// the ledger, with the entries built by entry. The results are recorded as the given operation
+// It returns the exit code of the command
+func runBreakGlass(logger *zap.Logger, repositories *repositories, operation summary.Operation, title string, edit ecrupdater.BreakGlassEdit,
+	entry func(r ecrupdater.BreakGlassResult, sid string) ledger.Entry) int {
+	results := summary.NewCollector()
+	clients := newClientFactory(logger, repositories.targets, results)
+	jobs := repositories.jobs(clients)
+
+	ctx, stop, cancel := runContext(logger)
+	defer cancel()
+
+	// Abort before any change if the callers are not the expected ones or miss a permission
+	if appconfig.Config.Preflight.Enabled {
+		if !preflight(logger, ecrupdater.PreflightJobs(ctx, jobs, appconfig.Config.Run.Workers, appconfig.Config.Preflight.ExpectedAccounts)) {
+			return exitFailed
+		}
+	}
+
+	// Save the current policies before changing them
+	if !initBackup(logger, repositories, jobs) {
+		return exitFailed
+	}
+
+	entries := []ledger.Entry{}
+	for _, r := range ecrupdater.RunBreakGlassJobs(ctx, stop, jobs, appconfig.Config.Run.Workers, operation, edit) {
+		for _, sid := range r.Sids {
+			entries = append(entries, entry(r, sid))
+		}
+	}
+
+	code := exitOK
+	if len(entries) > 0 {
+		if err := ledger.New(appconfig.Config.BreakGlass.LedgerFile).Append(entries...); err != nil {
+			logger.Error(fmt.Sprintf("Error: the live policies were changed, but cannot be recorded in the break-glass ledger: %v", err))
+			code = exitFailed
+		} else {
+			logger.Info(fmt.Sprintf("%d break-glass statement(s) recorded in %s", len(entries), appconfig.Config.BreakGlass.LedgerFile))
+		}
+	}
+
+	if !summarize(ctx, logger, results, operation, title) {
+		return exitFailed
+	}
+	return code
+}
+
+// parseGrant returns the actions of the grant flags, or an error if any flag is missing or invalid
+// The duration must not exceed maxDuration
+func parseGrant(s grantSettings, maxDuration time.Duration) ([]string, error) {
+	switch {
+	case s.repository == "":
+		return nil, errors.New("--repository must be set")
+	case !breakGlassPrincipalRegexp.MatchString(s.principal):
+		return nil, fmt.Errorf("--principal must be an account ID or an IAM ARN without wildcard, got %q", s.principal)
+	case s.duration <= 0:
+		return nil, errors.New("--duration must be set and greater than 0")
+	case s.duration > maxDuration:
+		return nil, fmt.Errorf("--duration must be at most %v, got %v", maxDuration, s.duration)
+	case strings.TrimSpace(s.reason) == "":
+		return nil, errors.New("--reason must be set")
+	}
+	return parseActions(s.actions)
+}
+
+// parseActions returns the ECR actions of a comma separated list of actions and of the pull and push presets, without duplicates
+func parseActions(list string) ([]string, error) {
+	actions := []string{}
+	seen := make(map[string]bool)
+	add := func(a string) {
+		if !seen[strings.ToLower(a)] {
+			seen[strings.ToLower(a)] = true
+			actions = append(actions, a)
+		}
+	}
+	for _, a := range strings.Split(list, ",") {
+		a = strings.TrimSpace(a)
+		switch {
+		case a == "pull":
+			for _, p := range configuration.PullActions {
+				add(p)
+			}
+		case a == "push":
+			for _, p := range configuration.PushActions {
+				add(p)
+			}
+		case strings.HasPrefix(strings.ToLower(a), "ecr:") && len(a) > len("ecr:"):
+			add(a)
+		default:
+			return nil, fmt.Errorf("--actions must be pull, push or ECR actions like ecr:DescribeImages, got %q", a)
+		}
+	}
+	return actions, nil
+}
+
+// keepPrivate will drop the public repositories, and the private ones not named name unless name is empty
+// It returns the number of repositories kept, in all their locations
+func (r *repositories) keepPrivate(name string) int {
+	for l, configs := range r.configs {
+		kept := []configuration.ConfigurationFile{}
+		for _, c := range configs {
+			if !c.IsPublic() && (name == "" || c.RepositoryName == name) {
+				kept = append(kept, c)
+			}
+		}
+		if len(kept) == 0 {
+			delete(r.configs, l)
+			continue
+		}
+		r.configs[l] = kept
+	}
+	return r.count()
+}
+
+// ledgerEntry returns the ledger entry of a statement added or removed by a break-glass edit
+func ledgerEntry(r ecrupdater.BreakGlassResult, sid string, event ledger.Event, expires time.Time) ledger.Entry {
+	return ledger.Entry{
+		Time:       time.Now().UTC(),
+		Event:      event,
+		User:       currentUser(),
+		Repository: r.Record.Repository,
+		Registry:   r.Record.Registry,
+		Target:     r.Record.TargetName,
+		Account:    r.Record.Account,
+		Region:     r.Record.Region,
+		Sid:        sid,
+		Expires:    expires.UTC(),
+	}
+}
+
+// currentUser returns the name of the local user running the command, empty if unknown
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
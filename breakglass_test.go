@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/ecrupdater"
+	"github.com/lescactus/ecr-go/ledger"
+	"github.com/lescactus/ecr-go/summary"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGrant(t *testing.T) {
+	valid := grantSettings{repository: "app", principal: "arn:aws:iam::111111111111:role/oncall", actions: "pull", duration: 2 * time.Hour, reason: "INC-1234"}
+
+	tests := []struct {
+		desc    string
+		edit    func(s *grantSettings)
+		want    []string
+		wantErr string
+	}{
+		{
+			desc: "Pull",
+			edit: func(s *grantSettings) {},
+			want: configuration.PullActions,
+		},
+		{
+			desc: "Pull, push and an ECR action, without duplicates",
+			edit: func(s *grantSettings) { s.actions = "pull, push,ecr:DescribeImages,ecr:BatchGetImage" },
+			want: []string{"ecr:BatchCheckLayerAvailability", "ecr:BatchGetImage", "ecr:GetDownloadUrlForLayer", "ecr:CompleteLayerUpload",
+				"ecr:InitiateLayerUpload", "ecr:PutImage", "ecr:UploadLayerPart", "ecr:DescribeImages"},
+		},
+		{
+			desc: "Account ID",
+			edit: func(s *grantSettings) { s.principal = "111111111111" },
+			want: configuration.PullActions,
+		},
+		{
+			desc:    "Missing repository",
+			edit:    func(s *grantSettings) { s.repository = "" },
+			wantErr: "--repository must be set",
+		},
+		{
+			desc:    "Wildcard principal",
+			edit:    func(s *grantSettings) { s.principal = "arn:aws:iam::111111111111:role/*" },
+			wantErr: `--principal must be an account ID or an IAM ARN without wildcard, got "arn:aws:iam::111111111111:role/*"`,
+		},
+		{
+			desc:    "Missing duration",
+			edit:    func(s *grantSettings) { s.duration = 0 },
+			wantErr: "--duration must be set and greater than 0",
+		},
+		{
+			desc:    "Duration too long",
+			edit:    func(s *grantSettings) { s.duration = 24 * time.Hour },
+			wantErr: "--duration must be at most 12h0m0s, got 24h0m0s",
+		},
+		{
+			desc:    "Missing reason",
+			edit:    func(s *grantSettings) { s.reason = " " },
+			wantErr: "--reason must be set",
+		},
+		{
+			desc:    "Unknown action",
+			edit:    func(s *grantSettings) { s.actions = "pull,delete" },
+			wantErr: `--actions must be pull, push or ECR actions like ecr:DescribeImages, got "delete"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			s := valid
+			test.edit(&s)
+			got, err := parseGrant(s, 12*time.Hour)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestKeepPrivate(t *testing.T) {
+	eu := location{region: "eu-west-1"}
+	us := location{region: "us-east-1"}
+	public := location{region: configuration.PublicRegion, public: true}
+	r := &repositories{configs: map[location][]configuration.ConfigurationFile{
+		eu:     {{RepositoryName: "app"}, {RepositoryName: "tools"}},
+		us:     {{RepositoryName: "tools"}},
+		public: {{RepositoryName: "app", Type: configuration.RepositoryTypePublic}},
+	}}
+
+	assert.Equal(t, 1, r.keepPrivate("app"))
+	assert.Equal(t, map[location][]configuration.ConfigurationFile{eu: {{RepositoryName: "app"}}}, r.configs)
+	assert.Equal(t, 0, r.keepPrivate("tools"))
+}
+
+func TestLedgerEntry(t *testing.T) {
+	r := ecrupdater.BreakGlassResult{
+		Record: summary.Record{Repository: "app", Registry: "111111111111", TargetName: "prod", Account: "111111111111", Region: "eu-west-1"},
+		Sids:   []string{"BreakGlass20261019T143000Z"},
+	}
+	expires := time.Date(2026, 10, 19, 16, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+
+	e := ledgerEntry(r, r.Sids[0], ledger.EventRevoke, expires)
+	assert.False(t, e.Time.IsZero())
+	e.Time = time.Time{}
+	assert.Equal(t, ledger.Entry{
+		Event:      ledger.EventRevoke,
+		User:       currentUser(),
+		Repository: "app",
+		Registry:   "111111111111",
+		Target:     "prod",
+		Account:    "111111111111",
+		Region:     "eu-west-1",
+		Sid:        "BreakGlass20261019T143000Z",
+		Expires:    time.Date(2026, 10, 19, 14, 30, 0, 0, time.UTC),
+	}, e)
+}
+
+func TestGrantCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grant")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	policy := filepath.Join(dir, "app.json")
+	assert.NoError(t, ioutil.WriteFile(policy, []byte(`{"Version":"2008-10-17","Statement":[]}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.yaml"), []byte("repositoryName: app\nrepositoryPolicyFile: "+policy+"\n"), 0644))
+	ledgerFile := filepath.Join(dir, "ledger.jsonl")
+
+	tests := []struct {
+		desc string
+		args []string
+		code int
+	}{
+		{
+			desc: "Dry run",
+			args: []string{"grant", "--repository", "app", "--principal", "111111111111", "--duration", "1h", "--reason", "INC-1234", "--dry-run"},
+			code: exitOK,
+		},
+		{
+			desc: "Unknown repository",
+			args: []string{"grant", "--repository", "web", "--principal", "111111111111", "--duration", "1h", "--reason", "INC-1234", "--dry-run"},
+			code: exitFailed,
+		},
+		{
+			desc: "Duration above the maximum",
+			args: []string{"grant", "--repository", "app", "--principal", "111111111111", "--duration", "2h", "--reason", "INC-1234", "--break-glass-max-duration", "1h"},
+			code: exitUsage,
+		},
+		{
+			desc: "Missing reason",
+			args: []string{"grant", "--repository", "app", "--principal", "111111111111", "--duration", "1h"},
+			code: exitUsage,
+		},
+		{
+			desc: "Revoke dry run",
+			args: []string{"revoke-expired", "--dry-run"},
+			code: exitOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append(test.args, "--config-dir", dir, "--break-glass-ledger", ledgerFile), &stdout, &stderr)
+			assert.Equal(t, test.code, code)
+
+			// Nothing is recorded without change
+			_, err := os.Stat(ledgerFile)
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+
+	appconfig.Init(appconfig.Sources{})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/ecrupdater"
+	"github.com/lescactus/ecr-go/summary"
+	"go.uber.org/zap"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// location is a region of an account of a target, for either the ECR or the ECR Public repositories
+// The empty target is the default AWS session, the empty account is the account of the credentials of the target,
+// the empty region is the region of the target
+type location struct {
+	target  string
+	account string
+	region  string
+	public  bool
+}
+
+// String returns the name of the location in the logs
+func (l location) String() string {
+	account := l.account
+	if account == "" {
+		account = "default"
+	}
+	s := fmt.Sprintf("account %s, region %s", account, l.regionName())
+	if l.public {
+		s = fmt.Sprintf("%s, public", s)
+	}
+	if l.target != "" {
+		s = fmt.Sprintf("target %s, %s", l.target, s)
+	}
+	return s
+}
+
+// regionName returns the name of the region of the location in the logs
+func (l location) regionName() string {
+	if l.region == "" {
+		return "default"
+	}
+	return l.region
+}
+
+// sortLocations will sort the locations by target, account, region and type
+func sortLocations(locations []location) {
+	sort.Slice(locations, func(i, j int) bool {
+		if locations[i].target != locations[j].target {
+			return locations[i].target < locations[j].target
+		}
+		if locations[i].account != locations[j].account {
+			return locations[i].account < locations[j].account
+		}
+		if locations[i].region != locations[j].region {
+			return locations[i].region < locations[j].region
+		}
+		return !locations[i].public && locations[j].public
+	})
+}
+
+// registryName returns the name of the registry in the logs
+func registryName(registry string) string {
+	if registry == "" {
+		return "default"
+	}
+	return registry
+}
+
+// sortedAccounts returns the accounts sorted by ID
+func sortedAccounts(accounts map[string]configuration.Account) []configuration.Account {
+	l := make([]configuration.Account, 0, len(accounts))
+	for _, a := range accounts {
+		l = append(l, a)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].ID < l[j].ID })
+	return l
+}
+
+// clientFactory builds the ECRUpdaterClients of a run, one per location
+// The AWS session and the assumed roles credentials of a target are shared by all its clients, and the rate limiters of
+// an account and region by all the clients calling its API quota
+type clientFactory struct {
+	logger   *zap.Logger
+	targets  configuration.Targets
+	results  *summary.Collector
+	sessions map[string]*session.Session
+	roles    map[string]*ecrupdater.RoleCredentials
+	limiters map[location]rateLimiters
+}
+
+// rateLimiters are the read and write rate limiters of an API quota
+type rateLimiters struct {
+	read  *ecrupdater.RateLimiter
+	write *ecrupdater.RateLimiter
+}
+
+// newClientFactory instanciate a clientFactory of the given targets
+// The results of all the clients are recorded in the given collector
+func newClientFactory(logger *zap.Logger, targets configuration.Targets, results *summary.Collector) *clientFactory {
+	return &clientFactory{
+		logger:   logger,
+		targets:  targets,
+		results:  results,
+		sessions: make(map[string]*session.Session),
+		roles:    make(map[string]*ecrupdater.RoleCredentials),
+		limiters: make(map[location]rateLimiters),
+	}
+}
+
+// rateLimiters returns the rate limiters of the API quota of the given account and region, for either ECR or ECR Public
+// The account of the credentials of a target is not known: its quota is the one of the target
+func (f *clientFactory) rateLimiters(target, account, region string, public bool) rateLimiters {
+	quota := location{account: account, region: region, public: public}
+	if account == "" {
+		quota.target = target
+	}
+	if l, ok := f.limiters[quota]; ok {
+		return l
+	}
+	l := rateLimiters{
+		read:  ecrupdater.NewRateLimiter(appconfig.Config.RateLimit.ReadRate, appconfig.Config.RateLimit.Burst),
+		write: ecrupdater.NewRateLimiter(appconfig.Config.RateLimit.WriteRate, appconfig.Config.RateLimit.Burst),
+	}
+	f.limiters[quota] = l
+	return l
+}
+
+// session returns the AWS session of the given target, using its profile and region
+// The empty target is the default AWS session
+func (f *clientFactory) session(target string) *session.Session {
+	if s, ok := f.sessions[target]; ok {
+		return s
+	}
+
+	t := f.targets[target]
+	opts := session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Profile:           t.Profile,
+	}
+	if t.Region != "" {
+		opts.Config.Region = aws.String(t.Region)
+	}
+	s := session.Must(session.NewSessionWithOptions(opts))
+
+	f.sessions[target] = s
+	f.roles[target] = ecrupdater.NewRoleCredentials(s)
+	return s
+}
+
+// client will instanciate an ECRUpdaterClient of the given location from the application configuration
+// The role of the account is assumed, a nil account meaning the credentials of the target.
+// The ECR endpoint of the target is used if set. ECR Public clients always use the ECR Public endpoint of its only region
+func (f *clientFactory) client(l location, account *configuration.Account) *ecrupdater.ECRUpdaterClient {
+	awssession := f.session(l.target)
+	logger := f.logger
+	if l.target != "" {
+		logger = logger.With(zap.String("target", l.target))
+	}
+
+	cfg := f.config(l, account)
+	accountID := ""
+	if account != nil {
+		accountID = account.ID
+		logger = logger.With(zap.String("account", accountID))
+	}
+	region := aws.StringValue(cfg.Region)
+	if region == "" {
+		region = aws.StringValue(awssession.Config.Region)
+	}
+	if region != "" {
+		logger = logger.With(zap.String("region", region))
+	}
+
+	limiters := f.rateLimiters(l.target, accountID, region, l.public)
+	e := &ecrupdater.ECRUpdaterClient{
+		Target:  l.target,
+		Account: accountID,
+		Region:  region,
+		Summary: f.results,
+		Logger:  logger,
+		Retry: ecrupdater.RetryPolicy{
+			MaxAttempts: appconfig.Config.Retry.MaxAttempts,
+			BaseDelay:   appconfig.Config.Retry.BaseDelay,
+			MaxDelay:    appconfig.Config.Retry.MaxDelay,
+		},
+		CallTimeout:   appconfig.Config.Run.CallTimeout,
+		ManagedPrefix: appconfig.Config.Policy.ManagedSidPrefix,
+	}
+	// The identity is checked with the credentials of the client, on the STS endpoint of the target or of its region
+	// A custom ECR endpoint without STS endpoint, like a local emulator, cannot be checked against the STS of AWS
+	if appconfig.Config.Preflight.Enabled {
+		t := f.targets[l.target]
+		stsConfig := &aws.Config{Credentials: cfg.Credentials, Region: cfg.Region}
+		if t.STSEndpointURL != "" {
+			stsConfig.Endpoint = aws.String(t.STSEndpointURL)
+		}
+		if t.STSEndpointURL == "" && t.EndpointURL != "" && !l.public {
+			logger.Warn("Identity check skipped: the target has a custom endpointUrl but no stsEndpointUrl")
+		} else {
+			e.STS = sts.New(awssession, stsConfig)
+		}
+	}
+	if l.public {
+		e.Public = ecrupdater.NewRateLimitedECRPublic(ecrpublic.New(awssession, cfg), limiters.read, limiters.write)
+		e.Logger = logger.With(zap.Bool("public", true))
+	} else {
+		e.Client = ecrupdater.NewRateLimitedECR(ecr.New(awssession, cfg), limiters.read, limiters.write)
+	}
+	e.Init()
+
+	return e
+}
+
+// config returns the AWS configuration of the ECR clients of the given location, over the session of its target
+// The SDK does not retry the calls: every attempt goes through the retries and the rate limiter of the ECRUpdaterClient
+func (f *clientFactory) config(l location, account *configuration.Account) *aws.Config {
+	cfg := &aws.Config{
+		Credentials: f.roles[l.target].Get(account),
+		MaxRetries:  aws.Int(0),
+	}
+	if endpoint := f.targets[l.target].EndpointURL; endpoint != "" && !l.public {
+		cfg.Endpoint = aws.String(endpoint)
+	}
+	region := l.region
+	if l.public {
+		region = configuration.PublicRegion
+	}
+	if region != "" {
+		cfg.Region = aws.String(region)
+	}
+	return cfg
+}
+
+// loadTargets will load the targets file of the application configuration
+// It returns no target if no targets file is set
+func loadTargets() (configuration.Targets, error) {
+	if appconfig.Config.AWS.TargetsFile == "" {
+		return configuration.Targets{}, nil
+	}
+	return configuration.LoadTargets(appconfig.Config.AWS.TargetsFile)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/ecrupdater"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestSortLocations(t *testing.T) {
+	locations := []location{
+		{account: "222222222222", region: "eu-west-1"},
+		{target: "local", region: "us-east-1"},
+		{account: "", region: "us-east-1", public: true},
+		{account: "", region: "us-east-1"},
+		{account: "111111111111", region: "us-east-1"},
+		{account: "111111111111", region: ""},
+	}
+	sortLocations(locations)
+
+	assert.Equal(t, []location{
+		{account: "", region: "us-east-1"},
+		{account: "", region: "us-east-1", public: true},
+		{account: "111111111111", region: ""},
+		{account: "111111111111", region: "us-east-1"},
+		{account: "222222222222", region: "eu-west-1"},
+		{target: "local", region: "us-east-1"},
+	}, locations)
+	assert.Equal(t, "account default, region default", location{}.String())
+	assert.Equal(t, "account 111111111111, region eu-west-1", location{account: "111111111111", region: "eu-west-1"}.String())
+	assert.Equal(t, "target local, account default, region us-east-1", location{target: "local", region: "us-east-1"}.String())
+	assert.Equal(t, "account default, region us-east-1, public", location{region: "us-east-1", public: true}.String())
+}
+
+func TestSortedAccounts(t *testing.T) {
+	accounts := map[string]configuration.Account{
+		"222222222222": {ID: "222222222222", RoleArn: "arn:aws:iam::222222222222:role/ecr-go"},
+		"111111111111": {ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go"},
+	}
+
+	assert.Equal(t, []configuration.Account{accounts["111111111111"], accounts["222222222222"]}, sortedAccounts(accounts))
+	assert.Empty(t, sortedAccounts(nil))
+}
+
+func TestRegistryName(t *testing.T) {
+	assert.Equal(t, "default", registryName(""))
+	assert.Equal(t, "111111111111", registryName("111111111111"))
+}
+
+func TestClientFactory(t *testing.T) {
+	targets := configuration.Targets{
+		"local": {Region: "us-east-1", EndpointURL: "http://localhost:4566"},
+	}
+	f := newClientFactory(zap.NewNop(), targets, nil)
+
+	e := f.client(location{target: "local"}, nil)
+	assert.Equal(t, "local", e.Target)
+	assert.Equal(t, "us-east-1", e.Region)
+	assert.Empty(t, e.Account)
+
+	e = f.client(location{target: "local", region: "eu-west-1"}, nil)
+	assert.Equal(t, "eu-west-1", e.Region)
+	assert.Len(t, f.sessions, 1, "the session of a target is shared by its clients")
+
+	e = f.client(location{target: "local", region: "eu-west-1", public: true}, nil)
+	assert.Equal(t, "us-east-1", e.Region, "ECR Public is only available in us-east-1")
+	assert.NotNil(t, e.Public)
+}
+
+func TestClientFactorySTS(t *testing.T) {
+	targets := configuration.Targets{
+		"local":    {Region: "us-east-1", EndpointURL: "http://localhost:4566"},
+		"emulated": {Region: "us-east-1", EndpointURL: "http://localhost:4566", STSEndpointURL: "http://localhost:4566"},
+		"prod":     {Region: "us-east-1"},
+	}
+	f := newClientFactory(zap.NewNop(), targets, nil)
+
+	e := f.client(location{target: "local"}, nil)
+	assert.Nil(t, e.STS, "the identity cannot be checked without the STS endpoint of the custom endpoint")
+
+	e = f.client(location{target: "local", public: true}, nil)
+	assert.NotNil(t, e.STS, "ECR Public does not use the custom endpoint")
+
+	e = f.client(location{target: "emulated"}, nil)
+	if assert.NotNil(t, e.STS) {
+		assert.Equal(t, "http://localhost:4566", e.STS.(*sts.STS).Endpoint)
+	}
+
+	e = f.client(location{target: "prod"}, nil)
+	if assert.NotNil(t, e.STS) {
+		assert.Equal(t, "https://sts.amazonaws.com", e.STS.(*sts.STS).Endpoint)
+	}
+}
+
+func TestClientFactoryRateLimiters(t *testing.T) {
+	targets := configuration.Targets{
+		"local": {Region: "us-east-1", EndpointURL: "http://localhost:4566"},
+		"ci":    {Region: "us-east-1", EndpointURL: "http://localhost:4566"},
+	}
+	f := newClientFactory(zap.NewNop(), targets, nil)
+	account := &configuration.Account{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go"}
+
+	limiter := func(e *ecrupdater.ECRUpdaterClient) *ecrupdater.RateLimiter {
+		return e.Client.(*ecrupdater.RateLimitedECR).Write
+	}
+	a := f.client(location{target: "local", account: account.ID, region: "eu-west-1"}, account)
+	b := f.client(location{target: "ci", account: account.ID, region: "eu-west-1"}, account)
+	c := f.client(location{target: "local", account: account.ID, region: "us-west-2"}, account)
+	d := f.client(location{target: "ci", region: "eu-west-1"}, nil)
+
+	assert := assert.New(t)
+	assert.NotNil(limiter(a))
+	assert.Same(limiter(a), limiter(b), "the clients of an account and region share its quota")
+	assert.NotSame(limiter(a), limiter(c), "each region has its own quota")
+	assert.NotSame(limiter(b), limiter(d), "the account of the credentials of a target is not known")
+	assert.Same(a.Client.(*ecrupdater.RateLimitedECR).Read, b.Client.(*ecrupdater.RateLimitedECR).Read)
+}
+
+func TestClientFactoryConfig(t *testing.T) {
+	targets := configuration.Targets{
+		"local": {Region: "us-east-1", EndpointURL: "http://localhost:4566"},
+	}
+	f := newClientFactory(zap.NewNop(), targets, nil)
+	f.session("local")
+
+	// The SDK must not retry: the retries and the throttling are handled by the ECRUpdaterClient
+	cfg := f.config(location{target: "local", region: "eu-west-1"}, nil)
+	assert.Equal(t, 0, aws.IntValue(cfg.MaxRetries))
+	assert.Equal(t, "eu-west-1", aws.StringValue(cfg.Region))
+	assert.Equal(t, "http://localhost:4566", aws.StringValue(cfg.Endpoint))
+
+	cfg = f.config(location{target: "local", public: true}, nil)
+	assert.Equal(t, 0, aws.IntValue(cfg.MaxRetries))
+	assert.Equal(t, configuration.PublicRegion, aws.StringValue(cfg.Region))
+	assert.Nil(t, cfg.Endpoint, "ECR Public always uses its own endpoint")
+}
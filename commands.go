@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/lescactus/ecr-go/backup"
+	"github.com/lescactus/ecr-go/ecrupdater"
+	"github.com/lescactus/ecr-go/summary"
+	"go.uber.org/zap"
+)
+
+// validateCommand will load and validate all the configuration files, log their expiring grants, and check the assertions of the assertions file if any
+func validateCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	logger.Info(fmt.Sprintf("Configuration directory is set to %s", appconfig.Config.Application.ConfigDir))
+	repositories, err := loadRepositories(logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitFailed
+	}
+	warnExpiries(logger, repositories, time.Now())
+	if appconfig.Config.Policy.AssertionsFile != "" && !checkAssertions(logger, repositories) {
+		return exitFailed
+	}
+	logger.Info(fmt.Sprintf("Validation completed ... all configuration files are valid (%d repositories in %d locations)", repositories.count(), len(repositories.configs)))
+	return exitOK
+}
+
+// planCommand will show the change the apply command would make to each repository
+func planCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	changes, code := plan(logger)
+	if changes == nil {
+		return code
+	}
+
+	counts := make(map[ecrupdater.Action]int)
+	for _, c := range changes {
+		counts[c.Action]++
+		fmt.Fprintf(out, "  %s\n", c)
+	}
+	fmt.Fprintf(out, "\nPlan: %d to create, %d to update, %d to delete, %d unchanged, %d errors\n", counts[ecrupdater.ActionCreate], counts[ecrupdater.ActionUpdate],
+		counts[ecrupdater.ActionDelete], counts[ecrupdater.ActionUnchanged], counts[ecrupdater.ActionError])
+	return code
+}
+
+// diffCommand will show the difference between the current and the configured policy of each repository to change
+func diffCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	changes, code := plan(logger)
+	for _, c := range changes {
+		if c.Action == ecrupdater.ActionUnchanged {
+			continue
+		}
+		fmt.Fprintf(out, "%s\n", c)
+		if c.Action == ecrupdater.ActionError {
+			continue
+		}
+		for _, line := range c.Diff() {
+			fmt.Fprintf(out, "%s\n", line)
+		}
+		fmt.Fprintln(out)
+	}
+	return code
+}
+
+// plan will compute the changes of all the configured repositories, without making any, after logging their expiring grants
+// It returns the changes, nil if the configuration cannot be loaded, and the exit code of the command
+func plan(logger *zap.Logger) ([]ecrupdater.Change, int) {
+	repositories, err := loadRepositories(logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return nil, exitFailed
+	}
+	warnExpiries(logger, repositories, time.Now())
+
+	clients := newClientFactory(logger, repositories.targets, summary.NewCollector())
+	jobs := repositories.jobs(clients)
+
+	ctx, stop, cancel := runContext(logger)
+	defer cancel()
+
+	changes := ecrupdater.PlanJobs(ctx, stop, jobs, appconfig.Config.Run.Workers)
+	for _, c := range changes {
+		if c.Action == ecrupdater.ActionError {
+			return changes, exitFailed
+		}
+	}
+	return changes, exitOK
+}
+
+// applyCommand will update the policies of all the configured repositories
+func applyCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	logger.Info(fmt.Sprintf("Staring %s v%s", appconfig.Config.Application.Name, appconfig.Config.Application.Version))
+	logger.Info(fmt.Sprintf("Configuration directory is set to %s", appconfig.Config.Application.ConfigDir))
+	logger.Info(fmt.Sprintf("Running in dry-mode: %v", appconfig.Config.Application.DryRun))
+
+	repositories, err := loadRepositories(logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitFailed
+	}
+
+	// Skip the ECR update if in dry run mode
+	if appconfig.Config.Application.DryRun {
+		logger.Info("Dry-run completed ... all configuration files are valid")
+		return exitOK
+	}
+
+	logger.Info(fmt.Sprintf("Running in transactional mode: %v", appconfig.Config.Run.Transactional))
+
+	// One ECR client per location, all sharing the same summary
+	results := summary.NewCollector()
+	clients := newClientFactory(logger, repositories.targets, results)
+	jobs := repositories.jobs(clients)
+
+	ctx, stop, cancel := runContext(logger)
+	defer cancel()
+
+	// Abort before any change if the callers are not the expected ones or miss a permission
+	if appconfig.Config.Preflight.Enabled {
+		if !preflight(logger, ecrupdater.PreflightJobs(ctx, jobs, appconfig.Config.Run.Workers, appconfig.Config.Preflight.ExpectedAccounts)) {
+			return exitFailed
+		}
+	}
+
+	// Save the current policies before overwriting them
+	if !initBackup(logger, repositories, jobs) {
+		return exitFailed
+	}
+
+	// Update the ECR repositories policies
+	ecrupdater.RunJobs(ctx, stop, jobs, appconfig.Config.Run.Workers, appconfig.Config.Run.Transactional)
+
+	if !summarize(ctx, logger, results, summary.OperationUpdate, "update") {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// initBackup will create the backup of the run and set it on the clients of the jobs, if BACKUP_DIR is set
+// It returns false if the backup cannot be created
+func initBackup(logger *zap.Logger, repositories *repositories, jobs []ecrupdater.Job) bool {
+	if appconfig.Config.Backup.Dir == "" {
+		return true
+	}
+	store := backup.NewDirStore(appconfig.Config.Backup.Dir)
+	backupID := backup.NewID(time.Now())
+	if err := store.Init(backup.Metadata{
+		ID:          backupID,
+		CreatedAt:   time.Now().UTC(),
+		Application: appconfig.Config.Application.Name,
+		Version:     appconfig.Config.Application.Version,
+		ConfigDir:   appconfig.Config.Application.ConfigDir,
+		Accounts:    sortedAccounts(repositories.accounts),
+	}); err != nil {
+		logger.Error(fmt.Sprintf("Error: cannot initialize the backup: %v", err))
+		return false
+	}
+	logger.Info(fmt.Sprintf("Current policies are saved in backup %s of %s", backupID, appconfig.Config.Backup.Dir))
+
+	for _, j := range jobs {
+		j.Client.Backup = store
+		j.Client.BackupID = backupID
+	}
+	return true
+}
+
+// restoreCommand will restore the policies of the given backup, for all or the selected repositories
+// Without backup ID, it lists the available backups
+func restoreCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	if appconfig.Config.Backup.Dir == "" {
+		logger.Error("Error: BACKUP_DIR must be set to restore a backup")
+		return exitUsage
+	}
+	store := backup.NewDirStore(appconfig.Config.Backup.Dir)
+
+	if len(args) == 0 {
+		backups, err := store.List()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error: cannot list the backups: %v", err))
+			return exitFailed
+		}
+		logger.Info(fmt.Sprintf("Available backups in %s: %d", appconfig.Config.Backup.Dir, len(backups)))
+		for _, b := range backups {
+			logger.Info(fmt.Sprintf("\t- %s (created at %v by %s v%s from %s)", b.ID, b.CreatedAt.Format(time.RFC3339), b.Application, b.Version, b.ConfigDir))
+		}
+		logger.Info("Usage: ecr-go restore <backup ID> [repository ...]")
+		return exitOK
+	}
+
+	metadata, entries, err := store.Load(args[0])
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitFailed
+	}
+	entries, err = backup.Select(entries, args[1:])
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitFailed
+	}
+	logger.Info(fmt.Sprintf("Restoring %d repositories from backup %s", len(entries), args[0]))
+
+	if appconfig.Config.Application.DryRun {
+		for _, entry := range entries {
+			logger.Info(fmt.Sprintf("\t- %s (had a policy: %v)", entry.RepositoryName, entry.Exists))
+		}
+		logger.Info("Dry-run completed ... no policy restored")
+		return exitOK
+	}
+
+	// Entries are restored in the location they were saved from
+	entriesByLocation := make(map[location][]backup.Entry)
+	for _, entry := range entries {
+		l := location{target: entry.Target, account: entry.Account, region: entry.Region, public: entry.Public}
+		entriesByLocation[l] = append(entriesByLocation[l], entry)
+	}
+
+	targets, err := loadTargets()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: cannot load the targets: %v", err))
+		return exitFailed
+	}
+	results := summary.NewCollector()
+	clients := newClientFactory(logger, targets, results)
+	locations := []location{}
+	for l := range entriesByLocation {
+		locations = append(locations, l)
+	}
+	sortLocations(locations)
+
+	jobs := []ecrupdater.RestoreJob{}
+	for _, l := range locations {
+		if _, ok := targets[l.target]; !ok && l.target != "" {
+			logger.Error(fmt.Sprintf("Error: target %s of backup %s not found in the targets file", l.target, args[0]))
+			return exitFailed
+		}
+		account := metadata.Account(l.account)
+		if account == nil && l.account != "" {
+			logger.Error(fmt.Sprintf("Error: account %s not found in the metadata of backup %s", l.account, args[0]))
+			return exitFailed
+		}
+		jobs = append(jobs, ecrupdater.RestoreJob{
+			Client:  clients.client(l, account),
+			Entries: entriesByLocation[l],
+		})
+	}
+
+	ctx, stop, cancel := runContext(logger)
+	defer cancel()
+
+	if appconfig.Config.Preflight.Enabled {
+		if !preflight(logger, ecrupdater.PreflightRestoreJobs(ctx, jobs, appconfig.Config.Run.Workers, appconfig.Config.Preflight.ExpectedAccounts)) {
+			return exitFailed
+		}
+	}
+
+	ecrupdater.RunRestoreJobs(ctx, stop, jobs, appconfig.Config.Run.Workers)
+
+	if !summarize(ctx, logger, results, summary.OperationRestore, "restoration") {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// versionCommand will print the name and the version of the application
+func versionCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	fmt.Fprintf(out, "%s v%s\n", appconfig.Config.Application.Name, appconfig.Config.Application.Version)
+	return exitOK
+}
@@ -0,0 +1,302 @@
+package configuration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lescactus/ecr-go/policy"
+)
+
+// Actions of the statements generated by the access presets: the ones of the pull and push permissions of the access
+// report, and BatchCheckLayerAvailability
+var (
+	PullActions = policy.GrantedActions(policy.PermissionPull, false)
+	PushActions = policy.GrantedActions(policy.PermissionPush, false)
+	// LambdaPullActions are the actions the Lambda service needs to create functions from the images of the repository,
+	// the ones of the pull permission only
+	LambdaPullActions = policy.Actions(policy.PermissionPull, false)
+)
+
+// LambdaService is the service principal of the statements generated by lambdaPull
+const LambdaService = "lambda.amazonaws.com"
+
+// Access are the access presets of a repository, expanded in standard statements merged with its policy
+// The principals are account IDs, ARNs, or account:<name> and group:<name> aliases. The ones of pull and push can also be
+// the accounts of an organization, as org:<organization ID>, or of an organizational unit, as ou:<organizational unit ID>
+// A principal can be given an expiry, after which it is dropped from the preset
+type Access struct {
+	Pull       []AccessPrincipal `yaml:"pull"`       // Principals allowed to pull the images
+	Push       []AccessPrincipal `yaml:"push"`       // Principals allowed to push images
+	LambdaPull []AccessPrincipal `yaml:"lambdaPull"` // Accounts whose Lambda functions can be created from the images
+}
+
+// AccessPrincipal is a principal of an access preset, written as a string, or as an object with the expiry of its access
+type AccessPrincipal struct {
+	Principal string `yaml:"principal"`
+	Expires   string `yaml:"expires"` // Expiry of the access, in RFC 3339 like 2026-12-31T00:00:00Z. Empty means it does not expire
+}
+
+// UnmarshalYAML will read a principal written as a string or as an object
+func (p *AccessPrincipal) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*p = AccessPrincipal{Principal: s}
+		return nil
+	}
+	type plain AccessPrincipal
+	return unmarshal((*plain)(p))
+}
+
+// accessPrincipals returns the principals of the entries of a preset
+func accessPrincipals(entries []AccessPrincipal) []string {
+	l := make([]string, len(entries))
+	for i, e := range entries {
+		l[i] = e.Principal
+	}
+	return l
+}
+
+// preset is an access preset, with the Sid of its statement
+type preset struct {
+	name       string
+	sid        string
+	entries    []AccessPrincipal
+	principals []string
+}
+
+// presets returns the presets of the access with principals, in the order of their statements
+func (a *Access) presets() []preset {
+	all := []preset{
+		{name: "pull", sid: "AccessPull", entries: a.Pull},
+		{name: "push", sid: "AccessPush", entries: a.Push},
+		{name: "lambdaPull", sid: "AccessLambdaPull", entries: a.LambdaPull},
+	}
+	l := []preset{}
+	for _, p := range all {
+		if len(p.entries) > 0 {
+			p.principals = accessPrincipals(p.entries)
+			l = append(l, p)
+		}
+	}
+	return l
+}
+
+// Active returns the access without the principals expired at now, and the expiries of the principals
+// It returns an error if a principal matching any of the required globs has no expiry
+func (a *Access) Active(now time.Time, required []string) (*Access, []Expiry, error) {
+	active := &Access{}
+	var expiries []Expiry
+	for _, p := range a.presets() {
+		kept := []AccessPrincipal{}
+		for _, e := range p.entries {
+			if e.Expires == "" {
+				if _, ok := requiresExpiry([]string{e.Principal}, required); ok {
+					return nil, nil, fmt.Errorf("the %s access of %s has no expiry, which it requires", p.name, e.Principal)
+				}
+				kept = append(kept, e)
+				continue
+			}
+			expires, err := parseExpiry(e.Expires)
+			if err != nil {
+				return nil, nil, fmt.Errorf("the %s access of %s: %v", p.name, e.Principal, err)
+			}
+			x := Expiry{Grant: fmt.Sprintf("%s access of %s", p.name, e.Principal), Expires: expires}
+			expiries = append(expiries, x)
+			if !x.Expired(now) {
+				kept = append(kept, AccessPrincipal{Principal: e.Principal})
+			}
+		}
+		switch p.name {
+		case "pull":
+			active.Pull = kept
+		case "push":
+			active.Push = kept
+		case "lambdaPull":
+			active.LambdaPull = kept
+		}
+	}
+	return active, expiries, nil
+}
+
+var (
+	// principalRegexp matches the principals of the pull and push presets: account IDs, ARNs and aliases
+	principalRegexp = regexp.MustCompile(`^([0-9]{12}|arn:.+|(account|group):.+)$`)
+	// OrganizationRegexp and UnitRegexp match the IDs of an organization and of an organizational unit
+	OrganizationRegexp = regexp.MustCompile(`^o-[a-z0-9]{10,32}$`)
+	UnitRegexp         = regexp.MustCompile(`^ou-[0-9a-z]{4,32}-[a-z0-9]{8,32}$`)
+)
+
+// Prefixes of the organizations and organizational units in the principals of the pull and push presets
+const (
+	OrganizationPrefix = "org:"
+	UnitPrefix         = "ou:"
+)
+
+// validate returns an error if a principal of a preset is invalid
+func (a *Access) validate() error {
+	for _, p := range a.presets() {
+		for _, principal := range p.principals {
+			switch {
+			case p.name == "lambdaPull" && !accountIDRegexp.MatchString(principal) && !aliasRegexp.MatchString(principal):
+				return fmt.Errorf("Access lambdaPull must be account IDs or account:<name> and group:<name> aliases, got %q", principal)
+			case strings.HasPrefix(principal, OrganizationPrefix):
+				if !OrganizationRegexp.MatchString(strings.TrimPrefix(principal, OrganizationPrefix)) {
+					return fmt.Errorf("Access %s organization must be org:o-<10 to 32 lowercase letters or digits>, got %q", p.name, principal)
+				}
+			case strings.HasPrefix(principal, UnitPrefix):
+				if !UnitRegexp.MatchString(strings.TrimPrefix(principal, UnitPrefix)) {
+					return fmt.Errorf("Access %s organizational unit must be ou:ou-<root ID>-<unit ID>, got %q", p.name, principal)
+				}
+			case !principalRegexp.MatchString(principal):
+				return fmt.Errorf("Access %s must be account IDs, ARNs, account:<name> and group:<name> aliases, org:<organization ID> or ou:<organizational unit ID>, got %q", p.name, principal)
+			}
+		}
+	}
+	return nil
+}
+
+// emptyPolicy is the policy of a repository with access presets and without policy file
+const emptyPolicy = `{"Version":"2008-10-17","Statement":[]}`
+
+// Statements returns the policy with the statements of the access presets appended, with the Sids prefixed by sidPrefix
+// The lambdaPull accounts are resolved with the aliases, the other principals are left to Expand
+// It returns an error if the policy already has a statement with the Sid of a preset, or if an alias is unknown
+func (a *Access) Statements(policy []byte, aliases *AccountAliases, sidPrefix string) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(policy))
+	d.UseNumber()
+	var doc map[string]interface{}
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	statements := []interface{}{}
+	switch s := doc["Statement"].(type) {
+	case []interface{}:
+		statements = s
+	case map[string]interface{}:
+		statements = []interface{}{s}
+	case nil:
+	default:
+		return nil, errors.New("Statement must be an object or a list of objects")
+	}
+	sids := make(map[string]bool)
+	for _, s := range statements {
+		if m, ok := s.(map[string]interface{}); ok {
+			if sid, ok := m["Sid"].(string); ok {
+				sids[strings.ToLower(sid)] = true
+			}
+		}
+	}
+
+	for _, p := range a.presets() {
+		generated, err := p.statements(sidPrefix, aliases)
+		if err != nil {
+			return nil, err
+		}
+		for _, statement := range generated {
+			if sid := statement["Sid"].(string); sids[strings.ToLower(sid)] {
+				return nil, fmt.Errorf("the Sid %s of the %s access is already used by the policy", sid, p.name)
+			}
+			statements = append(statements, statement)
+		}
+	}
+	doc["Statement"] = statements
+	return json.MarshalIndent(doc, "", "    ")
+}
+
+// statements returns the statements of the preset, with their Sid prefixed by sidPrefix
+// The principals of pull and push are granted by a statement, their organizations by a statement on any principal
+// with an aws:PrincipalOrgID condition, and their organizational units by one with an aws:PrincipalOrgPaths condition
+func (p preset) statements(sidPrefix string, aliases *AccountAliases) ([]map[string]interface{}, error) {
+	if p.name == "lambdaPull" {
+		statement, err := p.lambdaStatement(sidPrefix+p.sid, aliases)
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{statement}, nil
+	}
+
+	actions := PullActions
+	if p.name == "push" {
+		actions = PushActions
+	}
+	principals, organizations, units := []string{}, []string{}, []string{}
+	for _, principal := range p.principals {
+		switch {
+		case strings.HasPrefix(principal, OrganizationPrefix):
+			organizations = append(organizations, strings.TrimPrefix(principal, OrganizationPrefix))
+		case strings.HasPrefix(principal, UnitPrefix):
+			// The path of an organizational unit is <organization ID>/<root ID>/<parent units IDs>/<unit ID>/
+			units = append(units, fmt.Sprintf("*/%s/*", strings.TrimPrefix(principal, UnitPrefix)))
+		default:
+			principals = append(principals, principal)
+		}
+	}
+
+	statements := []map[string]interface{}{}
+	if len(principals) > 0 {
+		statements = append(statements, map[string]interface{}{
+			"Sid":       sidPrefix + p.sid,
+			"Effect":    "Allow",
+			"Principal": map[string]interface{}{"AWS": stringsValue(principals)},
+			"Action":    stringsValue(actions),
+		})
+	}
+	if len(organizations) > 0 {
+		statements = append(statements, map[string]interface{}{
+			"Sid":       sidPrefix + p.sid + "Organization",
+			"Effect":    "Allow",
+			"Principal": "*",
+			"Action":    stringsValue(actions),
+			"Condition": map[string]interface{}{"StringEquals": map[string]interface{}{"aws:PrincipalOrgID": stringsValue(organizations)}},
+		})
+	}
+	if len(units) > 0 {
+		statements = append(statements, map[string]interface{}{
+			"Sid":       sidPrefix + p.sid + "OrganizationalUnit",
+			"Effect":    "Allow",
+			"Principal": "*",
+			"Action":    stringsValue(actions),
+			"Condition": map[string]interface{}{"ForAnyValue:StringLike": map[string]interface{}{"aws:PrincipalOrgPaths": stringsValue(units)}},
+		})
+	}
+	return statements, nil
+}
+
+// lambdaStatement returns the statement of the lambdaPull preset
+func (p preset) lambdaStatement(sid string, aliases *AccountAliases) (map[string]interface{}, error) {
+	arns := []string{}
+	for _, principal := range p.principals {
+		ids := []string{principal}
+		if m := aliasRegexp.FindStringSubmatch(principal); m != nil {
+			var err error
+			if ids, err = aliases.accounts(m[1], m[2]); err != nil {
+				return nil, err
+			}
+		}
+		for _, id := range ids {
+			arns = append(arns, fmt.Sprintf("arn:%s:lambda:*:%s:function:*", aliases.partition(), id))
+		}
+	}
+	return map[string]interface{}{
+		"Sid":       sid,
+		"Effect":    "Allow",
+		"Principal": map[string]interface{}{"Service": LambdaService},
+		"Action":    stringsValue(LambdaPullActions),
+		"Condition": map[string]interface{}{"StringLike": map[string]interface{}{"aws:sourceArn": stringsValue(arns)}},
+	}, nil
+}
+
+// stringsValue returns the strings as a json list
+func stringsValue(l []string) []interface{} {
+	v := make([]interface{}, len(l))
+	for i, s := range l {
+		v[i] = s
+	}
+	return v
+}
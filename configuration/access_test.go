@@ -0,0 +1,158 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/lescactus/ecr-go/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessStatements(t *testing.T) {
+	aliases := &AccountAliases{Accounts: map[string]string{"prod": "111111111111"}}
+
+	tests := []struct {
+		desc      string
+		access    Access
+		policy    string
+		sidPrefix string
+		want      string
+		wantErr   string
+	}{
+		{
+			desc:   "Pull merged with the policy",
+			access: Access{Pull: entries("account:prod")},
+			policy: `{"Version":"2008-10-17","Statement":{"Sid":"Raw","Effect":"Deny","Principal":"*","Action":"ecr:DeleteRepository"}}`,
+			want: `{"Version":"2008-10-17","Statement":[
+				{"Sid":"Raw","Effect":"Deny","Principal":"*","Action":"ecr:DeleteRepository"},
+				{"Sid":"AccessPull","Effect":"Allow","Principal":{"AWS":["account:prod"]},"Action":["ecr:BatchCheckLayerAvailability","ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"]}
+			]}`,
+		},
+		{
+			desc:      "Push and Lambda pull, with a Sid prefix",
+			access:    Access{Push: entries("arn:aws:iam::222222222222:role/ci"), LambdaPull: entries("account:prod", "333333333333")},
+			policy:    emptyPolicy,
+			sidPrefix: "ecrgo-",
+			want: `{"Version":"2008-10-17","Statement":[
+				{"Sid":"ecrgo-AccessPush","Effect":"Allow","Principal":{"AWS":["arn:aws:iam::222222222222:role/ci"]},"Action":["ecr:BatchCheckLayerAvailability","ecr:CompleteLayerUpload","ecr:InitiateLayerUpload","ecr:PutImage","ecr:UploadLayerPart"]},
+				{"Sid":"ecrgo-AccessLambdaPull","Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"},"Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"],
+				 "Condition":{"StringLike":{"aws:sourceArn":["arn:aws:lambda:*:111111111111:function:*","arn:aws:lambda:*:333333333333:function:*"]}}}
+			]}`,
+		},
+		{
+			desc:   "Pull by an organization and an organizational unit",
+			access: Access{Pull: entries("111111111111", "org:o-a1b2c3d4e5", "ou:ou-ab12-11111111", "ou:ou-ab12-22222222")},
+			policy: emptyPolicy,
+			want: `{"Version":"2008-10-17","Statement":[
+				{"Sid":"AccessPull","Effect":"Allow","Principal":{"AWS":["111111111111"]},"Action":["ecr:BatchCheckLayerAvailability","ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"]},
+				{"Sid":"AccessPullOrganization","Effect":"Allow","Principal":"*","Action":["ecr:BatchCheckLayerAvailability","ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"],
+				 "Condition":{"StringEquals":{"aws:PrincipalOrgID":["o-a1b2c3d4e5"]}}},
+				{"Sid":"AccessPullOrganizationalUnit","Effect":"Allow","Principal":"*","Action":["ecr:BatchCheckLayerAvailability","ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"],
+				 "Condition":{"ForAnyValue:StringLike":{"aws:PrincipalOrgPaths":["*/ou-ab12-11111111/*","*/ou-ab12-22222222/*"]}}}
+			]}`,
+		},
+		{
+			desc:    "Organizational unit Sid already used",
+			access:  Access{Push: entries("ou:ou-ab12-11111111")},
+			policy:  `{"Statement":[{"Sid":"AccessPushOrganizationalUnit"}]}`,
+			wantErr: "the Sid AccessPushOrganizationalUnit of the push access is already used by the policy",
+		},
+		{
+			desc:    "Sid already used",
+			access:  Access{Pull: entries("111111111111")},
+			policy:  `{"Statement":[{"Sid":"accesspull"}]}`,
+			wantErr: "the Sid AccessPull of the pull access is already used by the policy",
+		},
+		{
+			desc:    "Unknown Lambda account",
+			access:  Access{LambdaPull: entries("account:dev")},
+			policy:  emptyPolicy,
+			wantErr: `unknown account alias "dev"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := test.access.Statements([]byte(test.policy), aliases, test.sidPrefix)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, test.want, string(got))
+		})
+	}
+}
+
+func TestLoadYamlConfigurationAccess(t *testing.T) {
+	aliases, err := LoadAccountAliases("testdata/aliases/accounts.yaml")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	c := NewConfigurationFile(Logger)
+	c.Aliases = aliases
+	if !assert.NoError(t, c.LoadYamlConfiguration("testdata/access/presets.yaml")) {
+		return
+	}
+	doc, err := policy.Parse(string(c.RepositoryPolicy))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, doc.Statements, 3)
+	assert.Equal(t, map[string][]string{"AWS": {"arn:aws:iam::111111111111:root", "arn:aws:iam::222222222222:root", "arn:aws:iam::333333333333:root"}}, doc.Statements[0].Principals)
+	assert.Equal(t, map[string][]string{"AWS": {"arn:aws:iam::111111111111:role/ci"}}, doc.Statements[1].Principals)
+	assert.Equal(t, map[string]map[string][]string{"StringLike": {"aws:sourceArn": {"arn:aws:lambda:*:111111111111:function:*"}}}, doc.Statements[2].Conditions)
+
+	c = NewConfigurationFile(Logger)
+	assert.EqualError(t, c.LoadYamlConfiguration("testdata/access/invalid_principal.yaml"), `Access push must be account IDs, ARNs, account:<name> and group:<name> aliases, org:<organization ID> or ou:<organizational unit ID>, got "role:ci"`)
+	c = NewConfigurationFile(Logger)
+	assert.EqualError(t, c.LoadYamlConfiguration("testdata/access/public.yaml"), "Access can only be set on a private repository")
+}
+
+func TestAccessValidate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		access  Access
+		wantErr string
+	}{
+		{
+			desc:   "Organization and organizational unit",
+			access: Access{Pull: entries("org:o-a1b2c3d4e5"), Push: entries("ou:ou-ab12-11111111")},
+		},
+		{
+			desc:    "Invalid organization",
+			access:  Access{Pull: entries("org:a1b2c3d4e5")},
+			wantErr: `Access pull organization must be org:o-<10 to 32 lowercase letters or digits>, got "org:a1b2c3d4e5"`,
+		},
+		{
+			desc:    "Invalid organizational unit",
+			access:  Access{Push: entries("ou:o-a1b2c3d4e5/ou-ab12-11111111")},
+			wantErr: `Access push organizational unit must be ou:ou-<root ID>-<unit ID>, got "ou:o-a1b2c3d4e5/ou-ab12-11111111"`,
+		},
+		{
+			desc:    "Organization for Lambda",
+			access:  Access{LambdaPull: entries("org:o-a1b2c3d4e5")},
+			wantErr: `Access lambdaPull must be account IDs or account:<name> and group:<name> aliases, got "org:o-a1b2c3d4e5"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := test.access.validate()
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// entries returns the entries of a preset without expiry of the principals
+func entries(principals ...string) []AccessPrincipal {
+	l := make([]AccessPrincipal, len(principals))
+	for i, p := range principals {
+		l[i] = AccessPrincipal{Principal: p}
+	}
+	return l
+}
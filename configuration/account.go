@@ -0,0 +1,105 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"gopkg.in/yaml.v2"
+)
+
+// AccountFileName is the name of the file defining the account of all the configuration files of a directory
+// and its subdirectories. It is not a repository configuration file
+const AccountFileName = "_account.yaml"
+
+// DefaultSessionName is the session name of the assumed roles when none is set
+const DefaultSessionName = "ecr-go"
+
+var accountIDRegexp = regexp.MustCompile(`^[0-9]{12}$`)
+
+// Account is the AWS account of a repository, and the IAM role assumed to manage it
+type Account struct {
+	ID          string `yaml:"id" json:"id"`
+	RoleArn     string `yaml:"roleArn" json:"roleArn"`
+	ExternalID  string `yaml:"externalId,omitempty" json:"externalId,omitempty"`
+	SessionName string `yaml:"sessionName,omitempty" json:"sessionName,omitempty"`
+}
+
+// Validate will ensure the account ID and the role ARN are valid and refer to the same account
+// It sets the default session name if none is set
+// It returns any error encountered
+func (a *Account) Validate() error {
+	if !accountIDRegexp.MatchString(a.ID) {
+		return fmt.Errorf("Account id must be a 12 digits AWS account ID, got %q", a.ID)
+	}
+	if a.RoleArn == "" {
+		return errors.New("Account roleArn must be present and not empty")
+	}
+	r, err := arn.Parse(a.RoleArn)
+	if err != nil {
+		return fmt.Errorf("Account roleArn is invalid: %v", err)
+	}
+	if r.AccountID != a.ID {
+		return fmt.Errorf("Account roleArn %s does not belong to account %s", a.RoleArn, a.ID)
+	}
+	if a.SessionName == "" {
+		a.SessionName = DefaultSessionName
+	}
+	return nil
+}
+
+// DirectoryAccounts are the accounts defined at directory level, by directory
+type DirectoryAccounts map[string]Account
+
+// LoadDirectoryAccounts will recursively look for all the account files in the root directory passed as argument
+// It returns the accounts by directory or any error encountered
+func LoadDirectoryAccounts(root string) (DirectoryAccounts, error) {
+	accounts := DirectoryAccounts{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, e error) error {
+		if e != nil {
+			return e
+		}
+		if info.IsDir() || info.Name() != AccountFileName {
+			return nil
+		}
+
+		d, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var a Account
+		if err := yaml.UnmarshalStrict(d, &a); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if err := a.Validate(); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		accounts[filepath.Dir(path)] = a
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// For returns the account of the given configuration file: the one of its directory or of the nearest parent directory
+// It returns nil if no directory defines an account
+func (d DirectoryAccounts) For(yamlFile string) *Account {
+	dir := filepath.Dir(filepath.Clean(yamlFile))
+	for {
+		if a, ok := d[dir]; ok {
+			return &a
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,94 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountValidate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		account Account
+		want    Account
+		wantErr string
+	}{
+		{
+			desc:    "Valid account, default session name",
+			account: Account{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go"},
+			want:    Account{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go", SessionName: "ecr-go"},
+		},
+		{
+			desc:    "Valid account with external ID and session name",
+			account: Account{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go", ExternalID: "secret", SessionName: "team"},
+			want:    Account{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go", ExternalID: "secret", SessionName: "team"},
+		},
+		{
+			desc:    "Invalid account ID",
+			account: Account{ID: "1111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go"},
+			wantErr: `Account id must be a 12 digits AWS account ID, got "1111"`,
+		},
+		{
+			desc:    "Missing role ARN",
+			account: Account{ID: "111111111111"},
+			wantErr: "Account roleArn must be present and not empty",
+		},
+		{
+			desc:    "Invalid role ARN",
+			account: Account{ID: "111111111111", RoleArn: "ecr-go"},
+			wantErr: "Account roleArn is invalid: arn: invalid prefix",
+		},
+		{
+			desc:    "Role of another account",
+			account: Account{ID: "111111111111", RoleArn: "arn:aws:iam::222222222222:role/ecr-go"},
+			wantErr: "Account roleArn arn:aws:iam::222222222222:role/ecr-go does not belong to account 111111111111",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			a := test.account
+			err := a.Validate()
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, a)
+		})
+	}
+}
+
+func TestLoadDirectoryAccounts(t *testing.T) {
+	_, err := LoadDirectoryAccounts("testdata/accounts/")
+	assert.EqualError(t, err, "testdata/accounts/other/_account.yaml: Account roleArn arn:aws:iam::444444444444:role/ecr-go does not belong to account 333333333333")
+
+	accounts, err := LoadDirectoryAccounts("testdata/accounts/team")
+	assert.NoError(t, err)
+	assert.Equal(t, DirectoryAccounts{
+		"testdata/accounts/team": {ID: "222222222222", RoleArn: "arn:aws:iam::222222222222:role/ecr-go", ExternalID: "secret", SessionName: "team"},
+	}, accounts)
+
+	accounts, err = LoadDirectoryAccounts("testdata/files/")
+	assert.NoError(t, err)
+	assert.Empty(t, accounts)
+
+	_, err = LoadDirectoryAccounts("nothing/")
+	assert.Error(t, err)
+}
+
+func TestDirectoryAccountsFor(t *testing.T) {
+	root := Account{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go", SessionName: "ecr-go"}
+	team := Account{ID: "222222222222", RoleArn: "arn:aws:iam::222222222222:role/ecr-go", SessionName: "team"}
+	accounts := DirectoryAccounts{
+		"files":      root,
+		"files/team": team,
+	}
+
+	assert.Equal(t, &root, accounts.For("files/repo.yaml"))
+	assert.Equal(t, &team, accounts.For("files/team/repo.yaml"))
+	assert.Equal(t, &team, accounts.For("files/team/app/repo.yaml"))
+	assert.Equal(t, &root, accounts.For("files/teams/repo.yaml"))
+	assert.Nil(t, accounts.For("other/repo.yaml"))
+	assert.Nil(t, DirectoryAccounts{}.For("files/repo.yaml"))
+}
@@ -0,0 +1,210 @@
+package configuration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// AccountAliases are the friendly names of the AWS accounts and of groups of accounts, declared in the accounts file
+// The policies reference them as account:<name> and group:<name>, optionally followed by the resource of an ARN,
+// like account:prod-eks:role/deploy
+type AccountAliases struct {
+	Accounts  map[string]string   `yaml:"accounts"`  // Account IDs by name
+	Groups    map[string][]string `yaml:"groups"`    // Account names or IDs by group name
+	Partition string              `yaml:"partition"` // AWS partition of the ARNs of the accounts, like aws-cn. Empty means the partition of the regions, or aws
+}
+
+// DefaultPartition is the AWS partition of the ARNs when none is set
+const DefaultPartition = "aws"
+
+var (
+	aliasNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	partitionRegexp = regexp.MustCompile(`^aws(-[a-z]+)*$`)
+	// aliasRegexp matches a reference to an alias in a policy: its kind, its name and the resource of the ARN, if any
+	aliasRegexp = regexp.MustCompile(`^(account|group):([A-Za-z0-9][A-Za-z0-9._-]*)(?::(.+))?$`)
+)
+
+// LoadAccountAliases will load the aliases of the given accounts file
+// It returns the aliases, or an error if the file cannot be read, a name or the partition is invalid, an account ID is not
+// 12 digits or a member of a group is neither an account ID nor a known account name
+func LoadAccountAliases(path string) (*AccountAliases, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var a AccountAliases
+	if err := yaml.UnmarshalStrict(d, &a); err != nil {
+		return nil, err
+	}
+	if a.Partition != "" && !partitionRegexp.MatchString(a.Partition) {
+		return nil, fmt.Errorf("%s: partition must be an AWS partition like aws, aws-cn or aws-us-gov, got %q", path, a.Partition)
+	}
+	for name, id := range a.Accounts {
+		if !aliasNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("%s: account name %q must be alphanumeric, with '.', '_' or '-' inside", path, name)
+		}
+		if !accountIDRegexp.MatchString(id) {
+			return nil, fmt.Errorf("%s: account %s must be a 12 digits AWS account ID, got %q", path, name, id)
+		}
+	}
+	for name := range a.Groups {
+		if !aliasNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("%s: group name %q must be alphanumeric, with '.', '_' or '-' inside", path, name)
+		}
+		if _, err := a.accounts("group", name); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return &a, nil
+}
+
+// partition returns the AWS partition of the ARNs of the accounts. A nil AccountAliases is in the default partition
+func (a *AccountAliases) partition() string {
+	if a == nil || a.Partition == "" {
+		return DefaultPartition
+	}
+	return a.Partition
+}
+
+// accounts returns the IDs of the accounts of an account or group alias
+// It returns an error if the alias is unknown. A nil AccountAliases knows no alias
+func (a *AccountAliases) accounts(kind, name string) ([]string, error) {
+	if a == nil {
+		a = &AccountAliases{}
+	}
+	if kind == "account" {
+		id, ok := a.Accounts[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown account alias %q", name)
+		}
+		return []string{id}, nil
+	}
+
+	members, ok := a.Groups[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown account group %q", name)
+	}
+	ids := []string{}
+	for _, m := range members {
+		if accountIDRegexp.MatchString(m) {
+			ids = append(ids, m)
+			continue
+		}
+		id, ok := a.Accounts[m]
+		if !ok {
+			return nil, fmt.Errorf("group %s: unknown account alias %q", name, m)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Expand returns the policy with its references to aliases expanded, or the policy unchanged if it has none
+// In Principal and NotPrincipal, account:<name> becomes the ARN of the root of the account, and account:<name>:<resource>
+// the ARN of the resource in the account, like arn:aws:iam::111111111111:role/deploy, in the partition of the aliases.
+// In the values of Condition, account:<name> becomes the account ID. A group becomes the list of the values of its accounts
+// The other keys, like Sid or Resource, are left as they are. It returns an error if an alias is unknown
+func (a *AccountAliases) Expand(policy []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(policy))
+	d.UseNumber()
+	var doc interface{}
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	// scope is the key of the statement whose values are expanded: Principal, NotPrincipal or Condition. Empty outside of them
+	expanded := false
+	var expand func(v interface{}, scope string) (interface{}, error)
+	expand = func(v interface{}, scope string) (interface{}, error) {
+		switch t := v.(type) {
+		case string:
+			if scope == "" {
+				return t, nil
+			}
+			values, err := a.expandString(t, scope != "Condition")
+			if err != nil || values == nil {
+				return t, err
+			}
+			expanded = true
+			if len(values) == 1 {
+				return values[0], nil
+			}
+			return values, nil
+		case []interface{}:
+			l := []interface{}{}
+			for _, e := range t {
+				x, err := expand(e, scope)
+				if err != nil {
+					return nil, err
+				}
+				// The values of a group are spliced in the list
+				if values, ok := x.([]interface{}); ok {
+					l = append(l, values...)
+				} else {
+					l = append(l, x)
+				}
+			}
+			return l, nil
+		case map[string]interface{}:
+			for _, k := range sortedMapKeys(t) {
+				child := scope
+				if child == "" && (k == "Principal" || k == "NotPrincipal" || k == "Condition") {
+					child = k
+				}
+				x, err := expand(t[k], child)
+				if err != nil {
+					return nil, err
+				}
+				t[k] = x
+			}
+		}
+		return v, nil
+	}
+
+	doc, err := expand(doc, "")
+	if err != nil || !expanded {
+		return policy, err
+	}
+	return json.MarshalIndent(doc, "", "    ")
+}
+
+// expandString returns the values of a reference to an alias, or nil if s is not a reference
+func (a *AccountAliases) expandString(s string, principal bool) ([]interface{}, error) {
+	m := aliasRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return nil, nil
+	}
+	ids, err := a.accounts(m[1], m[2])
+	if err != nil {
+		return nil, err
+	}
+	values := []interface{}{}
+	for _, id := range ids {
+		switch {
+		case m[3] != "":
+			values = append(values, fmt.Sprintf("arn:%s:iam::%s:%s", a.partition(), id, m[3]))
+		case principal:
+			values = append(values, fmt.Sprintf("arn:%s:iam::%s:root", a.partition(), id))
+		default:
+			values = append(values, id)
+		}
+	}
+	return values, nil
+}
+
+// sortedMapKeys returns the keys of the object, sorted, for the errors to be reproducible
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
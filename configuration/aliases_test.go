@@ -0,0 +1,169 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAccountAliases(t *testing.T) {
+	tests := []struct {
+		desc    string
+		file    string
+		want    *AccountAliases
+		wantErr string
+	}{
+		{
+			desc: "Valid accounts file",
+			file: "testdata/aliases/accounts.yaml",
+			want: &AccountAliases{
+				Accounts: map[string]string{"prod-eks": "111111111111", "prod-data": "222222222222"},
+				Groups:   map[string][]string{"all-prod": {"prod-eks", "prod-data", "333333333333"}},
+			},
+		},
+		{
+			desc: "Partition",
+			file: "testdata/aliases/partition.yaml",
+			want: &AccountAliases{
+				Accounts:  map[string]string{"prod-eks": "111111111111"},
+				Partition: "aws-cn",
+			},
+		},
+		{
+			desc:    "Invalid partition",
+			file:    "testdata/aliases/invalid_partition.yaml",
+			wantErr: `testdata/aliases/invalid_partition.yaml: partition must be an AWS partition like aws, aws-cn or aws-us-gov, got "china"`,
+		},
+		{
+			desc:    "Invalid account ID",
+			file:    "testdata/aliases/invalid_id.yaml",
+			wantErr: `testdata/aliases/invalid_id.yaml: account prod-eks must be a 12 digits AWS account ID, got "11111111111"`,
+		},
+		{
+			desc:    "Unknown member of a group",
+			file:    "testdata/aliases/unknown_member.yaml",
+			wantErr: `testdata/aliases/unknown_member.yaml: group all-prod: unknown account alias "prod-dta"`,
+		},
+		{
+			desc:    "Accounts file doesn't exists",
+			file:    "testdata/aliases/doesnotexists.yaml",
+			wantErr: "open testdata/aliases/doesnotexists.yaml: no such file or directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			aliases, err := LoadAccountAliases(test.file)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, aliases)
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	aliases := &AccountAliases{
+		Accounts: map[string]string{"prod-eks": "111111111111", "prod-data": "222222222222"},
+		Groups:   map[string][]string{"all-prod": {"prod-eks", "prod-data"}},
+	}
+
+	tests := []struct {
+		desc    string
+		aliases *AccountAliases
+		policy  string
+		want    string
+		wantErr string
+	}{
+		{
+			desc:    "No alias",
+			aliases: aliases,
+			policy:  `{"Statement": [{"Principal": {"AWS": "111111111111"}}]}`,
+			want:    `{"Statement": [{"Principal": {"AWS": "111111111111"}}]}`,
+		},
+		{
+			desc:    "Account",
+			aliases: aliases,
+			policy:  `{"Statement":[{"Principal":{"AWS":"account:prod-eks"}}]}`,
+			want:    "{\n    \"Statement\": [\n        {\n            \"Principal\": {\n                \"AWS\": \"arn:aws:iam::111111111111:root\"\n            }\n        }\n    ]\n}",
+		},
+		{
+			desc:    "Group and role in a list",
+			aliases: aliases,
+			policy:  `{"Statement":[{"Principal":{"AWS":["group:all-prod:role/deploy","333333333333"]}}]}`,
+			want:    "{\n    \"Statement\": [\n        {\n            \"Principal\": {\n                \"AWS\": [\n                    \"arn:aws:iam::111111111111:role/deploy\",\n                    \"arn:aws:iam::222222222222:role/deploy\",\n                    \"333333333333\"\n                ]\n            }\n        }\n    ]\n}",
+		},
+		{
+			desc:    "Condition",
+			aliases: aliases,
+			policy:  `{"Statement":[{"Condition":{"StringEquals":{"aws:PrincipalAccount":"group:all-prod"}},"Version":1}]}`,
+			want:    "{\n    \"Statement\": [\n        {\n            \"Condition\": {\n                \"StringEquals\": {\n                    \"aws:PrincipalAccount\": [\n                        \"111111111111\",\n                        \"222222222222\"\n                    ]\n                }\n            },\n            \"Version\": 1\n        }\n    ]\n}",
+		},
+		{
+			desc: "Partition",
+			aliases: &AccountAliases{
+				Accounts:  map[string]string{"prod-eks": "111111111111"},
+				Partition: "aws-cn",
+			},
+			policy: `{"Statement":[{"Principal":{"AWS":["account:prod-eks","account:prod-eks:role/deploy"]}}]}`,
+			want:   "{\n    \"Statement\": [\n        {\n            \"Principal\": {\n                \"AWS\": [\n                    \"arn:aws-cn:iam::111111111111:root\",\n                    \"arn:aws-cn:iam::111111111111:role/deploy\"\n                ]\n            }\n        }\n    ]\n}",
+		},
+		{
+			desc:    "Outside of the principals and the conditions",
+			aliases: aliases,
+			policy:  `{"Statement":[{"Sid":"account:prod-eks","Principal":{"AWS":"account:prod-eks"}}]}`,
+			want:    "{\n    \"Statement\": [\n        {\n            \"Principal\": {\n                \"AWS\": \"arn:aws:iam::111111111111:root\"\n            },\n            \"Sid\": \"account:prod-eks\"\n        }\n    ]\n}",
+		},
+		{
+			desc:    "Unknown alias",
+			aliases: aliases,
+			policy:  `{"Statement":[{"Principal":{"AWS":"account:prod-ekz"}}]}`,
+			wantErr: `unknown account alias "prod-ekz"`,
+		},
+		{
+			desc:    "Unknown group",
+			aliases: aliases,
+			policy:  `{"Statement":[{"Principal":{"AWS":"group:all-dev"}}]}`,
+			wantErr: `unknown account group "all-dev"`,
+		},
+		{
+			desc:    "No accounts file",
+			policy:  `{"Statement":[{"Principal":{"AWS":"account:prod-eks"}}]}`,
+			wantErr: `unknown account alias "prod-eks"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := test.aliases.Expand([]byte(test.policy))
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, string(got))
+		})
+	}
+}
+
+func TestLoadYamlConfigurationAliases(t *testing.T) {
+	aliases, err := LoadAccountAliases("testdata/aliases/accounts.yaml")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	c := NewConfigurationFile(Logger)
+	c.Aliases = aliases
+	if !assert.NoError(t, c.LoadYamlConfiguration("testdata/aliases/repository.yaml")) {
+		return
+	}
+	assert.Contains(t, string(c.RepositoryPolicy), `"arn:aws:iam::111111111111:root",`)
+	assert.Contains(t, string(c.RepositoryPolicy), `"arn:aws:iam::333333333333:root"`)
+	assert.NotContains(t, string(c.RepositoryPolicy), "group:")
+
+	// Without the accounts file, the aliases are unknown
+	c = NewConfigurationFile(Logger)
+	assert.EqualError(t, c.LoadYamlConfiguration("testdata/aliases/repository.yaml"), `testdata/aliases/policy.json: unknown account group "all-prod"`)
+}
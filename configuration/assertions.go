@@ -0,0 +1,110 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Expectations of an assertion
+const (
+	ExpectAllow        = "allow"         // The request is allowed
+	ExpectDeny         = "deny"          // The request is denied, explicitly or implicitly
+	ExpectExplicitDeny = "explicit-deny" // A Deny statement applies to the request
+	ExpectImplicitDeny = "implicit-deny" // No statement applies to the request
+)
+
+// Assertion is the expected answer of the policies of some repositories to a request, checked by validate
+type Assertion struct {
+	Description string                  `yaml:"description"`
+	Repository  string                  `yaml:"repository"` // Glob of the names of the repositories, where * does not match a /
+	Principal   string                  `yaml:"principal"`  // Caller: ARN of a role, a user or a session, account ID, or service
+	Action      string                  `yaml:"action"`     // pull, push, or an action like ecr:PutImage
+	Context     map[string]StringValues `yaml:"context"`    // Values of the condition keys of the request, like aws:PrincipalOrgID
+	Expect      string                  `yaml:"expect"`     // allow, deny, explicit-deny or implicit-deny
+}
+
+// StringValues are the values of a key, written as a single string or as a list
+type StringValues []string
+
+func (v *StringValues) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*v = StringValues{s}
+		return nil
+	}
+	var l []string
+	if err := unmarshal(&l); err != nil {
+		return errors.New("must be a string or a list of strings")
+	}
+	*v = l
+	return nil
+}
+
+// String returns the description of the assertion, or its request if it has none
+func (a Assertion) String() string {
+	if a.Description != "" {
+		return a.Description
+	}
+	return fmt.Sprintf("%s %s %s", a.Principal, a.Action, a.Repository)
+}
+
+// Matches returns true if the expectation of the assertion accepts the decision of an evaluation
+func (a Assertion) Matches(decision string) bool {
+	if a.Expect == ExpectDeny {
+		return decision == ExpectExplicitDeny || decision == ExpectImplicitDeny
+	}
+	return decision == a.Expect
+}
+
+// RequestContext returns the condition keys of the request of the assertion
+func (a Assertion) RequestContext() map[string][]string {
+	context := make(map[string][]string, len(a.Context))
+	for k, v := range a.Context {
+		context[k] = v
+	}
+	return context
+}
+
+// assertionsFile is the structure of the assertions file
+type assertionsFile struct {
+	Assertions []Assertion `yaml:"assertions"`
+}
+
+// LoadAssertions will load the assertions of the given assertions file
+// It returns the assertions in their order in the file, or any error encountered
+func LoadAssertions(path string) ([]Assertion, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f assertionsFile
+	if err := yaml.UnmarshalStrict(d, &f); err != nil {
+		return nil, err
+	}
+	for i, a := range f.Assertions {
+		if err := a.validate(); err != nil {
+			return nil, fmt.Errorf("%s: assertion %d: %v", path, i, err)
+		}
+	}
+	return f.Assertions, nil
+}
+
+// validate returns an error if a field of the assertion is missing or invalid
+func (a Assertion) validate() error {
+	if a.Repository == "" || a.Principal == "" || a.Action == "" {
+		return errors.New("repository, principal and action must be present and not empty")
+	}
+	if _, err := path.Match(a.Repository, ""); err != nil {
+		return fmt.Errorf("repository must be a valid glob, got %q", a.Repository)
+	}
+	switch a.Expect {
+	case ExpectAllow, ExpectDeny, ExpectExplicitDeny, ExpectImplicitDeny:
+		return nil
+	}
+	return fmt.Errorf("expect must be allow, deny, explicit-deny or implicit-deny, got %q", a.Expect)
+}
@@ -0,0 +1,74 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAssertions(t *testing.T) {
+	tests := []struct {
+		desc    string
+		file    string
+		want    []Assertion
+		wantErr string
+	}{
+		{
+			desc: "Valid assertions file",
+			file: "testdata/assertions/assertions.yaml",
+			want: []Assertion{
+				{
+					Description: "prod account can pull",
+					Repository:  "payments/*",
+					Principal:   "arn:aws:iam::111111111111:role/deploy",
+					Action:      "pull",
+					Context:     map[string]StringValues{"aws:PrincipalOrgID": {"o-a1b2c3d4e5"}},
+					Expect:      ExpectAllow,
+				},
+				{
+					Repository: "payments/api",
+					Principal:  "222222222222",
+					Action:     "ecr:PutImage",
+					Context:    map[string]StringValues{"aws:SourceVpc": {"vpc-1", "vpc-2"}},
+					Expect:     ExpectDeny,
+				},
+			},
+		},
+		{
+			desc:    "Invalid expectation",
+			file:    "testdata/assertions/invalid_expect.yaml",
+			wantErr: `testdata/assertions/invalid_expect.yaml: assertion 0: expect must be allow, deny, explicit-deny or implicit-deny, got "denied"`,
+		},
+		{
+			desc:    "Missing principal",
+			file:    "testdata/assertions/missing_principal.yaml",
+			wantErr: "testdata/assertions/missing_principal.yaml: assertion 0: repository, principal and action must be present and not empty",
+		},
+		{
+			desc:    "Assertions file doesn't exists",
+			file:    "testdata/assertions/doesnotexists.yaml",
+			wantErr: "open testdata/assertions/doesnotexists.yaml: no such file or directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assertions, err := LoadAssertions(test.file)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, assertions)
+		})
+	}
+}
+
+func TestAssertionMatches(t *testing.T) {
+	deny := Assertion{Expect: ExpectDeny}
+	assert.True(t, deny.Matches(ExpectExplicitDeny))
+	assert.True(t, deny.Matches(ExpectImplicitDeny))
+	assert.False(t, deny.Matches(ExpectAllow))
+	assert.True(t, Assertion{Expect: ExpectImplicitDeny}.Matches(ExpectImplicitDeny))
+	assert.False(t, Assertion{Expect: ExpectImplicitDeny}.Matches(ExpectExplicitDeny))
+}
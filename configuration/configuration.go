@@ -7,20 +7,35 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
 )
 
 type ConfigurationFile struct {
-	RepositoryName       string `yaml:"repositoryName"`
-	RepositoryPolicyFile string `yaml:"repositoryPolicyFile"`
+	RepositoryName       string            `yaml:"repositoryName"`
+	RepositoryPolicyFile string            `yaml:"repositoryPolicyFile"`
+	RegistryID           string            `yaml:"registryId"`  // Registry of the repository. Empty means the registry of the account
+	Target               string            `yaml:"target"`      // Name of the target of the targets file. Empty means the default AWS session
+	Regions              []string          `yaml:"regions"`     // Regions of the repository. Empty means the default regions
+	Account              *Account          `yaml:"account"`     // Account of the repository. nil means the account of the directory, or the default credentials
+	Type                 string            `yaml:"type"`        // Type of the repository, private or public. Empty means private
+	CatalogData          *CatalogData      `yaml:"catalogData"` // Catalog data of a public repository. nil leaves it unchanged
+	Labels               map[string]string `yaml:"labels"`      // Labels of the repository, used to select it with a Selector. They are not sent to AWS
+	Access               *Access           `yaml:"access"`      // Access presets, expanded in statements appended to the policy. nil means none
 	RepositoryPolicy     []byte
+	Aliases              *AccountAliases `yaml:"-"` // Aliases of the accounts referenced by the policy. nil means no alias is known
+	SidPrefix            string          `yaml:"-"` // Prefix of the Sids of the statements of the access presets, like the managed prefix of the merge mode
+	Now                  time.Time       `yaml:"-"` // Time the expiries of the grants are compared to. Zero means the current time
+	ExpiryRequired       []string        `yaml:"-"` // Globs of the principals whose grants must have an expiry. Empty means none
+	Expiries             []Expiry        `yaml:"-"` // Expiries of the grants of the statements and access presets, including the expired ones
+	Expired              bool            `yaml:"-"` // Every statement of the policy has expired: the policy of the repository must be deleted
 	logger               *zap.Logger
 }
 
 // GetYamlConfigurationFiles will recursively look for all yaml files in the root directory passed as argument
-// Only the files ending with .yaml or .yml will be accepted
+// Only the files ending with .yaml or .yml will be accepted. The account files are ignored
 // It returns a list of all yaml files found or any error encountered
 func GetYamlConfigurationFiles(root string) ([]string, error) {
 	yamlConfigurationFiles := []string{}
@@ -30,6 +45,9 @@ func GetYamlConfigurationFiles(root string) ([]string, error) {
 			return e
 		}
 		// Only look for .yaml or .yml files
+		if info.Name() == AccountFileName {
+			return nil
+		}
 		if filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml" {
 			yamlConfigurationFiles = append(yamlConfigurationFiles, path)
 		}
@@ -51,7 +69,9 @@ func NewConfigurationFile(logger *zap.Logger) ConfigurationFile {
 }
 
 // LoadYamlConfiguration will load the yaml file into a ConfigurationFile struct
-// Additionally, it will load the json policy defined in RepositoryPolicyFile
+// Additionally, it will load the json policy defined in RepositoryPolicyFile, with the statements of its access presets
+// appended and its account aliases expanded. The statements and the access principals expired at Now are dropped, and
+// Expired is set if no statement is left
 // It returns any error encountered
 func (c *ConfigurationFile) LoadYamlConfiguration(yamlFile string) error {
 	c.logger.Debug(fmt.Sprintf("%s - Reading yaml file ...", yamlFile))
@@ -69,25 +89,132 @@ func (c *ConfigurationFile) LoadYamlConfiguration(yamlFile string) error {
 	if c.RepositoryName == "" {
 		return errors.New("RepositoryName must be present and not empty")
 	}
-	if c.RepositoryPolicyFile == "" {
-		return errors.New("RepositoryPolicyFile must be present and not empty")
+	if c.RepositoryPolicyFile == "" && c.Access == nil {
+		return errors.New("RepositoryPolicyFile must be present and not empty, unless Access is set")
+	}
+	if c.RegistryID != "" && !accountIDRegexp.MatchString(c.RegistryID) {
+		return fmt.Errorf("RegistryID must be a 12 digits AWS account ID, got %q", c.RegistryID)
+	}
+	if c.Account != nil {
+		if err := c.Account.Validate(); err != nil {
+			return err
+		}
+	}
+	// Ensure Regions has no empty or duplicated region
+	for i, r := range c.Regions {
+		if r == "" {
+			return errors.New("Regions must not contain an empty region")
+		}
+		for _, o := range c.Regions[:i] {
+			if r == o {
+				return fmt.Errorf("Duplicate region %s in Regions", r)
+			}
+		}
+	}
+	if err := c.validateType(); err != nil {
+		return err
+	}
+	if err := validateLabels(c.Labels); err != nil {
+		return err
+	}
+	if c.Access != nil {
+		if c.IsPublic() {
+			return errors.New("Access can only be set on a private repository")
+		}
+		if err := c.Access.validate(); err != nil {
+			return err
+		}
+	}
+	if c.CatalogData != nil {
+		if err := c.CatalogData.loadLogo(); err != nil {
+			return err
+		}
+		for _, u := range c.CatalogData.Unsupported() {
+			c.logger.Warn(fmt.Sprintf("%s - %s is not supported by the ECR Public Gallery, it will not be displayed", yamlFile, u))
+		}
 	}
 
 	c.logger.Debug(fmt.Sprintf("%s - Unmarshalled: [%v, %v]", yamlFile, c.RepositoryName, c.RepositoryPolicyFile))
 
 	// Validate the RepositoryPolicyFile is a valid json file
-	c.logger.Debug(fmt.Sprintf("%s - Validating json policy: %s ...", yamlFile, c.RepositoryPolicyFile))
-	j, err := ioutil.ReadFile(c.RepositoryPolicyFile)
-	if err != nil {
-		return err
+	j := []byte(emptyPolicy)
+	if c.RepositoryPolicyFile != "" {
+		c.logger.Debug(fmt.Sprintf("%s - Validating json policy: %s ...", yamlFile, c.RepositoryPolicyFile))
+		j, err = ioutil.ReadFile(c.RepositoryPolicyFile)
+		if err != nil {
+			return err
+		}
+		if !json.Valid(j) {
+			return errors.New("not a valid json file")
+		}
+		c.logger.Debug(fmt.Sprintf("%s - Json policy validated: %s ...", yamlFile, c.RepositoryPolicyFile))
 	}
-	if !json.Valid(j) {
-		return errors.New("not a valid json file")
+
+	// Drop the expired statements and access principals
+	now := c.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if c.RepositoryPolicyFile != "" {
+		if j, c.Expiries, err = dropExpired(j, now, c.ExpiryRequired); err != nil {
+			return fmt.Errorf("%s: %v", c.RepositoryPolicyFile, err)
+		}
+	}
+
+	// Append the statements of the access presets
+	if c.Access != nil {
+		active, expiries, err := c.Access.Active(now, c.ExpiryRequired)
+		if err != nil {
+			return fmt.Errorf("Access: %v", err)
+		}
+		c.Expiries = append(c.Expiries, expiries...)
+		j, err = active.Statements(j, c.Aliases, c.SidPrefix)
+		if err != nil {
+			return fmt.Errorf("Access: %v", err)
+		}
+	}
+
+	// Expand the account aliases referenced by the policy
+	if j, err = c.Aliases.Expand(j); err != nil {
+		source := c.RepositoryPolicyFile
+		if source == "" {
+			source = "Access"
+		}
+		return fmt.Errorf("%s: %v", source, err)
 	}
-	c.logger.Debug(fmt.Sprintf("%s - Json policy validated: %s ...", yamlFile, c.RepositoryPolicyFile))
 
 	// Load the associated json policy from the file defined in RepositoryPolicyFile
 	c.RepositoryPolicy = j
 
+	// ECR rejects a policy without statement: once all its grants have expired, the policy is to be deleted
+	c.Expired, err = allExpired(j, c.Expiries, now)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// TargetRegions returns the regions the policy must be applied to
+// It returns PublicRegion for a public repository, Regions if set, the given default regions otherwise
+func (c *ConfigurationFile) TargetRegions(defaults []string) []string {
+	if c.IsPublic() {
+		return []string{PublicRegion}
+	}
+	if len(c.Regions) > 0 {
+		return c.Regions
+	}
+	return defaults
+}
+
+// Registry returns the ID of the registry of the repository: RegistryID if set, the ID of the account otherwise
+// It returns an empty string for the default registry of the default credentials
+func (c *ConfigurationFile) Registry() string {
+	if c.RegistryID != "" {
+		return c.RegistryID
+	}
+	if c.Account != nil {
+		return c.Account.ID
+	}
+	return ""
+}
@@ -36,7 +36,12 @@ func TestGetYamlConfigurationFiles(t *testing.T) {
 		{
 			desc:         "Yaml files exists in an existing directory",
 			mockFilesDir: "testdata/files/",
-			want:         []string{"testdata/files/test_1.yaml", "testdata/files/test_10.yaml", "testdata/files/test_11.yaml", "testdata/files/test_2.yml", "testdata/files/test_5.yaml", "testdata/files/test_6.yaml", "testdata/files/test_7.yaml", "testdata/files/test_8.yaml", "testdata/files/test_9.yaml"},
+			want:         []string{"testdata/files/test_1.yaml", "testdata/files/test_10.yaml", "testdata/files/test_11.yaml", "testdata/files/test_12.yaml", "testdata/files/test_13.yaml", "testdata/files/test_14.yaml", "testdata/files/test_15.yaml", "testdata/files/test_16.yaml", "testdata/files/test_17.yaml", "testdata/files/test_18.yaml", "testdata/files/test_19.yaml", "testdata/files/test_2.yml", "testdata/files/test_20.yaml", "testdata/files/test_21.yaml", "testdata/files/test_22.yaml", "testdata/files/test_23.yaml", "testdata/files/test_24.yaml", "testdata/files/test_25.yaml", "testdata/files/test_5.yaml", "testdata/files/test_6.yaml", "testdata/files/test_7.yaml", "testdata/files/test_8.yaml", "testdata/files/test_9.yaml"},
+		},
+		{
+			desc:         "Account files are ignored",
+			mockFilesDir: "testdata/accounts/team/",
+			want:         []string{"testdata/accounts/team/app/app.yaml", "testdata/accounts/team/app/override.yaml"},
 		},
 		{
 			desc:         "Yaml files doesn't exists in an existing directory",
@@ -60,6 +65,7 @@ func TestGetYamlConfigurationFiles(t *testing.T) {
 
 func TestLoadYamlConfiguration(t *testing.T) {
 	policy_1_json, _ := ioutil.ReadFile("testdata/files/policies/policy_1.json")
+	logo, _ := ioutil.ReadFile("testdata/files/logo.png")
 
 	testsWithoutError := []struct {
 		desc     string
@@ -76,6 +82,81 @@ func TestLoadYamlConfiguration(t *testing.T) {
 				logger:               Logger,
 			},
 		},
+		{
+			desc:     "Yaml file exists, policy exists, regions are set",
+			mockFile: "testdata/files/test_12.yaml",
+			want: ConfigurationFile{
+				RepositoryName:       "repository_12",
+				RepositoryPolicyFile: "testdata/files/policies/policy_1.json",
+				Regions:              []string{"eu-west-1", "us-east-1"},
+				RepositoryPolicy:     policy_1_json,
+				logger:               Logger,
+			},
+		},
+		{
+			desc:     "Yaml file exists, policy exists, registryId is set",
+			mockFile: "testdata/files/test_17.yaml",
+			want: ConfigurationFile{
+				RepositoryName:       "repository_17",
+				RepositoryPolicyFile: "testdata/files/policies/policy_1.json",
+				RegistryID:           "111111111111",
+				RepositoryPolicy:     policy_1_json,
+				logger:               Logger,
+			},
+		},
+		{
+			desc:     "Yaml file exists, policy exists, target is set",
+			mockFile: "testdata/files/test_18.yaml",
+			want: ConfigurationFile{
+				RepositoryName:       "repository_18",
+				RepositoryPolicyFile: "testdata/files/policies/policy_1.json",
+				Target:               "local",
+				RepositoryPolicy:     policy_1_json,
+				logger:               Logger,
+			},
+		},
+		{
+			desc:     "Yaml file exists, policy exists, public repository with catalog data",
+			mockFile: "testdata/files/test_19.yaml",
+			want: ConfigurationFile{
+				RepositoryName:       "repository_19",
+				RepositoryPolicyFile: "testdata/files/policies/policy_1.json",
+				Type:                 RepositoryTypePublic,
+				CatalogData: &CatalogData{
+					Description:      "Repository 19",
+					AboutText:        "# Repository 19\n",
+					UsageText:        "docker pull public.ecr.aws/lescactus/repository_19",
+					Architectures:    []string{"x86-64", "ARM 64"},
+					OperatingSystems: []string{"Linux"},
+					LogoFile:         "testdata/files/logo.png",
+					Logo:             logo,
+				},
+				RepositoryPolicy: policy_1_json,
+				logger:           Logger,
+			},
+		},
+		{
+			desc:     "Yaml file exists, policy exists, labels are set",
+			mockFile: "testdata/files/test_24.yaml",
+			want: ConfigurationFile{
+				RepositoryName:       "repository_24",
+				RepositoryPolicyFile: "testdata/files/policies/policy_1.json",
+				Labels:               map[string]string{"team": "payments", "env": "prod"},
+				RepositoryPolicy:     policy_1_json,
+				logger:               Logger,
+			},
+		},
+		{
+			desc:     "Yaml file exists, policy exists, account is set",
+			mockFile: "testdata/accounts/team/app/override.yaml",
+			want: ConfigurationFile{
+				RepositoryName:       "app",
+				RepositoryPolicyFile: "testdata/files/policies/policy_1.json",
+				Account:              &Account{ID: "555555555555", RoleArn: "arn:aws:iam::555555555555:role/ecr-go", SessionName: "ecr-go"},
+				RepositoryPolicy:     policy_1_json,
+				logger:               Logger,
+			},
+		},
 	}
 
 	testsWithError := []struct {
@@ -121,12 +202,57 @@ func TestLoadYamlConfiguration(t *testing.T) {
 		{
 			desc:     "Yaml file exists, RepositoryPolicyFile is missing",
 			mockFile: "testdata/files/test_10.yaml",
-			want:     errors.New("RepositoryPolicyFile must be present and not empty"),
+			want:     errors.New("RepositoryPolicyFile must be present and not empty, unless Access is set"),
 		},
 		{
 			desc:     "Yaml file exists, RepositoryPolicyFile is empty",
 			mockFile: "testdata/files/test_11.yaml",
-			want:     errors.New("RepositoryPolicyFile must be present and not empty"),
+			want:     errors.New("RepositoryPolicyFile must be present and not empty, unless Access is set"),
+		},
+		{
+			desc:     "Yaml file exists, registryId is invalid",
+			mockFile: "testdata/files/test_16.yaml",
+			want:     errors.New(`RegistryID must be a 12 digits AWS account ID, got "registry"`),
+		},
+		{
+			desc:     "Yaml file exists, account is invalid",
+			mockFile: "testdata/files/test_15.yaml",
+			want:     errors.New("Account roleArn must be present and not empty"),
+		},
+		{
+			desc:     "Yaml file exists, Regions has a duplicate",
+			mockFile: "testdata/files/test_13.yaml",
+			want:     errors.New("Duplicate region eu-west-1 in Regions"),
+		},
+		{
+			desc:     "Yaml file exists, Regions has an empty region",
+			mockFile: "testdata/files/test_14.yaml",
+			want:     errors.New("Regions must not contain an empty region"),
+		},
+		{
+			desc:     "Yaml file exists, public repository with regions",
+			mockFile: "testdata/files/test_20.yaml",
+			want:     errors.New("Regions cannot be set on a public repository, ECR Public is only available in us-east-1"),
+		},
+		{
+			desc:     "Yaml file exists, private repository with catalog data",
+			mockFile: "testdata/files/test_21.yaml",
+			want:     errors.New("CatalogData can only be set on a public repository"),
+		},
+		{
+			desc:     "Yaml file exists, unknown type",
+			mockFile: "testdata/files/test_22.yaml",
+			want:     errors.New(`Type must be private or public, got "protected"`),
+		},
+		{
+			desc:     "Yaml file exists, label key is invalid",
+			mockFile: "testdata/files/test_25.yaml",
+			want:     errors.New(`Label key "team name" must be alphanumeric, with '.', '_', '/' or '-' inside`),
+		},
+		{
+			desc:     "Yaml file exists, logo is not a PNG file",
+			mockFile: "testdata/files/test_23.yaml",
+			want:     errors.New("LogoFile testdata/files/policies/policy_1.json is not a PNG file"),
 		},
 	}
 
@@ -150,3 +276,35 @@ func TestLoadYamlConfiguration(t *testing.T) {
 		})
 	}
 }
+
+func TestTargetRegions(t *testing.T) {
+	defaults := []string{"eu-west-1"}
+
+	c := ConfigurationFile{}
+	assert.Equal(t, defaults, c.TargetRegions(defaults))
+	assert.Empty(t, c.TargetRegions(nil))
+
+	c.Regions = []string{"us-east-1", "us-west-2"}
+	assert.Equal(t, []string{"us-east-1", "us-west-2"}, c.TargetRegions(defaults))
+
+	c = ConfigurationFile{Type: RepositoryTypePublic}
+	assert.Equal(t, []string{PublicRegion}, c.TargetRegions(defaults))
+}
+
+func TestUnsupported(t *testing.T) {
+	d := CatalogData{
+		Architectures:    []string{"x86-64", "ARM 64", "riscv"},
+		OperatingSystems: []string{"Linux", "Plan 9"},
+	}
+	assert.Equal(t, []string{"riscv", "Plan 9"}, d.Unsupported())
+	assert.Empty(t, (&CatalogData{}).Unsupported())
+}
+
+func TestRegistry(t *testing.T) {
+	account := &Account{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go"}
+
+	assert.Equal(t, "", (&ConfigurationFile{}).Registry())
+	assert.Equal(t, "111111111111", (&ConfigurationFile{Account: account}).Registry())
+	assert.Equal(t, "222222222222", (&ConfigurationFile{RegistryID: "222222222222"}).Registry())
+	assert.Equal(t, "222222222222", (&ConfigurationFile{RegistryID: "222222222222", Account: account}).Registry())
+}
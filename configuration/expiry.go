@@ -0,0 +1,157 @@
+package configuration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lescactus/ecr-go/policy"
+)
+
+// ExpiresKey is the key of the expiry of a statement of a policy file. It is not sent to AWS
+const ExpiresKey = "Expires"
+
+// Expiry is a grant of the configuration with an expiry
+type Expiry struct {
+	Grant   string // Description of the grant, like statement VendorPull or pull access of 555555555555
+	Expires time.Time
+}
+
+// Expired returns true if the grant has expired at the given time
+func (e Expiry) Expired(now time.Time) bool {
+	return !now.Before(e.Expires)
+}
+
+// String returns the description of the grant
+func (e Expiry) String() string {
+	return e.Grant
+}
+
+// parseExpiry returns the time of an expiry, written in RFC 3339 like 2026-12-31T00:00:00Z
+func parseExpiry(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expiry must be a RFC 3339 time, like 2026-12-31T00:00:00Z, got %q", s)
+	}
+	return t, nil
+}
+
+// requiresExpiry returns the first principal matching any of the globs, if any
+// The principals are compared as written, case insensitively, with the * and ? wildcards
+func requiresExpiry(principals []string, globs []string) (string, bool) {
+	for _, p := range principals {
+		for _, g := range globs {
+			if policy.Wildcard(strings.ToLower(g), strings.ToLower(p)) {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// dropExpired returns the policy without its statements expired at now, and without the Expires key of the other ones
+// The policy is unchanged if no statement has an expiry. It returns the expiries of the statements, and an error if an expiry
+// is invalid, or if an Allow statement naming a principal matching any of the required globs has no expiry
+func dropExpired(data []byte, now time.Time, required []string) ([]byte, []Expiry, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var doc map[string]interface{}
+	if err := d.Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+	var statements []interface{}
+	switch s := doc["Statement"].(type) {
+	case []interface{}:
+		statements = s
+	case map[string]interface{}:
+		statements = []interface{}{s}
+	}
+
+	var expiries []Expiry
+	kept := []interface{}{}
+	for i, v := range statements {
+		st, ok := v.(map[string]interface{})
+		if !ok {
+			kept = append(kept, v)
+			continue
+		}
+		name := fmt.Sprintf("statement %d", i)
+		if sid, ok := st["Sid"].(string); ok && sid != "" {
+			name = "statement " + sid
+		}
+
+		raw, ok := st[ExpiresKey]
+		if !ok {
+			if st["Effect"] == policy.EffectAllow {
+				if p, ok := requiresExpiry(statementPrincipals(st), required); ok {
+					return nil, nil, fmt.Errorf("%s grants %s without %s, which requires an expiry", name, p, ExpiresKey)
+				}
+			}
+			kept = append(kept, st)
+			continue
+		}
+		s, _ := raw.(string)
+		expires, err := parseExpiry(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		e := Expiry{Grant: name, Expires: expires}
+		expiries = append(expiries, e)
+		if e.Expired(now) {
+			continue
+		}
+		delete(st, ExpiresKey)
+		kept = append(kept, st)
+	}
+	if len(expiries) == 0 {
+		return data, expiries, nil
+	}
+
+	doc["Statement"] = kept
+	b, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, expiries, nil
+}
+
+// allExpired returns true if a grant has expired at now and the policy has no statement left
+func allExpired(data []byte, expiries []Expiry, now time.Time) (bool, error) {
+	expired := false
+	for _, e := range expiries {
+		expired = expired || e.Expired(now)
+	}
+	if !expired {
+		return false, nil
+	}
+	doc, err := policy.Parse(string(data))
+	if err != nil {
+		return false, err
+	}
+	return len(doc.Statements) == 0, nil
+}
+
+// statementPrincipals returns the principals of the Principal element of a statement, as written
+func statementPrincipals(st map[string]interface{}) []string {
+	principals := []string{}
+	switch p := st["Principal"].(type) {
+	case string:
+		principals = append(principals, p)
+	case map[string]interface{}:
+		for _, v := range p {
+			switch t := v.(type) {
+			case string:
+				principals = append(principals, t)
+			case []interface{}:
+				for _, e := range t {
+					if s, ok := e.(string); ok {
+						principals = append(principals, s)
+					}
+				}
+			}
+		}
+	}
+	return principals
+}
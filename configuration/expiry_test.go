@@ -0,0 +1,176 @@
+package configuration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lescactus/ecr-go/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropExpired(t *testing.T) {
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc     string
+		policy   string
+		required []string
+		want     string
+		expiries []Expiry
+		wantErr  string
+	}{
+		{
+			desc:   "No expiry",
+			policy: `{"Statement":{"Effect":"Allow","Principal":"*","Action":"ecr:BatchGetImage"}}`,
+			want:   `{"Statement":{"Effect":"Allow","Principal":"*","Action":"ecr:BatchGetImage"}}`,
+		},
+		{
+			desc: "Expired and active statements",
+			policy: `{"Version":"2008-10-17","Statement":[
+				{"Sid":"Vendor","Effect":"Allow","Principal":{"AWS":"555555555555"},"Action":"ecr:BatchGetImage","Expires":"2026-06-30T00:00:00Z"},
+				{"Effect":"Allow","Principal":{"AWS":"666666666666"},"Action":"ecr:BatchGetImage","Expires":"2026-12-31T00:00:00+01:00"}
+			]}`,
+			want: `{"Version":"2008-10-17","Statement":[
+				{"Effect":"Allow","Principal":{"AWS":"666666666666"},"Action":"ecr:BatchGetImage"}
+			]}`,
+			expiries: []Expiry{
+				{Grant: "statement Vendor", Expires: time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC)},
+				{Grant: "statement 1", Expires: time.Date(2026, 12, 30, 23, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			desc:     "Required expiry",
+			policy:   `{"Statement":[{"Sid":"Vendor","Effect":"Allow","Principal":{"AWS":["111111111111","account:vendor-acme"]},"Action":"ecr:BatchGetImage"}]}`,
+			required: []string{"account:VENDOR-*"},
+			wantErr:  "statement Vendor grants account:vendor-acme without Expires, which requires an expiry",
+		},
+		{
+			desc:     "Required expiry of a Deny statement",
+			policy:   `{"Statement":[{"Effect":"Deny","Principal":"*","Action":"ecr:DeleteRepository"}]}`,
+			required: []string{"*"},
+			want:     `{"Statement":[{"Effect":"Deny","Principal":"*","Action":"ecr:DeleteRepository"}]}`,
+		},
+		{
+			desc:    "Invalid expiry",
+			policy:  `{"Statement":[{"Effect":"Allow","Principal":"*","Expires":"2026-12-31"}]}`,
+			wantErr: `statement 0: expiry must be a RFC 3339 time, like 2026-12-31T00:00:00Z, got "2026-12-31"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, expiries, err := dropExpired([]byte(test.policy), now, test.required)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, test.want, string(got))
+			for i := range expiries {
+				expiries[i].Expires = expiries[i].Expires.UTC()
+			}
+			assert.Equal(t, test.expiries, expiries)
+		})
+	}
+}
+
+func TestAccessActive(t *testing.T) {
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	access := &Access{
+		Pull: []AccessPrincipal{{Principal: "111111111111"}, {Principal: "555555555555", Expires: "2026-06-30T00:00:00Z"}},
+		Push: []AccessPrincipal{{Principal: "555555555555", Expires: "2026-12-31T00:00:00Z"}},
+	}
+
+	active, expiries, err := access.Active(now, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &Access{Pull: entries("111111111111"), Push: entries("555555555555")}, active)
+	assert.Equal(t, []Expiry{
+		{Grant: "pull access of 555555555555", Expires: time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC)},
+		{Grant: "push access of 555555555555", Expires: time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)},
+	}, expiries)
+	assert.True(t, expiries[0].Expired(now))
+	assert.False(t, expiries[1].Expired(now))
+
+	_, _, err = access.Active(now, []string{"1111*"})
+	assert.EqualError(t, err, "the pull access of 111111111111 has no expiry, which it requires")
+}
+
+func TestLoadYamlConfigurationExpiry(t *testing.T) {
+	c := NewConfigurationFile(Logger)
+	c.Now = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	if !assert.NoError(t, c.LoadYamlConfiguration("testdata/expiry/repository.yaml")) {
+		return
+	}
+	doc, err := policy.Parse(string(c.RepositoryPolicy))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, doc.Statements, 2) {
+		assert.Equal(t, "AuditPull", doc.Statements[0].Sid)
+		assert.Equal(t, map[string][]string{"AWS": {"111111111111", "888888888888"}}, doc.Statements[1].Principals)
+	}
+	assert.NotContains(t, string(c.RepositoryPolicy), ExpiresKey)
+	grants := []string{}
+	for _, e := range c.Expiries {
+		grants = append(grants, e.String())
+	}
+	assert.Equal(t, []string{"statement VendorPull", "statement AuditPull", "pull access of 777777777777", "pull access of 888888888888"}, grants)
+
+	c = NewConfigurationFile(Logger)
+	c.ExpiryRequired = []string{"arn:aws:iam::555555555555:*", "777777777777"}
+	assert.NoError(t, c.LoadYamlConfiguration("testdata/expiry/repository.yaml"))
+
+	c = NewConfigurationFile(Logger)
+	c.ExpiryRequired = []string{"111111111111"}
+	assert.EqualError(t, c.LoadYamlConfiguration("testdata/expiry/repository.yaml"), "Access: the pull access of 111111111111 has no expiry, which it requires")
+
+	c = NewConfigurationFile(Logger)
+	assert.EqualError(t, c.LoadYamlConfiguration("testdata/expiry/invalid_expiry.yaml"), `Access: the pull access of 777777777777: expiry must be a RFC 3339 time, like 2026-12-31T00:00:00Z, got "31/03/2026"`)
+}
+
+func TestLoadYamlConfigurationExpired(t *testing.T) {
+	tests := []struct {
+		desc string
+		file string
+		now  time.Time
+		want bool
+	}{
+		{
+			desc: "Every statement and access grant has expired",
+			file: "testdata/expiry/expired.yaml",
+			now:  time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: true,
+		},
+		{
+			desc: "Every access grant has expired",
+			file: "testdata/expiry/access_expired.yaml",
+			now:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+			want: true,
+		},
+		{
+			desc: "Statement still active",
+			file: "testdata/expiry/expired.yaml",
+			now:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			desc: "Active grant without expiry",
+			file: "testdata/expiry/repository.yaml",
+			now:  time.Date(2027, 6, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			c := NewConfigurationFile(Logger)
+			c.Now = test.now
+			if !assert.NoError(t, c.LoadYamlConfiguration(test.file)) {
+				return
+			}
+			assert.Equal(t, test.want, c.Expired)
+			doc, err := policy.Parse(string(c.RepositoryPolicy))
+			if assert.NoError(t, err) && test.want {
+				assert.Empty(t, doc.Statements)
+			}
+		})
+	}
+}
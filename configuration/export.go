@@ -0,0 +1,119 @@
+package configuration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SharedPoliciesDir is the directory, relative to the export directory, of the policies shared by several repositories
+const SharedPoliciesDir = "policies"
+
+// ExportedRepository is an existing repository to write as a configuration file
+type ExportedRepository struct {
+	RepositoryName string
+	RegistryID     string   // Registry of the repository. Empty means the registry of the account
+	Regions        []string // Regions of the repository. Empty means the default regions
+	PolicyText     string
+}
+
+// exportedFile is the content of an exported configuration file. Only the fields set are written
+type exportedFile struct {
+	RepositoryName       string   `yaml:"repositoryName"`
+	RepositoryPolicyFile string   `yaml:"repositoryPolicyFile"`
+	RegistryID           string   `yaml:"registryId,omitempty"`
+	Regions              []string `yaml:"regions,omitempty"`
+}
+
+// Export will write a configuration file <repository>.yaml and its indented policy <repository>.json per repository in dir
+// A repository name with slashes is written in the matching subdirectories
+// With shared, the policies identical for several repositories are written once in SharedPoliciesDir instead
+// The policy file paths are written relative to the working directory, as LoadYamlConfiguration reads them
+// Existing files are never overwritten. It returns the paths of the written files, or the first error encountered
+func Export(dir string, repositories []ExportedRepository, shared bool) ([]string, error) {
+	policies := make([][]byte, len(repositories))
+	for i, r := range repositories {
+		var b bytes.Buffer
+		if err := json.Indent(&b, []byte(r.PolicyText), "", "    "); err != nil {
+			return nil, fmt.Errorf("policy of repository %s is not a valid json document: %v", r.RepositoryName, err)
+		}
+		b.WriteString("\n")
+		policies[i] = b.Bytes()
+	}
+
+	// Shared policies are numbered in the order of their first repository
+	sharedFiles := make(map[string]string)
+	if shared {
+		count := make(map[string]int)
+		for _, r := range repositories {
+			count[canonicalPolicy(r.PolicyText)]++
+		}
+		for _, r := range repositories {
+			k := canonicalPolicy(r.PolicyText)
+			if _, ok := sharedFiles[k]; !ok && count[k] > 1 {
+				sharedFiles[k] = filepath.Join(dir, SharedPoliciesDir, fmt.Sprintf("shared-%d.json", len(sharedFiles)+1))
+			}
+		}
+	}
+
+	written := []string{}
+	for i, r := range repositories {
+		policyFile := filepath.Join(dir, filepath.FromSlash(r.RepositoryName)+".json")
+		if f, ok := sharedFiles[canonicalPolicy(r.PolicyText)]; ok {
+			policyFile = f
+		}
+		if !contains(written, policyFile) {
+			if err := writeNewFile(policyFile, policies[i]); err != nil {
+				return written, err
+			}
+			written = append(written, policyFile)
+		}
+
+		y, err := yaml.Marshal(exportedFile{
+			RepositoryName:       r.RepositoryName,
+			RepositoryPolicyFile: filepath.ToSlash(policyFile),
+			RegistryID:           r.RegistryID,
+			Regions:              r.Regions,
+		})
+		if err != nil {
+			return written, err
+		}
+		yamlFile := filepath.Join(dir, filepath.FromSlash(r.RepositoryName)+".yaml")
+		if err := writeNewFile(yamlFile, y); err != nil {
+			return written, err
+		}
+		written = append(written, yamlFile)
+	}
+
+	return written, nil
+}
+
+// canonicalPolicy returns the policy with sorted keys and without insignificant spaces, or as is if it is not valid JSON
+func canonicalPolicy(policy string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(policy), &v); err != nil {
+		return policy
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return policy
+	}
+	return string(b)
+}
+
+// writeNewFile will write data in the file, creating its directory if needed
+// It returns an error if the file already exists
+func writeNewFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
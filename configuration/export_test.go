@@ -0,0 +1,95 @@
+package configuration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	pull := `{"Version":"2008-10-17","Statement":[{"Sid":"Pull","Effect":"Allow","Principal":"*","Action":"ecr:BatchGetImage"}]}`
+	// Same document as pull, with another formatting and key order
+	pullReordered := `{"Statement": [{"Action": "ecr:BatchGetImage", "Effect": "Allow", "Principal": "*", "Sid": "Pull"}], "Version": "2008-10-17"}`
+	push := `{"Version":"2008-10-17","Statement":[{"Sid":"Push","Effect":"Allow","Principal":"*","Action":"ecr:PutImage"}]}`
+
+	repositories := []ExportedRepository{
+		{RepositoryName: "app", PolicyText: pull},
+		{RepositoryName: "team/api", RegistryID: "111111111111", Regions: []string{"eu-west-1"}, PolicyText: pullReordered},
+		{RepositoryName: "worker", PolicyText: push},
+	}
+
+	tests := []struct {
+		desc        string
+		shared      bool
+		wantWritten []string
+		wantPolicy  map[string]string // Policy file of each repository
+	}{
+		{
+			desc:        "A policy file per repository",
+			wantWritten: []string{"app.json", "app.yaml", "team/api.json", "team/api.yaml", "worker.json", "worker.yaml"},
+			wantPolicy:  map[string]string{"app": "app.json", "team/api": "team/api.json", "worker": "worker.json"},
+		},
+		{
+			desc:        "Identical policies are shared",
+			shared:      true,
+			wantWritten: []string{"policies/shared-1.json", "app.yaml", "team/api.yaml", "worker.json", "worker.yaml"},
+			wantPolicy:  map[string]string{"app": "policies/shared-1.json", "team/api": "policies/shared-1.json", "worker": "worker.json"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "export")
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer os.RemoveAll(dir)
+
+			written, err := Export(dir, repositories, test.shared)
+			assert.NoError(t, err)
+			want := []string{}
+			for _, f := range test.wantWritten {
+				want = append(want, filepath.Join(dir, f))
+			}
+			assert.Equal(t, want, written)
+
+			// The exported files are valid configuration files
+			for _, r := range repositories {
+				c := NewConfigurationFile(Logger)
+				if assert.NoError(t, c.LoadYamlConfiguration(filepath.Join(dir, r.RepositoryName+".yaml"))) {
+					assert.Equal(t, r.RepositoryName, c.RepositoryName)
+					assert.Equal(t, r.RegistryID, c.RegistryID)
+					assert.Equal(t, r.Regions, c.Regions)
+					assert.Equal(t, filepath.Join(dir, test.wantPolicy[r.RepositoryName]), c.RepositoryPolicyFile)
+					assert.Equal(t, canonicalPolicy(r.PolicyText), canonicalPolicy(string(c.RepositoryPolicy)))
+				}
+			}
+
+			// Existing files are not overwritten
+			_, err = Export(dir, repositories, test.shared)
+			assert.EqualError(t, err, filepath.Join(dir, test.wantWritten[0])+" already exists")
+		})
+	}
+}
+
+func TestExportIndentsPolicies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = Export(dir, []ExportedRepository{{RepositoryName: "app", PolicyText: `{"Version":"2008-10-17","Statement":[]}`}}, false)
+	assert.NoError(t, err)
+
+	policy, _ := ioutil.ReadFile(filepath.Join(dir, "app.json"))
+	assert.Equal(t, "{\n    \"Version\": \"2008-10-17\",\n    \"Statement\": []\n}\n", string(policy))
+	yamlFile, _ := ioutil.ReadFile(filepath.Join(dir, "app.yaml"))
+	assert.Equal(t, "repositoryName: app\nrepositoryPolicyFile: "+filepath.ToSlash(filepath.Join(dir, "app.json"))+"\n", string(yamlFile))
+
+	_, err = Export(dir, []ExportedRepository{{RepositoryName: "invalid", PolicyText: "{"}}, false)
+	assert.EqualError(t, err, "policy of repository invalid is not a valid json document: unexpected end of JSON input")
+}
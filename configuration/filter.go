@@ -0,0 +1,160 @@
+package configuration
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// labelRegexp is the format of the label keys and values. A value can also be empty
+var labelRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+
+// validateLabels returns an error if a key or a value of the labels is invalid
+func validateLabels(labels map[string]string) error {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if !labelRegexp.MatchString(k) {
+			return fmt.Errorf("Label key %q must be alphanumeric, with '.', '_', '/' or '-' inside", k)
+		}
+		if v := labels[k]; v != "" && !labelRegexp.MatchString(v) {
+			return fmt.Errorf("Label %s value %q must be empty or alphanumeric, with '.', '_', '/' or '-' inside", k, v)
+		}
+	}
+	return nil
+}
+
+// Requirement is a condition on a label
+type Requirement struct {
+	Key      string
+	Operator string // "=", "!=", "exists" or "!exists"
+	Value    string // Value of "=" and "!="
+}
+
+// Matches returns true if the labels meet the requirement
+// A missing label is different from any value
+func (r Requirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+	switch r.Operator {
+	case "=":
+		return ok && v == r.Value
+	case "!=":
+		return !ok || v != r.Value
+	case "exists":
+		return ok
+	default:
+		return !ok
+	}
+}
+
+// Selector is a list of label requirements, all of which must be met
+type Selector []Requirement
+
+// ParseSelector returns the selector of the given comma separated requirements
+// A requirement is key=value, key==value, key!=value, key for an existing label or !key for a missing label
+// An empty string is the selector of all the repositories
+func ParseSelector(s string) (Selector, error) {
+	selector := Selector{}
+	if strings.TrimSpace(s) == "" {
+		return selector, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		var r Requirement
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			r = Requirement{Key: kv[0], Operator: "!=", Value: kv[1]}
+		case strings.Contains(part, "=="):
+			kv := strings.SplitN(part, "==", 2)
+			r = Requirement{Key: kv[0], Operator: "=", Value: kv[1]}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(part, "=", 2)
+			r = Requirement{Key: kv[0], Operator: "=", Value: kv[1]}
+		case strings.HasPrefix(part, "!"):
+			r = Requirement{Key: strings.TrimPrefix(part, "!"), Operator: "!exists"}
+		default:
+			r = Requirement{Key: part, Operator: "exists"}
+		}
+
+		r.Key, r.Value = strings.TrimSpace(r.Key), strings.TrimSpace(r.Value)
+		if !labelRegexp.MatchString(r.Key) || (r.Value != "" && !labelRegexp.MatchString(r.Value)) {
+			return nil, fmt.Errorf("invalid label requirement %q in selector %q", part, s)
+		}
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+// Matches returns true if the labels meet all the requirements of the selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter selects the configuration files and the repositories to process
+// Empty fields select all of them
+type Filter struct {
+	Only     []string // Globs of the repository names to process
+	Exclude  []string // Globs of the repository names not to process, even if they match Only
+	Files    []string // Globs, paths or directories of the configuration files to process
+	Selector Selector // Labels of the repositories to process
+}
+
+// IsEmpty returns true if the filter selects all the repositories
+func (f Filter) IsEmpty() bool {
+	return len(f.Only) == 0 && len(f.Exclude) == 0 && len(f.Files) == 0 && len(f.Selector) == 0
+}
+
+// MatchesFile returns true if the configuration file is selected by Files
+// A file is selected if it matches a glob, or is in a directory of Files
+func (f Filter) MatchesFile(file string) bool {
+	if len(f.Files) == 0 {
+		return true
+	}
+	file = filepath.Clean(file)
+	for _, p := range f.Files {
+		p = filepath.Clean(p)
+		if ok, _ := filepath.Match(p, file); ok {
+			return true
+		}
+		if p == "." || strings.HasPrefix(file, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if the repository of the configuration file is selected by Only, Exclude and Selector
+// The globs match the whole repository name: * does not match a /
+func (f Filter) Matches(c ConfigurationFile) bool {
+	if len(f.Only) > 0 && !matchesAny(f.Only, c.RepositoryName) {
+		return false
+	}
+	if matchesAny(f.Exclude, c.RepositoryName) {
+		return false
+	}
+	return f.Selector.Matches(c.Labels)
+}
+
+// matchesAny returns true if the name matches any of the globs
+func matchesAny(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		desc    string
+		input   string
+		want    Selector
+		wantErr string
+	}{
+		{
+			desc:  "Empty selector",
+			input: " ",
+			want:  Selector{},
+		},
+		{
+			desc:  "All the operators",
+			input: "team=payments, env!=dev,tier==1,critical,!deprecated",
+			want: Selector{
+				{Key: "team", Operator: "=", Value: "payments"},
+				{Key: "env", Operator: "!=", Value: "dev"},
+				{Key: "tier", Operator: "=", Value: "1"},
+				{Key: "critical", Operator: "exists"},
+				{Key: "deprecated", Operator: "!exists"},
+			},
+		},
+		{
+			desc:  "Empty value",
+			input: "team=",
+			want:  Selector{{Key: "team", Operator: "=", Value: ""}},
+		},
+		{
+			desc:    "Empty key",
+			input:   "team=payments,=dev",
+			wantErr: `invalid label requirement "=dev" in selector "team=payments,=dev"`,
+		},
+		{
+			desc:    "Invalid value",
+			input:   "team=pay ments",
+			wantErr: `invalid label requirement "team=pay ments" in selector "team=pay ments"`,
+		},
+		{
+			desc:    "Empty requirement",
+			input:   "team=payments,",
+			wantErr: `invalid label requirement "" in selector "team=payments,"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			s, err := ParseSelector(test.input)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, s)
+		})
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	payments := ConfigurationFile{RepositoryName: "payments/api", Labels: map[string]string{"team": "payments", "env": "prod"}}
+	paymentsDev := ConfigurationFile{RepositoryName: "payments/api-dev", Labels: map[string]string{"team": "payments", "env": "dev"}}
+	search := ConfigurationFile{RepositoryName: "search", Labels: map[string]string{"team": "search"}}
+	unlabelled := ConfigurationFile{RepositoryName: "payments/legacy"}
+
+	selector := func(s string) Selector {
+		sel, err := ParseSelector(s)
+		assert.NoError(t, err)
+		return sel
+	}
+
+	tests := []struct {
+		desc   string
+		filter Filter
+		want   []string
+	}{
+		{
+			desc:   "Empty filter",
+			filter: Filter{},
+			want:   []string{"payments/api", "payments/api-dev", "search", "payments/legacy"},
+		},
+		{
+			desc:   "Only",
+			filter: Filter{Only: []string{"payments/*"}},
+			want:   []string{"payments/api", "payments/api-dev", "payments/legacy"},
+		},
+		{
+			desc:   "A glob does not match a slash",
+			filter: Filter{Only: []string{"*"}},
+			want:   []string{"search"},
+		},
+		{
+			desc:   "Exclude over only",
+			filter: Filter{Only: []string{"payments/*"}, Exclude: []string{"*/*-dev", "*/legacy"}},
+			want:   []string{"payments/api"},
+		},
+		{
+			desc:   "Selector",
+			filter: Filter{Selector: selector("team=payments,env!=dev")},
+			want:   []string{"payments/api"},
+		},
+		{
+			desc:   "Missing label",
+			filter: Filter{Selector: selector("env!=dev")},
+			want:   []string{"payments/api", "search", "payments/legacy"},
+		},
+		{
+			desc:   "Label does not exist",
+			filter: Filter{Selector: selector("!team")},
+			want:   []string{"payments/legacy"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got := []string{}
+			for _, c := range []ConfigurationFile{payments, paymentsDev, search, unlabelled} {
+				if test.filter.Matches(c) {
+					got = append(got, c.RepositoryName)
+				}
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestFilterMatchesFile(t *testing.T) {
+	files := []string{"files/payments/api.yaml", "files/payments/worker.yaml", "files/search.yaml", "files/payments-legacy.yaml"}
+
+	tests := []struct {
+		desc  string
+		files []string
+		want  []string
+	}{
+		{
+			desc: "No files",
+			want: files,
+		},
+		{
+			desc:  "Directory",
+			files: []string{"files/payments/"},
+			want:  []string{"files/payments/api.yaml", "files/payments/worker.yaml"},
+		},
+		{
+			desc:  "Path and glob",
+			files: []string{"./files/search.yaml", "files/*/w*.yaml"},
+			want:  []string{"files/payments/worker.yaml", "files/search.yaml"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			f := Filter{Files: test.files}
+			got := []string{}
+			for _, file := range files {
+				if f.MatchesFile(file) {
+					got = append(got, file)
+				}
+			}
+			assert.Equal(t, test.want, got)
+			assert.Equal(t, len(test.files) == 0, f.IsEmpty())
+		})
+	}
+}
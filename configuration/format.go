@@ -0,0 +1,304 @@
+package configuration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	yamlv2 "gopkg.in/yaml.v2"
+	// yaml.v3 keeps the comments of the files it rewrites, which yaml.v2 drops
+	"gopkg.in/yaml.v3"
+)
+
+// policyKeys are the keys of a policy document and of its statements, in their canonical order
+// The other keys follow, sorted
+var policyKeys = []string{"Version", "Id", "Statement"}
+var statementKeys = []string{"Sid", "Effect", "Principal", "NotPrincipal", "Action", "NotAction", "Resource", "NotResource", "Condition"}
+
+// FormatYaml returns the configuration file in its canonical form
+// The keys follow the order of the fields of ConfigurationFile, and of the structures it contains. The keys of the maps, like
+// labels, are sorted. Unknown keys are kept last. The comments are kept with the keys they are attached to
+// It returns an error if the file is not valid yaml, or if the canonical form would not load as the same configuration
+func FormatYaml(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return data, nil
+	}
+	root := doc.Content[0]
+	// The comment at the top of the file stays there, whatever the first key
+	if doc.HeadComment == "" && root.Kind == yaml.MappingNode && len(root.Content) > 0 {
+		doc.HeadComment = root.Content[0].HeadComment
+		root.Content[0].HeadComment = ""
+	}
+	orderMapping(root, reflect.TypeOf(ConfigurationFile{}))
+	normalizeStyle(root)
+
+	var b bytes.Buffer
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	if err := e.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+
+	// The configuration files are loaded with yaml.v2: ensure the canonical form is read the same way
+	var before, after ConfigurationFile
+	errBefore := yamlv2.Unmarshal(data, &before)
+	errAfter := yamlv2.Unmarshal(b.Bytes(), &after)
+	if errBefore == nil && (errAfter != nil || !reflect.DeepEqual(before, after)) {
+		return nil, errors.New("the canonical form would not load as the same configuration")
+	}
+
+	return b.Bytes(), nil
+}
+
+// orderMapping will sort the keys of the mapping node in the order of the yaml fields of the structure t,
+// the fields of the nested structures in their own order, and the keys of the nested maps alphabetically
+func orderMapping(n *yaml.Node, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		order := make(map[string]int)
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			order[name] = i
+			fields[name] = t.Field(i).Type
+		}
+		sortPairs(n, func(a, b string) bool {
+			ia, oka := order[a]
+			ib, okb := order[b]
+			if oka != okb {
+				return oka
+			}
+			return oka && ia < ib
+		})
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if ft, ok := fields[n.Content[i].Value]; ok {
+				orderMapping(n.Content[i+1], ft)
+			}
+		}
+	case reflect.Map:
+		sortPairs(n, func(a, b string) bool { return a < b })
+	}
+}
+
+// normalizeStyle will write the node and its children in block style, and their strings quoted only when needed
+// The literal and folded multiline strings are kept as such
+func normalizeStyle(n *yaml.Node) {
+	if n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+		n.Style = 0
+	}
+	for _, c := range n.Content {
+		normalizeStyle(c)
+	}
+}
+
+// sortPairs will stable sort the key/value pairs of the mapping node by key
+func sortPairs(n *yaml.Node, less func(a, b string) bool) {
+	pairs := make([][2]*yaml.Node, 0, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return less(pairs[i][0].Value, pairs[j][0].Value) })
+	for i, p := range pairs {
+		n.Content[2*i], n.Content[2*i+1] = p[0], p[1]
+	}
+}
+
+// FormatPolicy returns the policy in its canonical form, indented by 4 spaces
+// The keys of the document and of the statements are in the order of policyKeys and statementKeys, the other keys sorted
+// The principals lists are sorted and the Sids are in PascalCase, see CanonicalSid. Numbers are kept as written
+// The managed prefix of a Sid, if any, is kept as it is, see ManagedSid
+// It returns an error if the policy is not a single json document, or if a Sid has no canonical form or the one of another Sid
+func FormatPolicy(data []byte, managedPrefix string) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var doc interface{}
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New("not a single json document")
+	}
+
+	if m, ok := doc.(map[string]interface{}); ok {
+		// sids are the Sids of the statements already formatted, by canonical Sid
+		sids := make(map[string]string)
+		switch s := m["Statement"].(type) {
+		case []interface{}:
+			for _, st := range s {
+				if err := formatStatement(st, managedPrefix, sids); err != nil {
+					return nil, err
+				}
+			}
+		case map[string]interface{}:
+			if err := formatStatement(s, managedPrefix, sids); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if err := writeJSON(&b, doc, "", policyKeys); err != nil {
+		return nil, err
+	}
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
+
+// formatStatement will sort the principals lists of the statement and set its Sid in PascalCase, after its managed prefix if any
+// sids are the original Sids of the statements already formatted, by canonical Sid, the Sid of the statement is added to them
+// It returns an error if the canonical Sid is empty while the Sid is not, or is the one of another statement
+func formatStatement(v interface{}, managedPrefix string, sids map[string]string) error {
+	st, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if sid, ok := st["Sid"].(string); ok {
+		canonical := ManagedSid(sid, managedPrefix)
+		if canonical == "" && sid != "" {
+			return fmt.Errorf("Sid %q has no letter or digit", sid)
+		}
+		if other, ok := sids[canonical]; ok && canonical != "" {
+			if other == sid {
+				return fmt.Errorf("duplicate Sid %q", sid)
+			}
+			return fmt.Errorf("Sids %q and %q both become %q", other, sid, canonical)
+		}
+		sids[canonical] = sid
+		st["Sid"] = canonical
+	}
+	for _, k := range []string{"Principal", "NotPrincipal"} {
+		principals, ok := st[k].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, p := range principals {
+			if l, ok := p.([]interface{}); ok {
+				sort.SliceStable(l, func(i, j int) bool { return fmt.Sprint(l[i]) < fmt.Sprint(l[j]) })
+			}
+		}
+	}
+	return nil
+}
+
+// CanonicalSid returns the Sid in PascalCase, without the characters other than letters and digits
+// For instance, "cross-account pull" becomes "CrossAccountPull". A Sid already in PascalCase is unchanged
+func CanonicalSid(sid string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range sid {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ManagedSid returns the canonical form of the Sid: the managed prefix if the Sid starts with it, followed by the rest of the Sid in PascalCase
+// For instance, with the "ecrgo-" prefix, "ecrgo-cross-account pull" becomes "ecrgo-CrossAccountPull"
+func ManagedSid(sid, managedPrefix string) string {
+	if managedPrefix != "" && strings.HasPrefix(sid, managedPrefix) {
+		return managedPrefix + CanonicalSid(strings.TrimPrefix(sid, managedPrefix))
+	}
+	return CanonicalSid(sid)
+}
+
+// writeJSON will write v indented by 4 spaces from indent, with the keys of its objects in the order of keys first
+// The statements are written with statementKeys, and the other nested objects with their keys sorted
+func writeJSON(b *bytes.Buffer, v interface{}, indent string, keys []string) error {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if len(t) == 0 {
+			b.WriteString("{}")
+			return nil
+		}
+		b.WriteString("{\n")
+		for i, k := range orderedKeys(t, keys) {
+			name, _ := json.Marshal(k)
+			b.WriteString(indent + "    " + string(name) + ": ")
+			var nested []string
+			if k == "Statement" && indent == "" {
+				nested = statementKeys
+			}
+			if err := writeJSON(b, t[k], indent+"    ", nested); err != nil {
+				return err
+			}
+			if i < len(t)-1 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(indent + "}")
+	case []interface{}:
+		if len(t) == 0 {
+			b.WriteString("[]")
+			return nil
+		}
+		b.WriteString("[\n")
+		for i, e := range t {
+			b.WriteString(indent + "    ")
+			if err := writeJSON(b, e, indent+"    ", keys); err != nil {
+				return err
+			}
+			if i < len(t)-1 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(indent + "]")
+	default:
+		var e bytes.Buffer
+		enc := json.NewEncoder(&e)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(t); err != nil {
+			return err
+		}
+		b.Write(bytes.TrimRight(e.Bytes(), "\n"))
+	}
+	return nil
+}
+
+// orderedKeys returns the keys of m in the order of keys first, the other ones sorted
+func orderedKeys(m map[string]interface{}, keys []string) []string {
+	ordered := []string{}
+	for _, k := range keys {
+		if _, ok := m[k]; ok {
+			ordered = append(ordered, k)
+		}
+	}
+	others := []string{}
+	for k := range m {
+		if !contains(keys, k) {
+			others = append(others, k)
+		}
+	}
+	sort.Strings(others)
+	return append(ordered, others...)
+}
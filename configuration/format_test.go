@@ -0,0 +1,227 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatYaml(t *testing.T) {
+	tests := []struct {
+		desc    string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{
+			desc:  "Already formatted",
+			input: "repositoryName: app\nrepositoryPolicyFile: files/app.json\n",
+			want:  "repositoryName: app\nrepositoryPolicyFile: files/app.json\n",
+		},
+		{
+			desc: "Keys, indentation and styles",
+			input: `labels:
+    team: payments
+    env: prod
+repositoryPolicyFile: 'files/app.json'
+repositoryName: app
+regions: [eu-west-1, us-east-1]
+account:
+    roleArn: arn:aws:iam::111111111111:role/ecr-go
+    id: "111111111111"
+`,
+			want: `repositoryName: app
+repositoryPolicyFile: files/app.json
+regions:
+  - eu-west-1
+  - us-east-1
+account:
+  id: "111111111111"
+  roleArn: arn:aws:iam::111111111111:role/ecr-go
+labels:
+  env: prod
+  team: payments
+`,
+		},
+		{
+			desc: "Comments are kept",
+			input: `# Payments API
+repositoryPolicyFile: files/app.json # shared with the workers
+# Owned by the payments team
+repositoryName: app
+`,
+			want: `# Payments API
+
+# Owned by the payments team
+repositoryName: app
+repositoryPolicyFile: files/app.json # shared with the workers
+`,
+		},
+		{
+			desc: "Nested structures and multiline strings",
+			input: `type: public
+catalogData:
+  usageText: docker pull app
+  aboutText: |
+    # App
+    The app.
+  description: App
+repositoryName: app
+repositoryPolicyFile: files/app.json
+`,
+			want: `repositoryName: app
+repositoryPolicyFile: files/app.json
+type: public
+catalogData:
+  description: App
+  aboutText: |
+    # App
+    The app.
+  usageText: docker pull app
+`,
+		},
+		{
+			desc:  "Unknown keys are kept last",
+			input: "owner: payments\nrepositoryPolicyFile: files/app.json\nrepositoryName: app\n",
+			want:  "repositoryName: app\nrepositoryPolicyFile: files/app.json\nowner: payments\n",
+		},
+		{
+			desc:    "Invalid yaml",
+			input:   "repositoryName: [app\n",
+			wantErr: "yaml: line 1: did not find expected ',' or ']'",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := FormatYaml([]byte(test.input))
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, string(got))
+
+			// The canonical form is stable
+			again, err := FormatYaml(got)
+			assert.NoError(t, err)
+			assert.Equal(t, string(got), string(again))
+		})
+	}
+}
+
+func TestFormatPolicy(t *testing.T) {
+	tests := []struct {
+		desc    string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{
+			desc:  "Keys, principals, Sids and numbers",
+			input: `{"Statement":[{"Principal":{"AWS":["arn:aws:iam::222222222222:root","arn:aws:iam::111111111111:root"]},"Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"],"Effect":"Allow","Sid":"cross-account pull","Condition":{"NumericLessThan":{"aws:MultiFactorAuthAge":3600.0}}}],"Version":"2008-10-17"}`,
+			want: `{
+    "Version": "2008-10-17",
+    "Statement": [
+        {
+            "Sid": "CrossAccountPull",
+            "Effect": "Allow",
+            "Principal": {
+                "AWS": [
+                    "arn:aws:iam::111111111111:root",
+                    "arn:aws:iam::222222222222:root"
+                ]
+            },
+            "Action": [
+                "ecr:BatchGetImage",
+                "ecr:GetDownloadUrlForLayer"
+            ],
+            "Condition": {
+                "NumericLessThan": {
+                    "aws:MultiFactorAuthAge": 3600.0
+                }
+            }
+        }
+    ]
+}
+`,
+		},
+		{
+			desc:  "Single statement and empty values",
+			input: `{"Version":"2012-10-17","Statement":{"Sid":"Pull","Principal":"*","Effect":"Allow","Action":[],"Condition":{}}}`,
+			want: `{
+    "Version": "2012-10-17",
+    "Statement": {
+        "Sid": "Pull",
+        "Effect": "Allow",
+        "Principal": "*",
+        "Action": [],
+        "Condition": {}
+    }
+}
+`,
+		},
+		{
+			desc:    "Invalid json",
+			input:   `{"Version":`,
+			wantErr: "unexpected EOF",
+		},
+		{
+			desc:    "Several documents",
+			input:   `{} {}`,
+			wantErr: "not a single json document",
+		},
+		{
+			desc:    "Colliding Sids",
+			input:   `{"Statement":[{"Sid":"Allow-Pull","Effect":"Allow"},{"Sid":"AllowPull","Effect":"Allow"}]}`,
+			wantErr: `Sids "Allow-Pull" and "AllowPull" both become "AllowPull"`,
+		},
+		{
+			desc:    "Duplicate Sids",
+			input:   `{"Statement":[{"Sid":"Pull","Effect":"Allow"},{"Sid":"Pull","Effect":"Allow"}]}`,
+			wantErr: `duplicate Sid "Pull"`,
+		},
+		{
+			desc:    "Sid without letter or digit",
+			input:   `{"Statement":{"Sid":"--","Effect":"Allow"}}`,
+			wantErr: `Sid "--" has no letter or digit`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := FormatPolicy([]byte(test.input), "")
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, string(got))
+
+			again, err := FormatPolicy(got, "")
+			assert.NoError(t, err)
+			assert.Equal(t, string(got), string(again))
+		})
+	}
+}
+
+func TestCanonicalSid(t *testing.T) {
+	tests := map[string]string{
+		"CrossAccountPull":   "CrossAccountPull",
+		"cross-account pull": "CrossAccountPull",
+		"allow_push_CI":      "AllowPushCI",
+		"pull 2":             "Pull2",
+		"élan":               "Lan",
+		"":                   "",
+	}
+	for input, want := range tests {
+		assert.Equal(t, want, CanonicalSid(input), input)
+	}
+}
+
+func TestManagedSid(t *testing.T) {
+	assert.Equal(t, "ecrgo-CrossAccountPull", ManagedSid("ecrgo-cross-account pull", "ecrgo-"))
+	assert.Equal(t, "ecrgo-CrossAccountPull", ManagedSid("ecrgo-CrossAccountPull", "ecrgo-"))
+	assert.Equal(t, "EcrgoPull", ManagedSid("ecrgo pull", "ecrgo-"))
+	assert.Equal(t, "EcrgoPull", ManagedSid("ecrgo-pull", ""))
+}
@@ -0,0 +1,72 @@
+package configuration
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// OrganizationSnapshot is a local copy of the accounts of the organizations and organizational units, declared in the organization file
+// It lets the access report list the accounts granted access by org:<organization ID> and ou:<organizational unit ID>
+type OrganizationSnapshot struct {
+	Organizations map[string][]string `yaml:"organizations"` // Account IDs by organization ID
+	Units         map[string][]string `yaml:"units"`         // Account IDs by organizational unit ID, including the ones of its child units
+}
+
+// LoadOrganizationSnapshot will load the snapshot of the given organization file
+// It returns the snapshot, or an error if the file cannot be read, or an ID is not the one of an organization,
+// an organizational unit or an account
+func LoadOrganizationSnapshot(path string) (*OrganizationSnapshot, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var o OrganizationSnapshot
+	if err := yaml.UnmarshalStrict(d, &o); err != nil {
+		return nil, err
+	}
+	for id, accounts := range o.Organizations {
+		if !OrganizationRegexp.MatchString(id) {
+			return nil, fmt.Errorf("%s: organization ID must be o-<10 to 32 lowercase letters or digits>, got %q", path, id)
+		}
+		if err := checkAccountIDs(accounts); err != nil {
+			return nil, fmt.Errorf("%s: organization %s: %v", path, id, err)
+		}
+	}
+	for id, accounts := range o.Units {
+		if !UnitRegexp.MatchString(id) {
+			return nil, fmt.Errorf("%s: organizational unit ID must be ou-<root ID>-<unit ID>, got %q", path, id)
+		}
+		if err := checkAccountIDs(accounts); err != nil {
+			return nil, fmt.Errorf("%s: organizational unit %s: %v", path, id, err)
+		}
+	}
+	return &o, nil
+}
+
+// checkAccountIDs returns an error if any of the IDs is not a 12 digits AWS account ID
+func checkAccountIDs(ids []string) error {
+	for _, id := range ids {
+		if !accountIDRegexp.MatchString(id) {
+			return fmt.Errorf("account must be a 12 digits AWS account ID, got %q", id)
+		}
+	}
+	return nil
+}
+
+// Members returns the account IDs by organization and organizational unit ID. A nil snapshot has no member
+func (o *OrganizationSnapshot) Members() map[string][]string {
+	members := make(map[string][]string)
+	if o == nil {
+		return members
+	}
+	for id, accounts := range o.Organizations {
+		members[id] = accounts
+	}
+	for id, accounts := range o.Units {
+		members[id] = accounts
+	}
+	return members
+}
@@ -0,0 +1,63 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadOrganizationSnapshot(t *testing.T) {
+	tests := []struct {
+		desc    string
+		file    string
+		want    *OrganizationSnapshot
+		wantErr string
+	}{
+		{
+			desc: "Valid organization file",
+			file: "testdata/organization/organization.yaml",
+			want: &OrganizationSnapshot{
+				Organizations: map[string][]string{"o-a1b2c3d4e5": {"111111111111", "222222222222", "333333333333"}},
+				Units:         map[string][]string{"ou-ab12-11111111": {"111111111111", "222222222222"}},
+			},
+		},
+		{
+			desc:    "Invalid organizational unit ID",
+			file:    "testdata/organization/invalid_unit.yaml",
+			wantErr: `testdata/organization/invalid_unit.yaml: organizational unit ID must be ou-<root ID>-<unit ID>, got "o-a1b2c3d4e5/ou-ab12-11111111"`,
+		},
+		{
+			desc:    "Invalid account ID",
+			file:    "testdata/organization/invalid_account.yaml",
+			wantErr: `testdata/organization/invalid_account.yaml: organization o-a1b2c3d4e5: account must be a 12 digits AWS account ID, got "prod"`,
+		},
+		{
+			desc:    "Organization file doesn't exists",
+			file:    "testdata/organization/doesnotexists.yaml",
+			wantErr: "open testdata/organization/doesnotexists.yaml: no such file or directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			snapshot, err := LoadOrganizationSnapshot(test.file)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, snapshot)
+		})
+	}
+}
+
+func TestOrganizationSnapshotMembers(t *testing.T) {
+	snapshot := &OrganizationSnapshot{
+		Organizations: map[string][]string{"o-a1b2c3d4e5": {"111111111111", "222222222222"}},
+		Units:         map[string][]string{"ou-ab12-11111111": {"111111111111"}},
+	}
+	assert.Equal(t, map[string][]string{"o-a1b2c3d4e5": {"111111111111", "222222222222"}, "ou-ab12-11111111": {"111111111111"}}, snapshot.Members())
+
+	var none *OrganizationSnapshot
+	assert.Empty(t, none.Members())
+}
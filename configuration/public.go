@@ -0,0 +1,104 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	// RepositoryTypePrivate is the type of the ECR repositories, the default
+	RepositoryTypePrivate = "private"
+	// RepositoryTypePublic is the type of the ECR Public repositories
+	RepositoryTypePublic = "public"
+	// PublicRegion is the only region of the ECR Public API
+	PublicRegion = "us-east-1"
+)
+
+// Architectures and OperatingSystems supported by the ECR Public Gallery
+// Other values are accepted by ECR Public, but are not displayed nor searchable in the gallery
+var (
+	PublicArchitectures    = []string{"ARM", "ARM 64", "x86", "x86-64"}
+	PublicOperatingSystems = []string{"Linux", "Windows"}
+)
+
+// CatalogData is the catalog data of an ECR Public repository, displayed in the ECR Public Gallery
+// The about and usage texts are in markdown format
+// It is saved in the backups without its logo
+type CatalogData struct {
+	Description      string   `yaml:"description" json:"description,omitempty"`
+	AboutText        string   `yaml:"aboutText" json:"aboutText,omitempty"`
+	UsageText        string   `yaml:"usageText" json:"usageText,omitempty"`
+	Architectures    []string `yaml:"architectures" json:"architectures,omitempty"`
+	OperatingSystems []string `yaml:"operatingSystems" json:"operatingSystems,omitempty"`
+	LogoFile         string   `yaml:"logoFile" json:"-"` // PNG file of the logo of the repository. Empty means no logo
+	Logo             []byte   `yaml:"-" json:"-"`        // Content of LogoFile
+}
+
+// IsPublic returns true if the repository is an ECR Public repository
+func (c *ConfigurationFile) IsPublic() bool {
+	return c.Type == RepositoryTypePublic
+}
+
+// validateType will ensure the type of the repository is known and consistent with its settings
+// It returns any error encountered
+func (c *ConfigurationFile) validateType() error {
+	switch c.Type {
+	case "", RepositoryTypePrivate:
+		if c.CatalogData != nil {
+			return errors.New("CatalogData can only be set on a public repository")
+		}
+	case RepositoryTypePublic:
+		if len(c.Regions) > 0 {
+			return fmt.Errorf("Regions cannot be set on a public repository, ECR Public is only available in %s", PublicRegion)
+		}
+	default:
+		return fmt.Errorf("Type must be %s or %s, got %q", RepositoryTypePrivate, RepositoryTypePublic, c.Type)
+	}
+	return nil
+}
+
+// loadLogo will load the logo of the catalog data from LogoFile, if set
+// It returns any error encountered
+func (d *CatalogData) loadLogo() error {
+	if d.LogoFile == "" {
+		return nil
+	}
+	logo, err := ioutil.ReadFile(d.LogoFile)
+	if err != nil {
+		return err
+	}
+	if len(logo) < len(pngSignature) || string(logo[:len(pngSignature)]) != pngSignature {
+		return fmt.Errorf("LogoFile %s is not a PNG file", d.LogoFile)
+	}
+	d.Logo = logo
+	return nil
+}
+
+// Unsupported returns the architectures and operating systems of the catalog data not supported by the ECR Public Gallery
+func (d *CatalogData) Unsupported() []string {
+	unsupported := []string{}
+	for _, a := range d.Architectures {
+		if !contains(PublicArchitectures, a) {
+			unsupported = append(unsupported, a)
+		}
+	}
+	for _, o := range d.OperatingSystems {
+		if !contains(PublicOperatingSystems, o) {
+			unsupported = append(unsupported, o)
+		}
+	}
+	return unsupported
+}
+
+// pngSignature is the first bytes of any PNG file
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package configuration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Target is a named set of AWS connection settings, declared in the targets file
+// Empty settings mean the ones of the default AWS session
+type Target struct {
+	Profile        string `yaml:"profile"`        // Shared config profile
+	Region         string `yaml:"region"`         // Default region of the repositories of the target
+	EndpointURL    string `yaml:"endpointUrl"`    // Custom ECR endpoint: VPC or FIPS endpoint, local emulator ...
+	STSEndpointURL string `yaml:"stsEndpointUrl"` // Custom STS endpoint of the identity check. Empty means the one of the region
+}
+
+// Targets are the targets of the targets file, by name
+type Targets map[string]Target
+
+// targetsFile is the structure of the targets file
+type targetsFile struct {
+	Targets Targets `yaml:"targets"`
+}
+
+// LoadTargets will load the targets of the given targets file
+// It returns the targets by name or any error encountered
+func LoadTargets(path string) (Targets, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f targetsFile
+	if err := yaml.UnmarshalStrict(d, &f); err != nil {
+		return nil, err
+	}
+	if f.Targets == nil {
+		f.Targets = Targets{}
+	}
+
+	for name, t := range f.Targets {
+		if name == "" {
+			return nil, fmt.Errorf("%s: target name must not be empty", path)
+		}
+		if !isEndpointURL(t.EndpointURL) {
+			return nil, fmt.Errorf("%s: target %s endpointUrl must be an http or https URL, got %q", path, name, t.EndpointURL)
+		}
+		if !isEndpointURL(t.STSEndpointURL) {
+			return nil, fmt.Errorf("%s: target %s stsEndpointUrl must be an http or https URL, got %q", path, name, t.STSEndpointURL)
+		}
+	}
+
+	return f.Targets, nil
+}
+
+// isEndpointURL returns true if the endpoint is empty or an http or https URL with a host
+func isEndpointURL(endpoint string) bool {
+	if endpoint == "" {
+		return true
+	}
+	u, err := url.Parse(endpoint)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
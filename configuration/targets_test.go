@@ -0,0 +1,63 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTargets(t *testing.T) {
+	tests := []struct {
+		desc    string
+		file    string
+		want    Targets
+		wantErr string
+	}{
+		{
+			desc: "Valid targets file",
+			file: "testdata/targets/targets.yaml",
+			want: Targets{
+				"local": {Region: "us-east-1", EndpointURL: "http://localhost:4566", STSEndpointURL: "http://localhost:4566"},
+				"gov":   {Profile: "gov", Region: "us-gov-west-1", EndpointURL: "https://ecr-fips.us-gov-west-1.amazonaws.com"},
+				"prod":  {Profile: "prod"},
+			},
+		},
+		{
+			desc: "Empty targets file",
+			file: "testdata/targets/empty.yaml",
+			want: Targets{},
+		},
+		{
+			desc:    "Invalid endpoint URL",
+			file:    "testdata/targets/invalid_endpoint.yaml",
+			wantErr: `testdata/targets/invalid_endpoint.yaml: target local endpointUrl must be an http or https URL, got "localhost:4566"`,
+		},
+		{
+			desc:    "Invalid STS endpoint URL",
+			file:    "testdata/targets/invalid_sts_endpoint.yaml",
+			wantErr: `testdata/targets/invalid_sts_endpoint.yaml: target local stsEndpointUrl must be an http or https URL, got "localhost:4566"`,
+		},
+		{
+			desc:    "Unknown field",
+			file:    "testdata/targets/unknown_field.yaml",
+			wantErr: "yaml: unmarshal errors:\n  line 3: field endpoint not found in type configuration.Target",
+		},
+		{
+			desc:    "Targets file doesn't exists",
+			file:    "testdata/targets/doesnotexists.yaml",
+			wantErr: "open testdata/targets/doesnotexists.yaml: no such file or directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			targets, err := LoadTargets(test.file)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, targets)
+		})
+	}
+}
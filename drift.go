@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/lescactus/ecr-go/ecrupdater"
+	"github.com/lescactus/ecr-go/summary"
+	"go.uber.org/zap"
+)
+
+// driftSettings are the flags of the drift command
+type driftSettings struct {
+	unmanaged bool
+}
+
+// driftOptions are the flags of the drift command of the current run
+var driftOptions driftSettings
+
+// driftFlags will register the flags of the drift command
+func driftFlags(fs *flag.FlagSet) {
+	driftOptions = driftSettings{}
+	fs.BoolVar(&driftOptions.unmanaged, "unmanaged", false, "Report the private repositories of the configured registries that no configuration file covers, as drift")
+}
+
+// driftCommand will compare the policy and the managed settings of each repository with its configuration, without making any change
+// It exits with exitDrift if any repository is drifted, missing or unmanaged, and with exitFailed if any repository cannot be compared
+func driftCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	repositories, err := loadRepositories(logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitFailed
+	}
+
+	// The repositories not selected would be reported as unmanaged
+	if driftOptions.unmanaged && !repositories.filter.IsEmpty() {
+		logger.Error("Error: --unmanaged cannot be combined with a filter")
+		return exitUsage
+	}
+
+	clients := newClientFactory(logger, repositories.targets, summary.NewCollector())
+	jobs := repositories.jobs(clients)
+
+	ctx, stop, cancel := runContext(logger)
+	defer cancel()
+
+	drifts := []ecrupdater.Drift{}
+	for _, c := range ecrupdater.PlanJobs(ctx, stop, jobs, appconfig.Config.Run.Workers) {
+		drifts = append(drifts, ecrupdater.ChangeDrift(c))
+	}
+	if driftOptions.unmanaged {
+		drifts = append(drifts, ecrupdater.UnmanagedJobs(ctx, jobs)...)
+	}
+
+	counts := make(map[ecrupdater.DriftStatus]int)
+	for _, d := range drifts {
+		counts[d.Status]++
+		fmt.Fprintf(out, "  %s\n", d)
+	}
+	fmt.Fprintf(out, "\nDrift: %d drifted, %d missing, %d in sync, %d unmanaged, %d errors\n", counts[ecrupdater.DriftDrifted], counts[ecrupdater.DriftMissing], counts[ecrupdater.DriftInSync], counts[ecrupdater.DriftUnmanaged], counts[ecrupdater.DriftError])
+
+	switch {
+	case counts[ecrupdater.DriftError] > 0:
+		return exitFailed
+	case counts[ecrupdater.DriftDrifted]+counts[ecrupdater.DriftMissing]+counts[ecrupdater.DriftUnmanaged] > 0:
+		return exitDrift
+	}
+	return exitOK
+}
@@ -0,0 +1,223 @@
+package ecrupdater
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/lescactus/ecr-go/backup"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/summary"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockedECRRegistry is an in-memory registry
+// Repositories are the keys of policies, prefixed by "<registry ID>/" when a registry ID is given.
+// An empty policy means the repository has no policy
+type mockedECRRegistry struct {
+	ecriface.ECRAPI
+	sync.Mutex
+	policies map[string]string
+	invalid  string // Policy text rejected with an InvalidParameterException
+}
+
+func (m *mockedECRRegistry) GetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.GetRepositoryPolicyInput, opts ...request.Option) (*ecr.GetRepositoryPolicyOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	p, ok := m.policies[registryKey(input.RegistryId, input.RepositoryName)]
+	if !ok {
+		return nil, awserr.New(ecr.ErrCodeRepositoryNotFoundException, "The repository does not exist", nil)
+	}
+	if p == "" {
+		return nil, awserr.New(ecr.ErrCodeRepositoryPolicyNotFoundException, "Repository policy does not exist", nil)
+	}
+	return &ecr.GetRepositoryPolicyOutput{RepositoryName: input.RepositoryName, PolicyText: aws.String(p)}, nil
+}
+
+func (m *mockedECRRegistry) SetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.SetRepositoryPolicyInput, opts ...request.Option) (*ecr.SetRepositoryPolicyOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.policies[registryKey(input.RegistryId, input.RepositoryName)]; !ok {
+		return nil, awserr.New(ecr.ErrCodeRepositoryNotFoundException, "The repository does not exist", nil)
+	}
+	if m.invalid != "" && aws.StringValue(input.PolicyText) == m.invalid {
+		return nil, awserr.New(ecr.ErrCodeInvalidParameterException, "Invalid repository policy provided", nil)
+	}
+	m.policies[registryKey(input.RegistryId, input.RepositoryName)] = aws.StringValue(input.PolicyText)
+	return &ecr.SetRepositoryPolicyOutput{RepositoryName: input.RepositoryName, PolicyText: input.PolicyText}, nil
+}
+
+func (m *mockedECRRegistry) DeleteRepositoryPolicyWithContext(ctx aws.Context, input *ecr.DeleteRepositoryPolicyInput, opts ...request.Option) (*ecr.DeleteRepositoryPolicyOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	p, ok := m.policies[registryKey(input.RegistryId, input.RepositoryName)]
+	if !ok {
+		return nil, awserr.New(ecr.ErrCodeRepositoryNotFoundException, "The repository does not exist", nil)
+	}
+	if p == "" {
+		return nil, awserr.New(ecr.ErrCodeRepositoryPolicyNotFoundException, "Repository policy does not exist", nil)
+	}
+	m.policies[registryKey(input.RegistryId, input.RepositoryName)] = ""
+	return &ecr.DeleteRepositoryPolicyOutput{RepositoryName: input.RepositoryName, PolicyText: aws.String(p)}, nil
+}
+
+// registryKey returns the key of a repository in mockedECRRegistry.policies
+func registryKey(registryID, name *string) string {
+	if registryID == nil {
+		return aws.StringValue(name)
+	}
+	return aws.StringValue(registryID) + "/" + aws.StringValue(name)
+}
+
+// memoryStore is an in-memory backup.Store
+type memoryStore struct {
+	sync.Mutex
+	metadata map[string]backup.Metadata
+	entries  map[string][]backup.Entry
+	err      error // Returned by Save when set
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		metadata: make(map[string]backup.Metadata),
+		entries:  make(map[string][]backup.Entry),
+	}
+}
+
+func (s *memoryStore) Init(m backup.Metadata) error {
+	s.Lock()
+	defer s.Unlock()
+	s.metadata[m.ID] = m
+	return nil
+}
+
+func (s *memoryStore) Save(id string, e backup.Entry) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.entries[id] = append(s.entries[id], e)
+	return nil
+}
+
+func (s *memoryStore) List() ([]backup.Metadata, error) {
+	s.Lock()
+	defer s.Unlock()
+	l := []backup.Metadata{}
+	for _, m := range s.metadata {
+		l = append(l, m)
+	}
+	return l, nil
+}
+
+func (s *memoryStore) Load(id string) (backup.Metadata, []backup.Entry, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.metadata[id], s.entries[id], nil
+}
+
+func TestWorkBackup(t *testing.T) {
+	tests := []struct {
+		desc       string
+		repository string
+		storeErr   error
+		want       []backup.Entry
+		wantPolicy string
+		wantErr    bool
+	}{
+		{
+			desc:       "Existing policy is saved",
+			repository: "withpolicy",
+			want:       []backup.Entry{{RepositoryName: "withpolicy", Exists: true, PolicyText: "old"}},
+			wantPolicy: "new",
+		},
+		{
+			desc:       "Missing policy is saved",
+			repository: "withoutpolicy",
+			want:       []backup.Entry{{RepositoryName: "withoutpolicy", Exists: false}},
+			wantPolicy: "new",
+		},
+		{
+			desc:       "Repository not found",
+			repository: "notfound",
+			wantErr:    true,
+		},
+		{
+			desc:       "Backup failure prevents the update",
+			repository: "withpolicy",
+			storeErr:   errors.New("disk full"),
+			wantPolicy: "old",
+			wantErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			m := &mockedECRRegistry{policies: map[string]string{"withpolicy": "old", "withoutpolicy": ""}}
+			s := newMemoryStore()
+			s.err = test.storeErr
+			e := ECRUpdaterClient{
+				Client:   m,
+				Logger:   Logger,
+				Backup:   s,
+				BackupID: "run",
+			}
+			e.Init()
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go e.Work(context.Background(), configuration.ConfigurationFile{RepositoryName: test.repository, RepositoryPolicy: []byte("new")}, &wg)
+			wg.Wait()
+
+			assert := assert.New(t)
+			assert.Equal(test.want, s.entries["run"])
+			r, _ := e.Summary.Get(summary.OperationUpdate, test.repository)
+			if test.wantErr {
+				assert.Equal(summary.StatusFailed, r.Status)
+			} else {
+				assert.Equal(summary.StatusSucceeded, r.Status)
+				assert.Equal(2, r.Attempts)
+			}
+			if test.wantPolicy != "" {
+				assert.Equal(test.wantPolicy, m.policies[test.repository])
+			}
+		})
+	}
+}
+
+func TestRunRestore(t *testing.T) {
+	m := &mockedECRRegistry{policies: map[string]string{
+		"withpolicy":    "new",
+		"withoutpolicy": "new",
+		"stillnopolicy": "",
+	}}
+	e := ECRUpdaterClient{
+		Client: m,
+		Logger: Logger,
+	}
+	e.Init()
+
+	entries := []backup.Entry{
+		{RepositoryName: "withpolicy", Exists: true, PolicyText: "old"},
+		{RepositoryName: "withoutpolicy", Exists: false},
+		{RepositoryName: "stillnopolicy", Exists: false},
+		{RepositoryName: "notfound", Exists: true, PolicyText: "old"},
+	}
+	e.RunRestore(context.Background(), context.Background(), entries, 2)
+
+	assert := assert.New(t)
+	assert.Equal(map[string]string{"withpolicy": "old", "withoutpolicy": "", "stillnopolicy": ""}, m.policies)
+	assert.Equal([]string{"stillnopolicy", "withoutpolicy", "withpolicy"}, repositories(e.Summary, summary.OperationRestore, summary.StatusSucceeded))
+	assert.Equal([]string{"notfound"}, repositories(e.Summary, summary.OperationRestore, summary.StatusFailed))
+}
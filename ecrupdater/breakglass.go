@@ -0,0 +1,123 @@
+package ecrupdater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lescactus/ecr-go/backup"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/summary"
+)
+
+// BreakGlassEdit returns the policy to set on a repository given its current policy, empty if it has none, and the Sids of
+// the break-glass statements it adds or removes. The policy is left as is when no Sid is returned, and deleted when empty
+type BreakGlassEdit func(current string) (string, []string, error)
+
+// BreakGlassResult is the result of a break-glass edit of the live policy of a repository
+type BreakGlassResult struct {
+	Record summary.Record
+	Sids   []string // Sids of the statements added or removed. Empty if the policy was left as is or the edit failed
+}
+
+// RunBreakGlassJobs will apply the edit to the live policy of all the repositories of the jobs concurrently, each job with
+// at most workers concurrent edits. The results are recorded as the given operation
+// It returns the results in the order of the jobs and of their repositories
+func RunBreakGlassJobs(ctx, stop context.Context, jobs []Job, workers int, operation summary.Operation, edit BreakGlassEdit) []BreakGlassResult {
+	results := make([][]BreakGlassResult, len(jobs))
+	parallel(len(jobs), func(i int) {
+		results[i] = jobs[i].Client.RunBreakGlass(ctx, stop, jobs[i].Configs, workers, operation, edit)
+	})
+
+	all := []BreakGlassResult{}
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	return all
+}
+
+// RunBreakGlass will apply the edit to the live policy of all the given repositories, with at most workers concurrent edits
+// It follows the same scheduling and cancellation rules as Run. The configured policies are ignored
+// It returns the results in the order of the repositories
+func (e *ECRUpdaterClient) RunBreakGlass(ctx, stop context.Context, configs []configuration.ConfigurationFile, workers int, operation summary.Operation, edit BreakGlassEdit) []BreakGlassResult {
+	repositories := configRepositories(configs)
+	results := make([]BreakGlassResult, len(repositories))
+	for i, repo := range repositories {
+		results[i].Record = e.newRecord(repo, operation, summary.StatusCancelled)
+	}
+
+	e.schedule(stop, operation, repositories, workers, func(i int, wg *sync.WaitGroup) {
+		defer wg.Done()
+		results[i] = e.breakGlass(ctx, repositories[i], operation, edit)
+	})
+	return results
+}
+
+// breakGlass will apply the edit to the live policy of the repository, saving the current one first if e.Backup is set
+// It will record the result of the edit (succeeded, unchanged, failed or cancelled) in e.Summary
+func (e *ECRUpdaterClient) breakGlass(ctx context.Context, repo repository, operation summary.Operation, edit BreakGlassEdit) BreakGlassResult {
+	result := BreakGlassResult{Record: e.newRecord(repo, operation, summary.StatusSucceeded)}
+	defer func() { e.add(result.Record) }()
+	if ctx.Err() != nil {
+		e.Logger.Warn(fmt.Sprintf("Run interrupted, repository %s will not be processed", repo))
+		result.Record.Status = summary.StatusCancelled
+		return result
+	}
+
+	e.Logger.Info(fmt.Sprintf("Processing the break-glass statements of repository %s ...", repo))
+	start := time.Now()
+
+	// Public repositories have no break-glass statement
+	attempts := 0
+	var err error
+	if e.Public != nil {
+		err = errors.New("break-glass statements are only supported on private repositories")
+	}
+
+	var entry backup.Entry
+	var text string
+	var sids []string
+	if err == nil {
+		entry, attempts, err = e.currentPolicy(ctx, repo)
+	}
+	if err == nil {
+		current := ""
+		if entry.Exists {
+			current = entry.PolicyText
+		}
+		text, sids, err = edit(current)
+	}
+	if err == nil && len(sids) > 0 && e.Backup != nil {
+		err = e.saveBackup(entry)
+	}
+
+	// The new policy is set, or deleted if no statement is left
+	if err == nil && len(sids) > 0 {
+		entry.Exists = text != ""
+		entry.PolicyText = text
+		var a int
+		a, err = e.restorePolicy(ctx, entry)
+		attempts += a
+	}
+
+	result.Record.Duration = time.Since(start)
+	result.Record.Attempts = attempts
+	setError(&result.Record, err)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		e.Logger.Warn(fmt.Sprintf("Run interrupted while processing the repository %v: \"%v\"", repo, ctx.Err()))
+		result.Record.Status = summary.StatusCancelled
+	case err != nil:
+		e.Logger.Error(fmt.Sprintf("Error: An error occured while processing the break-glass statements of the repository %v after %d attempt(s): %s", repo, attempts, errorMessage(err)))
+		result.Record.Status = summary.StatusFailed
+	case len(sids) == 0:
+		e.Logger.Info(fmt.Sprintf("No break-glass statement to change for repository %s", repo))
+		result.Record.Status = summary.StatusUnchanged
+	default:
+		e.Logger.Info(fmt.Sprintf("Break-glass statements %v of repository %s processed", sids, repo))
+		result.Sids = sids
+	}
+	return result
+}
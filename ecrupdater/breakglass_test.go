@@ -0,0 +1,114 @@
+package ecrupdater
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lescactus/ecr-go/backup"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/summary"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunBreakGlass(t *testing.T) {
+	m := &mockedECRRegistry{policies: map[string]string{
+		"granted":   "old",
+		"revoked":   "last",
+		"unchanged": "kept",
+		"invalid":   "invalid",
+		"nopolicy":  "",
+	}}
+	s := newMemoryStore()
+	e := ECRUpdaterClient{
+		Client:   m,
+		Logger:   Logger,
+		Backup:   s,
+		BackupID: "run",
+	}
+	e.Init()
+
+	// The edit adds a statement, deletes the policy if it is the last one, leaves it unchanged or fails
+	edit := func(current string) (string, []string, error) {
+		switch current {
+		case "old", "":
+			return current + "+BreakGlass", []string{"BreakGlass"}, nil
+		case "last":
+			return "", []string{"BreakGlass"}, nil
+		case "invalid":
+			return "", nil, errors.New("invalid policy")
+		}
+		return current, nil, nil
+	}
+	configs := []configuration.ConfigurationFile{}
+	for _, name := range []string{"granted", "revoked", "unchanged", "invalid", "nopolicy", "notfound"} {
+		configs = append(configs, configuration.ConfigurationFile{RepositoryName: name, RepositoryPolicy: []byte("configured")})
+	}
+
+	results := RunBreakGlassJobs(context.Background(), context.Background(), []Job{{Client: &e, Configs: configs}}, 2, summary.OperationGrant, edit)
+
+	assert := assert.New(t)
+	assert.Equal(map[string]string{
+		"granted":   "old+BreakGlass",
+		"revoked":   "",
+		"unchanged": "kept",
+		"invalid":   "invalid",
+		"nopolicy":  "+BreakGlass",
+	}, m.policies)
+	assert.Len(results, 6)
+	for _, r := range results {
+		if r.Record.Status == summary.StatusSucceeded {
+			assert.Equal([]string{"BreakGlass"}, r.Sids, r.Record.Repository)
+		} else {
+			assert.Empty(r.Sids, r.Record.Repository)
+		}
+	}
+	assert.Equal([]string{"granted", "nopolicy", "revoked"}, repositories(e.Summary, summary.OperationGrant, summary.StatusSucceeded))
+	assert.Equal([]string{"unchanged"}, repositories(e.Summary, summary.OperationGrant, summary.StatusUnchanged))
+	assert.Equal([]string{"invalid", "notfound"}, repositories(e.Summary, summary.OperationGrant, summary.StatusFailed))
+	assert.ElementsMatch([]backup.Entry{
+		{RepositoryName: "granted", Exists: true, PolicyText: "old"},
+		{RepositoryName: "revoked", Exists: true, PolicyText: "last"},
+		{RepositoryName: "nopolicy", Exists: false},
+	}, s.entries["run"])
+}
+
+func TestRunBreakGlassPublic(t *testing.T) {
+	m := &mockedECRRegistry{policies: map[string]string{"public": "old"}}
+	e := ECRUpdaterClient{
+		Client: m,
+		Public: &mockedECRPublicRegistry{},
+		Logger: Logger,
+	}
+	e.Init()
+
+	edit := func(current string) (string, []string, error) {
+		return "new", []string{"BreakGlass"}, nil
+	}
+	results := e.RunBreakGlass(context.Background(), context.Background(), []configuration.ConfigurationFile{{RepositoryName: "public"}}, 1, summary.OperationGrant, edit)
+
+	assert.Equal(t, summary.StatusFailed, results[0].Record.Status)
+	assert.Equal(t, "break-glass statements are only supported on private repositories", results[0].Record.ErrorMessage)
+	assert.Equal(t, "old", m.policies["public"])
+}
+
+func TestRunBreakGlassCancelled(t *testing.T) {
+	m := &mockedECRRegistry{policies: map[string]string{"granted": "old"}}
+	e := ECRUpdaterClient{
+		Client: m,
+		Logger: Logger,
+	}
+	e.Init()
+
+	stop, cancel := context.WithCancel(context.Background())
+	cancel()
+	edit := func(current string) (string, []string, error) {
+		return "new", []string{"BreakGlass"}, nil
+	}
+	results := e.RunBreakGlass(context.Background(), stop, []configuration.ConfigurationFile{{RepositoryName: "granted"}}, 1, summary.OperationRevoke, edit)
+
+	assert.Equal(t, summary.StatusCancelled, results[0].Record.Status)
+	assert.Equal(t, summary.OperationRevoke, results[0].Record.Operation)
+	assert.Equal(t, "old", m.policies["granted"])
+	assert.Equal(t, []string{"granted"}, repositories(e.Summary, summary.OperationRevoke, summary.StatusCancelled))
+}
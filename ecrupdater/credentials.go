@@ -0,0 +1,55 @@
+package ecrupdater
+
+import (
+	"sync"
+
+	"github.com/lescactus/ecr-go/configuration"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+)
+
+// RoleCredentials provides the credentials of the roles assumed to manage the repositories of other accounts
+// The credentials of a role are shared by all the clients of its account: they are cached, and refreshed
+// by STS AssumeRole shortly before they expire
+// It is safe for concurrent use
+type RoleCredentials struct {
+	provider client.ConfigProvider
+	mu       sync.Mutex
+	cache    map[configuration.Account]*credentials.Credentials
+}
+
+// NewRoleCredentials instanciate a RoleCredentials assuming the roles with the credentials of the given provider,
+// usually the AWS session
+func NewRoleCredentials(provider client.ConfigProvider) *RoleCredentials {
+	return &RoleCredentials{
+		provider: provider,
+		cache:    make(map[configuration.Account]*credentials.Credentials),
+	}
+}
+
+// Get returns the credentials of the role of the given account
+// It returns nil for a nil account, meaning the default credentials must be used
+func (r *RoleCredentials) Get(account *configuration.Account) *credentials.Credentials {
+	if account == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.cache[*account]; ok {
+		return c
+	}
+
+	a := *account
+	c := stscreds.NewCredentials(r.provider, a.RoleArn, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = a.SessionName
+		if a.ExternalID != "" {
+			p.ExternalID = &a.ExternalID
+		}
+	})
+	r.cache[a] = c
+	return c
+}
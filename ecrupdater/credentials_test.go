@@ -0,0 +1,28 @@
+package ecrupdater
+
+import (
+	"testing"
+
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestRoleCredentials(t *testing.T) {
+	r := NewRoleCredentials(session.Must(session.NewSession(&aws.Config{Region: aws.String("us-east-1")})))
+
+	a1 := configuration.Account{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go", SessionName: "ecr-go"}
+	a2 := configuration.Account{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go", ExternalID: "secret", SessionName: "ecr-go"}
+
+	assert.Nil(t, r.Get(nil), "nil account uses the default credentials")
+
+	c1 := r.Get(&a1)
+	assert.NotNil(t, c1)
+	assert.Same(t, c1, r.Get(&configuration.Account{ID: "111111111111", RoleArn: "arn:aws:iam::111111111111:role/ecr-go", SessionName: "ecr-go"}), "credentials are cached by account")
+
+	c2 := r.Get(&a2)
+	assert.NotNil(t, c2)
+	assert.NotSame(t, c1, c2, "the external ID is part of the cache key")
+}
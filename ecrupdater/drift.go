@@ -0,0 +1,130 @@
+package ecrupdater
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/summary"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// DriftStatus is the state of a repository compared with its configuration
+type DriftStatus string
+
+const (
+	DriftInSync    DriftStatus = "in-sync"   // The repository matches its configuration
+	DriftDrifted   DriftStatus = "drifted"   // The policy or a managed setting of the repository differs from its configuration
+	DriftMissing   DriftStatus = "missing"   // The repository or its policy does not exist
+	DriftUnmanaged DriftStatus = "unmanaged" // The repository exists but no configuration file covers it
+	DriftError     DriftStatus = "error"     // The repository cannot be compared
+)
+
+// Drift is the state of a repository compared with its configuration
+type Drift struct {
+	Record summary.Record // Repository of the drift. Only its identifying fields are set
+	Status DriftStatus
+	Detail string // What is missing or drifted
+	Err    error
+}
+
+// ChangeDrift returns the drift reported by the given change
+// A repository that does not exist is missing, rather than an error
+func ChangeDrift(c Change) Drift {
+	d := Drift{Record: c.Record}
+	switch c.Action {
+	case ActionUnchanged:
+		d.Status = DriftInSync
+	case ActionCreate:
+		d.Status = DriftMissing
+		d.Detail = "no policy"
+	case ActionUpdate, ActionDelete:
+		d.Status = DriftDrifted
+		if c.Current != "" && !EquivalentPolicies(c.Current, c.Desired) {
+			d.Detail = "policy"
+		}
+		for _, s := range c.Changed {
+			if d.Detail != "" {
+				d.Detail += ", "
+			}
+			d.Detail += s
+		}
+	default:
+		if isRepositoryNotFound(c.Err) {
+			d.Status = DriftMissing
+			d.Detail = "no repository"
+		} else {
+			d.Status = DriftError
+			d.Err = c.Err
+		}
+	}
+	return d
+}
+
+// String returns the status and the repository of the drift, with its detail or error
+func (d Drift) String() string {
+	s := fmt.Sprintf("%-9s %s", d.Status, d.Record.Target())
+	if d.Detail != "" {
+		s = fmt.Sprintf("%s: %s", s, d.Detail)
+	}
+	if d.Err != nil {
+		s = fmt.Sprintf("%s: %v", s, d.Err)
+	}
+	return s
+}
+
+// UnmanagedJobs will list the repositories of the registries of all the jobs concurrently, and report those no configuration file of the job covers
+// The registries are the ones of the configuration files of each job. Public registries are not listed
+// A registry that cannot be listed is reported as an error. It returns the drifts in the order of the jobs and of the repository names
+func UnmanagedJobs(ctx context.Context, jobs []Job) []Drift {
+	drifts := make([][]Drift, len(jobs))
+	parallel(len(jobs), func(i int) {
+		if jobs[i].Client.Public == nil {
+			drifts[i] = jobs[i].Client.Unmanaged(ctx, jobs[i].Configs)
+		}
+	})
+
+	all := []Drift{}
+	for _, d := range drifts {
+		all = append(all, d...)
+	}
+	return all
+}
+
+// Unmanaged will list the repositories of the registries of the given configuration files, and report those none of them covers
+// A registry that cannot be listed is reported as an error on all its repositories, named "*"
+func (e *ECRUpdaterClient) Unmanaged(ctx context.Context, configs []configuration.ConfigurationFile) []Drift {
+	registries := []string{}
+	managed := make(map[repository]bool)
+	for _, r := range configRepositories(configs) {
+		if !containsString(registries, r.registryID) {
+			registries = append(registries, r.registryID)
+		}
+		managed[r] = true
+	}
+	sort.Strings(registries)
+
+	drifts := []Drift{}
+	for _, registryID := range registries {
+		repositories, err := e.listRepositories(ctx, repository{registryID: registryID}, ImportFilter{})
+		if err != nil {
+			drifts = append(drifts, Drift{Record: e.newRecord(repository{registryID: registryID, name: "*"}, "", ""), Status: DriftError, Err: err})
+			continue
+		}
+		for _, r := range repositories {
+			if !managed[r] {
+				drifts = append(drifts, Drift{Record: e.newRecord(r, "", ""), Status: DriftUnmanaged})
+			}
+		}
+	}
+	return drifts
+}
+
+// isRepositoryNotFound returns true if the error reports a repository that does not exist
+func isRepositoryNotFound(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == ecr.ErrCodeRepositoryNotFoundException
+}
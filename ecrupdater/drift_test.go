@@ -0,0 +1,113 @@
+package ecrupdater
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/summary"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeDrift(t *testing.T) {
+	record := summary.Record{Repository: "repo", Region: "eu-west-1"}
+	notFound := awserr.New(ecr.ErrCodeRepositoryNotFoundException, "The repository does not exist", nil)
+	denied := errors.New("AccessDeniedException")
+
+	tests := []struct {
+		desc   string
+		change Change
+		want   Drift
+		text   string
+	}{
+		{
+			desc:   "Unchanged",
+			change: Change{Record: record, Action: ActionUnchanged},
+			want:   Drift{Record: record, Status: DriftInSync},
+			text:   "in-sync   repo (eu-west-1)",
+		},
+		{
+			desc:   "No policy",
+			change: Change{Record: record, Action: ActionCreate},
+			want:   Drift{Record: record, Status: DriftMissing, Detail: "no policy"},
+			text:   "missing   repo (eu-west-1): no policy",
+		},
+		{
+			desc:   "No repository",
+			change: Change{Record: record, Action: ActionError, Err: notFound},
+			want:   Drift{Record: record, Status: DriftMissing, Detail: "no repository"},
+			text:   "missing   repo (eu-west-1): no repository",
+		},
+		{
+			desc:   "Policy and catalog data drifted",
+			change: Change{Record: record, Action: ActionUpdate, Current: `{"a": 1}`, Desired: `{"a": 2}`, Changed: []string{SettingCatalogData}},
+			want:   Drift{Record: record, Status: DriftDrifted, Detail: "policy, catalogData"},
+			text:   "drifted   repo (eu-west-1): policy, catalogData",
+		},
+		{
+			desc:   "Catalog data drifted",
+			change: Change{Record: record, Action: ActionUpdate, Current: `{"a": 1}`, Desired: `{"a":1}`, Changed: []string{SettingCatalogData}},
+			want:   Drift{Record: record, Status: DriftDrifted, Detail: "catalogData"},
+			text:   "drifted   repo (eu-west-1): catalogData",
+		},
+		{
+			desc:   "Policy to delete",
+			change: Change{Record: record, Action: ActionDelete, Current: `{"a": 1}`},
+			want:   Drift{Record: record, Status: DriftDrifted, Detail: "policy"},
+			text:   "drifted   repo (eu-west-1): policy",
+		},
+		{
+			desc:   "Error",
+			change: Change{Record: record, Action: ActionError, Err: denied},
+			want:   Drift{Record: record, Status: DriftError, Err: denied},
+			text:   "error     repo (eu-west-1): AccessDeniedException",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			d := ChangeDrift(test.change)
+			assert.Equal(t, test.want, d)
+			assert.Equal(t, test.text, d.String())
+		})
+	}
+}
+
+func TestUnmanagedJobs(t *testing.T) {
+	m := &mockedECRListing{
+		mockedECRRegistry: &mockedECRRegistry{policies: map[string]string{
+			"app":                 "",
+			"legacy":              "",
+			"worker":              "",
+			"111111111111/shared": "",
+			"111111111111/old":    "",
+			"222222222222/other":  "",
+		}},
+		pageSize: 2,
+	}
+	e := &ECRUpdaterClient{Client: m, Region: "eu-west-1", Logger: Logger}
+	e.Init()
+	public := &ECRUpdaterClient{Public: &mockedECRPublicRegistry{}, Region: "us-east-1", Logger: Logger}
+	public.Init()
+
+	jobs := []Job{
+		{Client: e, Configs: []configuration.ConfigurationFile{
+			{RepositoryName: "app"},
+			{RepositoryName: "worker"},
+			{RepositoryName: "shared", RegistryID: "111111111111"},
+		}},
+		{Client: public, Configs: []configuration.ConfigurationFile{{RepositoryName: "app", Type: configuration.RepositoryTypePublic}}},
+	}
+
+	drifts := UnmanagedJobs(context.Background(), jobs)
+
+	text := []string{}
+	for _, d := range drifts {
+		text = append(text, d.String())
+	}
+	assert.Equal(t, []string{"unmanaged legacy (eu-west-1)", "unmanaged 111111111111/old (eu-west-1)"}, text)
+}
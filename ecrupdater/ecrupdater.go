@@ -1,54 +1,532 @@
 package ecrupdater
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/lescactus/ecr-go/backup"
 	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/policy"
 	"github.com/lescactus/ecr-go/summary"
 	"go.uber.org/zap"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ecr"
-	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/aws/aws-sdk-go/service/ecrpublic/ecrpubliciface"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 )
 
+// ECRAPI is the part of ecriface.ECRAPI called by the ECRUpdaterClient, implemented by the ECR clients and by PublicECR
+type ECRAPI interface {
+	SetRepositoryPolicyWithContext(aws.Context, *ecr.SetRepositoryPolicyInput, ...request.Option) (*ecr.SetRepositoryPolicyOutput, error)
+	GetRepositoryPolicyWithContext(aws.Context, *ecr.GetRepositoryPolicyInput, ...request.Option) (*ecr.GetRepositoryPolicyOutput, error)
+	DeleteRepositoryPolicyWithContext(aws.Context, *ecr.DeleteRepositoryPolicyInput, ...request.Option) (*ecr.DeleteRepositoryPolicyOutput, error)
+	DescribeRepositoriesWithContext(aws.Context, *ecr.DescribeRepositoriesInput, ...request.Option) (*ecr.DescribeRepositoriesOutput, error)
+	ListTagsForResourceWithContext(aws.Context, *ecr.ListTagsForResourceInput, ...request.Option) (*ecr.ListTagsForResourceOutput, error)
+}
+
 type ECRUpdaterClient struct {
-	Client                   ecriface.ECRAPI
-	RepositoryFailedUpdate   summary.RepositoryFailedUpdate
-	RepositorySuccededUpdate summary.RepositorySuccededUpdate
-	Logger                   *zap.Logger
+	Client        ECRAPI
+	Public        ecrpubliciface.ECRPublicAPI // Client of the ECR Public repositories. When set, the client manages public repositories only
+	STS           stsiface.STSAPI             // Client used to check the identity of the caller before any change. nil skips the check
+	Target        string                      // Name of the target of Client, recorded in the summary. Empty means the default AWS session
+	Region        string                      // Region of Client, recorded in the summary
+	Account       string                      // Account of Client, recorded in the summary
+	Summary       *summary.Collector          // Results of all the operations of the run
+	Retry         RetryPolicy
+	CallTimeout   time.Duration // Timeout of each ECR call. 0 means no timeout
+	Backup        backup.Store  // Store receiving the previous policies before they are overwritten. nil disables the backup
+	BackupID      string        // ID of the backup of the current run, initialized with Backup.Init()
+	Transactional bool          // All-or-nothing mode: on any failure, the repositories already updated are rolled back
+	ManagedPrefix string        // Merge mode: only the statements whose Sid starts with it are managed. Empty means the configured policy replaces the current one
+	Logger        *zap.Logger
+	own           *summary.Collector                         // Results of the operations of this client only
+	written       *repositorySet                             // Repositories whose policy was set by an update, even if the update then failed
+	sleep         func(context.Context, time.Duration) error // Used to wait between two attempts. Overridden in tests
 }
 
 // Init will initialize the ECR client
+// A Summary shared with other clients can be set before calling Init
+// For public repositories, Client defaults to the repository policy calls of Public
 func (e *ECRUpdaterClient) Init() {
-	e.RepositoryFailedUpdate = summary.NewRepositoryFailedUpdate()
-	e.RepositorySuccededUpdate = summary.NewRepositorySuccededUpdate()
+	if e.Client == nil && e.Public != nil {
+		e.Client = &PublicECR{Client: e.Public}
+	}
+	if e.Summary == nil {
+		e.Summary = summary.NewCollector()
+	}
+	e.own = summary.NewCollector()
+	e.written = &repositorySet{}
+	if e.sleep == nil {
+		e.sleep = sleepContext
+	}
+}
+
+// Run will update the policies of all the given repositories, with at most workers concurrent updates
+// No new repository is scheduled once stop is done: the remaining ones are marked as cancelled
+// The in-flight updates are waited for. They are only interrupted when ctx is done
+// In transactional mode, see runTransaction
+func (e *ECRUpdaterClient) Run(ctx, stop context.Context, configs []configuration.ConfigurationFile, workers int) {
+	RunJobs(ctx, stop, []Job{{Client: e, Configs: configs}}, workers, e.Transactional)
+}
+
+// run will update the policies of all the given repositories, outside of any transaction
+func (e *ECRUpdaterClient) run(ctx, stop context.Context, configs []configuration.ConfigurationFile, workers int) {
+	e.schedule(stop, summary.OperationUpdate, configRepositories(configs), workers, func(i int, wg *sync.WaitGroup) {
+		e.Work(ctx, configs[i], wg)
+	})
+}
+
+// RunRestore will restore the policies of all the given backup entries, with at most workers concurrent restorations
+// It follows the same scheduling and cancellation rules as Run
+func (e *ECRUpdaterClient) RunRestore(ctx, stop context.Context, entries []backup.Entry, workers int) {
+	e.schedule(stop, summary.OperationRestore, entriesRepositories(entries), workers, func(i int, wg *sync.WaitGroup) {
+		e.Restore(ctx, entries[i], wg)
+	})
+}
+
+// schedule will call work for each of the given repositories, with at most workers concurrent calls
+// No new repository is scheduled once stop is done: the remaining ones are recorded as cancelled for the given operation
+// It returns once all the scheduled calls are completed
+func (e *ECRUpdaterClient) schedule(stop context.Context, operation summary.Operation, repositories []repository, workers int, work func(int, *sync.WaitGroup)) {
+	if workers < 1 {
+		workers = len(repositories)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+
+	for i := range repositories {
+		select {
+		case <-stop.Done():
+		case sem <- struct{}{}:
+		}
+		// select picks randomly when both are ready: always give priority to stop
+		if stop.Err() != nil {
+			e.Logger.Warn(fmt.Sprintf("Run interrupted, repository %s will not be processed", repositories[i]))
+			e.add(e.newRecord(repositories[i], operation, summary.StatusCancelled))
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem }()
+			work(i, &wg)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// repository identifies a repository of a registry of the client
+// The empty registry ID is the default registry of the credentials of the client
+type repository struct {
+	registryID string
+	name       string
+}
+
+// String returns the name of the repository, prefixed by its registry ID if set
+func (r repository) String() string {
+	if r.registryID == "" {
+		return r.name
+	}
+	return r.registryID + "/" + r.name
+}
+
+// registryIDInput returns the registry ID to set in the ECR calls, nil for the default registry
+func (r repository) registryIDInput() *string {
+	if r.registryID == "" {
+		return nil
+	}
+	return aws.String(r.registryID)
+}
+
+// configRepositories returns the repositories of the given configuration files
+func configRepositories(configs []configuration.ConfigurationFile) []repository {
+	repositories := make([]repository, len(configs))
+	for i := range configs {
+		repositories[i] = repository{registryID: configs[i].RegistryID, name: configs[i].RepositoryName}
+	}
+	return repositories
+}
+
+// repositorySet is a set of repositories safe for concurrent use
+type repositorySet struct {
+	mu           sync.Mutex
+	repositories []repository
+}
+
+// add will add the repository to the set, if not already present
+func (s *repositorySet) add(repo repository) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.repositories {
+		if r == repo {
+			return
+		}
+	}
+	s.repositories = append(s.repositories, repo)
+}
+
+// list returns the repositories of the set, in the order they were added
+func (s *repositorySet) list() []repository {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]repository{}, s.repositories...)
+}
+
+// add will record the result of an operation of this client in e.Summary
+func (e *ECRUpdaterClient) add(r summary.Record) {
+	e.own.Add(r)
+	e.Summary.Add(r)
+}
+
+// newRecord returns a summary.Record of the given operation on the given repository of this client
+func (e *ECRUpdaterClient) newRecord(r repository, operation summary.Operation, status summary.Status) summary.Record {
+	return summary.Record{
+		Repository: r.name,
+		Registry:   r.registryID,
+		TargetName: e.Target,
+		Region:     e.Region,
+		Account:    e.Account,
+		Public:     e.Public != nil,
+		Operation:  operation,
+		Status:     status,
+	}
 }
 
 // Work will update the given ECR repository policy
-// It will update the status of the update (success or fail) in a summary.RepositoryFailedUpdate and a summary.RepositorySuccededUpdate
-func (e *ECRUpdaterClient) Work(config configuration.ConfigurationFile, wg *sync.WaitGroup) {
+// It will record the result of the update (succeeded, failed or cancelled) in e.Summary
+func (e *ECRUpdaterClient) Work(ctx context.Context, config configuration.ConfigurationFile, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	e.Logger.Info(fmt.Sprintf("Updating repository %s ...", config.RepositoryName))
+	e.update(ctx, config, e.Backup != nil)
+}
 
-	// Actual AWS call to update the ECR repository policy
-	_, err := e.Client.SetRepositoryPolicy(&ecr.SetRepositoryPolicyInput{
-		PolicyText:     aws.String(string(config.RepositoryPolicy)),
-		RepositoryName: &config.RepositoryName,
-	})
+// update will update the given ECR repository policy, saving the current one first if backupFirst is set
+// The policy is deleted when no statement is left, an empty policy being rejected by ECR
+func (e *ECRUpdaterClient) update(ctx context.Context, config configuration.ConfigurationFile, backupFirst bool) {
+	repo := repository{registryID: config.RegistryID, name: config.RepositoryName}
+	record := e.newRecord(repo, summary.OperationUpdate, summary.StatusSucceeded)
+	if ctx.Err() != nil {
+		e.Logger.Warn(fmt.Sprintf("Run interrupted, repository %s will not be updated", repo))
+		record.Status = summary.StatusCancelled
+		e.add(record)
+		return
+	}
+
+	e.Logger.Info(fmt.Sprintf("Updating repository %s ...", repo))
+	start := time.Now()
+
+	// A public repository can only be managed by an ECR Public client, and the other way around
+	attempts := 0
+	var err error
+	if config.IsPublic() != (e.Public != nil) {
+		err = fmt.Errorf("repository %s of type %s cannot be managed by this client", repo, repositoryType(config))
+	}
+
+	// Save the current policy, and catalog data if managed, before overwriting them. In merge mode, the unmanaged statements are kept
+	policyText := e.configuredPolicy(config)
+	if err == nil && (backupFirst || e.ManagedPrefix != "") {
+		var entry backup.Entry
+		entry, attempts, err = e.previous(ctx, repo, backupFirst && config.CatalogData != nil)
+		if err == nil && backupFirst {
+			err = e.saveBackup(entry)
+		}
+		if err == nil {
+			policyText, err = e.desiredPolicy(entry, policyText)
+		}
+	}
+
+	// Actual AWS call to update the ECR repository policy. Without statement left, the policy is deleted
+	if err == nil {
+		var a int
+		if policyText == "" {
+			a, err = e.deletePolicy(ctx, repo)
+		} else {
+			a, err = e.withRetry(ctx, repo.String(), func(ctx context.Context) error {
+				_, err := e.Client.SetRepositoryPolicyWithContext(ctx, &ecr.SetRepositoryPolicyInput{
+					PolicyText:     aws.String(policyText),
+					RegistryId:     repo.registryIDInput(),
+					RepositoryName: aws.String(repo.name),
+				})
+				return err
+			})
+		}
+		attempts += a
+		if err == nil {
+			e.written.add(repo)
+		}
+	}
+
+	// The catalog data of a public repository is updated once its policy is
+	if err == nil && config.CatalogData != nil {
+		var a int
+		a, err = e.putCatalogData(ctx, repo, config.CatalogData)
+		attempts += a
+	}
+
+	record.Duration = time.Since(start)
+	record.Attempts = attempts
+	setError(&record, err)
 	if err != nil {
-		if awsErr, ok := err.(awserr.Error); ok {
-			e.Logger.Error(fmt.Sprintf("Error: An error occured while updating the repository %v: \"%v\"", config.RepositoryName, awsErr))
+		if ctx.Err() != nil {
+			e.Logger.Warn(fmt.Sprintf("Run interrupted while updating the repository %v: \"%v\"", repo, ctx.Err()))
+			record.Status = summary.StatusCancelled
+		} else {
+			e.Logger.Error(fmt.Sprintf("Error: An error occured while updating the repository %v after %d attempt(s): %s", repo, attempts, errorMessage(err)))
+			record.Status = summary.StatusFailed
+		}
+	} else {
+		e.Logger.Info(fmt.Sprintf("Policy updated for repository %s", repo))
+	}
+	e.add(record)
+}
 
+// Restore will restore the given backup entry
+// The policy is set back to its backed up value, or deleted if the repository had no policy
+// It will record the result of the restoration in e.Summary
+func (e *ECRUpdaterClient) Restore(ctx context.Context, entry backup.Entry, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	e.restore(ctx, entry, summary.OperationRestore)
+}
+
+// restore will restore the given backup entry and record the result as the given operation
+func (e *ECRUpdaterClient) restore(ctx context.Context, entry backup.Entry, operation summary.Operation) {
+	repo := repository{registryID: entry.RegistryID, name: entry.RepositoryName}
+	record := e.newRecord(repo, operation, summary.StatusSucceeded)
+	if ctx.Err() != nil {
+		e.Logger.Warn(fmt.Sprintf("Run interrupted, repository %s will not be restored", repo))
+		record.Status = summary.StatusCancelled
+		e.add(record)
+		return
+	}
+
+	e.Logger.Info(fmt.Sprintf("Restoring repository %s ...", repo))
+	start := time.Now()
+
+	attempts, err := e.restorePolicy(ctx, entry)
+
+	record.Duration = time.Since(start)
+	record.Attempts = attempts
+	setError(&record, err)
+	if err != nil {
+		if ctx.Err() != nil {
+			e.Logger.Warn(fmt.Sprintf("Run interrupted while restoring the repository %v: \"%v\"", repo, ctx.Err()))
+			record.Status = summary.StatusCancelled
 		} else {
-			e.Logger.Error(fmt.Sprintf("Error: An error occured while updating the repository %v: \"%v\"", config.RepositoryName, awsErr))
+			e.Logger.Error(fmt.Sprintf("Error: An error occured while restoring the repository %v after %d attempt(s): %s", repo, attempts, errorMessage(err)))
+			record.Status = summary.StatusFailed
 		}
-		e.RepositoryFailedUpdate.Add(config.RepositoryName, err)
 	} else {
-		e.Logger.Info(fmt.Sprintf("Policy updated for repository %s", config.RepositoryName))
-		e.RepositorySuccededUpdate.RepositoryNames = append(e.RepositorySuccededUpdate.RepositoryNames, config.RepositoryName)
+		e.Logger.Info(fmt.Sprintf("Policy restored for repository %s", repo))
+	}
+	e.add(record)
+}
+
+// configuredPolicy returns the configured policy of the repository, or an empty policy if every statement of the policy has
+// expired, so that the policy is deleted. In merge mode, the configured policy is kept to be merged with the unmanaged statements
+func (e *ECRUpdaterClient) configuredPolicy(config configuration.ConfigurationFile) string {
+	if config.Expired && e.ManagedPrefix == "" {
+		return ""
+	}
+	return string(config.RepositoryPolicy)
+}
+
+// desiredPolicy returns the policy to set on the repository whose current policy is entry
+// It is the configured policy, or in merge mode the configured policy merged with the unmanaged statements of the current one
+func (e *ECRUpdaterClient) desiredPolicy(entry backup.Entry, configured string) (string, error) {
+	if e.ManagedPrefix == "" {
+		return configured, nil
+	}
+	current := ""
+	if entry.Exists {
+		current = entry.PolicyText
+	}
+	return policy.Merge(current, configured, e.ManagedPrefix)
+}
+
+// currentPolicy will fetch the current policy of the repository
+// It returns the policy as a backup.Entry, the number of attempts made and any error encountered
+func (e *ECRUpdaterClient) currentPolicy(ctx context.Context, repo repository) (backup.Entry, int, error) {
+	entry := backup.Entry{
+		RepositoryName: repo.name,
+		RegistryID:     repo.registryID,
+		Region:         e.Region,
+		Account:        e.Account,
+		Target:         e.Target,
+		Public:         e.Public != nil,
+	}
+
+	attempts, err := e.withRetry(ctx, repo.String(), func(ctx context.Context) error {
+		out, err := e.Client.GetRepositoryPolicyWithContext(ctx, &ecr.GetRepositoryPolicyInput{
+			RegistryId:     repo.registryIDInput(),
+			RepositoryName: aws.String(repo.name),
+		})
+		if err != nil {
+			return err
+		}
+		entry.Exists = true
+		entry.PolicyText = aws.StringValue(out.PolicyText)
+		return nil
+	})
+	if err != nil && !isPolicyNotFound(err) {
+		return entry, attempts, err
+	}
+
+	return entry, attempts, nil
+}
+
+// previous will fetch the current policy of the repository, and its current catalog data if catalogData is set and the
+// repository is public, to save or restore them
+// It returns them as a backup.Entry, the number of attempts made and any error encountered
+func (e *ECRUpdaterClient) previous(ctx context.Context, repo repository, catalogData bool) (backup.Entry, int, error) {
+	entry, attempts, err := e.currentPolicy(ctx, repo)
+	if err != nil || !catalogData || e.Public == nil {
+		return entry, attempts, err
+	}
+
+	data, a, err := e.currentCatalogData(ctx, repo)
+	entry.CatalogData = data
+	return entry, attempts + a, err
+}
+
+// saveBackup will save the entry in e.Backup
+func (e *ECRUpdaterClient) saveBackup(entry backup.Entry) error {
+	if err := e.Backup.Save(e.BackupID, entry); err != nil {
+		return fmt.Errorf("cannot backup the policy of repository %s: %v", entry.RepositoryName, err)
+	}
+	e.Logger.Debug(fmt.Sprintf("Policy of repository %s saved in backup %s (exists: %v)", entry.RepositoryName, e.BackupID, entry.Exists))
+
+	return nil
+}
+
+// restorePolicy will set the policy of the repository back to the entry, then its catalog data if the entry has any
+// The policy is deleted if the entry records that the repository had no policy. The logo of the catalog data is not restored
+// It returns the number of attempts made and any error encountered
+func (e *ECRUpdaterClient) restorePolicy(ctx context.Context, entry backup.Entry) (int, error) {
+	attempts, err := e.setBackedUpPolicy(ctx, entry)
+	if err != nil || entry.CatalogData == nil || e.Public == nil {
+		return attempts, err
+	}
+
+	repo := repository{registryID: entry.RegistryID, name: entry.RepositoryName}
+	a, err := e.putCatalogData(ctx, repo, entry.CatalogData)
+	return attempts + a, err
+}
+
+// setBackedUpPolicy will set the policy of the repository back to the entry, or delete it if the repository had no policy
+// It returns the number of attempts made and any error encountered
+func (e *ECRUpdaterClient) setBackedUpPolicy(ctx context.Context, entry backup.Entry) (int, error) {
+	repo := repository{registryID: entry.RegistryID, name: entry.RepositoryName}
+	if entry.Exists {
+		return e.withRetry(ctx, repo.String(), func(ctx context.Context) error {
+			_, err := e.Client.SetRepositoryPolicyWithContext(ctx, &ecr.SetRepositoryPolicyInput{
+				PolicyText:     aws.String(entry.PolicyText),
+				RegistryId:     repo.registryIDInput(),
+				RepositoryName: aws.String(repo.name),
+			})
+			return err
+		})
+	}
+	return e.deletePolicy(ctx, repo)
+}
+
+// deletePolicy will delete the policy of the repository. A repository without policy is not an error
+// It returns the number of attempts made and any error encountered
+func (e *ECRUpdaterClient) deletePolicy(ctx context.Context, repo repository) (int, error) {
+	attempts, err := e.withRetry(ctx, repo.String(), func(ctx context.Context) error {
+		_, err := e.Client.DeleteRepositoryPolicyWithContext(ctx, &ecr.DeleteRepositoryPolicyInput{
+			RegistryId:     repo.registryIDInput(),
+			RepositoryName: aws.String(repo.name),
+		})
+		return err
+	})
+	// The policy is already absent
+	if isPolicyNotFound(err) {
+		err = nil
+	}
+	return attempts, err
+}
+
+// repositoryType returns the type of the repository of the given configuration file
+func repositoryType(config configuration.ConfigurationFile) string {
+	if config.IsPublic() {
+		return configuration.RepositoryTypePublic
+	}
+	return configuration.RepositoryTypePrivate
+}
+
+// isPolicyNotFound returns true if the error reports a repository without policy
+func isPolicyNotFound(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == ecr.ErrCodeRepositoryPolicyNotFoundException
+}
+
+// withRetry will call fn until it succeeds, fails with a non retryable error, the maximum number of attempts is reached or ctx is done
+// Each call is given its own context, bounded by e.CallTimeout. A call exceeding it is retried as a request timeout
+// Between two attempts, it waits for an exponential backoff with jitter as defined by e.Retry
+// It returns the number of attempts made and the last error encountered
+func (e *ECRUpdaterClient) withRetry(ctx context.Context, repository string, fn func(context.Context) error) (int, error) {
+	sleep := e.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		err = e.callWithTimeout(ctx, fn)
+		if err == nil || !IsRetryable(err) || attempt >= e.Retry.attempts() {
+			break
+		}
+
+		d := e.Retry.Backoff(attempt)
+		e.Logger.Warn(fmt.Sprintf("Attempt %d/%d for repository %s failed with a retryable error, retrying in %v: \"%v\"", attempt, e.Retry.attempts(), repository, d, err))
+		if serr := sleep(ctx, d); serr != nil {
+			break
+		}
+	}
+
+	return attempt, err
+}
+
+// callWithTimeout will call fn with a context derived from ctx and bounded by e.CallTimeout
+// If the call timeout is exceeded while ctx is still active, the error is turned into a retryable RequestTimeout error
+func (e *ECRUpdaterClient) callWithTimeout(ctx context.Context, fn func(context.Context) error) error {
+	if e.CallTimeout <= 0 {
+		return fn(ctx)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, e.CallTimeout)
+	defer cancel()
+
+	err := fn(callCtx)
+	if err != nil && ctx.Err() == nil && callCtx.Err() == context.DeadlineExceeded {
+		return awserr.New("RequestTimeout", fmt.Sprintf("ECR call did not complete within %v", e.CallTimeout), err)
+	}
+	return err
+}
+
+// sleepContext will wait for the given duration or until ctx is done
+// It returns the error of ctx if it is done before the end of the duration
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
 	}
 }
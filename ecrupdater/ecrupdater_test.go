@@ -1,10 +1,13 @@
 package ecrupdater
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/lescactus/ecr-go/configuration"
 	"github.com/lescactus/ecr-go/summary"
@@ -12,6 +15,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
 	"github.com/stretchr/testify/assert"
@@ -24,7 +28,7 @@ type mockedECRUpdatedPolicy struct {
 	Output ecr.SetRepositoryPolicyOutput
 }
 
-func (m mockedECRUpdatedPolicy) SetRepositoryPolicy(input *ecr.SetRepositoryPolicyInput) (*ecr.SetRepositoryPolicyOutput, error) {
+func (m mockedECRUpdatedPolicy) SetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.SetRepositoryPolicyInput, opts ...request.Option) (*ecr.SetRepositoryPolicyOutput, error) {
 	switch strings.Split(aws.StringValue(input.RepositoryName), "_")[0] {
 	case "notfound":
 		return &ecr.SetRepositoryPolicyOutput{}, awserr.New("RepositoryNotFoundException", "The repository with name "+aws.StringValue(input.RepositoryName)+" does not exist in the registry", errors.New("RepositoryNotFoundException"))
@@ -95,7 +99,7 @@ func TestWork(t *testing.T) {
 	testsWithoutError := []struct {
 		desc string
 		cf   configuration.ConfigurationFile
-		want ECRUpdaterClient
+		want summary.Record
 	}{
 		{
 			desc: "ECR repository updated successfully",
@@ -103,12 +107,11 @@ func TestWork(t *testing.T) {
 				RepositoryName:   "foo",
 				RepositoryPolicy: validRepositoryPolicy,
 			},
-			want: ECRUpdaterClient{
-				RepositoryFailedUpdate: summary.NewRepositoryFailedUpdate(),
-				RepositorySuccededUpdate: summary.RepositorySuccededUpdate{
-					RepositoryNames: []string{"foo"},
-				},
-				Logger: Logger,
+			want: summary.Record{
+				Repository: "foo",
+				Operation:  summary.OperationUpdate,
+				Status:     summary.StatusSucceeded,
+				Attempts:   1,
 			},
 		},
 	}
@@ -116,7 +119,7 @@ func TestWork(t *testing.T) {
 	testsWithErrors := []struct {
 		desc string
 		cf   configuration.ConfigurationFile
-		want ECRUpdaterClient
+		want summary.Record
 	}{
 		{
 			desc: "ECR repository not found error",
@@ -124,13 +127,14 @@ func TestWork(t *testing.T) {
 				RepositoryName:   "notfound_foo",
 				RepositoryPolicy: validRepositoryPolicy,
 			},
-			want: ECRUpdaterClient{
-				RepositoryFailedUpdate: summary.RepositoryFailedUpdate{
-					ErrorRepositoryName: map[string]error{
-						"notfound_foo": awserr.New("RepositoryNotFoundException", "The repository with name notfound_foo does not exist in the registry", errors.New("RepositoryNotFoundException")),
-					},
-				},
-				RepositorySuccededUpdate: summary.NewRepositorySuccededUpdate(),
+			want: summary.Record{
+				Repository:   "notfound_foo",
+				Operation:    summary.OperationUpdate,
+				Status:       summary.StatusFailed,
+				Attempts:     1,
+				ErrorCode:    "RepositoryNotFoundException",
+				ErrorMessage: "The repository with name notfound_foo does not exist in the registry",
+				Terminal:     true,
 			},
 		},
 		{
@@ -139,13 +143,14 @@ func TestWork(t *testing.T) {
 				RepositoryName:   "expiredtoken_foo",
 				RepositoryPolicy: validRepositoryPolicy,
 			},
-			want: ECRUpdaterClient{
-				RepositoryFailedUpdate: summary.RepositoryFailedUpdate{
-					ErrorRepositoryName: map[string]error{
-						"expiredtoken_foo": awserr.New("ExpiredTokenException", "The security token included in the request is expired", errors.New("ExpiredTokenException")),
-					},
-				},
-				RepositorySuccededUpdate: summary.NewRepositorySuccededUpdate(),
+			want: summary.Record{
+				Repository:   "expiredtoken_foo",
+				Operation:    summary.OperationUpdate,
+				Status:       summary.StatusFailed,
+				Attempts:     1,
+				ErrorCode:    "ExpiredTokenException",
+				ErrorMessage: "The security token included in the request is expired",
+				Terminal:     true,
 			},
 		},
 		{
@@ -154,13 +159,14 @@ func TestWork(t *testing.T) {
 				RepositoryName:   "nocredentials_foo",
 				RepositoryPolicy: validRepositoryPolicy,
 			},
-			want: ECRUpdaterClient{
-				RepositoryFailedUpdate: summary.RepositoryFailedUpdate{
-					ErrorRepositoryName: map[string]error{
-						"nocredentials_foo": awserr.New("NoCredentialProviders", "no valid providers in chain. Deprecated.", errors.New("NoCredentialProviders")),
-					},
-				},
-				RepositorySuccededUpdate: summary.NewRepositorySuccededUpdate(),
+			want: summary.Record{
+				Repository:   "nocredentials_foo",
+				Operation:    summary.OperationUpdate,
+				Status:       summary.StatusFailed,
+				Attempts:     1,
+				ErrorCode:    "NoCredentialProviders",
+				ErrorMessage: "no valid providers in chain. Deprecated.",
+				Terminal:     true,
 			},
 		},
 		{
@@ -169,13 +175,14 @@ func TestWork(t *testing.T) {
 				RepositoryName:   "accessdenied_foo",
 				RepositoryPolicy: validRepositoryPolicy,
 			},
-			want: ECRUpdaterClient{
-				RepositoryFailedUpdate: summary.RepositoryFailedUpdate{
-					ErrorRepositoryName: map[string]error{
-						"accessdenied_foo": awserr.New("AccessDeniedException", "User is not authorized to perform", errors.New("AccessDeniedException")),
-					},
-				},
-				RepositorySuccededUpdate: summary.NewRepositorySuccededUpdate(),
+			want: summary.Record{
+				Repository:   "accessdenied_foo",
+				Operation:    summary.OperationUpdate,
+				Status:       summary.StatusFailed,
+				Attempts:     1,
+				ErrorCode:    "AccessDeniedException",
+				ErrorMessage: "User is not authorized to perform",
+				Terminal:     true,
 			},
 		},
 		{
@@ -184,18 +191,17 @@ func TestWork(t *testing.T) {
 				RepositoryName:   "generic_foo",
 				RepositoryPolicy: validRepositoryPolicy,
 			},
-			want: ECRUpdaterClient{
-				RepositoryFailedUpdate: summary.RepositoryFailedUpdate{
-					ErrorRepositoryName: map[string]error{
-						"generic_foo": errors.New("Generic error"),
-					},
-				},
-				RepositorySuccededUpdate: summary.NewRepositorySuccededUpdate(),
+			want: summary.Record{
+				Repository:   "generic_foo",
+				Operation:    summary.OperationUpdate,
+				Status:       summary.StatusFailed,
+				Attempts:     1,
+				ErrorMessage: "Generic error",
 			},
 		},
 	}
 
-	for _, test := range testsWithoutError {
+	for _, test := range append(testsWithoutError, testsWithErrors...) {
 		t.Run(test.desc, func(t *testing.T) {
 			e := ECRUpdaterClient{
 				Client: mockedECRUpdatedPolicy{
@@ -207,41 +213,346 @@ func TestWork(t *testing.T) {
 
 			var wg sync.WaitGroup
 			wg.Add(1)
-			go e.Work(test.cf, &wg)
+			go e.Work(context.Background(), test.cf, &wg)
 			wg.Wait()
 
-			assert := assert.New(t)
-
-			assert.NoError(e.RepositoryFailedUpdate.Get("foo"))
-			assert.Nil(e.RepositoryFailedUpdate.Get("foo"))
-			assert.EqualValues(test.want.RepositorySuccededUpdate, e.RepositorySuccededUpdate)
-			assert.EqualValues(test.want.RepositoryFailedUpdate, e.RepositoryFailedUpdate)
+			records := e.Summary.Records()
+			if assert.Len(t, records, 1) {
+				// Duration is not deterministic
+				records[0].Duration = 0
+				assert.Equal(t, test.want, records[0])
+			}
 		})
 	}
+}
 
-	for _, test := range testsWithErrors {
+// repositories returns the names of the repositories having the given operation and status in the collector,
+// prefixed by their registry ID if set
+func repositories(c *summary.Collector, operation summary.Operation, status summary.Status) []string {
+	names := []string{}
+	for _, r := range c.WithStatus(operation, status) {
+		names = append(names, repository{registryID: r.Registry, name: r.Repository}.String())
+	}
+	return names
+}
+
+type mockedECRThrottled struct {
+	ecriface.ECRAPI
+	failures int // Number of calls failing with a ThrottlingException before succeeding
+	calls    int
+}
+
+func (m *mockedECRThrottled) SetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.SetRepositoryPolicyInput, opts ...request.Option) (*ecr.SetRepositoryPolicyOutput, error) {
+	m.calls++
+	if m.calls <= m.failures {
+		return &ecr.SetRepositoryPolicyOutput{}, awserr.New("ThrottlingException", "Rate exceeded", nil)
+	}
+	return &ecr.SetRepositoryPolicyOutput{RepositoryName: input.RepositoryName}, nil
+}
+
+func TestWorkRetry(t *testing.T) {
+	tests := []struct {
+		desc         string
+		failures     int
+		maxAttempts  int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			desc:         "Succeeds on first attempt",
+			failures:     0,
+			maxAttempts:  3,
+			wantAttempts: 1,
+		},
+		{
+			desc:         "Succeeds after throttling",
+			failures:     2,
+			maxAttempts:  3,
+			wantAttempts: 3,
+		},
+		{
+			desc:         "Throttled until max attempts",
+			failures:     5,
+			maxAttempts:  3,
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
 		t.Run(test.desc, func(t *testing.T) {
+			m := &mockedECRThrottled{failures: test.failures}
+			var sleeps []time.Duration
 			e := ECRUpdaterClient{
-				Client: mockedECRUpdatedPolicy{
-					Output: ecr.SetRepositoryPolicyOutput{},
-				},
+				Client: m,
 				Logger: Logger,
+				Retry: RetryPolicy{
+					MaxAttempts: test.maxAttempts,
+					BaseDelay:   time.Millisecond,
+					MaxDelay:    time.Second,
+				},
+				sleep: func(ctx context.Context, d time.Duration) error { sleeps = append(sleeps, d); return nil },
 			}
 			e.Init()
 
 			var wg sync.WaitGroup
 			wg.Add(1)
-			go e.Work(test.cf, &wg)
+			go e.Work(context.Background(), configuration.ConfigurationFile{RepositoryName: "foo", RepositoryPolicy: []byte("new")}, &wg)
 			wg.Wait()
 
 			assert := assert.New(t)
-			assert.Error(e.RepositoryFailedUpdate.Get(test.cf.RepositoryName))
-			assert.NotNil(e.RepositoryFailedUpdate.Get(test.cf.RepositoryName))
-			assert.EqualValues(test.want.RepositoryFailedUpdate.Get(test.cf.RepositoryName), e.RepositoryFailedUpdate.Get(test.cf.RepositoryName))
-			assert.EqualValues(test.want.RepositorySuccededUpdate, e.RepositorySuccededUpdate)
-			assert.EqualValues(test.want.RepositoryFailedUpdate, e.RepositoryFailedUpdate)
-			assert.Empty(e.RepositorySuccededUpdate.RepositoryNames)
-
+			assert.Equal(test.wantAttempts, m.calls)
+			r, _ := e.Summary.Get(summary.OperationUpdate, "foo")
+			assert.Equal(test.wantAttempts, r.Attempts)
+			assert.Len(sleeps, test.wantAttempts-1)
+			if test.wantErr {
+				assert.Equal(summary.StatusFailed, r.Status)
+				assert.Equal("ThrottlingException", r.ErrorCode)
+			} else {
+				assert.Equal(summary.StatusSucceeded, r.Status)
+			}
 		})
 	}
 }
+
+func TestWorkNoRetryOnTerminalError(t *testing.T) {
+	var sleeps int
+	e := ECRUpdaterClient{
+		Client: mockedECRUpdatedPolicy{},
+		Logger: Logger,
+		Retry:  DefaultRetryPolicy(),
+		sleep:  func(ctx context.Context, d time.Duration) error { sleeps++; return nil },
+	}
+	e.Init()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go e.Work(context.Background(), configuration.ConfigurationFile{RepositoryName: "notfound_foo", RepositoryPolicy: []byte("new")}, &wg)
+	wg.Wait()
+
+	assert.Equal(t, 0, sleeps)
+	r, _ := e.Summary.Get(summary.OperationUpdate, "notfound_foo")
+	assert.Equal(t, 1, r.Attempts)
+	assert.Equal(t, summary.StatusFailed, r.Status)
+}
+
+type mockedECRBlocking struct {
+	ecriface.ECRAPI
+	calls int
+}
+
+// SetRepositoryPolicyWithContext blocks until ctx is done, like a hanging ECR call would
+func (m *mockedECRBlocking) SetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.SetRepositoryPolicyInput, opts ...request.Option) (*ecr.SetRepositoryPolicyOutput, error) {
+	m.calls++
+	<-ctx.Done()
+	return &ecr.SetRepositoryPolicyOutput{}, awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+}
+
+func TestWorkCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	m := &mockedECRThrottled{}
+	e := ECRUpdaterClient{
+		Client: m,
+		Logger: Logger,
+	}
+	e.Init()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go e.Work(ctx, configuration.ConfigurationFile{RepositoryName: "foo", RepositoryPolicy: []byte("new")}, &wg)
+	wg.Wait()
+
+	assert := assert.New(t)
+	assert.Equal(0, m.calls)
+	assert.Equal([]string{"foo"}, repositories(e.Summary, summary.OperationUpdate, summary.StatusCancelled))
+	assert.Len(e.Summary.Records(), 1)
+}
+
+func TestWorkCallTimeout(t *testing.T) {
+	m := &mockedECRBlocking{}
+	e := ECRUpdaterClient{
+		Client:      m,
+		Logger:      Logger,
+		Retry:       RetryPolicy{MaxAttempts: 2},
+		CallTimeout: time.Millisecond,
+	}
+	e.Init()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go e.Work(context.Background(), configuration.ConfigurationFile{RepositoryName: "foo", RepositoryPolicy: []byte("new")}, &wg)
+	wg.Wait()
+
+	// A call exceeding its timeout is retried, then reported as failed
+	assert := assert.New(t)
+	assert.Equal(2, m.calls)
+	r, _ := e.Summary.Get(summary.OperationUpdate, "foo")
+	assert.Equal(2, r.Attempts)
+	assert.Equal(summary.StatusFailed, r.Status)
+	assert.Equal("RequestTimeout", r.ErrorCode)
+}
+
+func TestWorkRunDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	e := ECRUpdaterClient{
+		Client: &mockedECRBlocking{},
+		Logger: Logger,
+		Retry:  DefaultRetryPolicy(),
+	}
+	e.Init()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go e.Work(ctx, configuration.ConfigurationFile{RepositoryName: "foo", RepositoryPolicy: []byte("new")}, &wg)
+	wg.Wait()
+
+	// An update interrupted by the run deadline is cancelled, not failed
+	assert.Equal(t, []string{"foo"}, repositories(e.Summary, summary.OperationUpdate, summary.StatusCancelled))
+	assert.Len(t, e.Summary.Records(), 1)
+}
+
+func TestRun(t *testing.T) {
+	configs := []configuration.ConfigurationFile{
+		{RepositoryName: "foo", RepositoryPolicy: []byte("new")},
+		{RepositoryName: "bar", RepositoryPolicy: []byte("new")},
+		{RepositoryName: "notfound_baz", RepositoryPolicy: []byte("new")},
+	}
+
+	t.Run("All repositories are scheduled", func(t *testing.T) {
+		e := ECRUpdaterClient{
+			Client: mockedECRUpdatedPolicy{},
+			Logger: Logger,
+		}
+		e.Init()
+
+		e.Run(context.Background(), context.Background(), configs, 1)
+
+		assert.Equal(t, []string{"bar", "foo"}, repositories(e.Summary, summary.OperationUpdate, summary.StatusSucceeded))
+		assert.Equal(t, []string{"notfound_baz"}, repositories(e.Summary, summary.OperationUpdate, summary.StatusFailed))
+		assert.Empty(t, repositories(e.Summary, summary.OperationUpdate, summary.StatusCancelled))
+	})
+
+	t.Run("No repository is scheduled once stopped", func(t *testing.T) {
+		stop, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		e := ECRUpdaterClient{
+			Client: mockedECRUpdatedPolicy{},
+			Logger: Logger,
+		}
+		e.Init()
+
+		e.Run(context.Background(), stop, configs, 1)
+
+		assert.Equal(t, []string{"bar", "foo", "notfound_baz"}, repositories(e.Summary, summary.OperationUpdate, summary.StatusCancelled))
+		assert.Len(t, e.Summary.Records(), 3)
+	})
+}
+
+func TestRunConcurrentRecords(t *testing.T) {
+	configs := []configuration.ConfigurationFile{}
+	for i := 0; i < 200; i++ {
+		configs = append(configs, configuration.ConfigurationFile{RepositoryName: fmt.Sprintf("repo-%03d", i), RepositoryPolicy: []byte("new")})
+	}
+
+	e := ECRUpdaterClient{
+		Client: mockedECRUpdatedPolicy{},
+		Logger: zap.NewNop(),
+	}
+	e.Init()
+
+	e.Run(context.Background(), context.Background(), configs, 50)
+
+	// No record is lost when many repositories are updated concurrently
+	succeeded := repositories(e.Summary, summary.OperationUpdate, summary.StatusSucceeded)
+	assert.Len(t, succeeded, len(configs))
+	for i := range configs {
+		assert.Equal(t, configs[i].RepositoryName, succeeded[i])
+	}
+}
+
+func TestWorkMerge(t *testing.T) {
+	m := &mockedECRRegistry{policies: map[string]string{
+		"merged":   `{"Version":"2008-10-17","Statement":[{"Sid":"ecrgo-Old","Effect":"Allow","Principal":"*","Action":"ecr:*"},{"Sid":"Debug","Effect":"Allow","Principal":"*","Action":"ecr:*"}]}`,
+		"conflict": `{"Version":"2008-10-17","Statement":[{"Sid":"ECRGO-Pull","Effect":"Allow","Principal":"*","Action":"ecr:*"}]}`,
+	}}
+	e := &ECRUpdaterClient{Client: m, ManagedPrefix: "ecrgo-", Logger: Logger}
+	e.Init()
+
+	configured := []byte(`{"Version":"2008-10-17","Statement":[{"Sid":"ecrgo-Pull","Effect":"Allow","Principal":"*","Action":"ecr:BatchGetImage"}]}`)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	e.Work(context.Background(), configuration.ConfigurationFile{RepositoryName: "merged", RepositoryPolicy: configured}, &wg)
+	e.Work(context.Background(), configuration.ConfigurationFile{RepositoryName: "conflict", RepositoryPolicy: configured}, &wg)
+
+	assert := assert.New(t)
+	assert.True(EquivalentPolicies(`{"Version":"2008-10-17","Statement":[{"Sid":"ecrgo-Pull","Effect":"Allow","Principal":"*","Action":"ecr:BatchGetImage"},{"Sid":"Debug","Effect":"Allow","Principal":"*","Action":"ecr:*"}]}`, m.policies["merged"]), m.policies["merged"])
+	records := e.Summary.Records()
+	if !assert.Len(records, 2) {
+		return
+	}
+	// The records are sorted by repository
+	assert.Equal(summary.StatusFailed, records[0].Status)
+	assert.Contains(records[0].Error(), "conflict")
+	assert.Equal(summary.StatusSucceeded, records[1].Status)
+	assert.Equal(`{"Version":"2008-10-17","Statement":[{"Sid":"ECRGO-Pull","Effect":"Allow","Principal":"*","Action":"ecr:*"}]}`, m.policies["conflict"])
+}
+
+func TestWorkMergeNoStatementLeft(t *testing.T) {
+	m := &mockedECRRegistry{policies: map[string]string{
+		"managed":   `{"Version":"2008-10-17","Statement":[{"Sid":"ecrgo-Old","Effect":"Allow","Principal":"*","Action":"ecr:*"}]}`,
+		"nopolicy":  "",
+		"unmanaged": `{"Version":"2008-10-17","Statement":[{"Sid":"ecrgo-Old","Effect":"Allow","Principal":"*","Action":"ecr:*"},{"Sid":"Debug","Effect":"Allow","Principal":"*","Action":"ecr:*"}]}`,
+	}}
+	e := &ECRUpdaterClient{Client: m, ManagedPrefix: "ecrgo-", Logger: Logger}
+	e.Init()
+
+	// All the managed statements are removed from the configured policy
+	configured := []byte(`{"Version":"2008-10-17","Statement":[]}`)
+	var wg sync.WaitGroup
+	wg.Add(3)
+	e.Work(context.Background(), configuration.ConfigurationFile{RepositoryName: "managed", RepositoryPolicy: configured}, &wg)
+	e.Work(context.Background(), configuration.ConfigurationFile{RepositoryName: "nopolicy", RepositoryPolicy: configured}, &wg)
+	e.Work(context.Background(), configuration.ConfigurationFile{RepositoryName: "unmanaged", RepositoryPolicy: configured}, &wg)
+
+	assert := assert.New(t)
+	assert.Equal("", m.policies["managed"])
+	assert.Equal("", m.policies["nopolicy"])
+	assert.True(EquivalentPolicies(`{"Version":"2008-10-17","Statement":[{"Sid":"Debug","Effect":"Allow","Principal":"*","Action":"ecr:*"}]}`, m.policies["unmanaged"]), m.policies["unmanaged"])
+	assert.Equal([]string{"managed", "nopolicy", "unmanaged"}, repositories(e.Summary, summary.OperationUpdate, summary.StatusSucceeded))
+}
+
+func TestWorkExpired(t *testing.T) {
+	m := &mockedECRRegistry{policies: map[string]string{
+		"expired":  `{"Version":"2008-10-17","Statement":[{"Sid":"VendorPull","Effect":"Allow","Principal":"*","Action":"ecr:BatchGetImage"}]}`,
+		"nopolicy": "",
+	}}
+	e := &ECRUpdaterClient{Client: m, Logger: Logger}
+	e.Init()
+
+	// Every grant of the configured policy has expired: the policy is deleted rather than set without statement
+	configured := []byte(`{"Version":"2008-10-17","Statement":[]}`)
+	configs := []configuration.ConfigurationFile{
+		{RepositoryName: "expired", RepositoryPolicy: configured, Expired: true},
+		{RepositoryName: "nopolicy", RepositoryPolicy: configured, Expired: true},
+	}
+	assert := assert.New(t)
+	changes := PlanJobs(context.Background(), context.Background(), []Job{{Client: e, Configs: configs}}, 2)
+	if assert.Len(changes, 2) {
+		assert.Equal(ActionDelete, changes[0].Action)
+		assert.Equal(ActionUnchanged, changes[1].Action)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	e.Work(context.Background(), configs[0], &wg)
+	e.Work(context.Background(), configs[1], &wg)
+
+	assert.Equal("", m.policies["expired"])
+	assert.Equal("", m.policies["nopolicy"])
+	assert.Equal([]string{"expired", "nopolicy"}, repositories(e.Summary, summary.OperationUpdate, summary.StatusSucceeded))
+}
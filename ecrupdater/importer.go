@@ -0,0 +1,152 @@
+package ecrupdater
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// ImportFilter selects the existing repositories to import
+type ImportFilter struct {
+	Prefix string            // Prefix of the names of the repositories. Empty matches all the repositories
+	Tags   map[string]string // Tags the repositories must all have, with the same value. Empty matches all the repositories
+}
+
+// ImportedRepository is an existing repository with its current policy
+type ImportedRepository struct {
+	Name       string
+	RegistryID string // Registry of the repository, as given to Import
+	Exists     bool   // Whether the repository has a policy
+	PolicyText string
+}
+
+// Import will list the repositories of the given registry matching the filter, and fetch their current policy
+// with at most workers concurrent calls. The empty registry ID is the default registry of the client. No change is made
+// It returns the repositories sorted by name, or the first error encountered
+func (e *ECRUpdaterClient) Import(ctx context.Context, registryID string, filter ImportFilter, workers int) ([]ImportedRepository, error) {
+	if e.Public != nil {
+		return nil, fmt.Errorf("the repositories of %s cannot be imported, only private repositories can", e.location())
+	}
+
+	repositories, err := e.listRepositories(ctx, repository{registryID: registryID}, filter)
+	if err != nil {
+		return nil, err
+	}
+	if workers < 1 {
+		workers = len(repositories)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	imported := make([]ImportedRepository, len(repositories))
+	sem := make(chan struct{}, workers)
+	for i, r := range repositories {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, r repository) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			entry, _, err := e.currentPolicy(ctx, r)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("cannot fetch the policy of repository %s: %v", r, err)
+				}
+				mu.Unlock()
+				return
+			}
+			imported[i] = ImportedRepository{Name: r.name, RegistryID: r.registryID, Exists: entry.Exists, PolicyText: entry.PolicyText}
+		}(i, r)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return imported, nil
+}
+
+// listRepositories will page through the repositories of the registry of registry, keeping those matching the filter
+// It returns the matching repositories sorted by name
+func (e *ECRUpdaterClient) listRepositories(ctx context.Context, registry repository, filter ImportFilter) ([]repository, error) {
+	repositories := []repository{}
+	var token *string
+	for {
+		var out *ecr.DescribeRepositoriesOutput
+		_, err := e.withRetry(ctx, registryName(registry.registryID), func(ctx context.Context) error {
+			var err error
+			out, err = e.Client.DescribeRepositoriesWithContext(ctx, &ecr.DescribeRepositoriesInput{
+				RegistryId: registry.registryIDInput(),
+				NextToken:  token,
+			})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot list the repositories of registry %s: %v", registryName(registry.registryID), err)
+		}
+
+		for _, r := range out.Repositories {
+			name := aws.StringValue(r.RepositoryName)
+			if !strings.HasPrefix(name, filter.Prefix) {
+				continue
+			}
+			if len(filter.Tags) > 0 {
+				match, err := e.hasTags(ctx, aws.StringValue(r.RepositoryArn), filter.Tags)
+				if err != nil {
+					return nil, fmt.Errorf("cannot list the tags of repository %s: %v", name, err)
+				}
+				if !match {
+					continue
+				}
+			}
+			repositories = append(repositories, repository{registryID: registry.registryID, name: name})
+		}
+
+		token = out.NextToken
+		if token == nil {
+			break
+		}
+	}
+
+	sort.Slice(repositories, func(i, j int) bool { return repositories[i].name < repositories[j].name })
+	return repositories, nil
+}
+
+// hasTags returns true if the repository of the given ARN has all the given tags
+func (e *ECRUpdaterClient) hasTags(ctx context.Context, arn string, tags map[string]string) (bool, error) {
+	var out *ecr.ListTagsForResourceOutput
+	_, err := e.withRetry(ctx, arn, func(ctx context.Context) error {
+		var err error
+		out, err = e.Client.ListTagsForResourceWithContext(ctx, &ecr.ListTagsForResourceInput{ResourceArn: aws.String(arn)})
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	found := make(map[string]string, len(out.Tags))
+	for _, t := range out.Tags {
+		found[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	for k, v := range tags {
+		if value, ok := found[k]; !ok || value != v {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// registryName returns the ID of the registry, or "default" for the default registry
+func registryName(id string) string {
+	if id == "" {
+		return "default"
+	}
+	return id
+}
@@ -0,0 +1,143 @@
+package ecrupdater
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockedECRListing is a mockedECRRegistry listing its repositories by pages of pageSize, with their tags
+type mockedECRListing struct {
+	*mockedECRRegistry
+	pageSize int
+	tags     map[string]map[string]string
+	pages    int // Number of pages listed
+}
+
+func (m *mockedECRListing) DescribeRepositoriesWithContext(ctx aws.Context, input *ecr.DescribeRepositoriesInput, opts ...request.Option) (*ecr.DescribeRepositoriesOutput, error) {
+	m.pages++
+	prefix := ""
+	if input.RegistryId != nil {
+		prefix = aws.StringValue(input.RegistryId) + "/"
+	}
+	names := []string{}
+	for k := range m.policies {
+		if strings.HasPrefix(k, prefix) && !strings.Contains(strings.TrimPrefix(k, prefix), "/") {
+			names = append(names, strings.TrimPrefix(k, prefix))
+		}
+	}
+	// Unsorted, as ECR does not sort them
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	start := 0
+	if input.NextToken != nil {
+		start, _ = strconv.Atoi(aws.StringValue(input.NextToken))
+	}
+	out := &ecr.DescribeRepositoriesOutput{}
+	for i := start; i < len(names) && i < start+m.pageSize; i++ {
+		out.Repositories = append(out.Repositories, &ecr.Repository{
+			RepositoryName: aws.String(names[i]),
+			RepositoryArn:  aws.String("arn:aws:ecr:eu-west-1:000000000000:repository/" + names[i]),
+		})
+	}
+	if start+m.pageSize < len(names) {
+		out.NextToken = aws.String(strconv.Itoa(start + m.pageSize))
+	}
+	return out, nil
+}
+
+func (m *mockedECRListing) ListTagsForResourceWithContext(ctx aws.Context, input *ecr.ListTagsForResourceInput, opts ...request.Option) (*ecr.ListTagsForResourceOutput, error) {
+	name := strings.TrimPrefix(aws.StringValue(input.ResourceArn), "arn:aws:ecr:eu-west-1:000000000000:repository/")
+	out := &ecr.ListTagsForResourceOutput{}
+	for k, v := range m.tags[name] {
+		out.Tags = append(out.Tags, &ecr.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return out, nil
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		desc       string
+		registryID string
+		filter     ImportFilter
+		want       []ImportedRepository
+		wantPages  int
+	}{
+		{
+			desc: "All the repositories of all the pages",
+			want: []ImportedRepository{
+				{Name: "api", Exists: true, PolicyText: "api-policy"},
+				{Name: "app", Exists: true, PolicyText: "app-policy"},
+				{Name: "base"},
+				{Name: "worker", Exists: true, PolicyText: "worker-policy"},
+			},
+			wantPages: 2,
+		},
+		{
+			desc:   "Repositories with a prefix",
+			filter: ImportFilter{Prefix: "ap"},
+			want: []ImportedRepository{
+				{Name: "api", Exists: true, PolicyText: "api-policy"},
+				{Name: "app", Exists: true, PolicyText: "app-policy"},
+			},
+			wantPages: 2,
+		},
+		{
+			desc:   "Repositories with all the tags",
+			filter: ImportFilter{Tags: map[string]string{"team": "payments", "env": "prod"}},
+			want: []ImportedRepository{
+				{Name: "worker", Exists: true, PolicyText: "worker-policy"},
+			},
+			wantPages: 2,
+		},
+		{
+			desc:       "Repositories of a registry",
+			registryID: "111111111111",
+			want: []ImportedRepository{
+				{Name: "shared", RegistryID: "111111111111", Exists: true, PolicyText: "shared-policy"},
+			},
+			wantPages: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			m := &mockedECRListing{
+				mockedECRRegistry: &mockedECRRegistry{policies: map[string]string{
+					"worker":              "worker-policy",
+					"app":                 "app-policy",
+					"base":                "",
+					"api":                 "api-policy",
+					"111111111111/shared": "shared-policy",
+				}},
+				pageSize: 3,
+				tags: map[string]map[string]string{
+					"app":    {"team": "payments", "env": "dev"},
+					"worker": {"team": "payments", "env": "prod", "owner": "alice"},
+				},
+			}
+			e := &ECRUpdaterClient{Client: m, Logger: Logger}
+			e.Init()
+
+			imported, err := e.Import(context.Background(), test.registryID, test.filter, 2)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, imported)
+			assert.Equal(t, test.wantPages, m.pages)
+		})
+	}
+}
+
+func TestImportPublic(t *testing.T) {
+	e := &ECRUpdaterClient{Public: &mockedECRPublicRegistry{}, Region: "us-east-1", Logger: Logger}
+	e.Init()
+
+	_, err := e.Import(context.Background(), "", ImportFilter{}, 1)
+	assert.EqualError(t, err, "the repositories of default credentials, region us-east-1 cannot be imported, only private repositories can")
+}
@@ -0,0 +1,55 @@
+package ecrupdater
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lescactus/ecr-go/backup"
+	"github.com/lescactus/ecr-go/configuration"
+)
+
+// Job is a set of repositories to update with the same client
+type Job struct {
+	Client  *ECRUpdaterClient
+	Configs []configuration.ConfigurationFile
+}
+
+// RestoreJob is a set of backup entries to restore with the same client
+type RestoreJob struct {
+	Client  *ECRUpdaterClient
+	Entries []backup.Entry
+}
+
+// RunJobs will run all the jobs concurrently, each one with at most workers concurrent updates
+// In transactional mode, all the jobs form a single transaction, see runTransaction
+func RunJobs(ctx, stop context.Context, jobs []Job, workers int, transactional bool) {
+	if transactional {
+		runTransaction(ctx, stop, jobs, workers)
+		return
+	}
+
+	parallel(len(jobs), func(i int) {
+		jobs[i].Client.run(ctx, stop, jobs[i].Configs, workers)
+	})
+}
+
+// RunRestoreJobs will run all the restoration jobs concurrently, each one with at most workers concurrent restorations
+func RunRestoreJobs(ctx, stop context.Context, jobs []RestoreJob, workers int) {
+	parallel(len(jobs), func(i int) {
+		jobs[i].Client.RunRestore(ctx, stop, jobs[i].Entries, workers)
+	})
+}
+
+// parallel will call fn for each index in [0, n) concurrently
+// It returns once all the calls are completed
+func parallel(n int, fn func(int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,114 @@
+package ecrupdater
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lescactus/ecr-go/backup"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/summary"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRegionJobs returns a job per region, sharing the same summary, updating the same repositories
+func newRegionJobs(collector *summary.Collector, registries map[string]*mockedECRRegistry, configs []configuration.ConfigurationFile) []Job {
+	jobs := []Job{}
+	for _, region := range []string{"eu-west-1", "us-east-1"} {
+		e := &ECRUpdaterClient{
+			Client:  registries[region],
+			Region:  region,
+			Summary: collector,
+			Logger:  Logger,
+		}
+		e.Init()
+		jobs = append(jobs, Job{Client: e, Configs: configs})
+	}
+	return jobs
+}
+
+func TestRunJobs(t *testing.T) {
+	tests := []struct {
+		desc          string
+		transactional bool
+		wantPolicies  map[string]map[string]string
+		wantSucceeded []string
+		wantFailed    []string
+		wantRollback  []string
+	}{
+		{
+			// Only the us-east-1 registry rejects the policy of repo2
+			desc: "Regions are updated independently",
+			wantPolicies: map[string]map[string]string{
+				"eu-west-1": {"repo1": "new", "repo2": "rejected"},
+				"us-east-1": {"repo1": "new", "repo2": "old"},
+			},
+			wantSucceeded: []string{"eu-west-1/repo1", "eu-west-1/repo2", "us-east-1/repo1"},
+			wantFailed:    []string{"us-east-1/repo2"},
+		},
+		{
+			desc:          "A failure in a region rolls back all the regions",
+			transactional: true,
+			wantPolicies: map[string]map[string]string{
+				"eu-west-1": {"repo1": "old", "repo2": "old"},
+				"us-east-1": {"repo1": "old", "repo2": "old"},
+			},
+			wantSucceeded: []string{"eu-west-1/repo1", "eu-west-1/repo2", "us-east-1/repo1"},
+			wantFailed:    []string{"us-east-1/repo2"},
+			wantRollback:  []string{"eu-west-1/repo1", "eu-west-1/repo2", "us-east-1/repo1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			registries := map[string]*mockedECRRegistry{
+				"eu-west-1": {policies: map[string]string{"repo1": "old", "repo2": "old"}},
+				"us-east-1": {policies: map[string]string{"repo1": "old", "repo2": "old"}, invalid: "rejected"},
+			}
+			configs := []configuration.ConfigurationFile{
+				{RepositoryName: "repo1", RepositoryPolicy: []byte("new")},
+				{RepositoryName: "repo2", RepositoryPolicy: []byte("rejected")},
+			}
+
+			c := summary.NewCollector()
+			RunJobs(context.Background(), context.Background(), newRegionJobs(c, registries, configs), 2, test.transactional)
+
+			assert := assert.New(t)
+			for region, policies := range test.wantPolicies {
+				assert.Equal(policies, registries[region].policies, region)
+			}
+			assert.ElementsMatch(test.wantSucceeded, regionRepositories(c, summary.OperationUpdate, summary.StatusSucceeded))
+			assert.ElementsMatch(test.wantFailed, regionRepositories(c, summary.OperationUpdate, summary.StatusFailed))
+			assert.ElementsMatch(test.wantRollback, regionRepositories(c, summary.OperationRollback, summary.StatusSucceeded))
+		})
+	}
+}
+
+func TestRunRestoreJobs(t *testing.T) {
+	registries := map[string]*mockedECRRegistry{
+		"eu-west-1": {policies: map[string]string{"repo1": "new"}},
+		"us-east-1": {policies: map[string]string{"repo1": "new"}},
+	}
+	c := summary.NewCollector()
+	jobs := []RestoreJob{}
+	for _, j := range newRegionJobs(c, registries, nil) {
+		jobs = append(jobs, RestoreJob{
+			Client:  j.Client,
+			Entries: []backup.Entry{{RepositoryName: "repo1", Region: j.Client.Region, Exists: true, PolicyText: "old-" + j.Client.Region}},
+		})
+	}
+
+	RunRestoreJobs(context.Background(), context.Background(), jobs, 1)
+
+	assert.Equal(t, map[string]string{"repo1": "old-eu-west-1"}, registries["eu-west-1"].policies)
+	assert.Equal(t, map[string]string{"repo1": "old-us-east-1"}, registries["us-east-1"].policies)
+	assert.ElementsMatch(t, []string{"eu-west-1/repo1", "us-east-1/repo1"}, regionRepositories(c, summary.OperationRestore, summary.StatusSucceeded))
+}
+
+// regionRepositories returns the "region/repository" of the records of the given operation and status
+func regionRepositories(c *summary.Collector, operation summary.Operation, status summary.Status) []string {
+	l := []string{}
+	for _, r := range c.WithStatus(operation, status) {
+		l = append(l, r.Region+"/"+r.Repository)
+	}
+	return l
+}
@@ -0,0 +1,218 @@
+package ecrupdater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/summary"
+)
+
+// Action is the change a run would make to the policy of a repository
+type Action string
+
+const (
+	ActionCreate    Action = "create"    // The repository has no policy yet
+	ActionUpdate    Action = "update"    // The current policy differs from the configured one
+	ActionDelete    Action = "delete"    // No statement is left: the current policy is deleted
+	ActionUnchanged Action = "unchanged" // The current policy is equivalent to the configured one
+	ActionError     Action = "error"     // The current policy cannot be fetched
+)
+
+// Change is the change a run would make to the policy of a repository
+type Change struct {
+	Record  summary.Record // Repository of the change. Only its identifying fields are set
+	Action  Action
+	Current string   // Current policy text. Empty if the repository has no policy
+	Desired string   // Configured policy text, merged with the unmanaged statements of the current one in merge mode. Empty if no statement is left
+	Changed []string // Managed settings other than the policy that differ from the configuration, like catalogData
+	Err     error    // Error encountered while fetching the current policy or settings
+}
+
+// SettingCatalogData is the setting of a change of the catalog data of a public repository
+const SettingCatalogData = "catalogData"
+
+// PlanJobs will compute the changes of all the jobs concurrently, each one with at most workers concurrent calls
+// No change is made. It returns the changes in the order of the jobs and of their repositories
+func PlanJobs(ctx, stop context.Context, jobs []Job, workers int) []Change {
+	changes := make([][]Change, len(jobs))
+	parallel(len(jobs), func(i int) {
+		changes[i] = jobs[i].Client.Plan(ctx, stop, jobs[i].Configs, workers)
+	})
+
+	all := []Change{}
+	for _, c := range changes {
+		all = append(all, c...)
+	}
+	return all
+}
+
+// Plan will compare the current policy of each of the given repositories with its configured policy,
+// with at most workers concurrent calls. No change is made
+// The repositories not scheduled because stop is done are reported as errors
+func (e *ECRUpdaterClient) Plan(ctx, stop context.Context, configs []configuration.ConfigurationFile, workers int) []Change {
+	if workers < 1 {
+		workers = len(configs)
+	}
+
+	var wg sync.WaitGroup
+	changes := make([]Change, len(configs))
+	sem := make(chan struct{}, workers)
+	for i, repo := range configRepositories(configs) {
+		changes[i] = Change{
+			Record:  e.newRecord(repo, "", ""),
+			Desired: e.configuredPolicy(configs[i]),
+		}
+
+		select {
+		case <-stop.Done():
+		case sem <- struct{}{}:
+		}
+		if stop.Err() != nil {
+			changes[i].Action = ActionError
+			changes[i].Err = fmt.Errorf("run interrupted: %v", stop.Err())
+			continue
+		}
+
+		wg.Add(1)
+		go func(c *Change, repo repository, catalogData *configuration.CatalogData) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			entry, _, err := e.currentPolicy(ctx, repo)
+			if err == nil {
+				c.Desired, err = e.desiredPolicy(entry, c.Desired)
+			}
+			switch {
+			case err != nil:
+				c.Action = ActionError
+				c.Err = err
+				return
+			case !entry.Exists && c.Desired == "":
+				c.Action = ActionUnchanged
+			case !entry.Exists:
+				c.Action = ActionCreate
+			case c.Desired == "":
+				c.Action = ActionDelete
+				c.Current = entry.PolicyText
+			case EquivalentPolicies(entry.PolicyText, c.Desired):
+				c.Action = ActionUnchanged
+				c.Current = entry.PolicyText
+			default:
+				c.Action = ActionUpdate
+				c.Current = entry.PolicyText
+			}
+
+			// The catalog data is managed too: a repository with an unchanged policy is updated if its catalog data differs
+			if catalogData != nil && e.Public != nil {
+				differs, _, err := e.catalogDataDiffers(ctx, repo, catalogData)
+				switch {
+				case err != nil:
+					c.Action = ActionError
+					c.Err = err
+				case differs:
+					c.Changed = append(c.Changed, SettingCatalogData)
+					if c.Action == ActionUnchanged {
+						c.Action = ActionUpdate
+					}
+				}
+			}
+		}(&changes[i], repo, configs[i].CatalogData)
+	}
+	wg.Wait()
+
+	return changes
+}
+
+// String returns the action and the repository of the change, with the changed settings other than the policy
+func (c Change) String() string {
+	s := fmt.Sprintf("%-9s %s", c.Action, c.Record.Target())
+	if len(c.Changed) > 0 {
+		s = fmt.Sprintf("%s [%s]", s, strings.Join(c.Changed, ", "))
+	}
+	if c.Err != nil {
+		s = fmt.Sprintf("%s: %v", s, c.Err)
+	}
+	return s
+}
+
+// Diff returns the line by line difference between the current and the configured policy, both in canonical form
+// Removed lines are prefixed by "-", added lines by "+" and common lines by a space
+func (c Change) Diff() []string {
+	current, desired := []string{}, []string{}
+	if c.Current != "" {
+		current = canonicalLines(c.Current)
+	}
+	if c.Desired != "" {
+		desired = canonicalLines(c.Desired)
+	}
+	return lineDiff(current, desired)
+}
+
+// EquivalentPolicies returns true if both policies are the same JSON document, whatever their formatting and the order of their keys
+func EquivalentPolicies(a, b string) bool {
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return a == b
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// canonicalLines returns the lines of the policy indented with sorted keys, or its raw lines if it is not valid JSON
+func canonicalLines(policy string) []string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(policy), &v); err == nil {
+		if b, err := json.MarshalIndent(v, "", "    "); err == nil {
+			policy = string(b)
+		}
+	}
+	return strings.Split(strings.TrimRight(policy, "\n"), "\n")
+}
+
+// lineDiff returns the difference between a and b, from their longest common subsequence of lines
+func lineDiff(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []string{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "-"+a[i])
+			i++
+		default:
+			lines = append(lines, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+"+b[j])
+	}
+	return lines
+}
@@ -0,0 +1,175 @@
+package ecrupdater
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lescactus/ecr-go/configuration"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan(t *testing.T) {
+	m := &mockedECRRegistry{policies: map[string]string{
+		"same":      `{"Version": "2008-10-17", "Statement": []}`,
+		"different": `{"Version": "2012-10-17", "Statement": []}`,
+		"nopolicy":  "",
+	}}
+	e := &ECRUpdaterClient{Client: m, Region: "eu-west-1", Logger: Logger}
+	e.Init()
+
+	desired := `{"Statement":[],"Version":"2008-10-17"}`
+	configs := []configuration.ConfigurationFile{
+		{RepositoryName: "same", RepositoryPolicy: []byte(desired)},
+		{RepositoryName: "different", RepositoryPolicy: []byte(desired)},
+		{RepositoryName: "nopolicy", RepositoryPolicy: []byte(desired)},
+		{RepositoryName: "notfound", RepositoryPolicy: []byte(desired)},
+	}
+	changes := PlanJobs(context.Background(), context.Background(), []Job{{Client: e, Configs: configs}}, 2)
+
+	assert := assert.New(t)
+	if !assert.Len(changes, 4) {
+		return
+	}
+	assert.Equal(ActionUnchanged, changes[0].Action)
+	assert.Equal(ActionUpdate, changes[1].Action)
+	assert.Equal(`{"Version": "2012-10-17", "Statement": []}`, changes[1].Current)
+	assert.Equal(ActionCreate, changes[2].Action)
+	assert.Empty(changes[2].Current)
+	assert.Equal(ActionError, changes[3].Action)
+	assert.Error(changes[3].Err)
+
+	assert.Equal("update    different (eu-west-1)", changes[1].String())
+	assert.Equal("error     notfound (eu-west-1): RepositoryNotFoundException: The repository does not exist", changes[3].String())
+	assert.Equal([]string{
+		" {",
+		"     \"Statement\": [],",
+		"-    \"Version\": \"2012-10-17\"",
+		"+    \"Version\": \"2008-10-17\"",
+		" }",
+	}, changes[1].Diff())
+	assert.Equal([]string{"+{", "+    \"Statement\": [],", "+    \"Version\": \"2008-10-17\"", "+}"}, changes[2].Diff())
+
+	// Nothing was changed
+	assert.Equal(`{"Version": "2012-10-17", "Statement": []}`, m.policies["different"])
+	assert.Empty(e.Summary.Records())
+}
+
+func TestPlanCatalogData(t *testing.T) {
+	policy := `{"Version":"2008-10-17","Statement":[]}`
+	m := &mockedECRPublicRegistry{
+		policies: map[string]string{"same": policy, "described": policy, "new": ""},
+		catalog: map[string]*ecrpublic.RepositoryCatalogDataInput{
+			"same":      {Description: aws.String("Same"), Architectures: aws.StringSlice([]string{"x86-64", "ARM 64"})},
+			"described": {Description: aws.String("Old")},
+		},
+	}
+	e := &ECRUpdaterClient{Public: m, Region: "us-east-1", Logger: Logger}
+	e.Init()
+
+	configs := []configuration.ConfigurationFile{
+		{RepositoryName: "same", RepositoryPolicy: []byte(policy), CatalogData: &configuration.CatalogData{Description: "Same", Architectures: []string{"ARM 64", "x86-64"}}},
+		{RepositoryName: "described", RepositoryPolicy: []byte(policy), CatalogData: &configuration.CatalogData{Description: "New"}},
+		{RepositoryName: "new", RepositoryPolicy: []byte(policy), CatalogData: &configuration.CatalogData{Description: "New"}},
+		{RepositoryName: "unmanaged", RepositoryPolicy: []byte(policy)},
+	}
+	changes := e.Plan(context.Background(), context.Background(), configs, 1)
+
+	assert := assert.New(t)
+	assert.Equal(ActionUnchanged, changes[0].Action)
+	assert.Empty(changes[0].Changed)
+	assert.Equal(ActionUpdate, changes[1].Action)
+	assert.Equal([]string{SettingCatalogData}, changes[1].Changed)
+	assert.Equal("update    public:described (us-east-1) [catalogData]", changes[1].String())
+	assert.Equal(ActionCreate, changes[2].Action)
+	assert.Equal([]string{SettingCatalogData}, changes[2].Changed)
+	assert.Equal(ActionError, changes[3].Action)
+}
+
+func TestPlanInterrupted(t *testing.T) {
+	m := &mockedECRRegistry{policies: map[string]string{"repo1": ""}}
+	e := &ECRUpdaterClient{Client: m, Logger: Logger}
+	e.Init()
+
+	stop, cancel := context.WithCancel(context.Background())
+	cancel()
+	changes := e.Plan(context.Background(), stop, []configuration.ConfigurationFile{{RepositoryName: "repo1"}}, 1)
+
+	assert.Equal(t, ActionError, changes[0].Action)
+	assert.EqualError(t, changes[0].Err, "run interrupted: context canceled")
+}
+
+func TestEquivalentPolicies(t *testing.T) {
+	tests := []struct {
+		desc string
+		a, b string
+		want bool
+	}{
+		{
+			desc: "Same document, different formatting and keys order",
+			a:    `{"Version":"2008-10-17","Statement":[{"Sid":"A","Effect":"Allow"}]}`,
+			b:    "{\n  \"Statement\": [\n    {\"Effect\": \"Allow\", \"Sid\": \"A\"}\n  ],\n  \"Version\": \"2008-10-17\"\n}",
+			want: true,
+		},
+		{
+			desc: "Different statements order",
+			a:    `{"Statement":[{"Sid":"A"},{"Sid":"B"}]}`,
+			b:    `{"Statement":[{"Sid":"B"},{"Sid":"A"}]}`,
+			want: false,
+		},
+		{
+			desc: "Invalid JSON",
+			a:    `{`,
+			b:    `{}`,
+			want: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.want, EquivalentPolicies(test.a, test.b))
+		})
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	assert.Equal(t, []string{" a", "-b", "+x", " c", "+d"}, lineDiff([]string{"a", "b", "c"}, []string{"a", "x", "c", "d"}))
+	assert.Equal(t, []string{"-a"}, lineDiff([]string{"a"}, []string{}))
+	assert.Empty(t, lineDiff([]string{}, []string{}))
+}
+
+func TestPlanMerge(t *testing.T) {
+	m := &mockedECRRegistry{policies: map[string]string{
+		"same":    `{"Version":"2008-10-17","Statement":[{"Sid":"Debug","Effect":"Allow","Principal":"*","Action":"ecr:*"},{"Sid":"ecrgo-Pull","Effect":"Allow"}]}`,
+		"changed": `{"Version":"2008-10-17","Statement":[{"Sid":"ecrgo-Old","Effect":"Allow"}]}`,
+	}}
+	e := &ECRUpdaterClient{Client: m, ManagedPrefix: "ecrgo-", Logger: Logger}
+	e.Init()
+
+	configured := []byte(`{"Version":"2008-10-17","Statement":[{"Sid":"ecrgo-Pull","Effect":"Allow"}]}`)
+	changes := e.Plan(context.Background(), context.Background(), []configuration.ConfigurationFile{
+		{RepositoryName: "same", RepositoryPolicy: configured},
+		{RepositoryName: "changed", RepositoryPolicy: configured},
+	}, 1)
+
+	assert := assert.New(t)
+	// The order of the statements differs: the unmanaged ones are after the managed ones
+	assert.Equal(ActionUpdate, changes[0].Action)
+	assert.True(EquivalentPolicies(`{"Version":"2008-10-17","Statement":[{"Sid":"ecrgo-Pull","Effect":"Allow"},{"Sid":"Debug","Effect":"Allow","Principal":"*","Action":"ecr:*"}]}`, changes[0].Desired))
+	assert.Equal(ActionUpdate, changes[1].Action)
+	assert.True(EquivalentPolicies(string(configured), changes[1].Desired))
+
+	// Without statement left, the policy is deleted
+	m.policies["nopolicy"] = ""
+	changes = e.Plan(context.Background(), context.Background(), []configuration.ConfigurationFile{
+		{RepositoryName: "changed", RepositoryPolicy: []byte(`{"Version":"2008-10-17","Statement":[]}`)},
+		{RepositoryName: "nopolicy", RepositoryPolicy: []byte(`{"Version":"2008-10-17","Statement":[]}`)},
+	}, 1)
+	assert.Equal(ActionDelete, changes[0].Action)
+	assert.Equal(m.policies["changed"], changes[0].Current)
+	assert.Empty(changes[0].Desired)
+	assert.Equal([]string{`-{`, `-    "Statement": [`, `-        {`, `-            "Effect": "Allow",`, `-            "Sid": "ecrgo-Old"`, `-        }`, `-    ],`, `-    "Version": "2008-10-17"`, `-}`}, changes[0].Diff())
+	assert.Equal(ActionUnchanged, changes[1].Action)
+}
@@ -0,0 +1,219 @@
+package ecrupdater
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/lescactus/ecr-go/backup"
+	"github.com/lescactus/ecr-go/configuration"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// probePolicyText is the policy sent to probe the write permission of a repository
+// It is not valid JSON: an authorized call is always rejected with an InvalidParameterException, leaving the policy unchanged,
+// while an unauthorized call fails with an access denied error
+const probePolicyText = "{"
+
+// Identity is the identity of the caller of a client, as returned by STS GetCallerIdentity
+type Identity struct {
+	Account string
+	Arn     string
+}
+
+// PreflightJobs will check, for each job concurrently, the identity of the caller and its permissions on the repositories of the job
+// The caller must be in one of the expected accounts, if any. See CheckIdentity and CheckPermissions
+// No change is made. It returns all the errors encountered, in the order of the jobs: no error means the jobs can run
+func PreflightJobs(ctx context.Context, jobs []Job, workers int, expected []string) []error {
+	repositories := make([][]repository, len(jobs))
+	clients := make([]*ECRUpdaterClient, len(jobs))
+	for i, j := range jobs {
+		clients[i] = j.Client
+		repositories[i] = configRepositories(j.Configs)
+	}
+	return preflight(ctx, clients, repositories, workers, expected)
+}
+
+// PreflightRestoreJobs will run the checks of PreflightJobs on the repositories of the given restoration jobs
+func PreflightRestoreJobs(ctx context.Context, jobs []RestoreJob, workers int, expected []string) []error {
+	repositories := make([][]repository, len(jobs))
+	clients := make([]*ECRUpdaterClient, len(jobs))
+	for i, j := range jobs {
+		clients[i] = j.Client
+		repositories[i] = entriesRepositories(j.Entries)
+	}
+	return preflight(ctx, clients, repositories, workers, expected)
+}
+
+// preflight will check the identity of the caller of each client, then its permissions on the given repositories
+// The permissions are not checked for a client whose identity is rejected
+func preflight(ctx context.Context, clients []*ECRUpdaterClient, repositories [][]repository, workers int, expected []string) []error {
+	errs := make([][]error, len(clients))
+	parallel(len(clients), func(i int) {
+		if _, err := clients[i].CheckIdentity(ctx, expected); err != nil {
+			errs[i] = []error{err}
+			return
+		}
+		errs[i] = clients[i].checkPermissions(ctx, repositories[i], workers)
+	})
+
+	all := []error{}
+	for _, e := range errs {
+		all = append(all, e...)
+	}
+	return all
+}
+
+// CheckIdentity will fetch the identity of the caller of the client with e.STS, and log it
+// It returns an error if the caller is not in one of the expected accounts, or not in e.Account when set.
+// No expected account means any account. The check is skipped if e.STS is nil
+func (e *ECRUpdaterClient) CheckIdentity(ctx context.Context, expected []string) (Identity, error) {
+	if e.STS == nil {
+		return Identity{}, nil
+	}
+
+	var identity Identity
+	err := e.callWithTimeout(ctx, func(ctx context.Context) error {
+		out, err := e.STS.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return err
+		}
+		identity = Identity{Account: aws.StringValue(out.Account), Arn: aws.StringValue(out.Arn)}
+		return nil
+	})
+	if err != nil {
+		return identity, fmt.Errorf("%s: cannot get the caller identity: %v", e.location(), err)
+	}
+	e.Logger.Info(fmt.Sprintf("Caller identity: account %s, ARN %s", identity.Account, identity.Arn))
+
+	if e.Account != "" && identity.Account != e.Account {
+		return identity, fmt.Errorf("%s: caller %s is in account %s, not in the account of the repositories", e.location(), identity.Arn, identity.Account)
+	}
+	if len(expected) > 0 && !containsString(expected, identity.Account) {
+		return identity, fmt.Errorf("%s: caller %s is in account %s, which is not an expected account", e.location(), identity.Arn, identity.Account)
+	}
+	return identity, nil
+}
+
+// CheckPermissions will check the caller of the client can read and write the policy of each of the given repositories,
+// with at most workers concurrent checks. No change is made, see probePolicyText
+// It returns the errors of the repositories that cannot be managed or were not checked before ctx was done, sorted as the
+// given repositories
+func (e *ECRUpdaterClient) CheckPermissions(ctx context.Context, configs []configuration.ConfigurationFile, workers int) []error {
+	return e.checkPermissions(ctx, configRepositories(configs), workers)
+}
+
+// checkPermissions will check the caller of the client can read and write the policy of each of the given repositories
+func (e *ECRUpdaterClient) checkPermissions(ctx context.Context, repositories []repository, workers int) []error {
+	if workers < 1 {
+		workers = len(repositories)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(repositories))
+	sem := make(chan struct{}, workers)
+	for i := range repositories {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		// select picks randomly when both are ready: always give priority to the cancellation
+		if ctx.Err() != nil {
+			errs[i] = fmt.Errorf("%s: check interrupted: %v", e.describe(repositories[i]), ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = e.checkRepository(ctx, repositories[i])
+		}(i)
+	}
+	wg.Wait()
+
+	failed := []error{}
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
+
+// checkRepository will check the caller of the client can read and write the policy of the repository
+func (e *ECRUpdaterClient) checkRepository(ctx context.Context, repo repository) error {
+	e.Logger.Debug(fmt.Sprintf("Checking the permissions on repository %s ...", repo))
+
+	// Read: the current policy can be fetched, a repository without policy is fine
+	if _, _, err := e.currentPolicy(ctx, repo); err != nil {
+		return fmt.Errorf("%s: cannot read the policy: %v", e.describe(repo), err)
+	}
+
+	// Write: the probe is authorized, and rejected. It is sent once: a retry could only repeat a write that may have been applied
+	err := e.callWithTimeout(ctx, func(ctx context.Context) error {
+		_, err := e.Client.SetRepositoryPolicyWithContext(ctx, &ecr.SetRepositoryPolicyInput{
+			PolicyText:     aws.String(probePolicyText),
+			RegistryId:     repo.registryIDInput(),
+			RepositoryName: aws.String(repo.name),
+		})
+		return err
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == ecr.ErrCodeInvalidParameterException {
+		return nil
+	}
+	if err == nil {
+		return fmt.Errorf("%s: the write permission probe was unexpectedly accepted", e.describe(repo))
+	}
+	if isAccessDenied(err) {
+		return fmt.Errorf("%s: cannot write the policy: %v", e.describe(repo), err)
+	}
+	return fmt.Errorf("%s: cannot check the write permission: %v", e.describe(repo), err)
+}
+
+// describe returns a human readable identifier of the repository of this client
+func (e *ECRUpdaterClient) describe(repo repository) string {
+	return e.newRecord(repo, "", "").Target()
+}
+
+// location returns a human readable identifier of the target, account and region of this client
+func (e *ECRUpdaterClient) location() string {
+	l := "default credentials"
+	if e.Account != "" {
+		l = fmt.Sprintf("account %s", e.Account)
+	}
+	if e.Target != "" {
+		l = fmt.Sprintf("target %s, %s", e.Target, l)
+	}
+	if e.Region != "" {
+		l = fmt.Sprintf("%s, region %s", l, e.Region)
+	}
+	return l
+}
+
+// entriesRepositories returns the repositories of the given backup entries
+func entriesRepositories(entries []backup.Entry) []repository {
+	repositories := make([]repository, len(entries))
+	for i := range entries {
+		repositories[i] = repository{registryID: entries[i].RegistryID, name: entries[i].RepositoryName}
+	}
+	return repositories
+}
+
+// isAccessDenied returns true if the error reports a missing permission
+func isAccessDenied(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && (awsErr.Code() == "AccessDeniedException" || awsErr.Code() == "AccessDenied")
+}
+
+func containsString(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
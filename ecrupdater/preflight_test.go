@@ -0,0 +1,236 @@
+package ecrupdater
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lescactus/ecr-go/backup"
+	"github.com/lescactus/ecr-go/configuration"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockedSTS struct {
+	stsiface.STSAPI
+	account string
+	err     error
+}
+
+func (m mockedSTS) GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput, opts ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(m.account),
+		Arn:     aws.String("arn:aws:sts::" + m.account + ":assumed-role/ecr-go/ecr-go"),
+	}, nil
+}
+
+// mockedECRDenied is a mockedECRRegistry denying the reads and writes of some repositories
+type mockedECRDenied struct {
+	*mockedECRRegistry
+	deniedRead  map[string]bool
+	deniedWrite map[string]bool
+}
+
+func (m mockedECRDenied) GetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.GetRepositoryPolicyInput, opts ...request.Option) (*ecr.GetRepositoryPolicyOutput, error) {
+	if m.deniedRead[aws.StringValue(input.RepositoryName)] {
+		return nil, awserr.New("AccessDeniedException", "not authorized to perform: ecr:GetRepositoryPolicy", nil)
+	}
+	return m.mockedECRRegistry.GetRepositoryPolicyWithContext(ctx, input, opts...)
+}
+
+func (m mockedECRDenied) SetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.SetRepositoryPolicyInput, opts ...request.Option) (*ecr.SetRepositoryPolicyOutput, error) {
+	if m.deniedWrite[aws.StringValue(input.RepositoryName)] {
+		return nil, awserr.New("AccessDeniedException", "not authorized to perform: ecr:SetRepositoryPolicy", nil)
+	}
+	return m.mockedECRRegistry.SetRepositoryPolicyWithContext(ctx, input, opts...)
+}
+
+func TestCheckIdentity(t *testing.T) {
+	tests := []struct {
+		desc     string
+		sts      stsiface.STSAPI
+		account  string
+		expected []string
+		want     Identity
+		wantErr  string
+	}{
+		{
+			desc: "No STS client",
+		},
+		{
+			desc:     "Expected account",
+			sts:      mockedSTS{account: "111111111111"},
+			expected: []string{"222222222222", "111111111111"},
+			want:     Identity{Account: "111111111111", Arn: "arn:aws:sts::111111111111:assumed-role/ecr-go/ecr-go"},
+		},
+		{
+			desc: "Any account",
+			sts:  mockedSTS{account: "111111111111"},
+			want: Identity{Account: "111111111111", Arn: "arn:aws:sts::111111111111:assumed-role/ecr-go/ecr-go"},
+		},
+		{
+			desc:     "Unexpected account",
+			sts:      mockedSTS{account: "333333333333"},
+			expected: []string{"111111111111"},
+			want:     Identity{Account: "333333333333", Arn: "arn:aws:sts::333333333333:assumed-role/ecr-go/ecr-go"},
+			wantErr:  "default credentials: caller arn:aws:sts::333333333333:assumed-role/ecr-go/ecr-go is in account 333333333333, which is not an expected account",
+		},
+		{
+			desc:    "Not the account of the repositories",
+			sts:     mockedSTS{account: "333333333333"},
+			account: "111111111111",
+			want:    Identity{Account: "333333333333", Arn: "arn:aws:sts::333333333333:assumed-role/ecr-go/ecr-go"},
+			wantErr: "account 111111111111: caller arn:aws:sts::333333333333:assumed-role/ecr-go/ecr-go is in account 333333333333, not in the account of the repositories",
+		},
+		{
+			desc:    "STS error",
+			sts:     mockedSTS{err: errors.New("no credentials")},
+			wantErr: "default credentials: cannot get the caller identity: no credentials",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			e := ECRUpdaterClient{STS: test.sts, Account: test.account, Logger: Logger}
+			e.Init()
+
+			identity, err := e.CheckIdentity(context.Background(), test.expected)
+			assert.Equal(t, test.want, identity)
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	m := mockedECRDenied{
+		mockedECRRegistry: &mockedECRRegistry{
+			policies: map[string]string{"allowed": "old", "nopolicy": "", "readonly": "old", "hidden": "old"},
+			invalid:  probePolicyText,
+		},
+		deniedRead:  map[string]bool{"hidden": true},
+		deniedWrite: map[string]bool{"readonly": true, "hidden": true},
+	}
+	e := ECRUpdaterClient{Client: m, Region: "eu-west-1", Logger: Logger}
+	e.Init()
+
+	configs := []configuration.ConfigurationFile{
+		{RepositoryName: "allowed"},
+		{RepositoryName: "nopolicy"},
+		{RepositoryName: "readonly"},
+		{RepositoryName: "hidden"},
+		{RepositoryName: "notfound"},
+	}
+	errs := e.CheckPermissions(context.Background(), configs, 2)
+
+	assert := assert.New(t)
+	if assert.Len(errs, 3) {
+		assert.EqualError(errs[0], "readonly (eu-west-1): cannot write the policy: AccessDeniedException: not authorized to perform: ecr:SetRepositoryPolicy")
+		assert.EqualError(errs[1], "hidden (eu-west-1): cannot read the policy: AccessDeniedException: not authorized to perform: ecr:GetRepositoryPolicy")
+		assert.EqualError(errs[2], "notfound (eu-west-1): cannot read the policy: RepositoryNotFoundException: The repository does not exist")
+	}
+	// No change is made
+	assert.Equal(map[string]string{"allowed": "old", "nopolicy": "", "readonly": "old", "hidden": "old"}, m.policies)
+	assert.Empty(e.Summary.Records())
+}
+
+// mockedECRCancelling is a mockedECRRegistry cancelling the run on its first read
+type mockedECRCancelling struct {
+	*mockedECRRegistry
+	cancel context.CancelFunc
+}
+
+func (m mockedECRCancelling) GetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.GetRepositoryPolicyInput, opts ...request.Option) (*ecr.GetRepositoryPolicyOutput, error) {
+	m.cancel()
+	return m.mockedECRRegistry.GetRepositoryPolicyWithContext(ctx, input, opts...)
+}
+
+func TestCheckPermissionsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := mockedECRCancelling{
+		mockedECRRegistry: &mockedECRRegistry{policies: map[string]string{"first": "old", "second": "old"}, invalid: probePolicyText},
+		cancel:            cancel,
+	}
+	e := ECRUpdaterClient{Client: m, Region: "eu-west-1", Logger: Logger}
+	e.Init()
+
+	// The only worker is busy with the first repository when the run is cancelled: the check of the second one must not wait for it
+	errs := e.CheckPermissions(ctx, []configuration.ConfigurationFile{{RepositoryName: "first"}, {RepositoryName: "second"}}, 1)
+
+	if assert.NotEmpty(t, errs) {
+		assert.EqualError(t, errs[len(errs)-1], "second (eu-west-1): check interrupted: context canceled")
+	}
+}
+
+// mockedECRThrottledProbe is a mockedECRThrottled whose repositories have no policy
+type mockedECRThrottledProbe struct {
+	*mockedECRThrottled
+}
+
+func (m mockedECRThrottledProbe) GetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.GetRepositoryPolicyInput, opts ...request.Option) (*ecr.GetRepositoryPolicyOutput, error) {
+	return nil, awserr.New(ecr.ErrCodeRepositoryPolicyNotFoundException, "Repository policy does not exist", nil)
+}
+
+func TestCheckPermissionsProbeNotRetried(t *testing.T) {
+	m := &mockedECRThrottled{failures: 5}
+	var sleeps int
+	e := ECRUpdaterClient{
+		Client: mockedECRThrottledProbe{m},
+		Region: "eu-west-1",
+		Logger: Logger,
+		Retry:  DefaultRetryPolicy(),
+		sleep:  func(ctx context.Context, d time.Duration) error { sleeps++; return nil },
+	}
+	e.Init()
+
+	errs := e.CheckPermissions(context.Background(), []configuration.ConfigurationFile{{RepositoryName: "throttled"}}, 1)
+
+	assert := assert.New(t)
+	assert.Equal(1, m.calls)
+	assert.Equal(0, sleeps)
+	if assert.Len(errs, 1) {
+		assert.EqualError(errs[0], "throttled (eu-west-1): cannot check the write permission: ThrottlingException: Rate exceeded")
+	}
+}
+
+func TestPreflightJobs(t *testing.T) {
+	registry := &mockedECRRegistry{policies: map[string]string{"repo1": "old"}, invalid: probePolicyText}
+	newClient := func(account string) *ECRUpdaterClient {
+		e := &ECRUpdaterClient{Client: registry, STS: mockedSTS{account: account}, Account: account, Logger: Logger}
+		e.Init()
+		return e
+	}
+
+	configs := []configuration.ConfigurationFile{{RepositoryName: "repo1"}}
+	assert.Empty(t, PreflightJobs(context.Background(), []Job{{Client: newClient("111111111111"), Configs: configs}}, 2, []string{"111111111111"}))
+
+	// The permissions of a rejected caller are not checked
+	errs := PreflightJobs(context.Background(), []Job{
+		{Client: newClient("111111111111"), Configs: configs},
+		{Client: newClient("222222222222"), Configs: []configuration.ConfigurationFile{{RepositoryName: "notfound"}}},
+	}, 2, []string{"111111111111"})
+	if assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0].Error(), "which is not an expected account")
+	}
+
+	errs = PreflightRestoreJobs(context.Background(), []RestoreJob{
+		{Client: newClient("111111111111"), Entries: []backup.Entry{{RepositoryName: "repo1"}, {RepositoryName: "notfound"}}},
+	}, 2, nil)
+	if assert.Len(t, errs, 1) {
+		assert.EqualError(t, errs[0], "111111111111:notfound: cannot read the policy: RepositoryNotFoundException: The repository does not exist")
+	}
+}
@@ -0,0 +1,171 @@
+package ecrupdater
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lescactus/ecr-go/configuration"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/aws/aws-sdk-go/service/ecrpublic/ecrpubliciface"
+)
+
+// PublicECR exposes the repository policy calls of an ECR Public client as an ECRAPI,
+// so that the policies of the ECR Public repositories are managed like the ones of the ECR repositories
+// The other calls are made on the ECR Public client directly: they return an UnsupportedOperation error
+type PublicECR struct {
+	Client ecrpubliciface.ECRPublicAPI
+}
+
+// ErrCodeUnsupportedOperation is the code of the error of the calls of ECRAPI not supported by PublicECR
+const ErrCodeUnsupportedOperation = "UnsupportedOperation"
+
+// SetRepositoryPolicyWithContext calls ecrpubliciface.ECRPublicAPI.SetRepositoryPolicyWithContext
+func (p *PublicECR) SetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.SetRepositoryPolicyInput, opts ...request.Option) (*ecr.SetRepositoryPolicyOutput, error) {
+	out, err := p.Client.SetRepositoryPolicyWithContext(ctx, &ecrpublic.SetRepositoryPolicyInput{
+		Force:          input.Force,
+		PolicyText:     input.PolicyText,
+		RegistryId:     input.RegistryId,
+		RepositoryName: input.RepositoryName,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ecr.SetRepositoryPolicyOutput{
+		PolicyText:     out.PolicyText,
+		RegistryId:     out.RegistryId,
+		RepositoryName: out.RepositoryName,
+	}, nil
+}
+
+// GetRepositoryPolicyWithContext calls ecrpubliciface.ECRPublicAPI.GetRepositoryPolicyWithContext
+func (p *PublicECR) GetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.GetRepositoryPolicyInput, opts ...request.Option) (*ecr.GetRepositoryPolicyOutput, error) {
+	out, err := p.Client.GetRepositoryPolicyWithContext(ctx, &ecrpublic.GetRepositoryPolicyInput{
+		RegistryId:     input.RegistryId,
+		RepositoryName: input.RepositoryName,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ecr.GetRepositoryPolicyOutput{
+		PolicyText:     out.PolicyText,
+		RegistryId:     out.RegistryId,
+		RepositoryName: out.RepositoryName,
+	}, nil
+}
+
+// DeleteRepositoryPolicyWithContext calls ecrpubliciface.ECRPublicAPI.DeleteRepositoryPolicyWithContext
+func (p *PublicECR) DeleteRepositoryPolicyWithContext(ctx aws.Context, input *ecr.DeleteRepositoryPolicyInput, opts ...request.Option) (*ecr.DeleteRepositoryPolicyOutput, error) {
+	out, err := p.Client.DeleteRepositoryPolicyWithContext(ctx, &ecrpublic.DeleteRepositoryPolicyInput{
+		RegistryId:     input.RegistryId,
+		RepositoryName: input.RepositoryName,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ecr.DeleteRepositoryPolicyOutput{
+		PolicyText:     out.PolicyText,
+		RegistryId:     out.RegistryId,
+		RepositoryName: out.RepositoryName,
+	}, nil
+}
+
+// DescribeRepositoriesWithContext is not supported: the public repositories are described with the ECR Public client
+func (p *PublicECR) DescribeRepositoriesWithContext(ctx aws.Context, input *ecr.DescribeRepositoriesInput, opts ...request.Option) (*ecr.DescribeRepositoriesOutput, error) {
+	return nil, awserr.New(ErrCodeUnsupportedOperation, "DescribeRepositories is not supported on ECR Public through PublicECR", nil)
+}
+
+// ListTagsForResourceWithContext is not supported: the tags of the public repositories are listed with the ECR Public client
+func (p *PublicECR) ListTagsForResourceWithContext(ctx aws.Context, input *ecr.ListTagsForResourceInput, opts ...request.Option) (*ecr.ListTagsForResourceOutput, error) {
+	return nil, awserr.New(ErrCodeUnsupportedOperation, "ListTagsForResource is not supported on ECR Public through PublicECR", nil)
+}
+
+// putCatalogData will replace the catalog data of the given public repository
+// It returns the number of attempts made and any error encountered
+func (e *ECRUpdaterClient) putCatalogData(ctx context.Context, repo repository, data *configuration.CatalogData) (int, error) {
+	input := &ecrpublic.PutRepositoryCatalogDataInput{
+		CatalogData: &ecrpublic.RepositoryCatalogDataInput{
+			AboutText:        aws.String(data.AboutText),
+			Architectures:    aws.StringSlice(data.Architectures),
+			Description:      aws.String(data.Description),
+			OperatingSystems: aws.StringSlice(data.OperatingSystems),
+			UsageText:        aws.String(data.UsageText),
+		},
+		RegistryId:     repo.registryIDInput(),
+		RepositoryName: aws.String(repo.name),
+	}
+	if len(data.Logo) > 0 {
+		input.CatalogData.LogoImageBlob = data.Logo
+	}
+
+	e.Logger.Debug(fmt.Sprintf("Updating the catalog data of repository %s ...", repo))
+	return e.withRetry(ctx, repo.String(), func(ctx context.Context) error {
+		_, err := e.Public.PutRepositoryCatalogDataWithContext(ctx, input)
+		return err
+	})
+}
+
+// currentCatalogData will fetch the catalog data of the given public repository, without its logo
+// It returns the catalog data, the number of attempts made and any error encountered
+func (e *ECRUpdaterClient) currentCatalogData(ctx context.Context, repo repository) (*configuration.CatalogData, int, error) {
+	var current *ecrpublic.RepositoryCatalogData
+	attempts, err := e.withRetry(ctx, repo.String(), func(ctx context.Context) error {
+		out, err := e.Public.GetRepositoryCatalogDataWithContext(ctx, &ecrpublic.GetRepositoryCatalogDataInput{
+			RegistryId:     repo.registryIDInput(),
+			RepositoryName: aws.String(repo.name),
+		})
+		if err != nil {
+			return err
+		}
+		current = out.CatalogData
+		return nil
+	})
+	if err != nil {
+		return nil, attempts, err
+	}
+	if current == nil {
+		current = &ecrpublic.RepositoryCatalogData{}
+	}
+
+	return &configuration.CatalogData{
+		Description:      aws.StringValue(current.Description),
+		AboutText:        aws.StringValue(current.AboutText),
+		UsageText:        aws.StringValue(current.UsageText),
+		Architectures:    aws.StringValueSlice(current.Architectures),
+		OperatingSystems: aws.StringValueSlice(current.OperatingSystems),
+	}, attempts, nil
+}
+
+// catalogDataDiffers will fetch the catalog data of the given public repository and compare it with data
+// The logo is not compared: ECR Public only returns its URL
+// It returns true if any other field differs, the number of attempts made and any error encountered
+func (e *ECRUpdaterClient) catalogDataDiffers(ctx context.Context, repo repository, data *configuration.CatalogData) (bool, int, error) {
+	current, attempts, err := e.currentCatalogData(ctx, repo)
+	if err != nil {
+		return false, attempts, err
+	}
+
+	differs := current.Description != data.Description ||
+		current.AboutText != data.AboutText ||
+		current.UsageText != data.UsageText ||
+		!sameStrings(current.Architectures, data.Architectures) ||
+		!sameStrings(current.OperatingSystems, data.OperatingSystems)
+	return differs, attempts, nil
+}
+
+// sameStrings returns true if both lists have the same strings, whatever their order
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, s := range a {
+		if !containsString(b, s) {
+			return false
+		}
+	}
+	return true
+}
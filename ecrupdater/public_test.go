@@ -0,0 +1,248 @@
+package ecrupdater
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/lescactus/ecr-go/backup"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/summary"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/aws/aws-sdk-go/service/ecrpublic/ecrpubliciface"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockedECRPublicRegistry is an in-memory public registry
+// An empty policy means the repository has no policy
+type mockedECRPublicRegistry struct {
+	ecrpubliciface.ECRPublicAPI
+	sync.Mutex
+	policies map[string]string
+	catalog  map[string]*ecrpublic.RepositoryCatalogDataInput
+	invalid  string // Description of the catalog data rejected with an InvalidParameterException
+}
+
+func (m *mockedECRPublicRegistry) GetRepositoryPolicyWithContext(ctx aws.Context, input *ecrpublic.GetRepositoryPolicyInput, opts ...request.Option) (*ecrpublic.GetRepositoryPolicyOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	p, ok := m.policies[aws.StringValue(input.RepositoryName)]
+	if !ok {
+		return nil, awserr.New(ecrpublic.ErrCodeRepositoryNotFoundException, "The repository does not exist", nil)
+	}
+	if p == "" {
+		return nil, awserr.New(ecrpublic.ErrCodeRepositoryPolicyNotFoundException, "Repository policy does not exist", nil)
+	}
+	return &ecrpublic.GetRepositoryPolicyOutput{RepositoryName: input.RepositoryName, PolicyText: aws.String(p)}, nil
+}
+
+func (m *mockedECRPublicRegistry) SetRepositoryPolicyWithContext(ctx aws.Context, input *ecrpublic.SetRepositoryPolicyInput, opts ...request.Option) (*ecrpublic.SetRepositoryPolicyOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.policies[aws.StringValue(input.RepositoryName)]; !ok {
+		return nil, awserr.New(ecrpublic.ErrCodeRepositoryNotFoundException, "The repository does not exist", nil)
+	}
+	m.policies[aws.StringValue(input.RepositoryName)] = aws.StringValue(input.PolicyText)
+	return &ecrpublic.SetRepositoryPolicyOutput{RepositoryName: input.RepositoryName, PolicyText: input.PolicyText}, nil
+}
+
+func (m *mockedECRPublicRegistry) DeleteRepositoryPolicyWithContext(ctx aws.Context, input *ecrpublic.DeleteRepositoryPolicyInput, opts ...request.Option) (*ecrpublic.DeleteRepositoryPolicyOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	p := m.policies[aws.StringValue(input.RepositoryName)]
+	if p == "" {
+		return nil, awserr.New(ecrpublic.ErrCodeRepositoryPolicyNotFoundException, "Repository policy does not exist", nil)
+	}
+	m.policies[aws.StringValue(input.RepositoryName)] = ""
+	return &ecrpublic.DeleteRepositoryPolicyOutput{RepositoryName: input.RepositoryName, PolicyText: aws.String(p)}, nil
+}
+
+func (m *mockedECRPublicRegistry) PutRepositoryCatalogDataWithContext(ctx aws.Context, input *ecrpublic.PutRepositoryCatalogDataInput, opts ...request.Option) (*ecrpublic.PutRepositoryCatalogDataOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.policies[aws.StringValue(input.RepositoryName)]; !ok {
+		return nil, awserr.New(ecrpublic.ErrCodeRepositoryNotFoundException, "The repository does not exist", nil)
+	}
+	if m.invalid != "" && aws.StringValue(input.CatalogData.Description) == m.invalid {
+		return nil, awserr.New(ecrpublic.ErrCodeInvalidParameterException, "Invalid catalog data", nil)
+	}
+	m.catalog[aws.StringValue(input.RepositoryName)] = input.CatalogData
+	return &ecrpublic.PutRepositoryCatalogDataOutput{}, nil
+}
+
+func (m *mockedECRPublicRegistry) GetRepositoryCatalogDataWithContext(ctx aws.Context, input *ecrpublic.GetRepositoryCatalogDataInput, opts ...request.Option) (*ecrpublic.GetRepositoryCatalogDataOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.policies[aws.StringValue(input.RepositoryName)]; !ok {
+		return nil, awserr.New(ecrpublic.ErrCodeRepositoryNotFoundException, "The repository does not exist", nil)
+	}
+	out := &ecrpublic.GetRepositoryCatalogDataOutput{CatalogData: &ecrpublic.RepositoryCatalogData{}}
+	if c, ok := m.catalog[aws.StringValue(input.RepositoryName)]; ok {
+		out.CatalogData = &ecrpublic.RepositoryCatalogData{
+			AboutText:        c.AboutText,
+			Architectures:    c.Architectures,
+			Description:      c.Description,
+			OperatingSystems: c.OperatingSystems,
+			UsageText:        c.UsageText,
+		}
+	}
+	return out, nil
+}
+
+func TestWorkPublic(t *testing.T) {
+	catalog := &configuration.CatalogData{
+		Description:      "Public repository",
+		AboutText:        "# About",
+		UsageText:        "docker pull public.ecr.aws/lescactus/public",
+		Architectures:    []string{"x86-64"},
+		OperatingSystems: []string{"Linux"},
+		Logo:             []byte("logo"),
+	}
+	oldCatalog := &ecrpublic.RepositoryCatalogDataInput{Description: aws.String("Old repository")}
+
+	tests := []struct {
+		desc        string
+		config      configuration.ConfigurationFile
+		wantStatus  summary.Status
+		wantPolicy  string
+		wantCatalog *ecrpublic.RepositoryCatalogDataInput
+		wantBackup  []backup.Entry
+	}{
+		{
+			desc:       "Policy and catalog data are updated",
+			config:     configuration.ConfigurationFile{RepositoryName: "public", Type: configuration.RepositoryTypePublic, CatalogData: catalog, RepositoryPolicy: []byte("new")},
+			wantStatus: summary.StatusSucceeded,
+			wantPolicy: "new",
+			wantCatalog: &ecrpublic.RepositoryCatalogDataInput{
+				AboutText:        aws.String("# About"),
+				Architectures:    aws.StringSlice([]string{"x86-64"}),
+				Description:      aws.String("Public repository"),
+				LogoImageBlob:    []byte("logo"),
+				OperatingSystems: aws.StringSlice([]string{"Linux"}),
+				UsageText:        aws.String("docker pull public.ecr.aws/lescactus/public"),
+			},
+			wantBackup: []backup.Entry{{RepositoryName: "public", Region: configuration.PublicRegion, Public: true, Exists: true, PolicyText: "old",
+				CatalogData: &configuration.CatalogData{Description: "Old repository", Architectures: []string{}, OperatingSystems: []string{}}}},
+		},
+		{
+			desc:        "Policy only",
+			config:      configuration.ConfigurationFile{RepositoryName: "public", Type: configuration.RepositoryTypePublic, RepositoryPolicy: []byte("new")},
+			wantStatus:  summary.StatusSucceeded,
+			wantPolicy:  "new",
+			wantCatalog: oldCatalog,
+			wantBackup:  []backup.Entry{{RepositoryName: "public", Region: configuration.PublicRegion, Public: true, Exists: true, PolicyText: "old"}},
+		},
+		{
+			desc:        "Private repository",
+			config:      configuration.ConfigurationFile{RepositoryName: "public", RepositoryPolicy: []byte("new")},
+			wantStatus:  summary.StatusFailed,
+			wantPolicy:  "old",
+			wantCatalog: oldCatalog,
+		},
+		{
+			desc:        "Repository not found",
+			config:      configuration.ConfigurationFile{RepositoryName: "notfound", Type: configuration.RepositoryTypePublic, CatalogData: catalog, RepositoryPolicy: []byte("new")},
+			wantStatus:  summary.StatusFailed,
+			wantPolicy:  "old",
+			wantCatalog: oldCatalog,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			m := &mockedECRPublicRegistry{
+				policies: map[string]string{"public": "old"},
+				catalog:  map[string]*ecrpublic.RepositoryCatalogDataInput{"public": oldCatalog},
+			}
+			s := newMemoryStore()
+			e := ECRUpdaterClient{
+				Public:   m,
+				Region:   configuration.PublicRegion,
+				Logger:   Logger,
+				Backup:   s,
+				BackupID: "run",
+			}
+			e.Init()
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go e.Work(context.Background(), test.config, &wg)
+			wg.Wait()
+
+			assert := assert.New(t)
+			r, _ := e.Summary.Get(summary.OperationUpdate, test.config.RepositoryName)
+			assert.Equal(test.wantStatus, r.Status)
+			assert.True(r.Public)
+			assert.Equal(test.wantPolicy, m.policies["public"])
+			assert.Equal(test.wantCatalog, m.catalog["public"])
+			assert.Equal(test.wantBackup, s.entries["run"])
+		})
+	}
+}
+
+func TestWorkPrivateWithPublicRepository(t *testing.T) {
+	m := &mockedECRRegistry{policies: map[string]string{"public": "old"}}
+	e := ECRUpdaterClient{
+		Client: m,
+		Logger: Logger,
+	}
+	e.Init()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go e.Work(context.Background(), configuration.ConfigurationFile{RepositoryName: "public", Type: configuration.RepositoryTypePublic, RepositoryPolicy: []byte("new")}, &wg)
+	wg.Wait()
+
+	r, _ := e.Summary.Get(summary.OperationUpdate, "public")
+	assert.Equal(t, summary.StatusFailed, r.Status)
+	assert.Equal(t, "repository public of type public cannot be managed by this client", r.Error())
+	assert.Equal(t, "old", m.policies["public"])
+}
+
+func TestPublicECRUnsupported(t *testing.T) {
+	p := &PublicECR{Client: &mockedECRPublicRegistry{}}
+
+	_, err := p.DescribeRepositoriesWithContext(context.Background(), &ecr.DescribeRepositoriesInput{})
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrCodeUnsupportedOperation, err.(awserr.Error).Code())
+		assert.True(t, IsTerminal(err))
+	}
+
+	_, err = p.ListTagsForResourceWithContext(context.Background(), &ecr.ListTagsForResourceInput{})
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrCodeUnsupportedOperation, err.(awserr.Error).Code())
+	}
+}
+
+func TestRunRestorePublic(t *testing.T) {
+	m := &mockedECRPublicRegistry{
+		policies: map[string]string{"withpolicy": "new", "withoutpolicy": "new"},
+		catalog:  map[string]*ecrpublic.RepositoryCatalogDataInput{"withpolicy": {Description: aws.String("New repository")}},
+	}
+	e := ECRUpdaterClient{
+		Public: m,
+		Logger: Logger,
+	}
+	e.Init()
+
+	entries := []backup.Entry{
+		{RepositoryName: "withpolicy", Public: true, Exists: true, PolicyText: "old", CatalogData: &configuration.CatalogData{Description: "Old repository"}},
+		{RepositoryName: "withoutpolicy", Public: true, Exists: false},
+	}
+	e.RunRestore(context.Background(), context.Background(), entries, 2)
+
+	assert.Equal(t, map[string]string{"withpolicy": "old", "withoutpolicy": ""}, m.policies)
+	assert.Equal(t, "Old repository", aws.StringValue(m.catalog["withpolicy"].Description))
+	assert.NotContains(t, m.catalog, "withoutpolicy")
+	assert.Equal(t, []string{"withoutpolicy", "withpolicy"}, repositories(e.Summary, summary.OperationRestore, summary.StatusSucceeded))
+}
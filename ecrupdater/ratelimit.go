@@ -0,0 +1,349 @@
+package ecrupdater
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/aws/aws-sdk-go/service/ecrpublic/ecrpubliciface"
+)
+
+const (
+	// throttleFactor is the factor applied to the rate each time a throttling error is encountered
+	throttleFactor = 0.5
+	// recoverySteps is the number of successful calls needed to recover from the minimum rate to the maximum rate
+	recoverySteps = 20
+	// minRateFactor is the lowest fraction of the maximum rate the limiter can slow down to
+	minRateFactor = 0.05
+)
+
+// RateLimiter is an adaptive token bucket
+// Its rate is halved each time a throttling error is reported and recovers gradually
+// with each successful call, following an additive increase/multiplicative decrease scheme
+// It is safe for concurrent use and meant to be shared by all workers
+type RateLimiter struct {
+	mu      sync.Mutex
+	maxRate float64 // Configured rate, in tokens per second
+	minRate float64 // Lowest rate the limiter can slow down to
+	rate    float64 // Current rate, in tokens per second
+	burst   float64 // Maximum number of tokens in the bucket
+	tokens  float64 // Number of available tokens
+	last    time.Time
+
+	now   func() time.Time                           // Overridden in tests
+	sleep func(context.Context, time.Duration) error // Overridden in tests
+}
+
+// NewRateLimiter instanciate a RateLimiter allowing rate calls per second with the given burst
+// It returns nil if rate is not strictly positive. A nil RateLimiter never waits
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		maxRate: rate,
+		minRate: rate * minRateFactor,
+		rate:    rate,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    time.Now(),
+		now:     time.Now,
+		sleep:   sleepContext,
+	}
+}
+
+// Wait blocks until a token is available or ctx is done
+// It returns the error of ctx if it is done before a token is available
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	for {
+		d := r.reserve()
+		if d == 0 {
+			return nil
+		}
+		if err := r.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// reserve will try to take a token from the bucket
+// It returns 0 if a token was taken or the duration to wait before a token is available
+func (r *RateLimiter) reserve() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	if r.tokens >= 1 {
+		r.tokens--
+		return 0
+	}
+	return time.Duration((1 - r.tokens) / r.rate * float64(time.Second))
+}
+
+// Throttled will slow down the limiter after a throttling error
+func (r *RateLimiter) Throttled() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rate *= throttleFactor
+	if r.rate < r.minRate {
+		r.rate = r.minRate
+	}
+	// Drop the remaining burst so the slowdown takes effect immediately
+	if r.tokens > 1 {
+		r.tokens = 1
+	}
+}
+
+// Succeeded will gradually bring the limiter back to its configured rate after a successful call
+func (r *RateLimiter) Succeeded() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rate += (r.maxRate - r.minRate) / recoverySteps
+	if r.rate > r.maxRate {
+		r.rate = r.maxRate
+	}
+}
+
+// Rate returns the current rate of the limiter, in calls per second
+func (r *RateLimiter) Rate() float64 {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rate
+}
+
+// RateLimitedECR wraps an ecriface.ECRAPI and waits for a token of the Read or Write RateLimiter before each call
+// Throttling errors returned by ECR slow down the corresponding limiter
+// Calls not overridden here are passed through without limitation
+type RateLimitedECR struct {
+	ecriface.ECRAPI
+	Read  *RateLimiter
+	Write *RateLimiter
+}
+
+// NewRateLimitedECR wraps the given client with the given read and write limiters
+// It returns the client unchanged if both limiters are nil
+func NewRateLimitedECR(client ecriface.ECRAPI, read, write *RateLimiter) ecriface.ECRAPI {
+	if read == nil && write == nil {
+		return client
+	}
+	return &RateLimitedECR{
+		ECRAPI: client,
+		Read:   read,
+		Write:  write,
+	}
+}
+
+// call will wait for a token of the given limiter, run fn and report its outcome to the limiter
+func call(ctx context.Context, l *RateLimiter, fn func() error) error {
+	if err := l.Wait(ctx); err != nil {
+		return awserr.New(request.CanceledErrorCode, "request context canceled while waiting for the rate limiter", err)
+	}
+	err := fn()
+	if err != nil && IsThrottling(err) {
+		l.Throttled()
+	} else if err == nil {
+		l.Succeeded()
+	}
+	return err
+}
+
+// SetRepositoryPolicy calls SetRepositoryPolicyWithContext with a background context
+func (r *RateLimitedECR) SetRepositoryPolicy(input *ecr.SetRepositoryPolicyInput) (*ecr.SetRepositoryPolicyOutput, error) {
+	return r.SetRepositoryPolicyWithContext(aws.BackgroundContext(), input)
+}
+
+// SetRepositoryPolicyWithContext calls ecriface.ECRAPI.SetRepositoryPolicyWithContext, limited by the Write limiter
+func (r *RateLimitedECR) SetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.SetRepositoryPolicyInput, opts ...request.Option) (*ecr.SetRepositoryPolicyOutput, error) {
+	var out *ecr.SetRepositoryPolicyOutput
+	err := call(ctx, r.Write, func() (err error) {
+		out, err = r.ECRAPI.SetRepositoryPolicyWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+// DeleteRepositoryPolicy calls DeleteRepositoryPolicyWithContext with a background context
+func (r *RateLimitedECR) DeleteRepositoryPolicy(input *ecr.DeleteRepositoryPolicyInput) (*ecr.DeleteRepositoryPolicyOutput, error) {
+	return r.DeleteRepositoryPolicyWithContext(aws.BackgroundContext(), input)
+}
+
+// DeleteRepositoryPolicyWithContext calls ecriface.ECRAPI.DeleteRepositoryPolicyWithContext, limited by the Write limiter
+func (r *RateLimitedECR) DeleteRepositoryPolicyWithContext(ctx aws.Context, input *ecr.DeleteRepositoryPolicyInput, opts ...request.Option) (*ecr.DeleteRepositoryPolicyOutput, error) {
+	var out *ecr.DeleteRepositoryPolicyOutput
+	err := call(ctx, r.Write, func() (err error) {
+		out, err = r.ECRAPI.DeleteRepositoryPolicyWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+// GetRepositoryPolicy calls GetRepositoryPolicyWithContext with a background context
+func (r *RateLimitedECR) GetRepositoryPolicy(input *ecr.GetRepositoryPolicyInput) (*ecr.GetRepositoryPolicyOutput, error) {
+	return r.GetRepositoryPolicyWithContext(aws.BackgroundContext(), input)
+}
+
+// GetRepositoryPolicyWithContext calls ecriface.ECRAPI.GetRepositoryPolicyWithContext, limited by the Read limiter
+func (r *RateLimitedECR) GetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.GetRepositoryPolicyInput, opts ...request.Option) (*ecr.GetRepositoryPolicyOutput, error) {
+	var out *ecr.GetRepositoryPolicyOutput
+	err := call(ctx, r.Read, func() (err error) {
+		out, err = r.ECRAPI.GetRepositoryPolicyWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+// DescribeRepositories calls DescribeRepositoriesWithContext with a background context
+func (r *RateLimitedECR) DescribeRepositories(input *ecr.DescribeRepositoriesInput) (*ecr.DescribeRepositoriesOutput, error) {
+	return r.DescribeRepositoriesWithContext(aws.BackgroundContext(), input)
+}
+
+// DescribeRepositoriesWithContext calls ecriface.ECRAPI.DescribeRepositoriesWithContext, limited by the Read limiter
+func (r *RateLimitedECR) DescribeRepositoriesWithContext(ctx aws.Context, input *ecr.DescribeRepositoriesInput, opts ...request.Option) (*ecr.DescribeRepositoriesOutput, error) {
+	var out *ecr.DescribeRepositoriesOutput
+	err := call(ctx, r.Read, func() (err error) {
+		out, err = r.ECRAPI.DescribeRepositoriesWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+// ListTagsForResource calls ListTagsForResourceWithContext with a background context
+func (r *RateLimitedECR) ListTagsForResource(input *ecr.ListTagsForResourceInput) (*ecr.ListTagsForResourceOutput, error) {
+	return r.ListTagsForResourceWithContext(aws.BackgroundContext(), input)
+}
+
+// ListTagsForResourceWithContext calls ecriface.ECRAPI.ListTagsForResourceWithContext, limited by the Read limiter
+func (r *RateLimitedECR) ListTagsForResourceWithContext(ctx aws.Context, input *ecr.ListTagsForResourceInput, opts ...request.Option) (*ecr.ListTagsForResourceOutput, error) {
+	var out *ecr.ListTagsForResourceOutput
+	err := call(ctx, r.Read, func() (err error) {
+		out, err = r.ECRAPI.ListTagsForResourceWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+// RateLimitedECRPublic wraps an ecrpubliciface.ECRPublicAPI and waits for a token of the Read or Write RateLimiter before each call
+// It follows the same rules as RateLimitedECR
+type RateLimitedECRPublic struct {
+	ecrpubliciface.ECRPublicAPI
+	Read  *RateLimiter
+	Write *RateLimiter
+}
+
+// NewRateLimitedECRPublic wraps the given client with the given read and write limiters
+// It returns the client unchanged if both limiters are nil
+func NewRateLimitedECRPublic(client ecrpubliciface.ECRPublicAPI, read, write *RateLimiter) ecrpubliciface.ECRPublicAPI {
+	if read == nil && write == nil {
+		return client
+	}
+	return &RateLimitedECRPublic{
+		ECRPublicAPI: client,
+		Read:         read,
+		Write:        write,
+	}
+}
+
+// SetRepositoryPolicy calls SetRepositoryPolicyWithContext with a background context
+func (r *RateLimitedECRPublic) SetRepositoryPolicy(input *ecrpublic.SetRepositoryPolicyInput) (*ecrpublic.SetRepositoryPolicyOutput, error) {
+	return r.SetRepositoryPolicyWithContext(aws.BackgroundContext(), input)
+}
+
+// SetRepositoryPolicyWithContext calls ecrpubliciface.ECRPublicAPI.SetRepositoryPolicyWithContext, limited by the Write limiter
+func (r *RateLimitedECRPublic) SetRepositoryPolicyWithContext(ctx aws.Context, input *ecrpublic.SetRepositoryPolicyInput, opts ...request.Option) (*ecrpublic.SetRepositoryPolicyOutput, error) {
+	var out *ecrpublic.SetRepositoryPolicyOutput
+	err := call(ctx, r.Write, func() (err error) {
+		out, err = r.ECRPublicAPI.SetRepositoryPolicyWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+// DeleteRepositoryPolicy calls DeleteRepositoryPolicyWithContext with a background context
+func (r *RateLimitedECRPublic) DeleteRepositoryPolicy(input *ecrpublic.DeleteRepositoryPolicyInput) (*ecrpublic.DeleteRepositoryPolicyOutput, error) {
+	return r.DeleteRepositoryPolicyWithContext(aws.BackgroundContext(), input)
+}
+
+// DeleteRepositoryPolicyWithContext calls ecrpubliciface.ECRPublicAPI.DeleteRepositoryPolicyWithContext, limited by the Write limiter
+func (r *RateLimitedECRPublic) DeleteRepositoryPolicyWithContext(ctx aws.Context, input *ecrpublic.DeleteRepositoryPolicyInput, opts ...request.Option) (*ecrpublic.DeleteRepositoryPolicyOutput, error) {
+	var out *ecrpublic.DeleteRepositoryPolicyOutput
+	err := call(ctx, r.Write, func() (err error) {
+		out, err = r.ECRPublicAPI.DeleteRepositoryPolicyWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+// GetRepositoryPolicy calls GetRepositoryPolicyWithContext with a background context
+func (r *RateLimitedECRPublic) GetRepositoryPolicy(input *ecrpublic.GetRepositoryPolicyInput) (*ecrpublic.GetRepositoryPolicyOutput, error) {
+	return r.GetRepositoryPolicyWithContext(aws.BackgroundContext(), input)
+}
+
+// GetRepositoryPolicyWithContext calls ecrpubliciface.ECRPublicAPI.GetRepositoryPolicyWithContext, limited by the Read limiter
+func (r *RateLimitedECRPublic) GetRepositoryPolicyWithContext(ctx aws.Context, input *ecrpublic.GetRepositoryPolicyInput, opts ...request.Option) (*ecrpublic.GetRepositoryPolicyOutput, error) {
+	var out *ecrpublic.GetRepositoryPolicyOutput
+	err := call(ctx, r.Read, func() (err error) {
+		out, err = r.ECRPublicAPI.GetRepositoryPolicyWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+// PutRepositoryCatalogData calls PutRepositoryCatalogDataWithContext with a background context
+func (r *RateLimitedECRPublic) PutRepositoryCatalogData(input *ecrpublic.PutRepositoryCatalogDataInput) (*ecrpublic.PutRepositoryCatalogDataOutput, error) {
+	return r.PutRepositoryCatalogDataWithContext(aws.BackgroundContext(), input)
+}
+
+// PutRepositoryCatalogDataWithContext calls ecrpubliciface.ECRPublicAPI.PutRepositoryCatalogDataWithContext, limited by the Write limiter
+func (r *RateLimitedECRPublic) PutRepositoryCatalogDataWithContext(ctx aws.Context, input *ecrpublic.PutRepositoryCatalogDataInput, opts ...request.Option) (*ecrpublic.PutRepositoryCatalogDataOutput, error) {
+	var out *ecrpublic.PutRepositoryCatalogDataOutput
+	err := call(ctx, r.Write, func() (err error) {
+		out, err = r.ECRPublicAPI.PutRepositoryCatalogDataWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+// GetRepositoryCatalogData calls GetRepositoryCatalogDataWithContext with a background context
+func (r *RateLimitedECRPublic) GetRepositoryCatalogData(input *ecrpublic.GetRepositoryCatalogDataInput) (*ecrpublic.GetRepositoryCatalogDataOutput, error) {
+	return r.GetRepositoryCatalogDataWithContext(aws.BackgroundContext(), input)
+}
+
+// GetRepositoryCatalogDataWithContext calls ecrpubliciface.ECRPublicAPI.GetRepositoryCatalogDataWithContext, limited by the Read limiter
+func (r *RateLimitedECRPublic) GetRepositoryCatalogDataWithContext(ctx aws.Context, input *ecrpublic.GetRepositoryCatalogDataInput, opts ...request.Option) (*ecrpublic.GetRepositoryCatalogDataOutput, error) {
+	var out *ecrpublic.GetRepositoryCatalogDataOutput
+	err := call(ctx, r.Read, func() (err error) {
+		out, err = r.ECRPublicAPI.GetRepositoryCatalogDataWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
@@ -0,0 +1,197 @@
+package ecrupdater
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/aws/aws-sdk-go/service/ecrpublic/ecrpubliciface"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a manually advanced clock used to test the RateLimiter without sleeping
+type fakeClock struct {
+	t      time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.sleeps = append(c.sleeps, d)
+	c.t = c.t.Add(d)
+	return nil
+}
+
+func newTestRateLimiter(rate float64, burst int) (*RateLimiter, *fakeClock) {
+	c := &fakeClock{t: time.Unix(0, 0)}
+	r := NewRateLimiter(rate, burst)
+	r.now = c.now
+	r.sleep = c.sleep
+	r.last = c.t
+	return r, c
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	assert.Nil(t, NewRateLimiter(0, 5))
+	assert.Nil(t, NewRateLimiter(-1, 5))
+
+	r := NewRateLimiter(10, 0)
+	assert.NotNil(t, r)
+	assert.Equal(t, 10.0, r.Rate())
+	assert.Equal(t, 1.0, r.burst)
+
+	// A nil RateLimiter never waits
+	var n *RateLimiter
+	assert.NoError(t, n.Wait(context.Background()))
+	n.Throttled()
+	n.Succeeded()
+	assert.Equal(t, 0.0, n.Rate())
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	r, c := newTestRateLimiter(10, 2)
+
+	ctx := context.Background()
+
+	// The burst is consumed without waiting
+	assert.NoError(t, r.Wait(ctx))
+	assert.NoError(t, r.Wait(ctx))
+	assert.Empty(t, c.sleeps)
+
+	// Then one call every 100ms
+	assert.NoError(t, r.Wait(ctx))
+	assert.NoError(t, r.Wait(ctx))
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 100 * time.Millisecond}, c.sleeps)
+
+	// Waiting is interrupted when the context is done
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, r.Wait(cancelled))
+}
+
+func TestRateLimiterAdaptive(t *testing.T) {
+	r, _ := newTestRateLimiter(10, 2)
+
+	r.Throttled()
+	assert.Equal(t, 5.0, r.Rate())
+	r.Throttled()
+	assert.Equal(t, 2.5, r.Rate())
+
+	// The rate never goes below the minimum rate
+	for i := 0; i < 10; i++ {
+		r.Throttled()
+	}
+	assert.InDelta(t, 0.5, r.Rate(), 1e-9)
+
+	// And recovers gradually up to the configured rate
+	r.Succeeded()
+	assert.InDelta(t, 0.975, r.Rate(), 1e-9)
+	for i := 0; i < recoverySteps; i++ {
+		r.Succeeded()
+	}
+	assert.Equal(t, 10.0, r.Rate())
+}
+
+type mockedECRRateLimited struct {
+	ecriface.ECRAPI
+	err error
+}
+
+func (m mockedECRRateLimited) SetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.SetRepositoryPolicyInput, opts ...request.Option) (*ecr.SetRepositoryPolicyOutput, error) {
+	return &ecr.SetRepositoryPolicyOutput{RepositoryName: input.RepositoryName}, m.err
+}
+
+func (m mockedECRRateLimited) GetRepositoryPolicyWithContext(ctx aws.Context, input *ecr.GetRepositoryPolicyInput, opts ...request.Option) (*ecr.GetRepositoryPolicyOutput, error) {
+	return &ecr.GetRepositoryPolicyOutput{RepositoryName: input.RepositoryName}, m.err
+}
+
+func TestRateLimitedECR(t *testing.T) {
+	tests := []struct {
+		desc      string
+		err       error
+		wantWrite float64
+		wantRead  float64
+	}{
+		{
+			desc:      "Successful calls",
+			wantWrite: 10,
+			wantRead:  10,
+		},
+		{
+			desc:      "Throttled calls",
+			err:       awserr.New("ThrottlingException", "Rate exceeded", nil),
+			wantWrite: 5,
+			wantRead:  5,
+		},
+		{
+			desc:      "Other errors do not change the rate",
+			err:       awserr.New("RepositoryNotFoundException", "Not found", nil),
+			wantWrite: 10,
+			wantRead:  10,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			read, _ := newTestRateLimiter(10, 5)
+			write, _ := newTestRateLimiter(10, 5)
+			c := NewRateLimitedECR(mockedECRRateLimited{err: test.err}, read, write)
+
+			out, err := c.SetRepositoryPolicy(&ecr.SetRepositoryPolicyInput{RepositoryName: aws.String("foo")})
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, "foo", aws.StringValue(out.RepositoryName))
+			assert.Equal(t, test.wantWrite, write.Rate())
+
+			_, err = c.GetRepositoryPolicy(&ecr.GetRepositoryPolicyInput{RepositoryName: aws.String("foo")})
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.wantRead, read.Rate())
+		})
+	}
+
+	// Without limiters, the client is returned unchanged
+	m := mockedECRRateLimited{}
+	assert.Equal(t, m, NewRateLimitedECR(m, nil, nil))
+}
+
+type mockedECRPublicRateLimited struct {
+	ecrpubliciface.ECRPublicAPI
+	err error
+}
+
+func (m mockedECRPublicRateLimited) PutRepositoryCatalogDataWithContext(ctx aws.Context, input *ecrpublic.PutRepositoryCatalogDataInput, opts ...request.Option) (*ecrpublic.PutRepositoryCatalogDataOutput, error) {
+	return &ecrpublic.PutRepositoryCatalogDataOutput{}, m.err
+}
+
+func (m mockedECRPublicRateLimited) GetRepositoryPolicyWithContext(ctx aws.Context, input *ecrpublic.GetRepositoryPolicyInput, opts ...request.Option) (*ecrpublic.GetRepositoryPolicyOutput, error) {
+	return &ecrpublic.GetRepositoryPolicyOutput{RepositoryName: input.RepositoryName}, m.err
+}
+
+func TestRateLimitedECRPublic(t *testing.T) {
+	read, _ := newTestRateLimiter(10, 5)
+	write, _ := newTestRateLimiter(10, 5)
+	throttled := awserr.New("ThrottlingException", "Rate exceeded", nil)
+	c := NewRateLimitedECRPublic(mockedECRPublicRateLimited{err: throttled}, read, write)
+
+	_, err := c.PutRepositoryCatalogData(&ecrpublic.PutRepositoryCatalogDataInput{RepositoryName: aws.String("foo")})
+	assert.Equal(t, throttled, err)
+	assert.Equal(t, 5.0, write.Rate())
+	assert.Equal(t, 10.0, read.Rate())
+
+	_, err = c.GetRepositoryPolicy(&ecrpublic.GetRepositoryPolicyInput{RepositoryName: aws.String("foo")})
+	assert.Equal(t, throttled, err)
+	assert.Equal(t, 5.0, read.Rate())
+
+	// Without limiters, the client is returned unchanged
+	m := mockedECRPublicRateLimited{}
+	assert.Equal(t, m, NewRateLimitedECRPublic(m, nil, nil))
+}
@@ -0,0 +1,142 @@
+package ecrupdater
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/lescactus/ecr-go/summary"
+)
+
+// ErrorClass is the classification of an error code, deciding whether the failed call is retried
+type ErrorClass int
+
+const (
+	ErrorUnknown    ErrorClass = iota // The code is not known: the call is not retried
+	ErrorThrottling                   // The API rate is exceeded: the call is retried, and the rate limiter slows down
+	ErrorRetryable                    // The error is transient, like a server side error or a timeout: the call is retried
+	ErrorTerminal                     // The call will never succeed on retry, like for a missing repository or a denied access
+)
+
+// errorCodes are the classes of the known error codes of the ECR, ECR Public and STS APIs
+var errorCodes = map[string]ErrorClass{
+	"ThrottlingException":      ErrorThrottling,
+	"ThrottledException":       ErrorThrottling,
+	"TooManyRequestsException": ErrorThrottling,
+
+	"ServerException":         ErrorRetryable,
+	"InternalFailure":         ErrorRetryable,
+	"ServiceUnavailable":      ErrorRetryable,
+	"RequestTimeout":          ErrorRetryable,
+	"RequestTimeoutException": ErrorRetryable,
+
+	"RepositoryNotFoundException":       ErrorTerminal,
+	"RepositoryPolicyNotFoundException": ErrorTerminal,
+	"InvalidParameterException":         ErrorTerminal,
+	"AccessDenied":                      ErrorTerminal,
+	"AccessDeniedException":             ErrorTerminal,
+	"ExpiredTokenException":             ErrorTerminal,
+	"NoCredentialProviders":             ErrorTerminal,
+	ErrCodeUnsupportedOperation:         ErrorTerminal,
+}
+
+// RetryPolicy defines how ECR calls failing with a retryable error are retried
+type RetryPolicy struct {
+	MaxAttempts int           // Maximum number of attempts, including the first one
+	BaseDelay   time.Duration // Delay before the first retry, doubled on each subsequent retry
+	MaxDelay    time.Duration // Upper bound of the delay between two attempts
+}
+
+// DefaultRetryPolicy returns the RetryPolicy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    20 * time.Second,
+	}
+}
+
+// attempts returns the maximum number of attempts, always at least 1
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// Backoff returns the delay to wait before the given retry (starting at 1)
+// It uses an exponential backoff with full jitter: a random duration between 0 and min(MaxDelay, BaseDelay * 2^(retry-1))
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	if p.BaseDelay <= 0 || retry < 1 {
+		return 0
+	}
+
+	d := p.BaseDelay
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			d = p.MaxDelay
+			break
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// Classify returns the class of the given error
+// The codes not in errorCodes are classified as the SDK does: its transient errors, like a failed request, a response
+// timeout or a connection reset, are retryable. The SDK does not retry them itself, every attempt going through withRetry
+// It returns ErrorUnknown if the error is not an awserr.Error or if its code is not known
+func Classify(err error) ErrorClass {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return ErrorUnknown
+	}
+	if c, ok := errorCodes[awsErr.Code()]; ok {
+		return c
+	}
+	switch {
+	case request.IsErrorThrottle(err):
+		return ErrorThrottling
+	case request.IsErrorRetryable(err):
+		return ErrorRetryable
+	}
+	return ErrorUnknown
+}
+
+// IsRetryable will classify the given error
+// It returns true if the error is an awserr.Error whose code is known to be transient, throttling included
+// The other errors, like a missing repository, an invalid policy or a denied access, are never retried
+func IsRetryable(err error) bool {
+	c := Classify(err)
+	return c == ErrorThrottling || c == ErrorRetryable
+}
+
+// IsThrottling returns true if the error is an awserr.Error reporting an exceeded API rate
+func IsThrottling(err error) bool {
+	return Classify(err) == ErrorThrottling
+}
+
+// IsTerminal returns true if the error is an awserr.Error whose code is known to be final
+func IsTerminal(err error) bool {
+	return Classify(err) == ErrorTerminal
+}
+
+// setError will fill the error of the record from the given error, marking it terminal if it is known to be final
+func setError(r *summary.Record, err error) {
+	r.SetError(err)
+	r.Terminal = IsTerminal(err)
+}
+
+// errorMessage returns the given error as written in the logs, noting it is not retried if it is terminal
+func errorMessage(err error) string {
+	if IsTerminal(err) {
+		return fmt.Sprintf("terminal error, not retried: \"%v\"", err)
+	}
+	return fmt.Sprintf("\"%v\"", err)
+}
@@ -0,0 +1,123 @@
+package ecrupdater
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		desc         string
+		err          error
+		wantRetry    bool
+		wantThrottle bool
+		wantTerminal bool
+	}{
+		{
+			desc:         "Throttling",
+			err:          awserr.New("ThrottlingException", "Rate exceeded", nil),
+			wantRetry:    true,
+			wantThrottle: true,
+		},
+		{
+			desc:      "Server exception",
+			err:       awserr.New("ServerException", "Internal error", nil),
+			wantRetry: true,
+		},
+		{
+			desc:      "Request timeout",
+			err:       awserr.New("RequestTimeout", "Timeout", nil),
+			wantRetry: true,
+		},
+		{
+			desc:      "Request error",
+			err:       awserr.New(request.ErrCodeRequestError, "send request failed", errors.New("dial tcp: i/o timeout")),
+			wantRetry: true,
+		},
+		{
+			desc:      "Response timeout",
+			err:       awserr.New(request.ErrCodeResponseTimeout, "read on body has reached the timeout limit", nil),
+			wantRetry: true,
+		},
+		{
+			desc:      "Connection reset",
+			err:       awserr.New(request.ErrCodeSerialization, "failed to decode the response", errors.New("read tcp: connection reset by peer")),
+			wantRetry: true,
+		},
+		{
+			desc:         "SDK throttling",
+			err:          awserr.New("RequestLimitExceeded", "Rate exceeded", nil),
+			wantRetry:    true,
+			wantThrottle: true,
+		},
+		{
+			desc: "Request canceled",
+			err:  awserr.New(request.CanceledErrorCode, "request context canceled", errors.New("context canceled")),
+		},
+		{
+			desc:         "Repository not found",
+			err:          awserr.New("RepositoryNotFoundException", "Not found", nil),
+			wantTerminal: true,
+		},
+		{
+			desc:         "Invalid parameter",
+			err:          awserr.New("InvalidParameterException", "Invalid policy", nil),
+			wantTerminal: true,
+		},
+		{
+			desc:         "Access denied",
+			err:          awserr.New("AccessDeniedException", "Not authorized", nil),
+			wantTerminal: true,
+		},
+		{
+			desc: "Unknown aws error",
+			err:  awserr.New("Unknown", "Unknown", nil),
+		},
+		{
+			desc: "Generic error",
+			err:  errors.New("Generic error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.wantRetry, IsRetryable(test.err))
+			assert.Equal(t, test.wantThrottle, IsThrottling(test.err))
+			assert.Equal(t, test.wantTerminal, IsTerminal(test.err))
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{
+		MaxAttempts: 10,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+	}
+
+	tests := []struct {
+		desc  string
+		retry int
+		max   time.Duration
+	}{
+		{desc: "No retry", retry: 0, max: 0},
+		{desc: "First retry", retry: 1, max: 100 * time.Millisecond},
+		{desc: "Second retry", retry: 2, max: 200 * time.Millisecond},
+		{desc: "Third retry", retry: 3, max: 400 * time.Millisecond},
+		{desc: "Capped by MaxDelay", retry: 8, max: time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				d := p.Backoff(test.retry)
+				assert.True(t, d >= 0 && d <= test.max, "backoff %v out of [0, %v]", d, test.max)
+			}
+		})
+	}
+}
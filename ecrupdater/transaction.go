@@ -0,0 +1,154 @@
+package ecrupdater
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/lescactus/ecr-go/backup"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/summary"
+)
+
+// runTransaction will update the policies of all the repositories of the given jobs as a single transaction:
+//  1. The current policy of every repository is captured, and saved in the Backup of its client if set.
+//     If any of them cannot be captured, no repository is updated and the others are recorded as skipped
+//  2. The repositories are updated with the same scheduling and cancellation rules as Run
+//  3. If any update failed or was cancelled, the repositories whose policy was already set, even by an update that
+//     failed afterwards, are rolled back to their captured policy and catalog data, or their policy is deleted if they had none
+//
+// The jobs run concurrently in each step, so that a failure in any region rolls back all the regions.
+// The rollback is not bound to ctx: it runs even when the run was interrupted, each call being bounded by CallTimeout
+func runTransaction(ctx, stop context.Context, jobs []Job, workers int) {
+	if len(jobs) == 0 {
+		return
+	}
+	logger := jobs[0].Client.Logger
+
+	previous := make([]map[repository]backup.Entry, len(jobs))
+	failed := make([]map[repository]error, len(jobs))
+	parallel(len(jobs), func(i int) {
+		previous[i], failed[i] = jobs[i].Client.capture(ctx, stop, jobs[i].Configs, workers)
+	})
+
+	for i := range jobs {
+		if len(previous[i]) == len(jobs[i].Configs) {
+			continue
+		}
+		interrupted := ctx.Err() != nil || stop.Err() != nil
+		for j := range jobs {
+			jobs[j].Client.abort(ctx, jobs[j].Configs, failed[j], interrupted)
+		}
+		logger.Error("Error: Transaction aborted, no repository was updated")
+		return
+	}
+
+	parallel(len(jobs), func(i int) {
+		e, configs := jobs[i].Client, jobs[i].Configs
+		e.schedule(stop, summary.OperationUpdate, configRepositories(configs), workers, func(i int, wg *sync.WaitGroup) {
+			defer wg.Done()
+			e.update(ctx, configs[i], false)
+		})
+	})
+
+	ok := true
+	for _, j := range jobs {
+		if len(j.Client.records(summary.OperationUpdate, summary.StatusFailed)) > 0 || len(j.Client.records(summary.OperationUpdate, summary.StatusCancelled)) > 0 {
+			ok = false
+		}
+	}
+	if ok {
+		return
+	}
+
+	written := make([][]repository, len(jobs))
+	count := 0
+	for i, j := range jobs {
+		written[i] = j.Client.written.list()
+		count += len(written[i])
+	}
+	logger.Error(fmt.Sprintf("Error: Transaction failed, rolling back %d written repositories", count))
+	parallel(len(jobs), func(i int) {
+		jobs[i].Client.rollback(written[i], previous[i])
+	})
+}
+
+// records returns the records of this client with the given operation and status
+func (e *ECRUpdaterClient) records(operation summary.Operation, status summary.Status) []summary.Record {
+	return e.own.WithStatus(operation, status)
+}
+
+// capture will fetch the current policy of all the given repositories, and their catalog data when configured, with at most
+// workers concurrent calls. Policies are saved in e.Backup if set
+// It returns the captured policies by repository, and the errors of the repositories that could not be captured.
+// Repositories not scheduled because stop is done are in neither of them
+func (e *ECRUpdaterClient) capture(ctx, stop context.Context, configs []configuration.ConfigurationFile, workers int) (map[repository]backup.Entry, map[repository]error) {
+	if workers < 1 {
+		workers = len(configs)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	previous := make(map[repository]backup.Entry, len(configs))
+	failed := make(map[repository]error)
+	sem := make(chan struct{}, workers)
+
+	for i, repo := range configRepositories(configs) {
+		select {
+		case <-stop.Done():
+		case sem <- struct{}{}:
+		}
+		if stop.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(repo repository, catalogData bool) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			e.Logger.Debug(fmt.Sprintf("Capturing the current policy of repository %s ...", repo))
+			entry, _, err := e.previous(ctx, repo, catalogData)
+			if err == nil && e.Backup != nil {
+				err = e.saveBackup(entry)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed[repo] = fmt.Errorf("cannot capture the current policy: %v", err)
+				return
+			}
+			previous[repo] = entry
+		}(repo, configs[i].CatalogData != nil)
+	}
+	wg.Wait()
+
+	return previous, failed
+}
+
+// abort will record the given repositories of an aborted transaction
+// The repositories that could not be captured are recorded as failed and all the others as skipped,
+// or as cancelled if the run was interrupted
+func (e *ECRUpdaterClient) abort(ctx context.Context, configs []configuration.ConfigurationFile, failed map[repository]error, interrupted bool) {
+	for _, repo := range configRepositories(configs) {
+		record := e.newRecord(repo, summary.OperationUpdate, summary.StatusSkipped)
+		if err, ok := failed[repo]; ok && ctx.Err() == nil {
+			e.Logger.Error(fmt.Sprintf("Error: An error occured while capturing the policy of the repository %v: %s", repo, errorMessage(err)))
+			record.Status = summary.StatusFailed
+			setError(&record, err)
+		} else if interrupted {
+			record.Status = summary.StatusCancelled
+		}
+		e.add(record)
+	}
+}
+
+// rollback will restore the captured policy and catalog data of every given repository
+// The results are recorded in e.Summary as rollback operations
+func (e *ECRUpdaterClient) rollback(written []repository, previous map[repository]backup.Entry) {
+	for _, repo := range written {
+		e.Logger.Info(fmt.Sprintf("Rolling back repository %s ...", repo))
+		e.restore(context.Background(), previous[repo], summary.OperationRollback)
+	}
+}
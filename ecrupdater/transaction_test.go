@@ -0,0 +1,127 @@
+package ecrupdater
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/summary"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunTransaction(t *testing.T) {
+	tests := []struct {
+		desc           string
+		configs        []configuration.ConfigurationFile
+		wantPolicies   map[string]string
+		wantSucceeded  []string
+		wantFailed     []string
+		wantSkipped    []string
+		wantRolledBack []string
+	}{
+		{
+			desc: "All updates succeed",
+			configs: []configuration.ConfigurationFile{
+				{RepositoryName: "withpolicy", RepositoryPolicy: []byte("new")},
+				{RepositoryName: "withoutpolicy", RepositoryPolicy: []byte("new")},
+			},
+			wantPolicies:  map[string]string{"withpolicy": "new", "withoutpolicy": "new", "other": "old", "111111111111/other": "old", "222222222222/other": "old"},
+			wantSucceeded: []string{"withpolicy", "withoutpolicy"},
+		},
+		{
+			desc: "A capture fails: nothing is updated",
+			configs: []configuration.ConfigurationFile{
+				{RepositoryName: "withpolicy", RepositoryPolicy: []byte("new")},
+				{RepositoryName: "notfound", RepositoryPolicy: []byte("new")},
+			},
+			wantPolicies: map[string]string{"withpolicy": "old", "withoutpolicy": "", "other": "old", "111111111111/other": "old", "222222222222/other": "old"},
+			wantFailed:   []string{"notfound"},
+			wantSkipped:  []string{"withpolicy"},
+		},
+		{
+			desc: "An update fails: updated repositories are rolled back",
+			configs: []configuration.ConfigurationFile{
+				{RepositoryName: "withpolicy", RepositoryPolicy: []byte("new")},
+				{RepositoryName: "withoutpolicy", RepositoryPolicy: []byte("new")},
+				{RepositoryName: "other", RepositoryPolicy: []byte("invalid")},
+			},
+			wantPolicies:   map[string]string{"withpolicy": "old", "withoutpolicy": "", "other": "old", "111111111111/other": "old", "222222222222/other": "old"},
+			wantSucceeded:  []string{"withpolicy", "withoutpolicy"},
+			wantFailed:     []string{"other"},
+			wantRolledBack: []string{"withpolicy", "withoutpolicy"},
+		},
+		{
+			desc: "Same repository name in several registries",
+			configs: []configuration.ConfigurationFile{
+				{RepositoryName: "other", RegistryID: "111111111111", RepositoryPolicy: []byte("new")},
+				{RepositoryName: "other", RegistryID: "222222222222", RepositoryPolicy: []byte("invalid")},
+			},
+			wantPolicies:   map[string]string{"withpolicy": "old", "withoutpolicy": "", "other": "old", "111111111111/other": "old", "222222222222/other": "old"},
+			wantSucceeded:  []string{"111111111111/other"},
+			wantFailed:     []string{"222222222222/other"},
+			wantRolledBack: []string{"111111111111/other"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			m := &mockedECRRegistry{policies: map[string]string{"withpolicy": "old", "withoutpolicy": "", "other": "old", "111111111111/other": "old", "222222222222/other": "old"}}
+			m.invalid = "invalid"
+			s := newMemoryStore()
+			e := ECRUpdaterClient{
+				Client:        m,
+				Logger:        Logger,
+				Transactional: true,
+				Backup:        s,
+				BackupID:      "run",
+			}
+			e.Init()
+
+			e.Run(context.Background(), context.Background(), test.configs, 1)
+
+			assert := assert.New(t)
+			assert.Equal(test.wantPolicies, m.policies)
+			assert.ElementsMatch(test.wantSucceeded, repositories(e.Summary, summary.OperationUpdate, summary.StatusSucceeded))
+			assert.ElementsMatch(test.wantFailed, repositories(e.Summary, summary.OperationUpdate, summary.StatusFailed))
+			assert.ElementsMatch(test.wantSkipped, repositories(e.Summary, summary.OperationUpdate, summary.StatusSkipped))
+			assert.Empty(repositories(e.Summary, summary.OperationUpdate, summary.StatusCancelled))
+			assert.ElementsMatch(test.wantRolledBack, repositories(e.Summary, summary.OperationRollback, summary.StatusSucceeded))
+			assert.Empty(repositories(e.Summary, summary.OperationRollback, summary.StatusFailed))
+		})
+	}
+}
+
+func TestRunTransactionPublic(t *testing.T) {
+	m := &mockedECRPublicRegistry{
+		policies: map[string]string{"public": "old", "other": "old"},
+		catalog: map[string]*ecrpublic.RepositoryCatalogDataInput{
+			"public": {Description: aws.String("Old repository")},
+			"other":  {Description: aws.String("Old repository")},
+		},
+		invalid: "invalid",
+	}
+	e := ECRUpdaterClient{
+		Public:        m,
+		Logger:        Logger,
+		Transactional: true,
+	}
+	e.Init()
+
+	// The policy of public is set before its catalog data is rejected: it is rolled back as well
+	configs := []configuration.ConfigurationFile{
+		{RepositoryName: "other", Type: configuration.RepositoryTypePublic, RepositoryPolicy: []byte("new"), CatalogData: &configuration.CatalogData{Description: "New repository"}},
+		{RepositoryName: "public", Type: configuration.RepositoryTypePublic, RepositoryPolicy: []byte("new"), CatalogData: &configuration.CatalogData{Description: "invalid"}},
+	}
+	e.Run(context.Background(), context.Background(), configs, 1)
+
+	assert := assert.New(t)
+	assert.Equal(map[string]string{"public": "old", "other": "old"}, m.policies)
+	assert.Equal("Old repository", aws.StringValue(m.catalog["public"].Description))
+	assert.Equal("Old repository", aws.StringValue(m.catalog["other"].Description))
+	assert.Equal([]string{"other"}, repositories(e.Summary, summary.OperationUpdate, summary.StatusSucceeded))
+	assert.Equal([]string{"public"}, repositories(e.Summary, summary.OperationUpdate, summary.StatusFailed))
+	assert.ElementsMatch([]string{"other", "public"}, repositories(e.Summary, summary.OperationRollback, summary.StatusSucceeded))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"go.uber.org/zap"
+)
+
+// warnExpiries will log the grants of the configured repositories which expired, and so are dropped from their policy,
+// and the ones expiring within ExpiryWarningDays of now
+// A grant of a repository configured in several locations is only logged once
+func warnExpiries(logger *zap.Logger, repositories *repositories, now time.Time) {
+	window := time.Duration(appconfig.Config.Policy.ExpiryWarningDays) * 24 * time.Hour
+	seen := make(map[string]bool)
+	for _, r := range repositories.list() {
+		for _, e := range r.config.Expiries {
+			key := fmt.Sprintf("%s/%s/%s", r.record.Registry, r.record.Repository, e)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			remaining := e.Expires.Sub(now)
+			switch {
+			case e.Expired(now):
+				logger.Warn(fmt.Sprintf("%s - The %s expired on %s, it is dropped from the policy", r.record.Repository, e, e.Expires.Format(time.RFC3339)))
+			case window > 0 && remaining <= window:
+				days := int(math.Ceil(remaining.Hours() / 24))
+				logger.Warn(fmt.Sprintf("%s - The %s expires on %s, in %d day(s)", r.record.Repository, e, e.Expires.Format(time.RFC3339), days))
+			}
+		}
+	}
+}
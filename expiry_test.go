@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWarnExpiries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expiry")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	config := `repositoryName: app
+regions:
+  - eu-west-1
+  - us-east-1
+access:
+  pull:
+    - principal: "111111111111"
+      expires: 2020-01-01T00:00:00Z
+    - principal: "222222222222"
+      expires: 2099-01-11T00:00:00Z
+    - principal: "333333333333"
+      expires: 2099-12-31T00:00:00Z
+`
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.yaml"), []byte(config), 0644))
+	if !assert.NoError(t, appconfig.Init(appconfig.Sources{Flags: map[string]string{"config-dir": dir}})) {
+		return
+	}
+	defer appconfig.Init(appconfig.Sources{})
+
+	repositories, err := loadRepositories(zap.NewNop())
+	if !assert.NoError(t, err) {
+		return
+	}
+	core, logs := observer.New(zapcore.WarnLevel)
+	warnExpiries(zap.New(core), repositories, time.Date(2099, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	messages := []string{}
+	for _, e := range logs.All() {
+		messages = append(messages, e.Message)
+	}
+	assert.Equal(t, []string{
+		"app - The pull access of 111111111111 expired on 2020-01-01T00:00:00Z, it is dropped from the policy",
+		"app - The pull access of 222222222222 expires on 2099-01-11T00:00:00Z, in 10 day(s)",
+	}, messages)
+
+	// The expiry required by EXPIRY_REQUIRED fails the validation
+	if !assert.NoError(t, appconfig.Init(appconfig.Sources{Flags: map[string]string{"config-dir": dir, "expiry-required": "*"}})) {
+		return
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "tools.yaml"), []byte("repositoryName: tools\naccess:\n  push:\n    - \"444444444444\"\n"), 0644))
+	_, err = loadRepositories(zap.NewNop())
+	assert.EqualError(t, err, "Loading "+filepath.Join(dir, "tools.yaml")+": Access: the push access of 444444444444 has no expiry, which it requires")
+}
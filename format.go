@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/lescactus/ecr-go/configuration"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// fmtSettings are the flags of the fmt command
+type fmtSettings struct {
+	check bool
+}
+
+// fmtOptions are the flags of the fmt command of the current run
+var fmtOptions fmtSettings
+
+// fmtFlags will register the flags of the fmt command
+func fmtFlags(fs *flag.FlagSet) {
+	fmtOptions = fmtSettings{}
+	fs.BoolVar(&fmtOptions.check, "check", false, "Only list the files that are not in their canonical form, and exit with 1 if there is any")
+}
+
+// fmtCommand will rewrite the given configuration and policy files in their canonical form
+// Without file, it rewrites the configuration files of the configuration directory selected by Files, and their policy files
+// It prints the files rewritten, or not formatted with --check
+func fmtCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	files := args
+	if len(files) == 0 {
+		var err error
+		files, err = configurationFiles()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error: %v", err))
+			return exitFailed
+		}
+	}
+
+	code := exitOK
+	for _, f := range files {
+		changed, err := formatFile(f, !fmtOptions.check)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error: %s: %v", f, err))
+			code = exitFailed
+			continue
+		}
+		if changed {
+			fmt.Fprintln(out, f)
+			if fmtOptions.check {
+				code = exitFailed
+			}
+		}
+	}
+	return code
+}
+
+// configurationFiles returns the configuration files of the configuration directory selected by Files,
+// each one followed by its policy file. A policy file shared by several configuration files is returned once
+func configurationFiles() ([]string, error) {
+	yamlFiles, err := configuration.GetYamlConfigurationFiles(appconfig.Config.Application.ConfigDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the configuration files: %v", err)
+	}
+	filter := configuration.Filter{Files: appconfig.Config.Filter.Files}
+
+	files := []string{}
+	policies := make(map[string]bool)
+	for _, f := range yamlFiles {
+		if !filter.MatchesFile(f) {
+			continue
+		}
+		files = append(files, f)
+
+		d, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var c configuration.ConfigurationFile
+		if err := yaml.Unmarshal(d, &c); err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+		p := filepath.Clean(c.RepositoryPolicyFile)
+		if c.RepositoryPolicyFile != "" && !policies[p] {
+			policies[p] = true
+			files = append(files, c.RepositoryPolicyFile)
+		}
+	}
+	return files, nil
+}
+
+// formatFile will compute the canonical form of the configuration file or of the json policy file, and write it if write is set
+// It returns true if the file was not in its canonical form
+func formatFile(path string, write bool) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	var formatted []byte
+	switch filepath.Ext(path) {
+	case ".json":
+		formatted, err = configuration.FormatPolicy(d, appconfig.Config.Policy.ManagedSidPrefix)
+	case ".yaml", ".yml":
+		formatted, err = configuration.FormatYaml(d)
+	default:
+		return false, fmt.Errorf("unsupported file, only .json, .yaml and .yml files can be formatted")
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if bytes.Equal(d, formatted) {
+		return false, nil
+	}
+	if write {
+		return true, ioutil.WriteFile(path, formatted, info.Mode())
+	}
+	return true, nil
+}
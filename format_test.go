@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFmtCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fmt")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	policy := filepath.Join(dir, "app.json")
+	config := filepath.Join(dir, "app.yaml")
+	formatted := filepath.Join(dir, "formatted.yaml")
+	assert.NoError(t, ioutil.WriteFile(policy, []byte(`{"Statement":[],"Version":"2008-10-17"}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(config, []byte("repositoryPolicyFile: "+policy+"\nrepositoryName: app\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(formatted, []byte("repositoryName: formatted\nrepositoryPolicyFile: "+policy+"\n"), 0644))
+
+	// Check only lists the files not formatted
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"fmt", "--check", "--config-dir", dir}, &stdout, &stderr)
+	assert.Equal(t, exitFailed, code)
+	assert.Equal(t, config+"\n"+policy+"\n", stdout.String())
+	d, _ := ioutil.ReadFile(config)
+	assert.Equal(t, "repositoryPolicyFile: "+policy+"\nrepositoryName: app\n", string(d))
+
+	// The files are rewritten
+	stdout.Reset()
+	code = run([]string{"fmt", "--config-dir", dir}, &stdout, &stderr)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, config+"\n"+policy+"\n", stdout.String())
+	d, _ = ioutil.ReadFile(config)
+	assert.Equal(t, "repositoryName: app\nrepositoryPolicyFile: "+policy+"\n", string(d))
+	d, _ = ioutil.ReadFile(policy)
+	assert.Equal(t, "{\n    \"Version\": \"2008-10-17\",\n    \"Statement\": []\n}\n", string(d))
+
+	// Once formatted, the check passes
+	stdout.Reset()
+	code = run([]string{"fmt", "--check", config, policy}, &stdout, &stderr)
+	assert.Equal(t, exitOK, code)
+	assert.Empty(t, stdout.String())
+
+	// Unsupported files are errors
+	code = run([]string{"fmt", filepath.Join(dir, "README.md")}, &stdout, &stderr)
+	assert.Equal(t, exitFailed, code)
+}
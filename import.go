@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/ecrupdater"
+	"github.com/lescactus/ecr-go/summary"
+	"go.uber.org/zap"
+)
+
+// importSettings are the flags of the import command
+type importSettings struct {
+	output     string
+	prefix     string
+	tags       tagsFlag
+	registryID string
+	target     string
+	shared     bool
+}
+
+// importOptions are the flags of the import command of the current run
+var importOptions importSettings
+
+// importFlags will register the flags of the import command
+func importFlags(fs *flag.FlagSet) {
+	importOptions = importSettings{tags: tagsFlag{}}
+	fs.StringVar(&importOptions.output, "output", "imported/", "Directory where the configuration files and the policies are written. Existing files are never overwritten")
+	fs.StringVar(&importOptions.prefix, "prefix", "", "Import only the repositories whose name starts with this prefix")
+	fs.Var(importOptions.tags, "tag", "Import only the repositories with this tag, as key=value. Can be repeated: all the tags must match")
+	fs.StringVar(&importOptions.registryID, "registry-id", "", "Registry of the repositories. Empty means the registry of the credentials")
+	fs.StringVar(&importOptions.target, "target", "", "Name of the target of the targets file to import from. Empty means the default AWS session")
+	fs.BoolVar(&importOptions.shared, "shared", false, "Write the policies identical for several repositories once, in the policies/ directory of the output")
+}
+
+// tagsFlag is a repeatable flag of key=value tags
+type tagsFlag map[string]string
+
+// String returns the tags sorted by key
+func (t tagsFlag) String() string {
+	l := []string{}
+	for k, v := range t {
+		l = append(l, k+"="+v)
+	}
+	sort.Strings(l)
+	return strings.Join(l, ",")
+}
+
+// Set will add a key=value tag
+func (t tagsFlag) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("tag must be key=value, got %q", s)
+	}
+	t[kv[0]] = kv[1]
+	return nil
+}
+
+// importCommand will write the configuration files of the existing repositories of a registry, with their current policy
+// Only one region can be imported at a time. The repositories without policy are skipped
+func importCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	if len(appconfig.Config.AWS.Regions) > 1 {
+		logger.Error("Error: import reads a single region, set REGIONS to one region at most")
+		return exitUsage
+	}
+	l := location{target: importOptions.target}
+	if len(appconfig.Config.AWS.Regions) == 1 {
+		l.region = appconfig.Config.AWS.Regions[0]
+	}
+
+	targets, err := loadTargets()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: cannot load the targets: %v", err))
+		return exitFailed
+	}
+	if l.target != "" {
+		t, ok := targets[l.target]
+		if !ok {
+			logger.Error(fmt.Sprintf("Error: unknown target %s", l.target))
+			return exitUsage
+		}
+		if t.Region != "" {
+			l.region = t.Region
+		}
+	}
+
+	ctx, _, cancel := runContext(logger)
+	defer cancel()
+
+	client := newClientFactory(logger, targets, summary.NewCollector()).client(l, nil)
+	logger.Info(fmt.Sprintf("Importing the repositories of registry %s in %s ...", registryName(importOptions.registryID), l))
+	imported, err := client.Import(ctx, importOptions.registryID, ecrupdater.ImportFilter{
+		Prefix: importOptions.prefix,
+		Tags:   importOptions.tags,
+	}, appconfig.Config.Run.Workers)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitFailed
+	}
+
+	repositories := []configuration.ExportedRepository{}
+	for _, r := range imported {
+		if !r.Exists {
+			logger.Info(fmt.Sprintf("Repository %s has no policy, skipped", r.Name))
+			continue
+		}
+		e := configuration.ExportedRepository{RepositoryName: r.Name, RegistryID: r.RegistryID, PolicyText: r.PolicyText}
+		if l.region != "" {
+			e.Regions = []string{l.region}
+		}
+		repositories = append(repositories, e)
+	}
+
+	written, err := configuration.Export(importOptions.output, repositories, importOptions.shared)
+	for _, f := range written {
+		fmt.Fprintln(out, f)
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitFailed
+	}
+	logger.Info(fmt.Sprintf("Imported %d repositories in %s, %d skipped without policy", len(repositories), importOptions.output, len(imported)-len(repositories)))
+	return exitOK
+}
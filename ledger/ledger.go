@@ -0,0 +1,114 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Event is the kind of a break-glass change recorded in the ledger
+type Event string
+
+const (
+	EventGrant  Event = "grant"  // Break-glass statement added to the live policy of a repository
+	EventRevoke Event = "revoke" // Expired break-glass statement removed from the live policy of a repository
+)
+
+// Entry is a break-glass change of the live policy of a single repository
+// Registry, Target, Account and Region are empty for the default registry, AWS session, credentials and region
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Event      Event     `json:"event"`
+	User       string    `json:"user,omitempty"` // Local user who ran the command
+	Reason     string    `json:"reason,omitempty"`
+	Repository string    `json:"repository"`
+	Registry   string    `json:"registry,omitempty"`
+	Target     string    `json:"target,omitempty"`
+	Account    string    `json:"account,omitempty"`
+	Region     string    `json:"region,omitempty"`
+	Sid        string    `json:"sid"`
+	Principal  string    `json:"principal,omitempty"`
+	Actions    []string  `json:"actions,omitempty"`
+	Expires    time.Time `json:"expires"`
+}
+
+// Ledger is a local file recording the break-glass changes, one JSON entry per line
+// Entries are only ever appended to it
+type Ledger struct {
+	Path string
+}
+
+// New instanciate a Ledger
+// It returns a Ledger recording the entries in the file at path
+func New(path string) *Ledger {
+	return &Ledger{
+		Path: path,
+	}
+}
+
+// Append will append the entries to the ledger file, creating it if needed
+func (l *Ledger) Append(entries ...Entry) error {
+	for _, e := range entries {
+		if e.Repository == "" || e.Sid == "" {
+			return errors.New("Repository and Sid of a ledger entry must be present and not empty")
+		}
+	}
+
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	e := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := e.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load will read all the entries of the ledger file, oldest first
+// It returns no entry if the file does not exist yet
+func (l *Ledger) Load() ([]Entry, error) {
+	f, err := os.Open(l.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Entry{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []Entry{}
+	d := json.NewDecoder(f)
+	for d.More() {
+		var e Entry
+		if err := d.Decode(&e); err != nil {
+			return nil, fmt.Errorf("cannot read entry %d of %s: %v", len(entries)+1, l.Path, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Grant returns the last grant entry of the statement with the given Sid of a repository, matched on all the fields identifying
+// its repository. It returns false if the ledger has no such entry, like for a statement added by hand
+func Grant(entries []Entry, repository Entry) (Entry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Event == EventGrant && e.Sid == repository.Sid && e.Repository == repository.Repository && e.Registry == repository.Registry &&
+			e.Target == repository.Target && e.Account == repository.Account && e.Region == repository.Region {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
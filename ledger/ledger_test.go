@@ -0,0 +1,91 @@
+package ledger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedger(t *testing.T) {
+	root, err := ioutil.TempDir("", "ecr-go-ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	l := New(filepath.Join(root, "ledger.jsonl"))
+
+	// No ledger file yet
+	entries, err := l.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	granted := time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC)
+	grants := []Entry{
+		{Time: granted, Event: EventGrant, User: "alice", Reason: "INC-1234", Repository: "team/repo", Region: "eu-west-1", Sid: "BreakGlass20261019T143000Z", Principal: "111111111111", Actions: []string{"ecr:BatchGetImage"}, Expires: granted.Add(2 * time.Hour)},
+		{Time: granted, Event: EventGrant, User: "alice", Reason: "INC-1234", Repository: "team/repo", Region: "us-east-1", Sid: "BreakGlass20261019T143000Z", Principal: "111111111111", Actions: []string{"ecr:BatchGetImage"}, Expires: granted.Add(2 * time.Hour)},
+	}
+	revoke := Entry{Time: granted.Add(3 * time.Hour), Event: EventRevoke, User: "bob", Repository: "team/repo", Region: "eu-west-1", Sid: "BreakGlass20261019T143000Z", Expires: granted.Add(2 * time.Hour)}
+	assert.NoError(t, l.Append(grants...))
+	assert.NoError(t, l.Append(revoke))
+	assert.Error(t, l.Append(Entry{Event: EventGrant, Repository: "team/repo"}), "a ledger entry must have a Sid")
+
+	entries, err = l.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, append(grants, revoke), entries)
+
+	// One JSON entry per line
+	b, err := ioutil.ReadFile(l.Path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, `{"time":"2026-10-19T15:30:00Z","event":"revoke","user":"bob","repository":"team/repo","region":"eu-west-1","sid":"BreakGlass20261019T143000Z","expires":"2026-10-19T14:30:00Z"}`, lines[2])
+
+	// Corrupted ledger
+	assert.NoError(t, ioutil.WriteFile(l.Path, []byte("{}\n{"), 0644))
+	_, err = l.Load()
+	assert.Error(t, err)
+}
+
+func TestGrant(t *testing.T) {
+	entries := []Entry{
+		{Event: EventGrant, Repository: "repo", Region: "eu-west-1", Sid: "BreakGlass20261019T143000Z", Principal: "111111111111"},
+		{Event: EventGrant, Repository: "repo", Region: "us-east-1", Sid: "BreakGlass20261019T143000Z", Principal: "222222222222"},
+		{Event: EventRevoke, Repository: "repo", Region: "eu-west-1", Sid: "BreakGlass20261019T143000Z"},
+	}
+
+	tests := []struct {
+		desc   string
+		entry  Entry
+		want   Entry
+		wantOk bool
+	}{
+		{
+			desc:   "Grant of the region",
+			entry:  Entry{Repository: "repo", Region: "us-east-1", Sid: "BreakGlass20261019T143000Z"},
+			want:   entries[1],
+			wantOk: true,
+		},
+		{
+			desc:  "Other account",
+			entry: Entry{Repository: "repo", Region: "us-east-1", Account: "333333333333", Sid: "BreakGlass20261019T143000Z"},
+		},
+		{
+			desc:  "Statement added by hand",
+			entry: Entry{Repository: "repo", Region: "eu-west-1", Sid: "BreakGlass20261019T150000Z"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, ok := Grant(entries, test.entry)
+			assert.Equal(t, test.wantOk, ok)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
@@ -1,97 +1,240 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
-	"sync"
+	"os/signal"
+	"syscall"
 
 	"github.com/lescactus/ecr-go/appconfig"
-	"github.com/lescactus/ecr-go/configuration"
-	"github.com/lescactus/ecr-go/ecrupdater"
+	"github.com/lescactus/ecr-go/summary"
+	"go.uber.org/zap"
+)
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ecr"
+// Exit codes of the commands
+const (
+	exitOK     = 0 // The command succeeded
+	exitFailed = 1 // The command failed, or any repository could not be processed
+	exitUsage  = 2 // The command line or the configuration is invalid
+	exitDrift  = 3 // Any repository differs from its configuration
 )
 
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	args    string // Positional arguments in the usage
+	summary string
+	flags   func(fs *flag.FlagSet) // Registers the flags of the command only. nil if it has none
+	run     func(logger *zap.Logger, out io.Writer, args []string) int
+}
+
+// commands are the subcommands of the CLI, in the order of the usage
+var commands = []command{
+	{name: "validate", summary: "Validate the configuration files, without calling AWS", run: validateCommand},
+	{name: "fmt", args: "[file ...]", summary: "Rewrite the configuration and policy files in their canonical form", flags: fmtFlags, run: fmtCommand},
+	{name: "plan", summary: "Show the repositories whose policy would be created or updated", run: planCommand},
+	{name: "diff", summary: "Show the difference between the current and the configured policies", run: diffCommand},
+	{name: "drift", summary: "Check that the repositories match their configuration, exiting with 3 if any does not", flags: driftFlags, run: driftCommand},
+	{name: "apply", summary: "Update the policies of the repositories", run: applyCommand},
+	{name: "simulate", summary: "Evaluate a request against the configured policies, without calling AWS", flags: simulateFlags, run: simulateCommand},
+	{name: "access", summary: "Report which principals can pull from or push to each repository", flags: accessFlags, run: accessCommand},
+	{name: "import", summary: "Write the configuration files of existing repositories and their policies", flags: importFlags, run: importCommand},
+	{name: "grant", summary: "Grant a principal temporary access to a repository with a break-glass statement in its live policy", flags: grantFlags, run: grantCommand},
+	{name: "revoke-expired", summary: "Remove the expired break-glass statements from the live policies", run: revokeExpiredCommand},
+	{name: "restore", args: "[backup ID [repository ...]]", summary: "Restore the policies of a backup, or list the backups", run: restoreCommand},
+	{name: "version", summary: "Print the version", run: versionCommand},
+}
+
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run will run the command of the given command line
+// Its flags, the environment, the configuration file and the defaults are loaded in appconfig.Config, in this order of precedence
+// It returns the exit code of the command
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stdout)
+		return exitOK
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "Error: unknown command %q\n\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+
+	var sources appconfig.Sources
+	var configFile string
+	fs := appconfig.NewFlagSet("ecr-go "+cmd.name, &sources, &configFile)
+	fs.SetOutput(stderr)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: ecr-go %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if configFile == "" {
+		configFile = os.Getenv(appconfig.ConfigFileEnv)
+	}
+	if configFile != "" {
+		values, err := appconfig.ReadFile(configFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: cannot read the configuration file: %v\n", err)
+			return exitUsage
+		}
+		sources.File = values
+	}
+	if err := appconfig.Init(sources); err != nil {
+		fmt.Fprintf(stderr, "Error: invalid configuration: %v\n\n", err)
+		fs.Usage()
+		return exitUsage
+	}
 
 	logger, err := NewLogger(appconfig.Config.Application.LogLevel)
 	if err != nil {
-		log.Fatalln("Failed to initialize logger:", err)
+		fmt.Fprintf(stderr, "Failed to initialize logger: %v\n", err)
+		return exitFailed
 	}
 	defer logger.Sync()
 
-	logger.Info(fmt.Sprintf("Staring %s v%s", appconfig.Config.Application.Name, appconfig.Config.Application.Version))
-	logger.Info(fmt.Sprintf("Configuration directory is set to %s", appconfig.Config.Application.ConfigDir))
-	logger.Info(fmt.Sprintf("Running in dry-mode: %v", appconfig.Config.Application.DryRun))
+	return cmd.run(logger, stdout, fs.Args())
+}
 
-	var ConfigurationFiles []configuration.ConfigurationFile
+// usage will write the usage of the CLI to w
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: ecr-go <command> [flags] [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nRun 'ecr-go <command> -h' for the flags of a command. Every flag can also be set by its environment variable or in the configuration file\n")
+}
 
-	// Look recursively for all yaml configuration files
-	yamlConfigurationFilesList, err := configuration.GetYamlConfigurationFiles(appconfig.Config.Application.ConfigDir)
-	if err != nil {
-		logger.Fatal(fmt.Sprintf("Error: cannot get the configuration files: %v", err))
-	}
-
-	// For each yaml configuration file, load the associated json policy defined in ConfigurationFile.RepositoryPolicyFile
-	// in ConfigurationFile.RepositoryPolicy
-	// Ensure there is no duplicates
-	for _, yamlFile := range yamlConfigurationFilesList {
-		c := configuration.NewConfigurationFile(logger)
-		if err := c.LoadYamlConfiguration(yamlFile); err == nil {
-			for _, y := range ConfigurationFiles {
-				if c.RepositoryName == y.RepositoryName {
-					logger.Fatal(fmt.Sprint("Error: Duplicate RepositoryName", c.RepositoryName, "found in", yamlFile))
-				}
-			}
-			ConfigurationFiles = append(ConfigurationFiles, c)
-		} else {
-			logger.Fatal(fmt.Sprintf("Error: Loading %s: %v", yamlFile, err))
+// runContext will create the contexts of a run and handle SIGINT/SIGTERM
+// ctx bounds the whole run and interrupts the in-flight ECR calls
+// stop only prevents new repositories from being scheduled
+// On the first signal, stop is cancelled and the in-flight updates are waited for. On the second one, ctx is cancelled
+func runContext(logger *zap.Logger) (ctx, stop context.Context, cancel context.CancelFunc) {
+	var cancelRun context.CancelFunc
+	if appconfig.Config.Run.Timeout > 0 {
+		ctx, cancelRun = context.WithTimeout(context.Background(), appconfig.Config.Run.Timeout)
+	} else {
+		ctx, cancelRun = context.WithCancel(context.Background())
+	}
+	stop, stopScheduling := context.WithCancel(ctx)
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			logger.Warn(fmt.Sprintf("Received %v, waiting for the in-flight repositories updates. Send it again to interrupt them", sig))
+			stopScheduling()
+		case <-ctx.Done():
+			return
 		}
+		select {
+		case sig := <-sigs:
+			logger.Warn(fmt.Sprintf("Received %v, interrupting the in-flight repositories updates", sig))
+			cancelRun()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, stop, func() {
+		signal.Stop(sigs)
+		stopScheduling()
+		cancelRun()
 	}
+}
 
-	// Instanciate a new aws session
-	awssession := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+// preflight will log the errors of the pre-flight checks
+// It returns false if there is any
+func preflight(logger *zap.Logger, errs []error) bool {
+	if len(errs) == 0 {
+		logger.Info("Pre-flight checks passed")
+		return true
+	}
+	for _, err := range errs {
+		logger.Error(fmt.Sprintf("Error: Pre-flight check failed: %v", err))
+	}
+	logger.Error(fmt.Sprintf("Error: %d pre-flight check(s) failed, no repository was changed", len(errs)))
+	return false
+}
 
-	e := ecrupdater.ECRUpdaterClient{
-		Client: ecr.New(awssession, &aws.Config{}),
-		Logger: logger,
+// summarize will log the summary of the run, and write its records to SUMMARY_FILE if set
+// It returns false if any repository failed or was cancelled, or if the records cannot be written
+func summarize(ctx context.Context, logger *zap.Logger, results *summary.Collector, operation summary.Operation, title string) bool {
+	if ctx.Err() == context.DeadlineExceeded {
+		logger.Error(fmt.Sprintf("Error: Run deadline of %v exceeded", appconfig.Config.Run.Timeout))
 	}
-	e.Init()
 
-	// Skip the ECR update if in dry run mode
-	if !appconfig.Config.Application.DryRun {
-		var wg sync.WaitGroup
+	// Summarize how it went
+	logger.Info("")
+	logger.Info(fmt.Sprintf("Repository %s completed. Summary:", title))
+	for _, line := range results.Text(operation, title) {
+		logger.Info(line)
+	}
 
-		// Update the ECR repositories policies
-		for i := range ConfigurationFiles {
-			wg.Add(1)
-			go e.Work(ConfigurationFiles[i], &wg)
+	// Breakdown by account of a multi-account run
+	if lines := results.TextByAccount(operation); len(lines) > 0 {
+		logger.Info("Summary by account:")
+		for _, line := range lines {
+			logger.Info(line)
 		}
+	}
 
-		wg.Wait()
-
-		// Summarize how it went
-		logger.Info("")
-		logger.Info("Repository update completed. Summary:")
-		logger.Info(fmt.Sprintf("\tNumber of successful repositories updates: %v", len(e.RepositorySuccededUpdate.RepositoryNames)))
-		for i := range e.RepositorySuccededUpdate.RepositoryNames {
-			logger.Info(fmt.Sprintf("\t\t- %v", e.RepositorySuccededUpdate.RepositoryNames[i]))
-		}
-		logger.Info(fmt.Sprintf("\tNumber of failed repositories updates: %v", len(e.RepositoryFailedUpdate.GetAll())))
-		for i := range e.RepositoryFailedUpdate.GetAll() {
-			logger.Info(fmt.Sprintf("\t\t- %v: %v", i, e.RepositoryFailedUpdate.GetAll()[i]))
+	// Rollback of a failed transaction
+	if len(results.Records(summary.OperationRollback)) > 0 {
+		logger.Info("Transaction rollback summary:")
+		for _, line := range results.Text(summary.OperationRollback, "rollback") {
+			logger.Info(line)
 		}
+	}
 
-		if len(e.RepositoryFailedUpdate.GetAll()) > 0 {
-			os.Exit(1)
+	// Records of the run, for the tools processing its results
+	if file := appconfig.Config.Summary.File; file != "" {
+		if err := writeSummaryFile(file, results); err != nil {
+			logger.Error(fmt.Sprintf("Error: cannot write the summary: %v", err))
+			return false
 		}
+		logger.Info(fmt.Sprintf("Summary written to %s", file))
+	}
+
+	return results.ExitCode() == 0
+}
+
+// writeSummaryFile will write all the records of the run to the given file, as a JSON array
+func writeSummaryFile(path string, results *summary.Collector) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
 	}
-	if appconfig.Config.Application.DryRun {
-		logger.Info("Dry-run completed ... all configuration files are valid")
+	if err := results.WriteJSON(f); err != nil {
+		f.Close()
+		return err
 	}
+	return f.Close()
 }
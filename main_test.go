@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/lescactus/ecr-go/summary"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func init() {
+	appconfig.Init(appconfig.Sources{})
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		desc       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			desc:       "No command",
+			args:       []string{},
+			wantCode:   exitUsage,
+			wantStderr: "Usage: ecr-go <command>",
+		},
+		{
+			desc:       "Help",
+			args:       []string{"help"},
+			wantCode:   exitOK,
+			wantStdout: "Usage: ecr-go <command>",
+		},
+		{
+			desc:       "Unknown command",
+			args:       []string{"destroy"},
+			wantCode:   exitUsage,
+			wantStderr: `Error: unknown command "destroy"`,
+		},
+		{
+			desc:       "Help of a command",
+			args:       []string{"plan", "-h"},
+			wantCode:   exitOK,
+			wantStderr: "Usage: ecr-go plan [flags]",
+		},
+		{
+			desc:       "Unknown flag",
+			args:       []string{"plan", "--nope"},
+			wantCode:   exitUsage,
+			wantStderr: "flag provided but not defined: -nope",
+		},
+		{
+			desc:       "Invalid flag value",
+			args:       []string{"validate", "--workers", "0"},
+			wantCode:   exitUsage,
+			wantStderr: "Error: invalid configuration",
+		},
+		{
+			desc:       "Configuration file does not exist",
+			args:       []string{"validate", "--config-file", "testdata/doesnotexist.yaml"},
+			wantCode:   exitUsage,
+			wantStderr: "Error: cannot read the configuration file",
+		},
+		{
+			desc:       "Invalid flag of a command",
+			args:       []string{"import", "--tag", "team"},
+			wantCode:   exitUsage,
+			wantStderr: `tag must be key=value, got "team"`,
+		},
+		{
+			desc:     "Import of several regions",
+			args:     []string{"import", "--regions", "eu-west-1,us-east-1"},
+			wantCode: exitUsage,
+		},
+		{
+			desc:       "Version",
+			args:       []string{"version", "--application-version", "1.2.3"},
+			wantCode:   exitOK,
+			wantStdout: "ecr-go v1.2.3\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(test.args, &stdout, &stderr)
+
+			assert.Equal(t, test.wantCode, code)
+			assert.True(t, strings.Contains(stdout.String(), test.wantStdout), stdout.String())
+			assert.True(t, strings.Contains(stderr.String(), test.wantStderr), stderr.String())
+		})
+	}
+
+	appconfig.Init(appconfig.Sources{})
+}
+
+func TestTagsFlag(t *testing.T) {
+	tags := tagsFlag{}
+	assert.NoError(t, tags.Set("team=payments"))
+	assert.NoError(t, tags.Set("env="))
+	assert.NoError(t, tags.Set("owner=a=b"))
+	assert.EqualError(t, tags.Set("=prod"), `tag must be key=value, got "=prod"`)
+
+	assert.Equal(t, tagsFlag{"team": "payments", "env": "", "owner": "a=b"}, tags)
+	assert.Equal(t, "env=,owner=a=b,team=payments", tags.String())
+}
+
+func TestSummarizeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecr-go-summary")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer func() { appconfig.Config.Summary.File = "" }()
+
+	results := summary.NewCollector()
+	results.Add(summary.Record{Repository: "app", Operation: summary.OperationUpdate, Status: summary.StatusSucceeded, Attempts: 1})
+	results.Add(summary.Record{Repository: "tools", Operation: summary.OperationUpdate, Status: summary.StatusFailed, Attempts: 1, ErrorCode: "AccessDeniedException", ErrorMessage: "denied", Terminal: true})
+
+	appconfig.Config.Summary.File = filepath.Join(dir, "summary.json")
+	assert.False(t, summarize(context.Background(), zap.NewNop(), results, summary.OperationUpdate, "update"))
+	b, err := ioutil.ReadFile(appconfig.Config.Summary.File)
+	if assert.NoError(t, err) {
+		var records []summary.Record
+		assert.NoError(t, json.Unmarshal(b, &records))
+		assert.Equal(t, results.Records(), records)
+	}
+
+	// The run fails if its records cannot be written, even if all the repositories succeeded
+	results = summary.NewCollector()
+	results.Add(summary.Record{Repository: "app", Operation: summary.OperationUpdate, Status: summary.StatusSucceeded, Attempts: 1})
+	assert.True(t, summarize(context.Background(), zap.NewNop(), results, summary.OperationUpdate, "update"))
+	appconfig.Config.Summary.File = filepath.Join(dir, "missing", "summary.json")
+	assert.False(t, summarize(context.Background(), zap.NewNop(), results, summary.OperationUpdate, "update"))
+}
@@ -0,0 +1,282 @@
+package policy
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Permission is an access to a repository granted by its policy
+type Permission string
+
+const (
+	PermissionPull Permission = "pull" // Download the images of the repository
+	PermissionPush Permission = "push" // Upload images to the repository
+)
+
+// Permissions are all the permissions, in their display order
+var Permissions = []Permission{PermissionPull, PermissionPush}
+
+// permissionActions are the actions needed by each permission, without their service prefix
+// A principal allowed all the actions of a permission has it, in the access report as in simulate
+var permissionActions = map[Permission][]string{
+	PermissionPull: {"BatchGetImage", "GetDownloadUrlForLayer"},
+	PermissionPush: {"CompleteLayerUpload", "InitiateLayerUpload", "PutImage", "UploadLayerPart"},
+}
+
+// layerCheckAction is the action the clients call to skip the layers already in the repository, without its service prefix
+// The access presets grant it with both permissions, as the AWS managed policies do, but it is not needed by them:
+// a policy allowing only the actions of a permission, like most of the ones written by hand, still grants it
+const layerCheckAction = "BatchCheckLayerAvailability"
+
+// Service prefixes of the actions of the ECR and ECR Public repositories
+const (
+	PrivatePrefix = "ecr:"
+	PublicPrefix  = "ecr-public:"
+)
+
+// Actions returns the actions needed by the permission, with the service prefix of a public or private repository
+func Actions(permission Permission, public bool) []string {
+	prefix := PrivatePrefix
+	if public {
+		prefix = PublicPrefix
+	}
+	actions := []string{}
+	for _, a := range permissionActions[permission] {
+		actions = append(actions, prefix+a)
+	}
+	return actions
+}
+
+// GrantedActions returns the actions the access presets grant for the permission, sorted, with the service prefix of
+// a public or private repository: the actions needed by the permission and layerCheckAction
+func GrantedActions(permission Permission, public bool) []string {
+	prefix := PrivatePrefix
+	if public {
+		prefix = PublicPrefix
+	}
+	actions := append(Actions(permission, public), prefix+layerCheckAction)
+	sort.Strings(actions)
+	return actions
+}
+
+// Types of principals
+const (
+	PrincipalAnyone    = "anyone"
+	PrincipalAccount   = "account"
+	PrincipalRole      = "role"
+	PrincipalUser      = "user"
+	PrincipalSession   = "session"
+	PrincipalService   = "service"
+	PrincipalFederated = "federated"
+	PrincipalOther     = "other"
+)
+
+// Principal is a principal of a policy
+type Principal struct {
+	Type    string
+	ID      string // Account ID of an account, "*" for anyone, as written otherwise
+	Account string // Account of the principal, if any
+}
+
+var (
+	accountIDRegexp = regexp.MustCompile(`^[0-9]{12}$`)
+	iamArnRegexp    = regexp.MustCompile(`^arn:[^:]+:(iam|sts)::([0-9]{12}):([^/]+)`)
+)
+
+// ParsePrincipal returns the principal of the given type of a policy (AWS, Service or Federated) and value
+// The root of an account and its ID are the same principal
+func ParsePrincipal(kind, value string) Principal {
+	switch kind {
+	case "Service":
+		return Principal{Type: PrincipalService, ID: value}
+	case "Federated":
+		return Principal{Type: PrincipalFederated, ID: value}
+	}
+	if value == "*" {
+		return Principal{Type: PrincipalAnyone, ID: "*"}
+	}
+	if accountIDRegexp.MatchString(value) {
+		return Principal{Type: PrincipalAccount, ID: value, Account: value}
+	}
+	m := iamArnRegexp.FindStringSubmatch(value)
+	if m == nil {
+		return Principal{Type: PrincipalOther, ID: value}
+	}
+	p := Principal{ID: value, Account: m[2]}
+	switch {
+	case m[1] == "iam" && m[3] == "root":
+		p.Type, p.ID = PrincipalAccount, m[2]
+	case m[1] == "iam" && m[3] == "role":
+		p.Type = PrincipalRole
+	case m[1] == "iam" && m[3] == "user":
+		p.Type = PrincipalUser
+	case m[1] == "sts" && m[3] == "assumed-role":
+		p.Type = PrincipalSession
+	default:
+		p.Type = PrincipalOther
+	}
+	return p
+}
+
+// Covers returns true if a statement naming p applies to other: p is other, anyone, or the account of other
+func (p Principal) Covers(other Principal) bool {
+	switch {
+	case p.Type == PrincipalAnyone:
+		return true
+	case p.Type == PrincipalAccount:
+		return other.Account == p.Account
+	default:
+		return p.Type == other.Type && p.ID == other.ID
+	}
+}
+
+// String returns the ID of the principal
+func (p Principal) String() string {
+	return p.ID
+}
+
+// Grant is a permission granted to a principal by a policy
+type Grant struct {
+	Principal   Principal
+	Permission  Permission
+	Conditional bool // The permission is only granted under conditions
+}
+
+// Grants returns the permissions the policy of a public or private repository grants to each principal it names in an Allow statement
+// A principal is granted a permission if all its actions are allowed and none is denied without condition. The permission is
+// conditional if any of its actions is only allowed under conditions, or denied under conditions. NotPrincipal Allow statements are ignored
+// The organizations and organizational units a statement on anyone is restricted to by its only condition are named as well, and
+// granted its permissions without condition. The public repositories can also be pulled by anyone. The grants are sorted by principal type, principal and permission
+func Grants(doc Document, public bool) []Grant {
+	principals := []Principal{}
+	seen := make(map[Principal]bool)
+	for _, s := range doc.Statements {
+		if s.Effect != EffectAllow {
+			continue
+		}
+		named := []Principal{}
+		for _, kind := range sortedKeys(s.Principals) {
+			for _, v := range s.Principals[kind] {
+				named = append(named, ParsePrincipal(kind, v))
+			}
+		}
+		named = append(named, s.organizationScope()...)
+		for _, p := range named {
+			if !seen[p] {
+				seen[p] = true
+				principals = append(principals, p)
+			}
+		}
+	}
+
+	grants := []Grant{}
+	for _, p := range principals {
+		for _, permission := range Permissions {
+			granted, conditional := doc.allowed(p, Actions(permission, public))
+			if granted {
+				grants = append(grants, Grant{Principal: p, Permission: permission, Conditional: conditional})
+			}
+		}
+	}
+	if public {
+		anyone := Principal{Type: PrincipalAnyone, ID: "*"}
+		found := false
+		for i, g := range grants {
+			if g.Principal == anyone && g.Permission == PermissionPull {
+				grants[i].Conditional = false
+				found = true
+			}
+		}
+		if !found {
+			grants = append(grants, Grant{Principal: anyone, Permission: PermissionPull})
+		}
+	}
+
+	sortGrants(grants)
+	return grants
+}
+
+// typeOrder returns the display order of a principal type
+func typeOrder(t string) int {
+	for i, o := range []string{PrincipalAnyone, PrincipalOrganization, PrincipalUnit, PrincipalAccount, PrincipalRole, PrincipalUser, PrincipalSession, PrincipalService, PrincipalFederated} {
+		if t == o {
+			return i
+		}
+	}
+	return len(t) + 100
+}
+
+// allowed returns true if all the actions are allowed to the principal, and whether any of them is only under conditions
+func (d Document) allowed(p Principal, actions []string) (bool, bool) {
+	conditional := false
+	for _, a := range actions {
+		allow, allowConditional, deny, denyConditional := false, false, false, false
+		for _, s := range d.Statements {
+			if !s.MatchesAction(a) || !s.appliesTo(p) {
+				continue
+			}
+			hasConditions := s.HasConditions()
+			if p.Type == PrincipalOrganization || p.Type == PrincipalUnit {
+				var applies bool
+				if applies, hasConditions = s.inOrganizationScope(p); !applies {
+					continue
+				}
+			}
+			switch {
+			case s.Effect == EffectAllow && hasConditions:
+				allowConditional = true
+			case s.Effect == EffectAllow:
+				allow = true
+			case hasConditions:
+				denyConditional = true
+			default:
+				deny = true
+			}
+		}
+		if deny || !(allow || allowConditional) {
+			return false, false
+		}
+		if !allow || denyConditional {
+			conditional = true
+		}
+	}
+	return true, conditional
+}
+
+// appliesTo returns true if the statement applies to the principal
+// An Allow statement with NotPrincipal is never considered to apply
+func (s Statement) appliesTo(p Principal) bool {
+	if len(s.NotPrincipals) > 0 {
+		if s.Effect == EffectAllow {
+			return false
+		}
+		return !namesPrincipal(s.NotPrincipals, p)
+	}
+	return namesPrincipal(s.Principals, p)
+}
+
+// namesPrincipal returns true if any of the principals by type covers p
+func namesPrincipal(principals map[string][]string, p Principal) bool {
+	for kind, values := range principals {
+		for _, v := range values {
+			if ParsePrincipal(kind, v).Covers(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchesQuery returns true if the principal is the one of the query, belongs to the account of the query, or is anyone
+// The query is an account ID, an ARN or a service, compared case insensitively
+func (p Principal) MatchesQuery(query string) bool {
+	q := ParsePrincipal("AWS", query)
+	if strings.Contains(query, ".amazonaws.com") {
+		q = ParsePrincipal("Service", query)
+	}
+	if p.Type == PrincipalAnyone || strings.EqualFold(p.ID, q.ID) {
+		return true
+	}
+	return q.Type == PrincipalAccount && p.Account == q.Account
+}
@@ -0,0 +1,142 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrincipal(t *testing.T) {
+	tests := []struct {
+		kind, value string
+		want        Principal
+	}{
+		{"AWS", "*", Principal{Type: PrincipalAnyone, ID: "*"}},
+		{"AWS", "111111111111", Principal{Type: PrincipalAccount, ID: "111111111111", Account: "111111111111"}},
+		{"AWS", "arn:aws:iam::111111111111:root", Principal{Type: PrincipalAccount, ID: "111111111111", Account: "111111111111"}},
+		{"AWS", "arn:aws:iam::111111111111:role/ci", Principal{Type: PrincipalRole, ID: "arn:aws:iam::111111111111:role/ci", Account: "111111111111"}},
+		{"AWS", "arn:aws:iam::111111111111:user/bob", Principal{Type: PrincipalUser, ID: "arn:aws:iam::111111111111:user/bob", Account: "111111111111"}},
+		{"AWS", "arn:aws:sts::111111111111:assumed-role/ci/session", Principal{Type: PrincipalSession, ID: "arn:aws:sts::111111111111:assumed-role/ci/session", Account: "111111111111"}},
+		{"AWS", "AROAEXAMPLEID", Principal{Type: PrincipalOther, ID: "AROAEXAMPLEID"}},
+		{"Service", "lambda.amazonaws.com", Principal{Type: PrincipalService, ID: "lambda.amazonaws.com"}},
+		{"Federated", "cognito-identity.amazonaws.com", Principal{Type: PrincipalFederated, ID: "cognito-identity.amazonaws.com"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, ParsePrincipal(test.kind, test.value), test.value)
+	}
+}
+
+func TestActions(t *testing.T) {
+	assert.Equal(t, []string{"ecr:BatchGetImage", "ecr:GetDownloadUrlForLayer"}, Actions(PermissionPull, false))
+	assert.Equal(t, []string{"ecr-public:CompleteLayerUpload", "ecr-public:InitiateLayerUpload", "ecr-public:PutImage", "ecr-public:UploadLayerPart"}, Actions(PermissionPush, true))
+
+	// The presets grant BatchCheckLayerAvailability as well, which the permissions do not need
+	assert.Equal(t, []string{"ecr:BatchCheckLayerAvailability", "ecr:BatchGetImage", "ecr:GetDownloadUrlForLayer"}, GrantedActions(PermissionPull, false))
+	assert.Equal(t, []string{"ecr:BatchCheckLayerAvailability", "ecr:CompleteLayerUpload", "ecr:InitiateLayerUpload", "ecr:PutImage", "ecr:UploadLayerPart"}, GrantedActions(PermissionPush, false))
+}
+
+func TestGrants(t *testing.T) {
+	account := Principal{Type: PrincipalAccount, ID: "111111111111", Account: "111111111111"}
+	role := Principal{Type: PrincipalRole, ID: "arn:aws:iam::222222222222:role/ci", Account: "222222222222"}
+	lambda := Principal{Type: PrincipalService, ID: "lambda.amazonaws.com"}
+	anyone := Principal{Type: PrincipalAnyone, ID: "*"}
+
+	tests := []struct {
+		desc   string
+		policy string
+		public bool
+		want   []Grant
+	}{
+		{
+			desc: "Pull and push",
+			policy: `{"Statement":[
+				{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:root"},"Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"]},
+				{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::222222222222:role/ci"},"Action":"ecr:*"}
+			]}`,
+			want: []Grant{
+				{Principal: account, Permission: PermissionPull},
+				{Principal: role, Permission: PermissionPull},
+				{Principal: role, Permission: PermissionPush},
+			},
+		},
+		{
+			desc:   "Missing action",
+			policy: `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"111111111111"},"Action":["ecr:BatchGetImage","ecr:PutImage"]}]}`,
+			want:   []Grant{},
+		},
+		{
+			desc: "Conditional allow",
+			policy: `{"Statement":[
+				{"Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"},"Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"],"Condition":{"StringLike":{"aws:sourceArn":"arn:aws:lambda:*:111111111111:function:*"}}}
+			]}`,
+			want: []Grant{{Principal: lambda, Permission: PermissionPull, Conditional: true}},
+		},
+		{
+			desc: "Denied to the account",
+			policy: `{"Statement":[
+				{"Effect":"Allow","Principal":{"AWS":["111111111111","arn:aws:iam::222222222222:role/ci"]},"Action":"ecr:*"},
+				{"Effect":"Deny","Principal":{"AWS":"222222222222"},"Action":"ecr:PutImage"},
+				{"Effect":"Deny","Principal":"*","Action":"ecr:Put*","Condition":{"Bool":{"aws:SecureTransport":"false"}}}
+			]}`,
+			want: []Grant{
+				{Principal: account, Permission: PermissionPull},
+				{Principal: account, Permission: PermissionPush, Conditional: true},
+				{Principal: role, Permission: PermissionPull},
+			},
+		},
+		{
+			desc: "Deny to all but a principal",
+			policy: `{"Statement":[
+				{"Effect":"Allow","Principal":{"AWS":["111111111111","arn:aws:iam::222222222222:role/ci"]},"Action":"ecr:BatchGetImage"},
+				{"Effect":"Allow","Principal":{"AWS":["111111111111","arn:aws:iam::222222222222:role/ci"]},"Action":"ecr:GetDownloadUrlForLayer"},
+				{"Effect":"Deny","NotPrincipal":{"AWS":"111111111111"},"Action":"ecr:*"}
+			]}`,
+			want: []Grant{{Principal: account, Permission: PermissionPull}},
+		},
+		{
+			desc: "Organization and organizational unit",
+			policy: `{"Statement":[
+				{"Effect":"Allow","Principal":"*","Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"],"Condition":{"StringEquals":{"aws:PrincipalOrgID":"o-a1b2c3d4e5"}}},
+				{"Effect":"Allow","Principal":"*","Action":"ecr:*","Condition":{"ForAnyValue:StringLike":{"aws:PrincipalOrgPaths":"o-a1b2c3d4e5/r-ab12/ou-ab12-11111111/*"}}},
+				{"Effect":"Deny","Principal":"*","Action":"ecr:PutImage","Condition":{"StringEquals":{"aws:PrincipalOrgID":"o-z9y8x7w6v5"}}}
+			]}`,
+			want: []Grant{
+				{Principal: anyone, Permission: PermissionPull, Conditional: true},
+				{Principal: anyone, Permission: PermissionPush, Conditional: true},
+				{Principal: Principal{Type: PrincipalOrganization, ID: "o-a1b2c3d4e5"}, Permission: PermissionPull},
+				{Principal: Principal{Type: PrincipalUnit, ID: "ou-ab12-11111111"}, Permission: PermissionPull},
+				{Principal: Principal{Type: PrincipalUnit, ID: "ou-ab12-11111111"}, Permission: PermissionPush},
+			},
+		},
+		{
+			desc:   "Public repository",
+			policy: `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"111111111111"},"Action":"ecr-public:*"}]}`,
+			public: true,
+			want: []Grant{
+				{Principal: anyone, Permission: PermissionPull},
+				{Principal: account, Permission: PermissionPull},
+				{Principal: account, Permission: PermissionPush},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			doc, err := Parse(test.policy)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, test.want, Grants(doc, test.public))
+		})
+	}
+}
+
+func TestMatchesQuery(t *testing.T) {
+	role := ParsePrincipal("AWS", "arn:aws:iam::111111111111:role/ci")
+	assert.True(t, role.MatchesQuery("111111111111"))
+	assert.True(t, role.MatchesQuery("arn:aws:iam::111111111111:role/ci"))
+	assert.False(t, role.MatchesQuery("arn:aws:iam::111111111111:role/other"))
+	assert.False(t, role.MatchesQuery("222222222222"))
+	assert.True(t, ParsePrincipal("AWS", "*").MatchesQuery("222222222222"))
+	assert.True(t, ParsePrincipal("Service", "lambda.amazonaws.com").MatchesQuery("lambda.amazonaws.com"))
+}
@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// BreakGlassPrefix is the prefix of the Sids of the break-glass statements, followed by their expiry
+	BreakGlassPrefix = "BreakGlass"
+	// breakGlassTimeFormat is the layout of the expiry in the Sid of a break-glass statement, in UTC
+	breakGlassTimeFormat = "20060102T150405Z"
+	// breakGlassVersion is the version of the policy created for a repository without policy
+	breakGlassVersion = "2008-10-17"
+)
+
+// breakGlassRegexp matches the Sid of a break-glass statement: the prefix, the expiry and an optional counter
+var breakGlassRegexp = regexp.MustCompile(`^` + BreakGlassPrefix + `(\d{8}T\d{6}Z)\d*$`)
+
+// breakGlassStatement is a break-glass statement, in the order of its keys in the policy
+type breakGlassStatement struct {
+	Sid       string                       `json:"Sid"`
+	Effect    string                       `json:"Effect"`
+	Principal map[string]string            `json:"Principal"`
+	Action    []string                     `json:"Action"`
+	Condition map[string]map[string]string `json:"Condition"`
+}
+
+// BreakGlassExpiry returns the expiry of a break-glass statement given its Sid
+// It returns false if the Sid is not the one of a break-glass statement
+func BreakGlassExpiry(sid string) (time.Time, bool) {
+	m := breakGlassRegexp.FindStringSubmatch(sid)
+	if m == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(breakGlassTimeFormat, m[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// AddBreakGlass returns the current policy with a break-glass statement allowing the actions to the principal until expires
+// appended. An empty current policy is a repository without policy
+// The Sid of the statement is BreakGlassPrefix followed by the expiry, and by a counter if the policy already has this Sid.
+// Its aws:CurrentTime condition makes AWS deny the access once expired, even before the statement is revoked
+// It returns the policy, the Sid of the statement and an error if the principal or the actions are invalid
+func AddBreakGlass(current, principal string, actions []string, expires time.Time) (string, string, error) {
+	if principal == "" || strings.ContainsAny(principal, "*?") {
+		return "", "", fmt.Errorf("break-glass principal must be an account ID or an ARN without wildcard, got %q", principal)
+	}
+	if len(actions) == 0 {
+		return "", "", errors.New("break-glass actions must not be empty")
+	}
+
+	doc := rawDocument{keys: map[string]json.RawMessage{"Version": json.RawMessage(`"` + breakGlassVersion + `"`)}}
+	if current != "" {
+		var err error
+		if doc, err = parseRaw(current); err != nil {
+			return "", "", fmt.Errorf("current policy: %v", err)
+		}
+	}
+	sids := make(map[string]bool, len(doc.statements))
+	for _, s := range doc.statements {
+		sids[strings.ToLower(sid(s))] = true
+	}
+
+	expires = expires.UTC().Truncate(time.Second)
+	id := BreakGlassPrefix + expires.Format(breakGlassTimeFormat)
+	for i := 2; sids[strings.ToLower(id)]; i++ {
+		id = fmt.Sprintf("%s%s%d", BreakGlassPrefix, expires.Format(breakGlassTimeFormat), i)
+	}
+
+	statement, err := json.Marshal(breakGlassStatement{
+		Sid:       id,
+		Effect:    EffectAllow,
+		Principal: map[string]string{"AWS": principal},
+		Action:    actions,
+		Condition: map[string]map[string]string{"DateLessThan": {"aws:CurrentTime": expires.Format(time.RFC3339)}},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	text, err := doc.marshal(append(doc.statements, statement))
+	if err != nil {
+		return "", "", err
+	}
+	return text, id, nil
+}
+
+// RevokeExpired returns the current policy without its break-glass statements expired at now, and their Sids
+// The policy is returned unchanged if none has expired, and empty if no statement is left: the policy must be deleted
+func RevokeExpired(current string, now time.Time) (string, []string, error) {
+	if current == "" {
+		return "", nil, nil
+	}
+	doc, err := parseRaw(current)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var revoked []string
+	kept := []json.RawMessage{}
+	for _, s := range doc.statements {
+		id := sid(s)
+		if expires, ok := BreakGlassExpiry(id); ok && !now.Before(expires) {
+			revoked = append(revoked, id)
+			continue
+		}
+		kept = append(kept, s)
+	}
+	if len(revoked) == 0 {
+		return current, nil, nil
+	}
+	if len(kept) == 0 {
+		return "", revoked, nil
+	}
+	text, err := doc.marshal(kept)
+	if err != nil {
+		return "", nil, err
+	}
+	return text, revoked, nil
+}
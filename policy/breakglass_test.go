@@ -0,0 +1,181 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakGlassExpiry(t *testing.T) {
+	tests := []struct {
+		desc   string
+		sid    string
+		want   time.Time
+		wantOk bool
+	}{
+		{
+			desc:   "Break-glass statement",
+			sid:    "BreakGlass20261019T143000Z",
+			want:   time.Date(2026, 10, 19, 14, 30, 0, 0, time.UTC),
+			wantOk: true,
+		},
+		{
+			desc:   "Break-glass statement with a counter",
+			sid:    "BreakGlass20261019T143000Z2",
+			want:   time.Date(2026, 10, 19, 14, 30, 0, 0, time.UTC),
+			wantOk: true,
+		},
+		{
+			desc: "Other statement",
+			sid:  "VendorPull",
+		},
+		{
+			desc: "Prefix without expiry",
+			sid:  "BreakGlassPull",
+		},
+		{
+			desc: "Invalid expiry",
+			sid:  "BreakGlass20261399T143000Z",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, ok := BreakGlassExpiry(test.sid)
+			assert.Equal(t, test.wantOk, ok)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestAddBreakGlass(t *testing.T) {
+	expires := time.Date(2026, 10, 19, 16, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	statement := "        {\n            \"Sid\": \"BreakGlass20261019T143000Z\",\n            \"Effect\": \"Allow\",\n            \"Principal\": {\n                \"AWS\": \"arn:aws:iam::111111111111:role/oncall\"\n            },\n" +
+		"            \"Action\": [\n                \"ecr:BatchGetImage\",\n                \"ecr:GetDownloadUrlForLayer\"\n            ],\n" +
+		"            \"Condition\": {\n                \"DateLessThan\": {\n                    \"aws:CurrentTime\": \"2026-10-19T14:30:00Z\"\n                }\n            }\n        }\n"
+
+	tests := []struct {
+		desc      string
+		current   string
+		principal string
+		actions   []string
+		want      string
+		wantSid   string
+		wantErr   string
+	}{
+		{
+			desc:      "No current policy",
+			principal: "arn:aws:iam::111111111111:role/oncall",
+			actions:   []string{"ecr:BatchGetImage", "ecr:GetDownloadUrlForLayer"},
+			want:      "{\n    \"Statement\": [\n" + statement + "    ],\n    \"Version\": \"2008-10-17\"\n}",
+			wantSid:   "BreakGlass20261019T143000Z",
+		},
+		{
+			desc:      "Appended to the current statements",
+			current:   `{"Version":"2012-10-17","Statement":{"Sid":"Pull","Effect":"Allow","Principal":"*","Action":"ecr:BatchGetImage"}}`,
+			principal: "arn:aws:iam::111111111111:role/oncall",
+			actions:   []string{"ecr:BatchGetImage", "ecr:GetDownloadUrlForLayer"},
+			want: "{\n    \"Statement\": [\n" +
+				"        {\n            \"Sid\": \"Pull\",\n            \"Effect\": \"Allow\",\n            \"Principal\": \"*\",\n            \"Action\": \"ecr:BatchGetImage\"\n        },\n" +
+				statement + "    ],\n    \"Version\": \"2012-10-17\"\n}",
+			wantSid: "BreakGlass20261019T143000Z",
+		},
+		{
+			desc:      "Counter appended to a taken Sid",
+			current:   `{"Version":"2008-10-17","Statement":[{"Sid":"BreakGlass20261019T143000Z"},{"Sid":"breakglass20261019T143000Z2"}]}`,
+			principal: "111111111111",
+			actions:   []string{"ecr:*"},
+			wantSid:   "BreakGlass20261019T143000Z3",
+		},
+		{
+			desc:      "Wildcard principal",
+			principal: "*",
+			actions:   []string{"ecr:*"},
+			wantErr:   `break-glass principal must be an account ID or an ARN without wildcard, got "*"`,
+		},
+		{
+			desc:      "No action",
+			principal: "111111111111",
+			wantErr:   "break-glass actions must not be empty",
+		},
+		{
+			desc:      "Invalid current policy",
+			current:   `{`,
+			principal: "111111111111",
+			actions:   []string{"ecr:*"},
+			wantErr:   "current policy: unexpected end of JSON input",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, sid, err := AddBreakGlass(test.current, test.principal, test.actions, expires)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantSid, sid)
+			if test.want != "" {
+				assert.Equal(t, test.want, got)
+			}
+			// The statement is revoked once expired
+			text, revoked, err := RevokeExpired(got, expires)
+			assert.NoError(t, err)
+			assert.Contains(t, revoked, sid)
+			assert.NotContains(t, text, sid)
+		})
+	}
+}
+
+func TestRevokeExpired(t *testing.T) {
+	now := time.Date(2026, 10, 19, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc        string
+		current     string
+		want        string
+		wantRevoked []string
+		wantErr     bool
+	}{
+		{
+			desc:        "Expired statements revoked",
+			current:     `{"Version":"2008-10-17","Statement":[{"Sid":"Pull"},{"Sid":"BreakGlass20261019T143000Z"},{"Sid":"BreakGlass20261019T143001Z"},{"Sid":"BreakGlass20261018T000000Z2"}]}`,
+			want:        "{\n    \"Statement\": [\n        {\n            \"Sid\": \"Pull\"\n        },\n        {\n            \"Sid\": \"BreakGlass20261019T143001Z\"\n        }\n    ],\n    \"Version\": \"2008-10-17\"\n}",
+			wantRevoked: []string{"BreakGlass20261019T143000Z", "BreakGlass20261018T000000Z2"},
+		},
+		{
+			desc:    "Nothing expired",
+			current: `{"Version":"2008-10-17","Statement":[{"Sid":"Pull"},{"Sid":"BreakGlassPull"}]}`,
+			want:    `{"Version":"2008-10-17","Statement":[{"Sid":"Pull"},{"Sid":"BreakGlassPull"}]}`,
+		},
+		{
+			desc:        "Last statement revoked",
+			current:     `{"Version":"2008-10-17","Statement":{"Sid":"BreakGlass20261019T000000Z"}}`,
+			want:        "",
+			wantRevoked: []string{"BreakGlass20261019T000000Z"},
+		},
+		{
+			desc: "No policy",
+		},
+		{
+			desc:    "Invalid policy",
+			current: `[]`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, revoked, err := RevokeExpired(test.current, now)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+			assert.Equal(t, test.wantRevoked, revoked)
+		})
+	}
+}
@@ -0,0 +1,385 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decision is the answer of a policy to a request
+type Decision string
+
+const (
+	DecisionAllow        Decision = "allow"         // An Allow statement applies to the request and no Deny statement does
+	DecisionExplicitDeny Decision = "explicit-deny" // A Deny statement applies to the request
+	DecisionImplicitDeny Decision = "implicit-deny" // No statement applies to the request
+)
+
+// Request is a call to a repository, evaluated against its policy
+type Request struct {
+	Principal string              // Caller: ARN of a role, a user or a session, account ID, or service like lambda.amazonaws.com
+	Action    string              // Action called, like ecr:BatchGetImage
+	Resource  string              // ARN of the repository. Empty matches the resources of all the statements
+	Context   map[string][]string // Values of the condition keys of the request, like aws:PrincipalOrgID
+	Time      time.Time           // Time of the request, setting aws:CurrentTime and aws:EpochTime unless in Context. Zero means now
+}
+
+// Evaluation is the decision of a policy for a request, with the statements leading to it
+type Evaluation struct {
+	Decision   Decision
+	Statements []string // Sid, or position if it has none, of the statements applying to the request with the effect of the decision
+}
+
+// String returns the decision and the statements leading to it
+func (e Evaluation) String() string {
+	if len(e.Statements) == 0 {
+		return string(e.Decision)
+	}
+	return fmt.Sprintf("%s (%s)", e.Decision, strings.Join(e.Statements, ", "))
+}
+
+// Evaluate returns the decision of the policy for the request: a Deny statement applying to it wins over an Allow one,
+// and a request no statement applies to is implicitly denied
+// Only the repository policy is evaluated: the identity policies of the caller, the service control policies and the
+// permissions boundaries are not. It returns an error if a condition operator is not supported
+func (d Document) Evaluate(r Request) (Evaluation, error) {
+	caller := callerPrincipal(r.Principal)
+	context := requestContext(r, caller)
+
+	allowed, denied := []string{}, []string{}
+	for i, s := range d.Statements {
+		if !s.MatchesAction(r.Action) || !s.matchesResource(r.Resource) || !s.matchesCaller(caller) {
+			continue
+		}
+		ok, err := s.conditionsMatch(context)
+		if err != nil {
+			return Evaluation{}, fmt.Errorf("%s: %v", statementName(s, i), err)
+		}
+		if !ok {
+			continue
+		}
+		if s.Effect == EffectDeny {
+			denied = append(denied, statementName(s, i))
+		} else {
+			allowed = append(allowed, statementName(s, i))
+		}
+	}
+
+	switch {
+	case len(denied) > 0:
+		return Evaluation{Decision: DecisionExplicitDeny, Statements: denied}, nil
+	case len(allowed) > 0:
+		return Evaluation{Decision: DecisionAllow, Statements: allowed}, nil
+	}
+	return Evaluation{Decision: DecisionImplicitDeny}, nil
+}
+
+// EvaluateActions returns the decision of the policy for the request with each of the actions
+// The request is allowed if all the actions are. Otherwise, the decision is the one of the first action denied,
+// an explicit deny taking precedence over an implicit one
+func (d Document) EvaluateActions(r Request, actions []string) (Evaluation, error) {
+	result := Evaluation{Decision: DecisionAllow}
+	seen := make(map[string]bool)
+	for _, a := range actions {
+		r.Action = a
+		e, err := d.Evaluate(r)
+		if err != nil {
+			return Evaluation{}, err
+		}
+		switch {
+		case e.Decision == DecisionExplicitDeny:
+			return e, nil
+		case e.Decision == DecisionImplicitDeny:
+			if result.Decision == DecisionAllow {
+				result = e
+			}
+		case result.Decision == DecisionAllow:
+			for _, s := range e.Statements {
+				if !seen[s] {
+					seen[s] = true
+					result.Statements = append(result.Statements, s)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// ExpandAction returns the actions of the pull or push permission of a public or private repository, or the action itself
+func ExpandAction(action string, public bool) []string {
+	switch Permission(action) {
+	case PermissionPull, PermissionPush:
+		return Actions(Permission(action), public)
+	}
+	return []string{action}
+}
+
+// statementName returns the Sid of the statement, or its position in the policy if it has none
+func statementName(s Statement, i int) string {
+	if s.Sid != "" {
+		return s.Sid
+	}
+	return fmt.Sprintf("statement %d", i)
+}
+
+// callerPrincipal returns the principal of the caller of a request
+func callerPrincipal(caller string) Principal {
+	if !strings.HasPrefix(caller, "arn:") && strings.HasSuffix(caller, ".amazonaws.com") {
+		return ParsePrincipal("Service", caller)
+	}
+	return ParsePrincipal("AWS", caller)
+}
+
+// requestContext returns the condition keys of the request by lower case name, with the keys of the caller and of the time of the
+// request not set by the request
+func requestContext(r Request, caller Principal) map[string][]string {
+	context := make(map[string][]string, len(r.Context)+2)
+	for k, v := range r.Context {
+		context[strings.ToLower(k)] = v
+	}
+	defaults := map[string]string{}
+	switch caller.Type {
+	case PrincipalService:
+		defaults["aws:principalservicename"] = caller.ID
+	case PrincipalAccount:
+		defaults["aws:principalarn"] = fmt.Sprintf("arn:aws:iam::%s:root", caller.Account)
+	case PrincipalAnyone, PrincipalOther:
+	default:
+		defaults["aws:principalarn"] = caller.ID
+	}
+	if caller.Account != "" {
+		defaults["aws:principalaccount"] = caller.Account
+	}
+	now := r.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	defaults["aws:currenttime"] = now.UTC().Format(time.RFC3339)
+	defaults["aws:epochtime"] = strconv.FormatInt(now.Unix(), 10)
+	for k, v := range defaults {
+		if _, ok := context[k]; !ok {
+			context[k] = []string{v}
+		}
+	}
+	return context
+}
+
+// sessionRegexp matches the ARN of an assumed role session, with the name of the role
+var sessionRegexp = regexp.MustCompile(`^arn:[^:]+:sts::[0-9]{12}:assumed-role/([^/]+)/`)
+
+// matchesCaller returns true if the statement applies to the caller
+// The sessions of a role are covered by the role, whatever its path
+func (s Statement) matchesCaller(caller Principal) bool {
+	names := func(principals map[string][]string) bool {
+		for kind, values := range principals {
+			for _, v := range values {
+				p := ParsePrincipal(kind, v)
+				if p.Covers(caller) {
+					return true
+				}
+				if m := sessionRegexp.FindStringSubmatch(caller.ID); m != nil && p.Type == PrincipalRole && p.Account == caller.Account && strings.HasSuffix(p.ID, "/"+m[1]) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if len(s.NotPrincipals) > 0 {
+		return !names(s.NotPrincipals)
+	}
+	return names(s.Principals)
+}
+
+// matchesResource returns true if the statement applies to the resource. An empty resource matches any statement
+func (s Statement) matchesResource(resource string) bool {
+	switch {
+	case resource == "":
+		return true
+	case len(s.NotResources) > 0:
+		return !anyWildcard(s.NotResources, resource)
+	case len(s.Resources) > 0:
+		return anyWildcard(s.Resources, resource)
+	}
+	return true
+}
+
+// anyWildcard returns true if the value matches any of the patterns, case sensitively
+func anyWildcard(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if Wildcard(p, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionOperators compare a value of the condition of a statement with a value of the request, by operator
+var conditionOperators = map[string]func(condition, value string) bool{
+	"StringEquals":             func(c, v string) bool { return c == v },
+	"StringEqualsIgnoreCase":   strings.EqualFold,
+	"StringLike":               Wildcard,
+	"ArnEquals":                Wildcard,
+	"ArnLike":                  Wildcard,
+	"Bool":                     strings.EqualFold,
+	"NumericEquals":            compareNumbers(func(v, c float64) bool { return v == c }),
+	"NumericLessThan":          compareNumbers(func(v, c float64) bool { return v < c }),
+	"NumericLessThanEquals":    compareNumbers(func(v, c float64) bool { return v <= c }),
+	"NumericGreaterThan":       compareNumbers(func(v, c float64) bool { return v > c }),
+	"NumericGreaterThanEquals": compareNumbers(func(v, c float64) bool { return v >= c }),
+	"DateEquals":               compareDates(func(v, c time.Time) bool { return v.Equal(c) }),
+	"DateLessThan":             compareDates(func(v, c time.Time) bool { return v.Before(c) }),
+	"DateLessThanEquals":       compareDates(func(v, c time.Time) bool { return !v.After(c) }),
+	"DateGreaterThan":          compareDates(func(v, c time.Time) bool { return v.After(c) }),
+	"DateGreaterThanEquals":    compareDates(func(v, c time.Time) bool { return !v.Before(c) }),
+}
+
+// negatedOperators are the operators negating another one
+var negatedOperators = map[string]string{
+	"StringNotEquals":           "StringEquals",
+	"StringNotEqualsIgnoreCase": "StringEqualsIgnoreCase",
+	"StringNotLike":             "StringLike",
+	"ArnNotEquals":              "ArnEquals",
+	"ArnNotLike":                "ArnLike",
+	"NumericNotEquals":          "NumericEquals",
+	"DateNotEquals":             "DateEquals",
+}
+
+// compareNumbers returns an operator comparing the number of the request with the one of the condition
+// A value which is not a number never matches
+func compareNumbers(compare func(value, condition float64) bool) func(condition, value string) bool {
+	return func(condition, value string) bool {
+		c, err := strconv.ParseFloat(condition, 64)
+		if err != nil {
+			return false
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		return err == nil && compare(v, c)
+	}
+}
+
+// compareDates returns an operator comparing the date of the request with the one of the condition
+// A value which is not a date never matches
+func compareDates(compare func(value, condition time.Time) bool) func(condition, value string) bool {
+	return func(condition, value string) bool {
+		c, ok := parseDate(condition)
+		if !ok {
+			return false
+		}
+		v, ok := parseDate(value)
+		return ok && compare(v, c)
+	}
+}
+
+// dateLayouts are the ISO 8601 formats of the dates of the conditions, from the most to the least precise
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02"}
+
+// parseDate returns the time of a date of a condition: an ISO 8601 date or a number of seconds since the epoch
+func parseDate(s string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), true
+	}
+	return time.Time{}, false
+}
+
+// conditionsMatch returns true if all the conditions of the statement match the request context, keyed by lower case name
+// A condition matches if any of its values matches a value of the request, or none does for a negated operator.
+// The ForAnyValue: and ForAllValues: prefixes and the IfExists suffix are supported
+// It returns an error if an operator is not supported
+func (s Statement) conditionsMatch(context map[string][]string) (bool, error) {
+	for _, operator := range sortedOperators(s.Conditions) {
+		for key, conditions := range s.Conditions[operator] {
+			ok, err := conditionMatches(operator, conditions, context[strings.ToLower(key)])
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// conditionMatches returns true if the values of a key of the request match the condition values with the operator
+// values is nil if the request has no such key
+func conditionMatches(operator string, conditions, values []string) (bool, error) {
+	op, set := operator, ""
+	for _, prefix := range []string{"ForAnyValue:", "ForAllValues:"} {
+		if strings.HasPrefix(op, prefix) {
+			op, set = strings.TrimPrefix(op, prefix), prefix
+		}
+	}
+	ifExists := strings.HasSuffix(op, "IfExists")
+	op = strings.TrimSuffix(op, "IfExists")
+
+	if op == "Null" {
+		for _, c := range conditions {
+			if strings.EqualFold(c, "true") != (values == nil) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	negated := false
+	if positive, ok := negatedOperators[op]; ok {
+		op, negated = positive, true
+	}
+	compare, ok := conditionOperators[op]
+	if !ok {
+		return false, fmt.Errorf("unsupported condition operator %s", operator)
+	}
+
+	if values == nil {
+		return ifExists || set == "ForAllValues:" || (negated && set == ""), nil
+	}
+	matches := func(v string) bool {
+		for _, c := range conditions {
+			if compare(c, v) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch set {
+	case "ForAllValues:":
+		for _, v := range values {
+			if matches(v) == negated {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "ForAnyValue:":
+		for _, v := range values {
+			if matches(v) != negated {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	for _, v := range values {
+		if matches(v) {
+			return !negated, nil
+		}
+	}
+	return negated, nil
+}
+
+// sortedOperators returns the operators of the conditions, sorted, for the errors to be reproducible
+func sortedOperators(conditions map[string]map[string][]string) []string {
+	operators := make([]string, 0, len(conditions))
+	for o := range conditions {
+		operators = append(operators, o)
+	}
+	sort.Strings(operators)
+	return operators
+}
@@ -0,0 +1,191 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	doc, err := Parse(`{"Version":"2008-10-17","Statement":[
+		{"Sid":"ProdPull","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:root"},"Action":["ecr:BatchCheckLayerAvailability","ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"]},
+		{"Sid":"CiPush","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::222222222222:role/build/ci"},"Action":"ecr:*"},
+		{"Sid":"OrgPull","Effect":"Allow","Principal":"*","Action":"ecr:BatchGetImage","Condition":{"StringEquals":{"aws:PrincipalOrgID":"o-a1b2c3d4e5"}}},
+		{"Sid":"LambdaPull","Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"},"Action":"ecr:BatchGetImage","Condition":{"ArnLike":{"aws:sourceArn":"arn:aws:lambda:*:111111111111:function:*"}}},
+		{"Sid":"DenyDelete","Effect":"Deny","NotPrincipal":{"AWS":"arn:aws:iam::222222222222:role/build/ci"},"Action":"ecr:Delete*"},
+		{"Sid":"DenyHttp","Effect":"Deny","Principal":"*","NotAction":"ecr:Describe*","Condition":{"Bool":{"aws:SecureTransport":"false"}}},
+		{"Sid":"BreakGlass","Effect":"Allow","Principal":{"AWS":"444444444444"},"Action":"ecr:BatchGetImage","Condition":{"DateLessThan":{"aws:CurrentTime":"2026-10-19T14:30:00Z"}}}
+	]}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	expires := time.Date(2026, 10, 19, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc    string
+		request Request
+		want    Evaluation
+	}{
+		{
+			desc:    "Account root allowed",
+			request: Request{Principal: "arn:aws:iam::111111111111:role/deploy", Action: "ecr:BatchGetImage"},
+			want:    Evaluation{Decision: DecisionAllow, Statements: []string{"ProdPull"}},
+		},
+		{
+			desc:    "Action not allowed",
+			request: Request{Principal: "111111111111", Action: "ecr:PutImage"},
+			want:    Evaluation{Decision: DecisionImplicitDeny},
+		},
+		{
+			desc:    "Session of an allowed role",
+			request: Request{Principal: "arn:aws:sts::222222222222:assumed-role/ci/build-42", Action: "ecr:PutImage"},
+			want:    Evaluation{Decision: DecisionAllow, Statements: []string{"CiPush"}},
+		},
+		{
+			desc:    "Other role of the account",
+			request: Request{Principal: "arn:aws:iam::222222222222:role/dev", Action: "ecr:PutImage"},
+			want:    Evaluation{Decision: DecisionImplicitDeny},
+		},
+		{
+			desc:    "Organization",
+			request: Request{Principal: "arn:aws:iam::333333333333:role/app", Action: "ecr:BatchGetImage", Context: map[string][]string{"aws:PrincipalOrgID": {"o-a1b2c3d4e5"}}},
+			want:    Evaluation{Decision: DecisionAllow, Statements: []string{"OrgPull"}},
+		},
+		{
+			desc:    "Other organization",
+			request: Request{Principal: "arn:aws:iam::333333333333:role/app", Action: "ecr:BatchGetImage", Context: map[string][]string{"aws:PrincipalOrgID": {"o-other"}}},
+			want:    Evaluation{Decision: DecisionImplicitDeny},
+		},
+		{
+			desc:    "Service with a matching source",
+			request: Request{Principal: "lambda.amazonaws.com", Action: "ecr:BatchGetImage", Context: map[string][]string{"aws:SourceArn": {"arn:aws:lambda:eu-west-1:111111111111:function:api"}}},
+			want:    Evaluation{Decision: DecisionAllow, Statements: []string{"LambdaPull"}},
+		},
+		{
+			desc:    "Service without source",
+			request: Request{Principal: "lambda.amazonaws.com", Action: "ecr:BatchGetImage"},
+			want:    Evaluation{Decision: DecisionImplicitDeny},
+		},
+		{
+			desc:    "Deny wins",
+			request: Request{Principal: "111111111111", Action: "ecr:BatchGetImage", Context: map[string][]string{"aws:SecureTransport": {"false"}}},
+			want:    Evaluation{Decision: DecisionExplicitDeny, Statements: []string{"DenyHttp"}},
+		},
+		{
+			desc:    "NotPrincipal",
+			request: Request{Principal: "arn:aws:iam::222222222222:role/dev", Action: "ecr:DeleteRepository"},
+			want:    Evaluation{Decision: DecisionExplicitDeny, Statements: []string{"DenyDelete"}},
+		},
+		{
+			desc:    "Excluded by NotPrincipal",
+			request: Request{Principal: "arn:aws:iam::222222222222:role/build/ci", Action: "ecr:DeleteRepository"},
+			want:    Evaluation{Decision: DecisionAllow, Statements: []string{"CiPush"}},
+		},
+		{
+			desc:    "Before the expiry",
+			request: Request{Principal: "444444444444", Action: "ecr:BatchGetImage", Time: expires.Add(-time.Minute)},
+			want:    Evaluation{Decision: DecisionAllow, Statements: []string{"BreakGlass"}},
+		},
+		{
+			desc:    "After the expiry",
+			request: Request{Principal: "444444444444", Action: "ecr:BatchGetImage", Time: expires},
+			want:    Evaluation{Decision: DecisionImplicitDeny},
+		},
+		{
+			desc:    "Current time of the context",
+			request: Request{Principal: "444444444444", Action: "ecr:BatchGetImage", Time: expires, Context: map[string][]string{"aws:CurrentTime": {"2026-10-19T12:00:00Z"}}},
+			want:    Evaluation{Decision: DecisionAllow, Statements: []string{"BreakGlass"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			e, err := doc.Evaluate(test.request)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, e)
+		})
+	}
+}
+
+func TestEvaluateActions(t *testing.T) {
+	doc, err := Parse(`{"Statement":[
+		{"Sid":"Pull","Effect":"Allow","Principal":{"AWS":"111111111111"},"Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"]},
+		{"Sid":"Push","Effect":"Allow","Principal":{"AWS":"111111111111"},"Action":["ecr:PutImage","ecr:InitiateLayerUpload"]}
+	]}`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	e, err := doc.EvaluateActions(Request{Principal: "111111111111"}, ExpandAction("pull", false))
+	assert.NoError(t, err)
+	assert.Equal(t, Evaluation{Decision: DecisionAllow, Statements: []string{"Pull"}}, e)
+	assert.Equal(t, "allow (Pull)", e.String())
+
+	// Some push actions are not allowed
+	e, err = doc.EvaluateActions(Request{Principal: "111111111111"}, ExpandAction("push", false))
+	assert.NoError(t, err)
+	assert.Equal(t, Evaluation{Decision: DecisionImplicitDeny}, e)
+
+	assert.Equal(t, []string{"ecr-public:BatchGetImage", "ecr-public:GetDownloadUrlForLayer"}, ExpandAction("pull", true))
+	assert.Equal(t, []string{"ecr:DescribeImages"}, ExpandAction("ecr:DescribeImages", false))
+}
+
+func TestConditionMatches(t *testing.T) {
+	tests := []struct {
+		desc       string
+		operator   string
+		conditions []string
+		values     []string
+		want       bool
+		wantErr    string
+	}{
+		{desc: "StringEquals", operator: "StringEquals", conditions: []string{"a", "b"}, values: []string{"b"}, want: true},
+		{desc: "StringEquals is case sensitive", operator: "StringEquals", conditions: []string{"a"}, values: []string{"A"}, want: false},
+		{desc: "StringEquals without key", operator: "StringEquals", conditions: []string{"a"}, want: false},
+		{desc: "StringEqualsIfExists without key", operator: "StringEqualsIfExists", conditions: []string{"a"}, want: true},
+		{desc: "StringNotEquals", operator: "StringNotEquals", conditions: []string{"a"}, values: []string{"a"}, want: false},
+		{desc: "StringNotEquals without key", operator: "StringNotEquals", conditions: []string{"a"}, want: true},
+		{desc: "StringEqualsIgnoreCase", operator: "StringEqualsIgnoreCase", conditions: []string{"a"}, values: []string{"A"}, want: true},
+		{desc: "StringLike", operator: "StringLike", conditions: []string{"o-*"}, values: []string{"o-a1b2"}, want: true},
+		{desc: "StringNotLike", operator: "StringNotLike", conditions: []string{"o-*"}, values: []string{"o-a1b2"}, want: false},
+		{desc: "ArnLike", operator: "ArnLike", conditions: []string{"arn:aws:iam::*:role/ci-*"}, values: []string{"arn:aws:iam::111111111111:role/ci-build"}, want: true},
+		{desc: "ArnNotLike", operator: "ArnNotLike", conditions: []string{"arn:aws:iam::*:role/ci-*"}, values: []string{"arn:aws:iam::111111111111:role/dev"}, want: true},
+		{desc: "Bool", operator: "Bool", conditions: []string{"true"}, values: []string{"True"}, want: true},
+		{desc: "Null without key", operator: "Null", conditions: []string{"true"}, want: true},
+		{desc: "Null with key", operator: "Null", conditions: []string{"true"}, values: []string{"a"}, want: false},
+		{desc: "ForAnyValue", operator: "ForAnyValue:StringEquals", conditions: []string{"a"}, values: []string{"b", "a"}, want: true},
+		{desc: "ForAnyValue without key", operator: "ForAnyValue:StringEquals", conditions: []string{"a"}, want: false},
+		{desc: "ForAllValues", operator: "ForAllValues:StringEquals", conditions: []string{"a", "b"}, values: []string{"b", "c"}, want: false},
+		{desc: "ForAllValues without key", operator: "ForAllValues:StringEquals", conditions: []string{"a"}, want: true},
+		{desc: "NumericEquals", operator: "NumericEquals", conditions: []string{"10"}, values: []string{"10.0"}, want: true},
+		{desc: "NumericNotEquals", operator: "NumericNotEquals", conditions: []string{"10"}, values: []string{"10"}, want: false},
+		{desc: "NumericLessThan", operator: "NumericLessThan", conditions: []string{"1"}, values: []string{"0"}, want: true},
+		{desc: "NumericLessThanEquals", operator: "NumericLessThanEquals", conditions: []string{"1"}, values: []string{"1"}, want: true},
+		{desc: "NumericGreaterThan", operator: "NumericGreaterThan", conditions: []string{"1"}, values: []string{"1"}, want: false},
+		{desc: "NumericGreaterThanEquals", operator: "NumericGreaterThanEquals", conditions: []string{"1"}, values: []string{"2"}, want: true},
+		{desc: "Numeric with a value which is not a number", operator: "NumericLessThan", conditions: []string{"1"}, values: []string{"a"}, want: false},
+		{desc: "NumericLessThanIfExists without key", operator: "NumericLessThanIfExists", conditions: []string{"1"}, want: true},
+		{desc: "DateEquals in another format", operator: "DateEquals", conditions: []string{"2026-10-19T14:30:00Z"}, values: []string{"1792420200"}, want: true},
+		{desc: "DateNotEquals", operator: "DateNotEquals", conditions: []string{"2026-10-19T14:30:00Z"}, values: []string{"2026-10-19T16:30:00+02:00"}, want: false},
+		{desc: "DateLessThan", operator: "DateLessThan", conditions: []string{"2026-10-19T14:30:00Z"}, values: []string{"2026-10-19T14:29:59Z"}, want: true},
+		{desc: "DateLessThan at the date", operator: "DateLessThan", conditions: []string{"2026-10-19T14:30:00Z"}, values: []string{"2026-10-19T14:30:00Z"}, want: false},
+		{desc: "DateLessThanEquals", operator: "DateLessThanEquals", conditions: []string{"2026-10-19T14:30:00Z"}, values: []string{"2026-10-19T14:30:00Z"}, want: true},
+		{desc: "DateGreaterThan a day", operator: "DateGreaterThan", conditions: []string{"2026-10-19"}, values: []string{"2026-10-19T00:00:01Z"}, want: true},
+		{desc: "DateGreaterThanEquals", operator: "DateGreaterThanEquals", conditions: []string{"2026-10-19T14:30:00Z"}, values: []string{"2026-10-19T14:00:00Z"}, want: false},
+		{desc: "Date with a value which is not a date", operator: "DateGreaterThan", conditions: []string{"2026-10-19"}, values: []string{"tomorrow"}, want: false},
+		{desc: "Unsupported operator", operator: "IpAddress", conditions: []string{"10.0.0.0/8"}, values: []string{"10.0.0.1"}, wantErr: "unsupported condition operator IpAddress"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			ok, err := conditionMatches(test.operator, test.conditions, test.values)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, ok)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// rawDocument is a policy whose statements are kept as written
+type rawDocument struct {
+	keys       map[string]json.RawMessage // Keys of the document other than Statement
+	statements []json.RawMessage
+}
+
+// parseRaw returns the document of the policy text, a single statement being a list of one statement
+func parseRaw(text string) (rawDocument, error) {
+	var doc rawDocument
+	if err := json.Unmarshal([]byte(text), &doc.keys); err != nil {
+		return doc, err
+	}
+	s := doc.keys["Statement"]
+	delete(doc.keys, "Statement")
+	switch {
+	case len(s) == 0 || string(s) == "null":
+	case s[0] == '{':
+		doc.statements = []json.RawMessage{s}
+	default:
+		if err := json.Unmarshal(s, &doc.statements); err != nil {
+			return doc, fmt.Errorf("Statement: %v", err)
+		}
+	}
+	return doc, nil
+}
+
+// sid returns the Sid of a statement, empty if it has none
+func sid(statement json.RawMessage) string {
+	var s struct {
+		Sid string `json:"Sid"`
+	}
+	json.Unmarshal(statement, &s)
+	return s.Sid
+}
+
+// CheckManaged returns an error if any statement of the configured policy is not managed: its Sid must start with prefix
+func CheckManaged(configured, prefix string) error {
+	doc, err := parseRaw(configured)
+	if err != nil {
+		return err
+	}
+	for i, s := range doc.statements {
+		if !strings.HasPrefix(sid(s), prefix) {
+			return fmt.Errorf("statement %d is not managed: its Sid must start with %q, got %q", i, prefix, sid(s))
+		}
+	}
+	return nil
+}
+
+// Merge returns the policy made of the statements of the configured policy, all managed, followed by the statements of the
+// current policy not managed, kept as they are. The managed statements of the current policy are replaced
+// A statement is managed if its Sid starts with prefix. The other keys of the document, like Version, are the configured ones
+// It returns an empty policy when no statement is left, since ECR rejects a policy without statement: the policy must then be
+// deleted. It returns an error if a configured statement is not managed, or if an unmanaged statement of the current policy
+// conflicts with a managed one: both having the same Sid, case insensitively, the merged policy would be rejected
+func Merge(current, configured, prefix string) (string, error) {
+	if err := CheckManaged(configured, prefix); err != nil {
+		return "", err
+	}
+	doc, err := parseRaw(configured)
+	if err != nil {
+		return "", err
+	}
+	managed := make(map[string]bool, len(doc.statements))
+	for _, s := range doc.statements {
+		managed[strings.ToLower(sid(s))] = true
+	}
+
+	statements := doc.statements
+	if current != "" {
+		live, err := parseRaw(current)
+		if err != nil {
+			return "", fmt.Errorf("current policy: %v", err)
+		}
+		conflicts := []string{}
+		for _, s := range live.statements {
+			id := sid(s)
+			switch {
+			case strings.HasPrefix(id, prefix):
+			case id != "" && managed[strings.ToLower(id)]:
+				conflicts = append(conflicts, fmt.Sprintf("%q", id))
+			default:
+				statements = append(statements, s)
+			}
+		}
+		if len(conflicts) > 0 {
+			return "", fmt.Errorf("conflict: the unmanaged statements %s of the current policy have the Sid of a managed statement", strings.Join(conflicts, ", "))
+		}
+	}
+
+	if len(statements) == 0 {
+		return "", nil
+	}
+	return doc.marshal(statements)
+}
+
+// marshal returns the indented text of the document with the given statements instead of its own
+func (d rawDocument) marshal(statements []json.RawMessage) (string, error) {
+	keys := make(map[string]json.RawMessage, len(d.keys)+1)
+	for k, v := range d.keys {
+		keys[k] = v
+	}
+	if statements == nil {
+		statements = []json.RawMessage{}
+	}
+	b, err := json.Marshal(statements)
+	if err != nil {
+		return "", err
+	}
+	keys["Statement"] = b
+	text, err := json.MarshalIndent(keys, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
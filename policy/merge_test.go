@@ -0,0 +1,87 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	configured := `{"Version":"2008-10-17","Statement":[
+		{"Sid":"ecrgo-Pull","Effect":"Allow","Principal":{"AWS":"111111111111"},"Action":"ecr:BatchGetImage"}
+	]}`
+
+	tests := []struct {
+		desc       string
+		current    string
+		configured string
+		want       string
+		wantErr    string
+	}{
+		{
+			desc:       "No current policy",
+			configured: configured,
+			want:       "{\n    \"Statement\": [\n        {\n            \"Sid\": \"ecrgo-Pull\",\n            \"Effect\": \"Allow\",\n            \"Principal\": {\n                \"AWS\": \"111111111111\"\n            },\n            \"Action\": \"ecr:BatchGetImage\"\n        }\n    ],\n    \"Version\": \"2008-10-17\"\n}",
+		},
+		{
+			desc: "Unmanaged statements kept, managed ones replaced",
+			current: `{"Version":"2012-10-17","Statement":[
+				{"Sid":"ecrgo-Old","Effect":"Allow","Principal":"*","Action":"ecr:*"},
+				{"Sid":"TemporaryDebug","Effect":"Allow","Principal":{"AWS":"222222222222"},"Action":"ecr:*"},
+				{"Effect":"Deny","Principal":"*","Action":"ecr:DeleteRepository"}
+			]}`,
+			configured: configured,
+			want: "{\n    \"Statement\": [\n" +
+				"        {\n            \"Sid\": \"ecrgo-Pull\",\n            \"Effect\": \"Allow\",\n            \"Principal\": {\n                \"AWS\": \"111111111111\"\n            },\n            \"Action\": \"ecr:BatchGetImage\"\n        },\n" +
+				"        {\n            \"Sid\": \"TemporaryDebug\",\n            \"Effect\": \"Allow\",\n            \"Principal\": {\n                \"AWS\": \"222222222222\"\n            },\n            \"Action\": \"ecr:*\"\n        },\n" +
+				"        {\n            \"Effect\": \"Deny\",\n            \"Principal\": \"*\",\n            \"Action\": \"ecr:DeleteRepository\"\n        }\n" +
+				"    ],\n    \"Version\": \"2008-10-17\"\n}",
+		},
+		{
+			desc:       "All managed statements removed",
+			current:    `{"Statement":{"Sid":"ecrgo-Old","Effect":"Allow","Principal":"*","Action":"ecr:*"}}`,
+			configured: `{"Version":"2008-10-17","Statement":[]}`,
+			want:       "",
+		},
+		{
+			desc:       "No statement without current policy",
+			configured: `{"Version":"2008-10-17","Statement":[]}`,
+			want:       "",
+		},
+		{
+			desc:       "Only unmanaged statements left",
+			current:    `{"Statement":[{"Sid":"ecrgo-Old","Effect":"Allow","Principal":"*","Action":"ecr:*"},{"Sid":"Debug","Effect":"Allow","Principal":"*","Action":"ecr:*"}]}`,
+			configured: `{"Version":"2008-10-17","Statement":[]}`,
+			want:       "{\n    \"Statement\": [\n        {\n            \"Sid\": \"Debug\",\n            \"Effect\": \"Allow\",\n            \"Principal\": \"*\",\n            \"Action\": \"ecr:*\"\n        }\n    ],\n    \"Version\": \"2008-10-17\"\n}",
+		},
+		{
+			desc:       "Conflict",
+			current:    `{"Statement":[{"Sid":"ECRGO-pull","Effect":"Allow","Principal":"*","Action":"ecr:*"}]}`,
+			configured: configured,
+			wantErr:    `conflict: the unmanaged statements "ECRGO-pull" of the current policy have the Sid of a managed statement`,
+		},
+		{
+			desc:       "Unmanaged configured statement",
+			configured: `{"Statement":[{"Sid":"Pull","Effect":"Allow"}]}`,
+			wantErr:    `statement 0 is not managed: its Sid must start with "ecrgo-", got "Pull"`,
+		},
+		{
+			desc:       "Invalid current policy",
+			current:    `{`,
+			configured: configured,
+			wantErr:    "current policy: unexpected end of JSON input",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			merged, err := Merge(test.current, test.configured, "ecrgo-")
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, merged)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package policy
+
+import (
+	"sort"
+	"strings"
+)
+
+// Types of the principals a statement is restricted to by its organization conditions
+const (
+	PrincipalOrganization = "organization"
+	PrincipalUnit         = "ou" // Organizational unit
+)
+
+// Condition keys of the organization of the caller
+const (
+	KeyPrincipalOrgID    = "aws:PrincipalOrgID"
+	KeyPrincipalOrgPaths = "aws:PrincipalOrgPaths"
+)
+
+// organizationScope returns the organizations or organizational units a statement is restricted to, if its only condition is
+// an aws:PrincipalOrgID or aws:PrincipalOrgPaths one. It returns nil otherwise
+// An organization path, like o-a1b2c3d4e5/r-ab12/ou-ab12-11111111/*, restricts the statement to its last organizational
+// unit, or to its organization if it has none
+func (s Statement) organizationScope() []Principal {
+	if len(s.Conditions) != 1 {
+		return nil
+	}
+	for operator, keys := range s.Conditions {
+		if len(keys) != 1 {
+			return nil
+		}
+		switch strings.TrimPrefix(operator, "ForAnyValue:") {
+		case "StringEquals", "StringLike":
+		default:
+			return nil
+		}
+		for key, values := range keys {
+			scope := []Principal{}
+			for _, v := range values {
+				var p Principal
+				switch {
+				case strings.EqualFold(key, KeyPrincipalOrgID) && !strings.ContainsAny(v, "*?"):
+					p = Principal{Type: PrincipalOrganization, ID: v}
+				case strings.EqualFold(key, KeyPrincipalOrgPaths) && strings.HasPrefix(operator, "ForAnyValue:"):
+					p = pathScope(v)
+				}
+				if p.Type == "" {
+					return nil
+				}
+				scope = append(scope, p)
+			}
+			return scope
+		}
+	}
+	return nil
+}
+
+// pathScope returns the organizational unit or organization an organization path is restricted to
+// It returns the zero Principal if the path names neither
+func pathScope(path string) Principal {
+	p := Principal{}
+	for _, segment := range strings.Split(path, "/") {
+		switch {
+		case strings.HasPrefix(segment, "ou-") && !strings.ContainsAny(segment, "*?"):
+			p = Principal{Type: PrincipalUnit, ID: segment}
+		case strings.HasPrefix(segment, "o-") && !strings.ContainsAny(segment, "*?") && p.Type == "":
+			p = Principal{Type: PrincipalOrganization, ID: segment}
+		}
+	}
+	return p
+}
+
+// inOrganizationScope returns whether the statement applies to an organization or organizational unit principal,
+// and whether only under conditions. A statement restricted to other organizations does not apply
+func (s Statement) inOrganizationScope(p Principal) (applies bool, conditional bool) {
+	scope := s.organizationScope()
+	if scope == nil {
+		return true, s.HasConditions()
+	}
+	for _, o := range scope {
+		if o == p {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// ExpandOrganizations returns the grants with the ones of the organizations and organizational units replaced by grants
+// to their accounts, given by members. The ones members does not know are kept
+// An account granted a permission both directly and by its organization gets the unconditional grant, if any
+func ExpandOrganizations(grants []Grant, members map[string][]string) []Grant {
+	expanded := []Grant{}
+	index := make(map[Grant]int)
+	add := func(g Grant) {
+		key := Grant{Principal: g.Principal, Permission: g.Permission}
+		if i, ok := index[key]; ok {
+			expanded[i].Conditional = expanded[i].Conditional && g.Conditional
+			return
+		}
+		index[key] = len(expanded)
+		expanded = append(expanded, g)
+	}
+	for _, g := range grants {
+		accounts, ok := members[g.Principal.ID]
+		if !ok || (g.Principal.Type != PrincipalOrganization && g.Principal.Type != PrincipalUnit) {
+			add(g)
+			continue
+		}
+		for _, a := range accounts {
+			add(Grant{Principal: Principal{Type: PrincipalAccount, ID: a, Account: a}, Permission: g.Permission, Conditional: g.Conditional})
+		}
+	}
+	sortGrants(expanded)
+	return expanded
+}
+
+// sortGrants will sort the grants by principal type, principal and permission
+func sortGrants(grants []Grant) {
+	sort.SliceStable(grants, func(i, j int) bool {
+		a, b := grants[i], grants[j]
+		if a.Principal.Type != b.Principal.Type {
+			return typeOrder(a.Principal.Type) < typeOrder(b.Principal.Type)
+		}
+		if a.Principal.ID != b.Principal.ID {
+			return a.Principal.ID < b.Principal.ID
+		}
+		return a.Permission < b.Permission
+	})
+}
@@ -0,0 +1,80 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrganizationScope(t *testing.T) {
+	tests := []struct {
+		desc   string
+		policy string
+		want   []Principal
+	}{
+		{
+			desc:   "Organization",
+			policy: `{"Statement":{"Effect":"Allow","Principal":"*","Condition":{"StringEquals":{"aws:principalorgid":["o-a1b2c3d4e5","o-z9y8x7w6v5"]}}}}`,
+			want:   []Principal{{Type: PrincipalOrganization, ID: "o-a1b2c3d4e5"}, {Type: PrincipalOrganization, ID: "o-z9y8x7w6v5"}},
+		},
+		{
+			desc:   "Organization paths",
+			policy: `{"Statement":{"Effect":"Allow","Principal":"*","Condition":{"ForAnyValue:StringLike":{"aws:PrincipalOrgPaths":["*/ou-ab12-11111111/*","o-a1b2c3d4e5/*"]}}}}`,
+			want:   []Principal{{Type: PrincipalUnit, ID: "ou-ab12-11111111"}, {Type: PrincipalOrganization, ID: "o-a1b2c3d4e5"}},
+		},
+		{
+			desc:   "Organization paths without ForAnyValue",
+			policy: `{"Statement":{"Effect":"Allow","Principal":"*","Condition":{"StringLike":{"aws:PrincipalOrgPaths":"o-a1b2c3d4e5/*"}}}}`,
+		},
+		{
+			desc:   "Organization wildcard",
+			policy: `{"Statement":{"Effect":"Allow","Principal":"*","Condition":{"StringLike":{"aws:PrincipalOrgID":"o-*"}}}}`,
+		},
+		{
+			desc:   "Other condition",
+			policy: `{"Statement":{"Effect":"Allow","Principal":"*","Condition":{"StringEquals":{"aws:PrincipalOrgID":"o-a1b2c3d4e5"},"Bool":{"aws:SecureTransport":"true"}}}}`,
+		},
+		{
+			desc:   "No condition",
+			policy: `{"Statement":{"Effect":"Allow","Principal":"*"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			doc, err := Parse(test.policy)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, test.want, doc.Statements[0].organizationScope())
+		})
+	}
+}
+
+func TestExpandOrganizations(t *testing.T) {
+	organization := Principal{Type: PrincipalOrganization, ID: "o-a1b2c3d4e5"}
+	unit := Principal{Type: PrincipalUnit, ID: "ou-ab12-11111111"}
+	unknown := Principal{Type: PrincipalUnit, ID: "ou-ab12-22222222"}
+	account1 := Principal{Type: PrincipalAccount, ID: "111111111111", Account: "111111111111"}
+	account2 := Principal{Type: PrincipalAccount, ID: "222222222222", Account: "222222222222"}
+	members := map[string][]string{
+		"o-a1b2c3d4e5":     {"111111111111", "222222222222"},
+		"ou-ab12-11111111": {"222222222222"},
+	}
+
+	grants := []Grant{
+		{Principal: organization, Permission: PermissionPull},
+		{Principal: unit, Permission: PermissionPush},
+		{Principal: unknown, Permission: PermissionPull},
+		{Principal: account1, Permission: PermissionPull, Conditional: true},
+		{Principal: account1, Permission: PermissionPush, Conditional: true},
+	}
+	assert.Equal(t, []Grant{
+		{Principal: unknown, Permission: PermissionPull},
+		{Principal: account1, Permission: PermissionPull},
+		{Principal: account1, Permission: PermissionPush, Conditional: true},
+		{Principal: account2, Permission: PermissionPull},
+		{Principal: account2, Permission: PermissionPush},
+	}, ExpandOrganizations(grants, members))
+	assert.Equal(t, grants[:1], ExpandOrganizations(grants[:1], nil))
+}
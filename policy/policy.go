@@ -0,0 +1,239 @@
+// Package policy parses the repository policies and answers who they grant access to, without calling AWS
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Effects of a statement
+const (
+	EffectAllow = "Allow"
+	EffectDeny  = "Deny"
+)
+
+// Document is a repository policy
+type Document struct {
+	Version    string
+	Statements []Statement
+}
+
+// Statement is a statement of a repository policy
+// The principals, actions and conditions are in their expanded form: a single string is a list of one element
+type Statement struct {
+	Sid           string
+	Effect        string
+	Principals    map[string][]string // Principals by type: AWS, Service or Federated. "*" alone is {"AWS": ["*"]}
+	NotPrincipals map[string][]string
+	Actions       []string
+	NotActions    []string
+	Resources     []string // Resources of the statement. Empty in most repository policies, where it is the repository itself
+	NotResources  []string
+	Conditions    map[string]map[string][]string // Values by condition key, by operator
+}
+
+// rawStatement is a statement as written in a policy
+type rawStatement struct {
+	Sid          string                                `json:"Sid"`
+	Effect       string                                `json:"Effect"`
+	Principal    json.RawMessage                       `json:"Principal"`
+	NotPrincipal json.RawMessage                       `json:"NotPrincipal"`
+	Action       stringList                            `json:"Action"`
+	NotAction    stringList                            `json:"NotAction"`
+	Resource     stringList                            `json:"Resource"`
+	NotResource  stringList                            `json:"NotResource"`
+	Condition    map[string]map[string]json.RawMessage `json:"Condition"`
+}
+
+// stringList is a list of strings written as a single string or as a list
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.New("must be a string or a list of strings")
+	}
+	*l = list
+	return nil
+}
+
+// Parse returns the document of the given policy text
+// It returns an error if the policy is not valid json, or if a statement is not a valid statement
+func Parse(text string) (Document, error) {
+	var raw struct {
+		Version   string          `json:"Version"`
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return Document{}, err
+	}
+
+	var rawStatements []rawStatement
+	if len(raw.Statement) > 0 && raw.Statement[0] == '{' {
+		var s rawStatement
+		if err := json.Unmarshal(raw.Statement, &s); err != nil {
+			return Document{}, fmt.Errorf("Statement: %v", err)
+		}
+		rawStatements = []rawStatement{s}
+	} else if len(raw.Statement) > 0 {
+		if err := json.Unmarshal(raw.Statement, &rawStatements); err != nil {
+			return Document{}, fmt.Errorf("Statement: %v", err)
+		}
+	}
+
+	doc := Document{Version: raw.Version}
+	for i, r := range rawStatements {
+		s, err := r.statement()
+		if err != nil {
+			return Document{}, fmt.Errorf("Statement %d: %v", i, err)
+		}
+		doc.Statements = append(doc.Statements, s)
+	}
+	return doc, nil
+}
+
+// statement returns the expanded form of the statement
+func (r rawStatement) statement() (Statement, error) {
+	s := Statement{Sid: r.Sid, Effect: r.Effect, Actions: r.Action, NotActions: r.NotAction, Resources: r.Resource, NotResources: r.NotResource}
+	if s.Effect != EffectAllow && s.Effect != EffectDeny {
+		return s, fmt.Errorf("Effect must be Allow or Deny, got %q", s.Effect)
+	}
+	var err error
+	if s.Principals, err = principals(r.Principal); err != nil {
+		return s, fmt.Errorf("Principal %v", err)
+	}
+	if s.NotPrincipals, err = principals(r.NotPrincipal); err != nil {
+		return s, fmt.Errorf("NotPrincipal %v", err)
+	}
+	if len(r.Condition) > 0 {
+		s.Conditions = make(map[string]map[string][]string)
+		for operator, keys := range r.Condition {
+			s.Conditions[operator] = make(map[string][]string)
+			for k, v := range keys {
+				values, err := conditionValues(v)
+				if err != nil {
+					return s, fmt.Errorf("Condition %s %s %v", operator, k, err)
+				}
+				s.Conditions[operator][k] = values
+			}
+		}
+	}
+	return s, nil
+}
+
+// principals returns the principals by type of a Principal or NotPrincipal element
+func principals(b json.RawMessage) (map[string][]string, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		if s != "*" {
+			return nil, fmt.Errorf("must be \"*\" or an object, got %q", s)
+		}
+		return map[string][]string{"AWS": {"*"}}, nil
+	}
+	var m map[string]stringList
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.New("must be \"*\" or an object of strings or lists of strings")
+	}
+	p := make(map[string][]string, len(m))
+	for k, v := range m {
+		p[k] = v
+	}
+	return p, nil
+}
+
+// conditionValues returns the values of a condition key as strings, whatever their json type
+func conditionValues(b json.RawMessage) ([]string, error) {
+	var values []interface{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+		values = []interface{}{v}
+	}
+	l := make([]string, len(values))
+	for i, v := range values {
+		switch t := v.(type) {
+		case string:
+			l[i] = t
+		case bool, float64:
+			l[i] = fmt.Sprint(t)
+		default:
+			return nil, errors.New("must be a string, a number, a boolean or a list of them")
+		}
+	}
+	return l, nil
+}
+
+// HasConditions returns true if the statement only applies under conditions
+func (s Statement) HasConditions() bool {
+	return len(s.Conditions) > 0
+}
+
+// MatchesAction returns true if the statement applies to the given action
+// The actions are compared case insensitively, with the * and ? wildcards
+func (s Statement) MatchesAction(action string) bool {
+	if len(s.NotActions) > 0 {
+		return !matchesAny(s.NotActions, action)
+	}
+	return matchesAny(s.Actions, action)
+}
+
+// matchesAny returns true if the value matches any of the patterns, case insensitively
+func matchesAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if Wildcard(strings.ToLower(p), strings.ToLower(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wildcard returns true if the value matches the pattern, where * matches any sequence of characters and ? any single character
+func Wildcard(pattern, value string) bool {
+	p, v := []rune(pattern), []rune(value)
+	// Position of the last * and of the value it matched from, to backtrack to
+	star, match := -1, 0
+	i, j := 0, 0
+	for j < len(v) {
+		switch {
+		case i < len(p) && (p[i] == '?' || p[i] == v[j]):
+			i++
+			j++
+		case i < len(p) && p[i] == '*':
+			star, match = i, j
+			i++
+		case star >= 0:
+			i = star + 1
+			match++
+			j = match
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// sortedKeys returns the keys of the map, sorted
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		desc    string
+		text    string
+		want    Document
+		wantErr string
+	}{
+		{
+			desc: "Single statement and strings",
+			text: `{"Version":"2008-10-17","Statement":{"Sid":"A","Effect":"Allow","Principal":"*","Action":"ecr:BatchGetImage"}}`,
+			want: Document{Version: "2008-10-17", Statements: []Statement{
+				{Sid: "A", Effect: EffectAllow, Principals: map[string][]string{"AWS": {"*"}}, Actions: []string{"ecr:BatchGetImage"}},
+			}},
+		},
+		{
+			desc: "Lists, NotPrincipal and conditions",
+			text: `{"Statement":[{"Effect":"Deny","NotPrincipal":{"AWS":["111111111111","arn:aws:iam::222222222222:root"]},"NotAction":["ecr:Get*"],"Condition":{"Bool":{"aws:SecureTransport":false}}}]}`,
+			want: Document{Statements: []Statement{
+				{
+					Effect:        EffectDeny,
+					NotPrincipals: map[string][]string{"AWS": {"111111111111", "arn:aws:iam::222222222222:root"}},
+					NotActions:    []string{"ecr:Get*"},
+					Conditions:    map[string]map[string][]string{"Bool": {"aws:SecureTransport": {"false"}}},
+				},
+			}},
+		},
+		{
+			desc: "No statement",
+			text: `{"Version":"2008-10-17","Statement":[]}`,
+			want: Document{Version: "2008-10-17"},
+		},
+		{
+			desc:    "Invalid effect",
+			text:    `{"Statement":[{"Effect":"allow"}]}`,
+			wantErr: `Statement 0: Effect must be Allow or Deny, got "allow"`,
+		},
+		{
+			desc:    "Invalid principal",
+			text:    `{"Statement":[{"Effect":"Allow","Principal":"111111111111"}]}`,
+			wantErr: `Statement 0: Principal must be "*" or an object, got "111111111111"`,
+		},
+		{
+			desc:    "Invalid json",
+			text:    `{`,
+			wantErr: "unexpected end of JSON input",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			doc, err := Parse(test.text)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, doc)
+		})
+	}
+}
+
+func TestMatchesAction(t *testing.T) {
+	s := Statement{Actions: []string{"ecr:Get*", "ecr:BatchGetImage"}}
+	assert.True(t, s.MatchesAction("ecr:GetDownloadUrlForLayer"))
+	assert.True(t, s.MatchesAction("ECR:batchgetimage"))
+	assert.False(t, s.MatchesAction("ecr:PutImage"))
+	assert.False(t, s.MatchesAction("ecr-public:GetDownloadUrlForLayer"))
+
+	s = Statement{NotActions: []string{"ecr:Put*"}}
+	assert.True(t, s.MatchesAction("ecr:BatchGetImage"))
+	assert.False(t, s.MatchesAction("ecr:PutImage"))
+}
+
+func TestWildcard(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		want           bool
+	}{
+		{"*", "", true},
+		{"ecr:*", "ecr:PutImage", true},
+		{"ecr:*Image", "ecr:BatchGetImage", true},
+		{"ecr:*Image", "ecr:ImageScan", false},
+		{"ecr:Put?mage", "ecr:PutImage", true},
+		{"ecr:Put?mage", "ecr:Putmage", false},
+		{"a*b*c", "aXXbYYc", true},
+		{"a*b*c", "aXXbYY", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, Wildcard(test.pattern, test.value), "%s %s", test.pattern, test.value)
+	}
+}
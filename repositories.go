@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/lescactus/ecr-go/configuration"
+	"github.com/lescactus/ecr-go/ecrupdater"
+	"github.com/lescactus/ecr-go/policy"
+	"github.com/lescactus/ecr-go/summary"
+	"go.uber.org/zap"
+)
+
+// repositories are the configured repositories by location, with the accounts and targets they use
+type repositories struct {
+	configs        map[location][]configuration.ConfigurationFile
+	accounts       map[string]configuration.Account
+	targets        configuration.Targets
+	sessionRegions map[string]string // Region of the session of each target, by name. Empty if the session has none
+	filter         configuration.Filter
+	skipped        int // Number of configuration files not selected by the filter
+}
+
+// loadRepositories will load all the configuration files of the configuration directory selected by the filter, with their json policy
+// All the files are read and validated, even if they are not selected, so that a repository is never duplicated by a file
+// left out of the filter
+// The account of a configuration file is its own, or the one of its directory. In merge mode, all its statements must be managed
+// It returns the first error encountered, including duplicated repositories in a location
+func loadRepositories(logger *zap.Logger) (*repositories, error) {
+	r := &repositories{
+		configs:        make(map[location][]configuration.ConfigurationFile),
+		accounts:       make(map[string]configuration.Account),
+		sessionRegions: make(map[string]string),
+	}
+	defaultRegions := appconfig.Config.AWS.Regions
+	if len(defaultRegions) == 0 {
+		defaultRegions = []string{""}
+	}
+	selector, err := configuration.ParseSelector(appconfig.Config.Filter.Selector)
+	if err != nil {
+		return nil, err
+	}
+	r.filter = configuration.Filter{
+		Only:     appconfig.Config.Filter.Only,
+		Exclude:  appconfig.Config.Filter.Exclude,
+		Files:    appconfig.Config.Filter.Files,
+		Selector: selector,
+	}
+
+	// Look recursively for all yaml configuration files
+	yamlConfigurationFilesList, err := configuration.GetYamlConfigurationFiles(appconfig.Config.Application.ConfigDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the configuration files: %v", err)
+	}
+	directoryAccounts, err := configuration.LoadDirectoryAccounts(appconfig.Config.Application.ConfigDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the accounts: %v", err)
+	}
+	r.targets, err = loadTargets()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the targets: %v", err)
+	}
+	var aliases *configuration.AccountAliases
+	if appconfig.Config.AWS.AccountsFile != "" {
+		aliases, err = configuration.LoadAccountAliases(appconfig.Config.AWS.AccountsFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the account aliases: %v", err)
+		}
+	}
+
+	// For each yaml configuration file, load the associated json policy defined in ConfigurationFile.RepositoryPolicyFile
+	// in ConfigurationFile.RepositoryPolicy
+	// Ensure there is no duplicates in a region of a target among all the files, then keep the ones selected by the filter
+	all := make(map[location][]configuration.ConfigurationFile)
+	for _, yamlFile := range yamlConfigurationFilesList {
+		c, err := loadConfigurationFile(logger, yamlFile, aliases)
+		if err != nil {
+			return nil, err
+		}
+		// In merge mode, all the configured statements are managed
+		if prefix := appconfig.Config.Policy.ManagedSidPrefix; prefix != "" {
+			if err := policy.CheckManaged(string(c.RepositoryPolicy), prefix); err != nil {
+				return nil, fmt.Errorf("Loading %s: policy %v", yamlFile, err)
+			}
+		}
+		regions := defaultRegions
+		if c.Target != "" {
+			t, ok := r.targets[c.Target]
+			if !ok {
+				return nil, fmt.Errorf("Unknown target %s in %s", c.Target, yamlFile)
+			}
+			if t.Region != "" {
+				regions = []string{t.Region}
+			}
+		}
+		// Without a partition in the accounts file, the ARNs of the accounts are in the partition of the regions of the repository
+		if aliases == nil || aliases.Partition == "" {
+			if c, err = r.loadInPartition(logger, yamlFile, aliases, c, c.TargetRegions(regions)); err != nil {
+				return nil, err
+			}
+		}
+		if c.Account == nil {
+			c.Account = directoryAccounts.For(yamlFile)
+		}
+		accountID := ""
+		if c.Account != nil {
+			if a, ok := r.accounts[c.Account.ID]; ok && a != *c.Account {
+				return nil, fmt.Errorf("Account %s is defined with a different role in %s", c.Account.ID, yamlFile)
+			}
+			r.accounts[c.Account.ID] = *c.Account
+			accountID = c.Account.ID
+		}
+		selected := r.filter.MatchesFile(yamlFile) && r.filter.Matches(c)
+		if !selected {
+			logger.Debug(fmt.Sprintf("%s - Repository %s not selected by the filter", yamlFile, c.RepositoryName))
+			r.skipped++
+		}
+		for _, region := range c.TargetRegions(regions) {
+			// A repository is identified by its target, region, type, registry and name, whatever the account managing it
+			l := location{target: c.Target, account: accountID, region: region, public: c.IsPublic()}
+			for other, ys := range all {
+				if other.target != l.target || other.region != l.region || other.public != l.public {
+					continue
+				}
+				for _, y := range ys {
+					if y.RepositoryName == c.RepositoryName && y.Registry() == c.Registry() {
+						return nil, fmt.Errorf("Duplicate RepositoryName %s in registry %s of %s found in %s", c.RepositoryName, registryName(c.Registry()), l, yamlFile)
+					}
+				}
+			}
+			all[l] = append(all[l], c)
+			if selected {
+				r.configs[l] = append(r.configs[l], c)
+			}
+		}
+	}
+
+	if !r.filter.IsEmpty() {
+		logger.Info(fmt.Sprintf("%d configuration files selected by the filter, %d skipped", len(yamlConfigurationFilesList)-r.skipped, r.skipped))
+		if r.count() == 0 {
+			logger.Warn("No repository selected by the filter, nothing to do")
+		}
+	}
+
+	return r, nil
+}
+
+// loadConfigurationFile will load a configuration file with the given aliases and the policy settings of the application
+// configuration. It returns the loaded file, or an error if it is invalid
+func loadConfigurationFile(logger *zap.Logger, yamlFile string, aliases *configuration.AccountAliases) (configuration.ConfigurationFile, error) {
+	c := configuration.NewConfigurationFile(logger)
+	c.Aliases = aliases
+	c.SidPrefix = appconfig.Config.Policy.ManagedSidPrefix
+	c.ExpiryRequired = appconfig.Config.Policy.ExpiryRequired
+	if err := c.LoadYamlConfiguration(yamlFile); err != nil {
+		return c, fmt.Errorf("Loading %s: %v", yamlFile, err)
+	}
+	return c, nil
+}
+
+// loadInPartition will load again the configuration file c, loaded in the partition of the aliases, in the partition of
+// the given regions of the repository. An empty region is the region of the session of its target
+// It returns c if the regions are all in its partition or unknown, or an error if the policy differs between the partitions
+// of the regions: the file must then be split by partition
+func (r *repositories) loadInPartition(logger *zap.Logger, yamlFile string, aliases *configuration.AccountAliases, c configuration.ConfigurationFile, regions []string) (configuration.ConfigurationFile, error) {
+	partitions := []string{}
+	seen := make(map[string]bool)
+	for _, region := range regions {
+		if region == "" {
+			region = r.sessionRegion(c.Target)
+		}
+		p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region)
+		if !ok {
+			continue
+		}
+		if !seen[p.ID()] {
+			seen[p.ID()] = true
+			partitions = append(partitions, p.ID())
+		}
+	}
+
+	loaded := c
+	for i, p := range partitions {
+		if p == configuration.DefaultPartition && i == 0 {
+			continue
+		}
+		located := configuration.AccountAliases{Partition: p}
+		if aliases != nil {
+			located = *aliases
+			located.Partition = p
+		}
+		other, err := loadConfigurationFile(logger, yamlFile, &located)
+		if err != nil {
+			return c, err
+		}
+		if i == 0 {
+			loaded = other
+		} else if string(other.RepositoryPolicy) != string(loaded.RepositoryPolicy) {
+			return c, fmt.Errorf("Loading %s: the ARNs of the policy differ between the partitions %s and %s of its regions, split it in a file per partition or set the partition of the accounts file", yamlFile, partitions[0], p)
+		}
+	}
+	return loaded, nil
+}
+
+// sessionRegion returns the region of the session of the given target, from its profile or the environment
+// It returns an empty region if the session has none or cannot be created
+func (r *repositories) sessionRegion(target string) string {
+	if region, ok := r.sessionRegions[target]; ok {
+		return region
+	}
+	region := ""
+	s, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Profile:           r.targets[target].Profile,
+	})
+	if err == nil {
+		region = aws.StringValue(s.Config.Region)
+	}
+	r.sessionRegions[target] = region
+	return region
+}
+
+// jobs returns a job per location with a client of the given factory, sorted by location
+func (r *repositories) jobs(clients *clientFactory) []ecrupdater.Job {
+	locations := []location{}
+	for l := range r.configs {
+		locations = append(locations, l)
+	}
+	sortLocations(locations)
+
+	jobs := []ecrupdater.Job{}
+	for _, l := range locations {
+		var account *configuration.Account
+		if a, ok := r.accounts[l.account]; ok {
+			account = &a
+		}
+		jobs = append(jobs, ecrupdater.Job{Client: clients.client(l, account), Configs: r.configs[l]})
+	}
+	return jobs
+}
+
+// configuredRepository is a configured repository in one of its locations
+type configuredRepository struct {
+	record summary.Record // Repository. Only its identifying fields are set
+	config configuration.ConfigurationFile
+}
+
+// list returns the configured repositories of all the locations, sorted by location
+func (r *repositories) list() []configuredRepository {
+	locations := []location{}
+	for l := range r.configs {
+		locations = append(locations, l)
+	}
+	sortLocations(locations)
+
+	list := []configuredRepository{}
+	for _, l := range locations {
+		for _, c := range r.configs[l] {
+			record := summary.Record{Repository: c.RepositoryName, Registry: c.Registry(), Region: l.region, Public: l.public}
+			list = append(list, configuredRepository{record: record, config: c})
+		}
+	}
+	return list
+}
+
+// count returns the number of repositories in all the locations
+func (r *repositories) count() int {
+	n := 0
+	for _, c := range r.configs {
+		n += len(c)
+	}
+	return n
+}
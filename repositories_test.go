@@ -0,0 +1,196 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/lescactus/ecr-go/appconfig"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestLoadRepositoriesFilter(t *testing.T) {
+	tests := []struct {
+		desc    string
+		flags   map[string]string
+		want    []string
+		wantErr string
+	}{
+		{
+			desc: "No filter",
+			want: []string{"payments/api", "payments/api-dev", "search"},
+		},
+		{
+			desc:  "Only and exclude",
+			flags: map[string]string{"only": "payments/*", "exclude": "*/*-dev"},
+			want:  []string{"payments/api"},
+		},
+		{
+			desc:  "Files",
+			flags: map[string]string{"files": "testdata/repositories/search/"},
+			want:  []string{"search"},
+		},
+		{
+			desc:  "Selector",
+			flags: map[string]string{"selector": "team=payments,env!=dev"},
+			want:  []string{"payments/api"},
+		},
+		{
+			desc:  "Merge mode",
+			flags: map[string]string{"managed-sid-prefix": "ecrgo-"},
+			want:  []string{"payments/api", "payments/api-dev", "search"},
+		},
+		{
+			desc:  "Nothing selected",
+			flags: map[string]string{"selector": "team=ops"},
+			want:  []string{},
+		},
+		{
+			desc:    "Invalid selector",
+			flags:   map[string]string{"selector": "team=pay ments"},
+			wantErr: `invalid label requirement "team=pay ments" in selector "team=pay ments"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			flags := map[string]string{"config-dir": "testdata/repositories/"}
+			for k, v := range test.flags {
+				flags[k] = v
+			}
+			if !assert.NoError(t, appconfig.Init(appconfig.Sources{Flags: flags})) {
+				return
+			}
+			defer appconfig.Init(appconfig.Sources{})
+
+			r, err := loadRepositories(zap.NewNop())
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			names := []string{}
+			for _, configs := range r.configs {
+				for _, c := range configs {
+					names = append(names, c.RepositoryName)
+				}
+			}
+			sort.Strings(names)
+			assert.Equal(t, test.want, names)
+		})
+	}
+}
+
+func TestLoadRepositoriesDuplicates(t *testing.T) {
+	wantErr := "Duplicate RepositoryName app in registry default of account default, region default found in testdata/duplicates/team-b/app.yaml"
+
+	tests := []struct {
+		desc  string
+		flags map[string]string
+	}{
+		{
+			desc: "No filter",
+		},
+		{
+			desc:  "Duplicate left out by files",
+			flags: map[string]string{"files": "testdata/duplicates/team-a/"},
+		},
+		{
+			desc:  "Duplicate left out by the selector",
+			flags: map[string]string{"selector": "team=a"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			flags := map[string]string{"config-dir": "testdata/duplicates/"}
+			for k, v := range test.flags {
+				flags[k] = v
+			}
+			if !assert.NoError(t, appconfig.Init(appconfig.Sources{Flags: flags})) {
+				return
+			}
+			defer appconfig.Init(appconfig.Sources{})
+
+			_, err := loadRepositories(zap.NewNop())
+			assert.EqualError(t, err, wantErr)
+		})
+	}
+}
+
+func TestLoadRepositoriesPartition(t *testing.T) {
+	tests := []struct {
+		desc      string
+		flags     map[string]string
+		awsRegion string
+		want      string
+		wantErr   string
+	}{
+		{
+			desc:  "Default regions",
+			flags: map[string]string{"config-dir": "testdata/partitions/china/", "regions": "cn-north-1"},
+			want:  "arn:aws-cn:iam::111111111111:root",
+		},
+		{
+			desc:      "Region of the session",
+			flags:     map[string]string{"config-dir": "testdata/partitions/china/"},
+			awsRegion: "cn-northwest-1",
+			want:      "arn:aws-cn:iam::111111111111:root",
+		},
+		{
+			desc:  "Regions of the file",
+			flags: map[string]string{"config-dir": "testdata/partitions/regional/", "regions": "eu-west-1"},
+			want:  "arn:aws-cn:iam::111111111111:root",
+		},
+		{
+			desc:  "Partition of the accounts file",
+			flags: map[string]string{"config-dir": "testdata/partitions/china/", "regions": "eu-west-1", "accounts-file": "testdata/partitions/accounts-cn.yaml"},
+			want:  "arn:aws-cn:iam::111111111111:root",
+		},
+		{
+			desc:  "Default partition",
+			flags: map[string]string{"config-dir": "testdata/partitions/china/", "regions": "eu-west-1"},
+			want:  "arn:aws:iam::111111111111:root",
+		},
+		{
+			desc:  "Same policy in several partitions",
+			flags: map[string]string{"config-dir": "testdata/partitions/plain/"},
+		},
+		{
+			desc:    "Policy differing between partitions",
+			flags:   map[string]string{"config-dir": "testdata/partitions/mixed/"},
+			wantErr: "Loading testdata/partitions/mixed/app.yaml: the ARNs of the policy differ between the partitions aws and aws-cn of its regions, split it in a file per partition or set the partition of the accounts file",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			flags := map[string]string{"accounts-file": "testdata/partitions/accounts.yaml"}
+			for k, v := range test.flags {
+				flags[k] = v
+			}
+			if !assert.NoError(t, appconfig.Init(appconfig.Sources{Flags: flags})) {
+				return
+			}
+			defer appconfig.Init(appconfig.Sources{})
+			defer os.Setenv("AWS_REGION", os.Getenv("AWS_REGION"))
+			os.Setenv("AWS_REGION", test.awsRegion)
+
+			r, err := loadRepositories(zap.NewNop())
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			if !assert.NoError(t, err) || test.want == "" {
+				return
+			}
+			for _, configs := range r.configs {
+				for _, c := range configs {
+					assert.Contains(t, string(c.RepositoryPolicy), test.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/lescactus/ecr-go/policy"
+	"go.uber.org/zap"
+)
+
+// simulateSettings are the flags of the simulate command
+type simulateSettings struct {
+	principal  string
+	action     string
+	repository string
+	context    contextFlag
+}
+
+// simulateOptions are the flags of the simulate command of the current run
+var simulateOptions simulateSettings
+
+// simulateFlags will register the flags of the simulate command
+func simulateFlags(fs *flag.FlagSet) {
+	simulateOptions = simulateSettings{context: contextFlag{}}
+	fs.StringVar(&simulateOptions.principal, "principal", "", "Caller: ARN of a role, a user or a session, account ID, or service like lambda.amazonaws.com")
+	fs.StringVar(&simulateOptions.action, "action", "", "Action called: pull, push, or an action like ecr:PutImage")
+	fs.StringVar(&simulateOptions.repository, "repository", "", "Glob of the names of the repositories to evaluate the request against")
+	fs.Var(simulateOptions.context, "context", "Value of a condition key of the request, as key=value, like aws:PrincipalOrgID=o-a1b2c3d4e5. Can be repeated, for a key with several values too")
+}
+
+// contextFlag is a repeatable flag of key=value condition keys, each key having one or more values
+type contextFlag map[string][]string
+
+// String returns the keys and their values sorted by key
+func (c contextFlag) String() string {
+	l := []string{}
+	for k, values := range c {
+		for _, v := range values {
+			l = append(l, k+"="+v)
+		}
+	}
+	sort.Strings(l)
+	return strings.Join(l, ",")
+}
+
+// Set will add a value to a key
+func (c contextFlag) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("context must be key=value, got %q", s)
+	}
+	c[kv[0]] = append(c[kv[0]], kv[1])
+	return nil
+}
+
+// simulateCommand will evaluate a request against the configured policy of each repository selected, without calling AWS
+// It prints the decision for each repository: allow, explicit-deny or implicit-deny, with the statements leading to it
+func simulateCommand(logger *zap.Logger, out io.Writer, args []string) int {
+	if simulateOptions.principal == "" || simulateOptions.action == "" || simulateOptions.repository == "" {
+		logger.Error("Error: --principal, --action and --repository are required")
+		return exitUsage
+	}
+	if _, err := path.Match(simulateOptions.repository, ""); err != nil {
+		logger.Error(fmt.Sprintf("Error: invalid repository glob %q: %v", simulateOptions.repository, err))
+		return exitUsage
+	}
+
+	repositories, err := loadRepositories(logger)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error: %v", err))
+		return exitFailed
+	}
+
+	code := exitOK
+	found := false
+	for _, r := range repositories.list() {
+		if ok, _ := path.Match(simulateOptions.repository, r.record.Repository); !ok {
+			continue
+		}
+		found = true
+		e, err := r.evaluate(simulateOptions.principal, simulateOptions.action, simulateOptions.context)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error: %s: %v", r.record.Target(), err))
+			code = exitFailed
+			continue
+		}
+		fmt.Fprintf(out, "  %-13s %s%s\n", e.Decision, r.record.Target(), statementsSuffix(e))
+	}
+	if !found {
+		logger.Error(fmt.Sprintf("Error: no configured repository matches %q", simulateOptions.repository))
+		return exitFailed
+	}
+	return code
+}
+
+// evaluate returns the decision of the configured policy of the repository for the request of the principal
+// The action is pull, push, or an action like ecr:PutImage
+func (r configuredRepository) evaluate(principal, action string, context map[string][]string) (policy.Evaluation, error) {
+	doc, err := policy.Parse(string(r.config.RepositoryPolicy))
+	if err != nil {
+		return policy.Evaluation{}, err
+	}
+	request := policy.Request{Principal: principal, Context: context}
+	return doc.EvaluateActions(request, policy.ExpandAction(action, r.record.Public))
+}
+
+// statementsSuffix returns the statements leading to the decision, after a colon, or nothing if there is none
+func statementsSuffix(e policy.Evaluation) string {
+	if len(e.Statements) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(e.Statements, ", ")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writePolicyConfigs will write a configuration file for each repository, all with the given policy
+func writePolicyConfigs(t *testing.T, dir, policy string, repositories ...string) {
+	policyFile := filepath.Join(dir, "policy.json")
+	assert.NoError(t, ioutil.WriteFile(policyFile, []byte(policy), 0644))
+	for _, name := range repositories {
+		config := "repositoryName: " + name + "\nrepositoryPolicyFile: " + policyFile + "\nregions:\n- eu-west-1\n"
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".yaml"), []byte(config), 0644))
+	}
+}
+
+// simulatedPolicy grants pull to the prod account and to the organization, push to a CI role, and everything to two accounts
+// until their break-glass grant expires
+const simulatedPolicy = `{"Version":"2008-10-17","Statement":[
+	{"Sid":"ProdPull","Effect":"Allow","Principal":{"AWS":"111111111111"},"Action":["ecr:BatchCheckLayerAvailability","ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"]},
+	{"Sid":"OrgPull","Effect":"Allow","Principal":"*","Action":["ecr:BatchCheckLayerAvailability","ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"],"Condition":{"StringEquals":{"aws:PrincipalOrgID":"o-a1b2c3d4e5"}}},
+	{"Sid":"CiPush","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::222222222222:role/ci"},"Action":"ecr:*"},
+	{"Sid":"DenyDelete","Effect":"Deny","Principal":"*","Action":"ecr:DeleteRepository"},
+	{"Sid":"BreakGlass20261019T143000Z","Effect":"Allow","Principal":{"AWS":"777777777777"},"Action":"ecr:*","Condition":{"DateLessThan":{"aws:CurrentTime":"2026-10-19T14:30:00Z"}}},
+	{"Sid":"BreakGlass20200101T000000Z","Effect":"Allow","Principal":{"AWS":"888888888888"},"Action":"ecr:*","Condition":{"DateLessThan":{"aws:CurrentTime":"2020-01-01T00:00:00Z"}}}
+]}`
+
+func TestSimulateCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simulate")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	writePolicyConfigs(t, dir, simulatedPolicy, "app", "tools")
+
+	tests := []struct {
+		desc string
+		args []string
+		code int
+		want string
+	}{
+		{
+			desc: "Pull",
+			args: []string{"--principal", "arn:aws:iam::111111111111:role/deploy", "--action", "pull", "--repository", "*"},
+			want: "  allow         app (eu-west-1): ProdPull\n  allow         tools (eu-west-1): ProdPull\n",
+		},
+		{
+			desc: "Push",
+			args: []string{"--principal", "111111111111", "--action", "push", "--repository", "app"},
+			want: "  implicit-deny app (eu-west-1)\n",
+		},
+		{
+			desc: "Context",
+			args: []string{"--principal", "333333333333", "--action", "pull", "--repository", "app", "--context", "aws:PrincipalOrgID=o-a1b2c3d4e5"},
+			want: "  allow         app (eu-west-1): OrgPull\n",
+		},
+		{
+			desc: "Current time before the expiry",
+			args: []string{"--principal", "777777777777", "--action", "pull", "--repository", "app", "--context", "aws:CurrentTime=2026-10-19T14:00:00Z"},
+			want: "  allow         app (eu-west-1): BreakGlass20261019T143000Z\n",
+		},
+		{
+			desc: "Current time after the expiry",
+			args: []string{"--principal", "777777777777", "--action", "pull", "--repository", "app", "--context", "aws:CurrentTime=2026-10-19T14:30:00Z"},
+			want: "  implicit-deny app (eu-west-1)\n",
+		},
+		{
+			desc: "Expired grant",
+			args: []string{"--principal", "888888888888", "--action", "pull", "--repository", "app"},
+			want: "  implicit-deny app (eu-west-1)\n",
+		},
+		{
+			desc: "Deny",
+			args: []string{"--principal", "arn:aws:iam::222222222222:role/ci", "--action", "ecr:DeleteRepository", "--repository", "app"},
+			want: "  explicit-deny app (eu-west-1): DenyDelete\n",
+		},
+		{
+			desc: "No repository",
+			args: []string{"--principal", "111111111111", "--action", "pull", "--repository", "other"},
+			code: exitFailed,
+		},
+		{
+			desc: "Missing flag",
+			args: []string{"--principal", "111111111111", "--repository", "app"},
+			code: exitUsage,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"simulate", "--config-dir", dir}, test.args...), &stdout, &stderr)
+			assert.Equal(t, test.code, code)
+			assert.Equal(t, test.want, stdout.String())
+		})
+	}
+}
+
+func TestContextFlag(t *testing.T) {
+	c := contextFlag{}
+	assert.NoError(t, c.Set("aws:SourceVpc=vpc-2"))
+	assert.NoError(t, c.Set("aws:SourceVpc=vpc-1"))
+	assert.NoError(t, c.Set("aws:PrincipalOrgID=o-a1b2c3d4e5"))
+	assert.EqualError(t, c.Set("aws:PrincipalOrgID"), `context must be key=value, got "aws:PrincipalOrgID"`)
+	assert.Equal(t, contextFlag{"aws:SourceVpc": {"vpc-2", "vpc-1"}, "aws:PrincipalOrgID": {"o-a1b2c3d4e5"}}, c)
+	assert.Equal(t, "aws:PrincipalOrgID=o-a1b2c3d4e5,aws:SourceVpc=vpc-1,aws:SourceVpc=vpc-2", c.String())
+}
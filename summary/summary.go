@@ -1,59 +1,315 @@
 package summary
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// Status is the outcome of an operation on a repository
+type Status string
+
+const (
+	StatusSucceeded Status = "succeeded" // The operation was applied
+	StatusFailed    Status = "failed"    // The operation was attempted and failed
+	StatusUnchanged Status = "unchanged" // The operation was not needed, the repository was already up to date
+	StatusSkipped   Status = "skipped"   // The operation was deliberately not attempted
+	StatusCancelled Status = "cancelled" // The operation was interrupted or never scheduled because the run was interrupted
+)
+
+// Statuses lists all the statuses, in reporting order
+var Statuses = []Status{StatusSucceeded, StatusUnchanged, StatusSkipped, StatusFailed, StatusCancelled}
+
+// statusLabels are the adjectives used for the statuses in the text summary
+var statusLabels = map[Status]string{
+	StatusSucceeded: "successful",
+	StatusFailed:    "failed",
+	StatusUnchanged: "unchanged",
+	StatusSkipped:   "skipped",
+	StatusCancelled: "cancelled",
+}
+
+// Operation is the kind of change applied to a repository
+type Operation string
+
+const (
+	OperationUpdate   Operation = "update"   // Policy update from the configuration
+	OperationRestore  Operation = "restore"  // Policy restoration from a backup
+	OperationRollback Operation = "rollback" // Policy rollback of a failed transaction
+	OperationGrant    Operation = "grant"    // Break-glass statement added to the live policy
+	OperationRevoke   Operation = "revoke"   // Expired break-glass statements removed from the live policy
 )
 
-type RepositoryFailedUpdate struct {
-	ErrorRepositoryName map[string]error // Hashmap to store the repositories names that failed to be updated and their error for the summary
-	sync.RWMutex                         // Mutex to protect the hashmap from concurrent accesses
+// operationOrder is the order of the operations in the sorted records
+var operationOrder = map[Operation]int{
+	OperationUpdate:   0,
+	OperationRestore:  1,
+	OperationRollback: 2,
+	OperationGrant:    3,
+	OperationRevoke:   4,
 }
 
-type RepositorySuccededUpdate struct {
-	RepositoryNames []string // Slice to store the repositories names that were successfully updated for the summary
+// Record is the result of an operation on a single repository
+type Record struct {
+	Repository   string        `json:"repository"`
+	Registry     string        `json:"registry,omitempty"`
+	TargetName   string        `json:"target,omitempty"`
+	Region       string        `json:"region,omitempty"`
+	Account      string        `json:"account,omitempty"`
+	Public       bool          `json:"public,omitempty"`
+	Operation    Operation     `json:"operation"`
+	Status       Status        `json:"status"`
+	Duration     time.Duration `json:"duration"`
+	Attempts     int           `json:"attempts"`
+	ErrorCode    string        `json:"errorCode,omitempty"`
+	ErrorMessage string        `json:"errorMessage,omitempty"`
+	Terminal     bool          `json:"terminal,omitempty"` // The error is final: the operation would not succeed on retry
+}
+
+// SetError will fill the ErrorCode and ErrorMessage of the record from the given error
+// The code is only set for awserr.Error errors
+func (r *Record) SetError(err error) {
+	if err == nil {
+		r.ErrorCode = ""
+		r.ErrorMessage = ""
+		return
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		r.ErrorCode = awsErr.Code()
+		r.ErrorMessage = awsErr.Message()
+		return
+	}
+	r.ErrorCode = ""
+	r.ErrorMessage = err.Error()
 }
 
-// NewRepositoryFailedUpdate instanciate a RepositoryFailedUpdate struct
-// It returns a RepositoryFailedUpdate with an initialized errorRepositoryName map
-func NewRepositoryFailedUpdate() RepositoryFailedUpdate {
-	return RepositoryFailedUpdate{
-		ErrorRepositoryName: make(map[string]error),
+// Error returns the error of the record in the "Code: Message" format, or an empty string
+func (r Record) Error() string {
+	if r.ErrorCode == "" {
+		return r.ErrorMessage
 	}
+	return fmt.Sprintf("%s: %s", r.ErrorCode, r.ErrorMessage)
 }
 
-// NewRepositorySuccededUpdate instanciate a RepositorySuccededUpdate
-// It returns a RepositorySuccededUpdate
-func NewRepositorySuccededUpdate() RepositorySuccededUpdate {
-	return RepositorySuccededUpdate{}
+// Target returns a human readable identifier of the repository the record is about
+func (r Record) Target() string {
+	t := r.Repository
+	if r.Registry != "" {
+		t = fmt.Sprintf("%s/%s", r.Registry, t)
+	}
+	if r.Public {
+		t = fmt.Sprintf("public:%s", t)
+	}
+	if r.Region != "" {
+		t = fmt.Sprintf("%s (%s)", t, r.Region)
+	}
+	if r.Account != "" {
+		t = fmt.Sprintf("%s:%s", r.Account, t)
+	}
+	if r.TargetName != "" {
+		t = fmt.Sprintf("[%s] %s", r.TargetName, t)
+	}
+	return t
 }
 
-// Add will add the faulted repository name and its associated error in the hashmap
-func (r *RepositoryFailedUpdate) Add(repo string, e error) {
-	r.Lock()
-	defer r.Unlock()
+// Collector gathers the records of a run
+// It is safe for concurrent use
+type Collector struct {
+	mu      sync.RWMutex
+	records []Record
+}
 
-	r.ErrorRepositoryName[repo] = e
+// NewCollector instanciate an empty Collector
+func NewCollector() *Collector {
+	return &Collector{}
 }
 
-// GetAll will return the errorRepositoryName
-// It returns a map[string]error containing the faulted repositories names and their associated errors
-func (r *RepositoryFailedUpdate) GetAll() map[string]error {
-	r.RLock()
-	defer r.RUnlock()
+// Add will add the record to the collector
+func (c *Collector) Add(r Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	return r.ErrorRepositoryName
+	c.records = append(c.records, r)
 }
 
-// Get will retrieve the error of the given repository name
-// It returns the error associated to the repository name
-func (r *RepositoryFailedUpdate) Get(repository string) error {
-	r.RLock()
-	defer r.RUnlock()
+// Records returns a copy of all the records, sorted by target, account, region, type, registry, repository and operation
+// Records of the given operations only are returned if any is given
+func (c *Collector) Records(operations ...Operation) []Record {
+	c.mu.RLock()
+	records := make([]Record, 0, len(c.records))
+	for _, r := range c.records {
+		if len(operations) == 0 || containsOperation(operations, r.Operation) {
+			records = append(records, r)
+		}
+	}
+	c.mu.RUnlock()
+
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.TargetName != b.TargetName {
+			return a.TargetName < b.TargetName
+		}
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		if a.Public != b.Public {
+			return !a.Public
+		}
+		if a.Registry != b.Registry {
+			return a.Registry < b.Registry
+		}
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		return operationOrder[a.Operation] < operationOrder[b.Operation]
+	})
+
+	return records
+}
 
-	return r.ErrorRepositoryName[repository]
+// WithStatus returns the sorted records of the given operation having the given status
+func (c *Collector) WithStatus(operation Operation, status Status) []Record {
+	records := []Record{}
+	for _, r := range c.Records(operation) {
+		if r.Status == status {
+			records = append(records, r)
+		}
+	}
+	return records
 }
 
-// Add will add the succeded repository in the slice
-func (r *RepositorySuccededUpdate) Add(repository string) {
-	r.RepositoryNames = append(r.RepositoryNames, repository)
+// Get returns the last record of the given operation on the given repository
+// It returns false if there is none
+func (c *Collector) Get(operation Operation, repository string) (Record, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for i := len(c.records) - 1; i >= 0; i-- {
+		if c.records[i].Operation == operation && c.records[i].Repository == repository {
+			return c.records[i], true
+		}
+	}
+	return Record{}, false
+}
+
+// Count returns the number of records of the given operation by status
+func (c *Collector) Count(operation Operation) map[Status]int {
+	return c.Aggregate(func(Record) string { return "" }, operation)[""]
+}
+
+// Aggregate returns the number of records by key and status, the key of a record being computed by key
+// Only the records of the given operations are aggregated if any is given
+func (c *Collector) Aggregate(key func(Record) string, operations ...Operation) map[string]map[Status]int {
+	a := make(map[string]map[Status]int)
+	for _, r := range c.Records(operations...) {
+		k := key(r)
+		if a[k] == nil {
+			a[k] = make(map[Status]int)
+		}
+		a[k][r.Status]++
+	}
+	return a
+}
+
+// Failed returns true if any record failed or was cancelled
+func (c *Collector) Failed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, r := range c.records {
+		if r.Status == StatusFailed || r.Status == StatusCancelled {
+			return true
+		}
+	}
+	return false
+}
+
+// ExitCode returns the exit code of the run: 1 if any record failed or was cancelled, 0 otherwise
+func (c *Collector) ExitCode() int {
+	if c.Failed() {
+		return 1
+	}
+	return 0
+}
+
+// Text returns the human readable summary of the given operation, one line per entry
+// title is used to name the operation in the summary, e.g. "update"
+func (c *Collector) Text(operation Operation, title string) []string {
+	lines := []string{}
+	for _, status := range Statuses {
+		records := c.WithStatus(operation, status)
+		// Unchanged and skipped repositories are only reported when there are some
+		if len(records) == 0 && status != StatusSucceeded && status != StatusFailed && status != StatusCancelled {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("\tNumber of %s repositories %ss: %v", statusLabels[status], title, len(records)))
+		for _, r := range records {
+			line := fmt.Sprintf("\t\t- %v (attempts: %d, duration: %v)", r.Target(), r.Attempts, r.Duration.Round(time.Millisecond))
+			if r.Terminal {
+				line = fmt.Sprintf("%s (terminal)", line)
+			}
+			if r.Error() != "" {
+				line = fmt.Sprintf("%s: %s", line, r.Error())
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// TextByAccount returns the human readable number of records of the given operation by account and status, one line per account
+// It returns no line if all the records are of the default account
+func (c *Collector) TextByAccount(operation Operation) []string {
+	counts := c.Aggregate(func(r Record) string { return r.Account }, operation)
+	if len(counts) == 0 || len(counts) == 1 && counts[""] != nil {
+		return []string{}
+	}
+
+	accounts := make([]string, 0, len(counts))
+	for a := range counts {
+		accounts = append(accounts, a)
+	}
+	sort.Strings(accounts)
+
+	lines := []string{}
+	for _, a := range accounts {
+		parts := []string{}
+		for _, status := range Statuses {
+			if n := counts[a][status]; n > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", n, statusLabels[status]))
+			}
+		}
+		name := a
+		if name == "" {
+			name = "default"
+		}
+		lines = append(lines, fmt.Sprintf("\tAccount %s: %s", name, strings.Join(parts, ", ")))
+	}
+	return lines
+}
+
+// WriteJSON will write all the sorted records to w as a JSON array
+func (c *Collector) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(c.Records())
+}
+
+func containsOperation(operations []Operation, o Operation) bool {
+	for _, op := range operations {
+		if op == o {
+			return true
+		}
+	}
+	return false
 }
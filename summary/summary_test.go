@@ -1,149 +1,210 @@
 package summary
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestNewRepositoryFailedUpdate(t *testing.T) {
-	var r1 RepositoryFailedUpdate
-	var r2 RepositoryFailedUpdate
+func TestNewCollector(t *testing.T) {
+	c := NewCollector()
 
-	r1 = NewRepositoryFailedUpdate()
-
-	m := make(map[string]error)
-	r2.ErrorRepositoryName = m
-
-	assert.Equal(t, r1, r2)
-}
-
-func TestNewRepositorySuccededUpdate(t *testing.T) {
-	var r1 RepositorySuccededUpdate
-	var r2 RepositorySuccededUpdate
-
-	r1 = NewRepositorySuccededUpdate()
-
-	assert.Equal(t, r1, r2)
+	assert.Empty(t, c.Records())
+	assert.False(t, c.Failed())
+	assert.Equal(t, 0, c.ExitCode())
 }
 
-func TestRFAdd(t *testing.T) {
+func TestSetError(t *testing.T) {
 	tests := []struct {
-		desc string
-		want RepositoryFailedUpdate
+		desc        string
+		err         error
+		wantCode    string
+		wantMessage string
+		wantError   string
 	}{
 		{
-			desc: "Add entries to ErrorRepositoryName hashmap",
-			want: RepositoryFailedUpdate{
-				ErrorRepositoryName: map[string]error{
-					"repoName1": errors.New("repoName1"),
-					"repoName2": errors.New("repoName2"),
-					"repoName3": errors.New("repoName3"),
-				},
-			},
+			desc:        "AWS error",
+			err:         awserr.New("RepositoryNotFoundException", "The repository does not exist", nil),
+			wantCode:    "RepositoryNotFoundException",
+			wantMessage: "The repository does not exist",
+			wantError:   "RepositoryNotFoundException: The repository does not exist",
+		},
+		{
+			desc:        "Generic error",
+			err:         errors.New("Generic error"),
+			wantMessage: "Generic error",
+			wantError:   "Generic error",
+		},
+		{
+			desc: "No error",
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.desc, func(t *testing.T) {
-			r := NewRepositoryFailedUpdate()
-			r.Add("repoName1", errors.New("repoName1"))
-			r.Add("repoName2", errors.New("repoName2"))
-			r.Add("repoName3", errors.New("repoName3"))
-			assert.Equal(t, test.want, r)
+			r := Record{ErrorCode: "previous", ErrorMessage: "previous"}
+			r.SetError(test.err)
+
+			assert.Equal(t, test.wantCode, r.ErrorCode)
+			assert.Equal(t, test.wantMessage, r.ErrorMessage)
+			assert.Equal(t, test.wantError, r.Error())
 		})
 	}
 }
 
-func TestGetAll(t *testing.T) {
-	tests := []struct {
-		desc string
-		want map[string]error
-	}{
-		{
-			desc: "Read entries from errorRepositoryName hashmap",
-			want: map[string]error{
-				"repoName1": errors.New("repoName1"),
-				"repoName2": errors.New("repoName2"),
-				"repoName3": errors.New("repoName3"),
-			},
-		},
-	}
+func TestTarget(t *testing.T) {
+	assert.Equal(t, "repo", Record{Repository: "repo"}.Target())
+	assert.Equal(t, "repo (eu-west-1)", Record{Repository: "repo", Region: "eu-west-1"}.Target())
+	assert.Equal(t, "111111111111:repo (eu-west-1)", Record{Repository: "repo", Region: "eu-west-1", Account: "111111111111"}.Target())
+	assert.Equal(t, "111111111111:222222222222/repo (eu-west-1)", Record{Repository: "repo", Registry: "222222222222", Region: "eu-west-1", Account: "111111111111"}.Target())
+	assert.Equal(t, "[local] repo (us-east-1)", Record{Repository: "repo", Region: "us-east-1", TargetName: "local"}.Target())
+	assert.Equal(t, "public:repo (us-east-1)", Record{Repository: "repo", Region: "us-east-1", Public: true}.Target())
+}
 
-	for _, test := range tests {
-		t.Run(test.desc, func(t *testing.T) {
-			r := NewRepositoryFailedUpdate()
-			r.Add("repoName1", errors.New("repoName1"))
-			r.Add("repoName2", errors.New("repoName2"))
-			r.Add("repoName3", errors.New("repoName3"))
-			m := r.GetAll()
-			assert.Equal(t, test.want, m)
-		})
+func TestRecords(t *testing.T) {
+	c := NewCollector()
+	c.Add(Record{Repository: "repoName2", Operation: OperationRollback, Status: StatusSucceeded})
+	c.Add(Record{Repository: "repoName2", Operation: OperationUpdate, Status: StatusSucceeded})
+	c.Add(Record{Repository: "repoName1", Region: "us-east-1", Operation: OperationUpdate, Status: StatusFailed})
+	c.Add(Record{Repository: "repoName1", Region: "eu-west-1", Operation: OperationUpdate, Status: StatusSucceeded})
+	c.Add(Record{Repository: "repoName3", Operation: OperationUpdate, Status: StatusCancelled})
+
+	// Sorted by account, region, repository and operation
+	want := []Record{
+		{Repository: "repoName2", Operation: OperationUpdate, Status: StatusSucceeded},
+		{Repository: "repoName2", Operation: OperationRollback, Status: StatusSucceeded},
+		{Repository: "repoName3", Operation: OperationUpdate, Status: StatusCancelled},
+		{Repository: "repoName1", Region: "eu-west-1", Operation: OperationUpdate, Status: StatusSucceeded},
+		{Repository: "repoName1", Region: "us-east-1", Operation: OperationUpdate, Status: StatusFailed},
 	}
+	assert.Equal(t, want, c.Records())
+	assert.Equal(t, []Record{want[1]}, c.Records(OperationRollback))
+	assert.Equal(t, []Record{want[0], want[3]}, c.WithStatus(OperationUpdate, StatusSucceeded))
+	assert.Empty(t, c.WithStatus(OperationRestore, StatusSucceeded))
+
+	r, ok := c.Get(OperationUpdate, "repoName3")
+	assert.True(t, ok)
+	assert.Equal(t, want[2], r)
+	_, ok = c.Get(OperationRestore, "repoName3")
+	assert.False(t, ok)
+
+	assert.Equal(t, map[Status]int{StatusSucceeded: 2, StatusFailed: 1, StatusCancelled: 1}, c.Count(OperationUpdate))
+	assert.Equal(t, map[string]map[Status]int{
+		"":          {StatusSucceeded: 1, StatusCancelled: 1},
+		"eu-west-1": {StatusSucceeded: 1},
+		"us-east-1": {StatusFailed: 1},
+	}, c.Aggregate(func(r Record) string { return r.Region }, OperationUpdate))
+
+	assert.True(t, c.Failed())
+	assert.Equal(t, 1, c.ExitCode())
 }
 
-func TestGet(t *testing.T) {
+func TestExitCode(t *testing.T) {
 	tests := []struct {
-		desc string
-		key  string
-		want error
+		desc     string
+		statuses []Status
+		want     int
 	}{
 		{
-			desc: "Read first entry from errorRepositoryName hashmap",
-			key:  "repoName1",
-			want: errors.New("errorName1"),
+			desc:     "All succeeded",
+			statuses: []Status{StatusSucceeded, StatusUnchanged, StatusSkipped},
+			want:     0,
 		},
 		{
-			desc: "Read second entry from errorRepositoryName hashmap",
-			key:  "repoName2",
-			want: errors.New("errorName2"),
+			desc:     "One failed",
+			statuses: []Status{StatusSucceeded, StatusFailed},
+			want:     1,
 		},
 		{
-			desc: "Read third entry from errorRepositoryName hashmap",
-			key:  "repoName3",
-			want: errors.New("errorName3"),
+			desc:     "One cancelled",
+			statuses: []Status{StatusSucceeded, StatusCancelled},
+			want:     1,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.desc, func(t *testing.T) {
-			r := NewRepositoryFailedUpdate()
-			r.Add("repoName1", errors.New("errorName1"))
-			r.Add("repoName2", errors.New("errorName2"))
-			r.Add("repoName3", errors.New("errorName3"))
-
-			e := r.Get(test.key)
-			assert.Error(t, test.want, e)
-			assert.EqualError(t, e, test.want.Error())
+			c := NewCollector()
+			for i, s := range test.statuses {
+				c.Add(Record{Repository: fmt.Sprintf("repoName%d", i), Operation: OperationUpdate, Status: s})
+			}
+			assert.Equal(t, test.want, c.ExitCode())
 		})
 	}
 }
 
-func TestRSAdd(t *testing.T) {
-	tests := []struct {
-		desc string
-		want RepositorySuccededUpdate
-	}{
-		{
-			desc: "Add entries to RepositoryNames slice",
-			want: RepositorySuccededUpdate{
-				RepositoryNames: []string{
-					"repoName1",
-					"repoName2",
-					"repoName3",
-				},
-			},
-		},
+func TestConcurrentAdd(t *testing.T) {
+	c := NewCollector()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Add(Record{Repository: fmt.Sprintf("repoName%03d", i), Operation: OperationUpdate, Status: StatusSucceeded})
+		}(i)
 	}
+	wg.Wait()
 
-	for _, test := range tests {
-		t.Run(test.desc, func(t *testing.T) {
-			r := NewRepositorySuccededUpdate()
-			r.Add("repoName1")
-			r.Add("repoName2")
-			r.Add("repoName3")
-			assert.Equal(t, test.want, r)
-		})
+	records := c.Records()
+	assert.Len(t, records, 100)
+	for i := range records {
+		assert.Equal(t, fmt.Sprintf("repoName%03d", i), records[i].Repository)
 	}
 }
+
+func TestText(t *testing.T) {
+	c := NewCollector()
+	c.Add(Record{Repository: "repoName1", Operation: OperationUpdate, Status: StatusSucceeded, Attempts: 1, Duration: 1500 * time.Microsecond})
+	c.Add(Record{Repository: "repoName2", Operation: OperationUpdate, Status: StatusFailed, Attempts: 3, ErrorCode: "ThrottlingException", ErrorMessage: "Rate exceeded"})
+	c.Add(Record{Repository: "repoName3", Operation: OperationRollback, Status: StatusSucceeded, Attempts: 1})
+	c.Add(Record{Repository: "repoName4", Operation: OperationUpdate, Status: StatusFailed, Attempts: 1, ErrorCode: "AccessDeniedException", ErrorMessage: "denied", Terminal: true})
+
+	assert.Equal(t, []string{
+		"\tNumber of successful repositories updates: 1",
+		"\t\t- repoName1 (attempts: 1, duration: 2ms)",
+		"\tNumber of failed repositories updates: 2",
+		"\t\t- repoName2 (attempts: 3, duration: 0s): ThrottlingException: Rate exceeded",
+		"\t\t- repoName4 (attempts: 1, duration: 0s) (terminal): AccessDeniedException: denied",
+		"\tNumber of cancelled repositories updates: 0",
+	}, c.Text(OperationUpdate, "update"))
+}
+
+func TestWriteJSON(t *testing.T) {
+	c := NewCollector()
+	c.Add(Record{Repository: "repoName2", Operation: OperationUpdate, Status: StatusFailed, Attempts: 1, ErrorCode: "AccessDeniedException", ErrorMessage: "denied"})
+	c.Add(Record{Repository: "repoName1", Operation: OperationUpdate, Status: StatusSucceeded, Attempts: 1})
+
+	var b bytes.Buffer
+	assert.NoError(t, c.WriteJSON(&b))
+
+	var records []Record
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &records))
+	assert.Equal(t, c.Records(), records)
+}
+
+func TestTextByAccount(t *testing.T) {
+	c := NewCollector()
+	assert.Empty(t, c.TextByAccount(OperationUpdate))
+
+	c.Add(Record{Repository: "repoName1", Operation: OperationUpdate, Status: StatusSucceeded})
+	assert.Empty(t, c.TextByAccount(OperationUpdate), "no breakdown without accounts")
+
+	c.Add(Record{Repository: "repoName1", Account: "222222222222", Operation: OperationUpdate, Status: StatusFailed})
+	c.Add(Record{Repository: "repoName2", Account: "222222222222", Operation: OperationUpdate, Status: StatusSucceeded})
+	c.Add(Record{Repository: "repoName1", Account: "111111111111", Operation: OperationUpdate, Status: StatusCancelled})
+	c.Add(Record{Repository: "repoName1", Account: "111111111111", Operation: OperationRollback, Status: StatusSucceeded})
+
+	assert.Equal(t, []string{
+		"\tAccount default: 1 successful",
+		"\tAccount 111111111111: 1 cancelled",
+		"\tAccount 222222222222: 1 successful, 1 failed",
+	}, c.TextByAccount(OperationUpdate))
+}